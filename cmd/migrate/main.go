@@ -3,9 +3,11 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
@@ -14,6 +16,8 @@ import (
 	"github.com/urfave/cli/v2"
 
 	"github.com/loloDawit/ecom/config"
+	"github.com/loloDawit/ecom/services/order"
+	"github.com/loloDawit/ecom/services/privacy"
 )
 
 func main() {
@@ -31,6 +35,19 @@ func main() {
 				Usage:  "Revert the last migration",
 				Action: runMigrationsDown,
 			},
+			{
+				Name:   "backfill-order-items",
+				Usage:  "Fill in unit price, subtotal and product snapshot of existing order items",
+				Action: runBackfillOrderItems,
+			},
+			{
+				Name:  "erase-user",
+				Usage: "Anonymize a user who asked to be forgotten, keeping their orders",
+				Flags: []cli.Flag{
+					&cli.IntFlag{Name: "user-id", Usage: "id of the user to erase", Required: true},
+				},
+				Action: runEraseUser,
+			},
 		},
 	}
 
@@ -48,7 +65,45 @@ func runMigrationsDown(c *cli.Context) error {
 	return runMigrations("down")
 }
 
-func runMigrations(direction string) error {
+func runBackfillOrderItems(c *cli.Context) error {
+	db, cfg, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	updated, err := order.NewOrderStore(db, cfg).BackfillOrderItemSnapshots()
+	if err != nil {
+		return fmt.Errorf("failed to backfill order items: %v", err)
+	}
+
+	fmt.Printf("Backfilled %d order items\n", updated)
+	return nil
+}
+
+func runEraseUser(c *cli.Context) error {
+	db, cfg, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	userID := c.Int("user-id")
+	err = privacy.NewErasureStore(db, cfg).EraseUser(userID, time.Now())
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("user %d does not exist", userID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to erase user %d: %v", userID, err)
+	}
+
+	fmt.Printf("Erased user %d\n", userID)
+	return nil
+}
+
+// openDatabase loads the configuration for the current environment and opens
+// a connection to its database.
+func openDatabase() (*sql.DB, *config.Config, error) {
 	ctx := context.Background()
 
 	// Set the directory, environment, and deployment
@@ -67,7 +122,16 @@ func runMigrations(direction string) error {
 
 	db, err := sql.Open("postgres", connStr)
 	if err != nil {
-		return fmt.Errorf("unable to connect to the database: %v", err)
+		return nil, nil, fmt.Errorf("unable to connect to the database: %v", err)
+	}
+
+	return db, cfg, nil
+}
+
+func runMigrations(direction string) error {
+	db, _, err := openDatabase()
+	if err != nil {
+		return err
 	}
 	defer db.Close()
 
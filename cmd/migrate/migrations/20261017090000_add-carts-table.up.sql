@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS carts (
+  id SERIAL NOT NULL,
+  userId INT NOT NULL UNIQUE,
+  createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updatedAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (id),
+  FOREIGN KEY (userId) REFERENCES users(id)
+);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS cart_items (
+  id SERIAL NOT NULL,
+  cartId INT NOT NULL,
+  productId INT NOT NULL,
+  quantity INT NOT NULL CHECK (quantity > 0),
+  createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (id),
+  UNIQUE (cartId, productId),
+  FOREIGN KEY (cartId) REFERENCES carts(id) ON DELETE CASCADE,
+  FOREIGN KEY (productId) REFERENCES products(id)
+);
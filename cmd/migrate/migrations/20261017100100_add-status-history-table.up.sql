@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS status_history (
+  id SERIAL NOT NULL,
+  orderId INT NOT NULL,
+  fromStatus VARCHAR(20) NOT NULL,
+  toStatus VARCHAR(20) NOT NULL,
+  actorId INT NOT NULL,
+  createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (id),
+  FOREIGN KEY (orderId) REFERENCES orders(id),
+  FOREIGN KEY (actorId) REFERENCES users(id)
+);
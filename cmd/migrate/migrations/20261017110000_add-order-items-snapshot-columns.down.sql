@@ -0,0 +1,5 @@
+ALTER TABLE order_items
+  DROP COLUMN IF EXISTS subtotal,
+  DROP COLUMN IF EXISTS productName,
+  DROP COLUMN IF EXISTS productImage,
+  DROP COLUMN IF EXISTS createdAt;
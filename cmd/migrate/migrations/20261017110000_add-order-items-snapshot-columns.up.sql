@@ -0,0 +1,5 @@
+ALTER TABLE order_items
+  ADD COLUMN IF NOT EXISTS subtotal DECIMAL(10, 2),
+  ADD COLUMN IF NOT EXISTS productName VARCHAR(255),
+  ADD COLUMN IF NOT EXISTS productImage VARCHAR(255),
+  ADD COLUMN IF NOT EXISTS createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP;
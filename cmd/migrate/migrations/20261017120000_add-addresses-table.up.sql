@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS addresses (
+  id SERIAL NOT NULL,
+  userId INT NOT NULL,
+  line1 VARCHAR(255) NOT NULL,
+  line2 VARCHAR(255) NOT NULL DEFAULT '',
+  city VARCHAR(100) NOT NULL,
+  region VARCHAR(100) NOT NULL DEFAULT '',
+  postalCode VARCHAR(20) NOT NULL,
+  country CHAR(2) NOT NULL,
+  isDefault BOOLEAN NOT NULL DEFAULT FALSE,
+  createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (id),
+  FOREIGN KEY (userId) REFERENCES users(id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS addresses_one_default_per_user ON addresses (userId) WHERE isDefault;
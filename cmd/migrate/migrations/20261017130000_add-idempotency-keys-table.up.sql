@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+  key VARCHAR(255) NOT NULL,
+  scope CHAR(64) NOT NULL,
+  fingerprint CHAR(64) NOT NULL,
+  statusCode INT,
+  contentType VARCHAR(255) NOT NULL DEFAULT '',
+  responseBody BYTEA,
+  createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  PRIMARY KEY (key, scope)
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_created_at ON idempotency_keys (createdAt);
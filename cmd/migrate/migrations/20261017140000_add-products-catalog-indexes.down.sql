@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS products_name_id;
+DROP INDEX IF EXISTS products_created_at_id;
+DROP INDEX IF EXISTS products_price_id;
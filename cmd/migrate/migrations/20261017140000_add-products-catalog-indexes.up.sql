@@ -0,0 +1,3 @@
+CREATE INDEX IF NOT EXISTS products_price_id ON products (price, id);
+CREATE INDEX IF NOT EXISTS products_created_at_id ON products (createdAt, id);
+CREATE INDEX IF NOT EXISTS products_name_id ON products (name, id);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS products_search_vector;
+
+ALTER TABLE products DROP COLUMN IF EXISTS searchVector;
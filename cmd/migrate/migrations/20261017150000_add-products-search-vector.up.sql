@@ -0,0 +1,7 @@
+ALTER TABLE products
+  ADD COLUMN IF NOT EXISTS searchVector TSVECTOR GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', coalesce(name, '')), 'A') ||
+    setweight(to_tsvector('english', coalesce(description, '')), 'B')
+  ) STORED;
+
+CREATE INDEX IF NOT EXISTS products_search_vector ON products USING GIN (searchVector);
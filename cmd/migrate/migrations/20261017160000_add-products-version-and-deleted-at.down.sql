@@ -0,0 +1,3 @@
+ALTER TABLE products
+  DROP COLUMN IF EXISTS deletedAt,
+  DROP COLUMN IF EXISTS version;
@@ -0,0 +1,3 @@
+ALTER TABLE products
+  ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1,
+  ADD COLUMN IF NOT EXISTS deletedAt TIMESTAMP;
@@ -0,0 +1,3 @@
+ALTER TABLE users
+  ADD COLUMN IF NOT EXISTS role VARCHAR(16) NOT NULL DEFAULT 'customer'
+  CONSTRAINT users_role_check CHECK (role IN ('customer', 'staff', 'admin'));
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+  id SERIAL PRIMARY KEY,
+  userId INT NOT NULL,
+  familyId CHAR(32) NOT NULL,
+  tokenHash CHAR(64) NOT NULL UNIQUE,
+  expiresAt TIMESTAMP NOT NULL,
+  rotatedAt TIMESTAMP,
+  revokedAt TIMESTAMP,
+  createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  FOREIGN KEY (userId) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS refresh_tokens_family_id ON refresh_tokens (familyId);
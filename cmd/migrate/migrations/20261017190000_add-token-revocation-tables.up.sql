@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+  jti CHAR(32) PRIMARY KEY,
+  userId INT NOT NULL,
+  expiresAt TIMESTAMP NOT NULL,
+  revokedAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  FOREIGN KEY (userId) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS revoked_tokens_expires_at ON revoked_tokens (expiresAt);
+
+CREATE TABLE IF NOT EXISTS user_token_revocations (
+  userId INT PRIMARY KEY,
+  revokedBefore TIMESTAMP NOT NULL,
+
+  FOREIGN KEY (userId) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS login_throttles (
+  throttleKey VARCHAR(320) PRIMARY KEY,
+  failures INT NOT NULL DEFAULT 0,
+  lastFailureAt TIMESTAMP NOT NULL,
+  lockedUntil TIMESTAMP
+);
@@ -0,0 +1,32 @@
+CREATE TABLE IF NOT EXISTS user_totp (
+  userId INT PRIMARY KEY,
+  secret VARCHAR(64) NOT NULL,
+  confirmedAt TIMESTAMP,
+  lastUsedStep BIGINT NOT NULL DEFAULT 0,
+  createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  FOREIGN KEY (userId) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+  id SERIAL PRIMARY KEY,
+  userId INT NOT NULL,
+  codeHash CHAR(64) NOT NULL UNIQUE,
+  usedAt TIMESTAMP,
+
+  FOREIGN KEY (userId) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS mfa_recovery_codes_user_id ON mfa_recovery_codes (userId);
+
+CREATE TABLE IF NOT EXISTS mfa_challenges (
+  id SERIAL PRIMARY KEY,
+  userId INT NOT NULL,
+  tokenHash CHAR(64) NOT NULL UNIQUE,
+  expiresAt TIMESTAMP NOT NULL,
+  usedAt TIMESTAMP,
+  failedAttempts INT NOT NULL DEFAULT 0,
+  createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+  FOREIGN KEY (userId) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS users_email_active;
+ALTER TABLE users ADD CONSTRAINT users_email_key UNIQUE (email);
+ALTER TABLE users DROP COLUMN IF EXISTS deletedAt;
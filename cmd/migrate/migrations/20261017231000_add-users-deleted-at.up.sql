@@ -0,0 +1,5 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deletedAt TIMESTAMP;
+
+-- a deleted account no longer holds on to its email
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_email_key;
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_active ON users (email) WHERE deletedAt IS NULL;
@@ -0,0 +1,6 @@
+DELETE FROM idempotency_keys;
+
+ALTER TABLE idempotency_keys DROP CONSTRAINT idempotency_keys_pkey;
+ALTER TABLE idempotency_keys DROP COLUMN userId;
+ALTER TABLE idempotency_keys ADD COLUMN scope CHAR(64) NOT NULL;
+ALTER TABLE idempotency_keys ADD PRIMARY KEY (key, scope);
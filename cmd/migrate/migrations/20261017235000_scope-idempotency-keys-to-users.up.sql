@@ -0,0 +1,8 @@
+-- keys were scoped to a hash of the Authorization header; stored responses
+-- are short-lived, so existing ones are simply dropped
+DELETE FROM idempotency_keys;
+
+ALTER TABLE idempotency_keys DROP CONSTRAINT idempotency_keys_pkey;
+ALTER TABLE idempotency_keys DROP COLUMN scope;
+ALTER TABLE idempotency_keys ADD COLUMN userId INT NOT NULL REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE idempotency_keys ADD PRIMARY KEY (key, userId);
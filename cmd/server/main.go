@@ -12,10 +12,24 @@ import (
 	"github.com/joho/godotenv"
 	"github.com/loloDawit/ecom/config"
 	"github.com/loloDawit/ecom/db"
+	"github.com/loloDawit/ecom/services/address"
+	"github.com/loloDawit/ecom/services/admin"
+	"github.com/loloDawit/ecom/services/apikey"
+	"github.com/loloDawit/ecom/services/auth"
 	"github.com/loloDawit/ecom/services/cart"
+	"github.com/loloDawit/ecom/services/idempotency"
+	"github.com/loloDawit/ecom/services/lockout"
+	"github.com/loloDawit/ecom/services/mfa"
+	"github.com/loloDawit/ecom/services/notify"
 	"github.com/loloDawit/ecom/services/order"
+	"github.com/loloDawit/ecom/services/password"
+	"github.com/loloDawit/ecom/services/privacy"
 	"github.com/loloDawit/ecom/services/product"
+	"github.com/loloDawit/ecom/services/revocation"
+	"github.com/loloDawit/ecom/services/session"
+	"github.com/loloDawit/ecom/services/transaction"
 	"github.com/loloDawit/ecom/services/user"
+	"github.com/loloDawit/ecom/services/verification"
 )
 
 type APIServer struct {
@@ -33,19 +47,87 @@ func (s *APIServer) Start() error {
 	router := mux.NewRouter()
 	subrouter := router.PathPrefix("/api/v1").Subrouter()
 
-	// initialize the user handler
-	userHandler := user.NewHandlers(user.NewUserStore(s.db, s.cfg), s.cfg)
+	// tokens are signed with the configured keys, or the shared secret
+	keys, err := auth.LoadKeySet(s.cfg.JWT)
+	if err != nil {
+		return err
+	}
+
+	// every protected route authenticates through the same authenticator,
+	// which takes API keys as well as access tokens and rejects tokens
+	// revoked by logging out; disabling a user revokes their sessions too
+	userStore := user.NewUserStore(s.db, s.cfg)
+	revocations := revocation.NewCachedStore(revocation.NewRevocationStore(s.db, s.cfg), revocation.DefaultCacheSize)
+	tokenAuthenticator := auth.NewKeySetAuthenticator(keys).WithRevocationStore(revocations)
+	apiKeys := apikey.NewService(apikey.NewAPIKeyStore(s.db, s.cfg), userStore)
+	authenticator := apikey.NewAuthenticator(apiKeys, tokenAuthenticator)
+
+	// email goes to the log, a directory, memory or an SMTP server depending
+	// on config; only local environments may skip delivering it
+	mailer, err := notify.NewMailer(s.cfg.Mail, s.cfg.Environment)
+	if err != nil {
+		return err
+	}
+	notifier := notify.NewNotifier(mailer, s.cfg)
+
+	// initialize the user, session, two-factor and email verification handlers
+	sessions := session.NewService(session.NewRefreshTokenStore(s.db, s.cfg), revocations, userStore, keys, s.cfg)
+	verifier := verification.NewService(verification.NewEmailVerificationStore(s.db, s.cfg), notifier, s.cfg)
+	limiter := lockout.NewLimiter(lockout.NewLoginThrottleStore(s.db, s.cfg))
+	mfaService := mfa.NewService(mfa.NewMFAStore(s.db, s.cfg), s.cfg)
+	userHandler := user.NewHandlers(userStore, sessions, sessions, verifier, limiter, mfaService, authenticator, s.cfg)
 	userHandler.RegisterRoutes(subrouter)
+	mfaHandler := mfa.NewHandlers(mfaService, userStore, sessions, limiter, authenticator, s.cfg)
+	mfaHandler.RegisterRoutes(subrouter)
+	sessionHandler := session.NewHandlers(sessions, authenticator, s.cfg)
+	sessionHandler.RegisterRoutes(subrouter)
+	verificationHandler := verification.NewHandlers(verifier, userStore, authenticator, s.cfg)
+	verificationHandler.RegisterRoutes(subrouter)
+
+	// initialize the API key handler
+	apiKeyHandler := apikey.NewHandlers(apiKeys, authenticator, s.cfg)
+	apiKeyHandler.RegisterRoutes(subrouter)
+
+	// initialize the admin user management handler
+	adminHandler := admin.NewHandlers(userStore, sessions, authenticator, s.cfg)
+	adminHandler.RegisterRoutes(subrouter)
+
+	// initialize the password reset handler
+	passwordHandler := password.NewHandlers(password.NewPasswordResetStore(s.db, s.cfg), userStore, sessions, notifier, s.cfg)
+	passwordHandler.RegisterRoutes(subrouter)
+
+	// make retried checkouts and product creation safe; stored responses
+	// expire after a day and are purged in the background
+	idempotencyStore := idempotency.NewIdempotencyStore(s.db, s.cfg)
+	idempotency.StartPurging(idempotencyStore, idempotency.PurgeInterval)
 
 	// initialize the product handler
-	productHandler := product.NewHandlers(product.NewProductStore(s.db, s.cfg))
+	productHandler := product.NewHandlers(product.NewProductStore(s.db, s.cfg), authenticator, s.cfg).WithIdempotency(idempotencyStore)
 	productHandler.RegisterRoutes(subrouter)
 
+	// initialize the address book handler
+	addressStore := address.NewAddressStore(s.db, s.cfg)
+	addressHandler := address.NewHandlers(addressStore, authenticator, s.cfg)
+	addressHandler.RegisterRoutes(subrouter)
+
 	// initialize the cart handler
-	orderStore := order.NewOrderStore(s.db, s.cfg)
-	cartHandler := cart.NewHandlers(orderStore, product.NewProductStore(s.db, s.cfg), s.cfg)
+	transactor := transaction.NewTransactor(s.db, s.cfg)
+	cartHandler := cart.NewHandlers(cart.NewCartStore(s.db, s.cfg), product.NewProductStore(s.db, s.cfg), addressStore, userStore, notifier, transactor, authenticator, s.cfg).WithIdempotency(idempotencyStore)
 	cartHandler.RegisterRoutes(subrouter)
 
+	// initialize the order handler
+	orderStore := order.NewOrderStore(s.db, s.cfg)
+	orderHandler := order.NewHandlers(orderStore, order.NewService(transactor), authenticator, s.cfg)
+	orderHandler.RegisterRoutes(subrouter)
+
+	// initialize the data export handler; erasure runs from the migrate CLI
+	privacyService := privacy.NewService(userStore, addressStore, orderStore)
+	privacyHandler := privacy.NewHandlers(privacyService, authenticator, s.cfg)
+	privacyHandler.RegisterRoutes(subrouter)
+
+	// publish the public keys so other services can verify our tokens
+	router.HandleFunc("/.well-known/jwks.json", auth.JWKSHandler(keys)).Methods("GET")
+
 	// add health check endpoint
 	router.HandleFunc("/health", s.healthCheckHandler).Methods("GET")
 
@@ -16,11 +16,13 @@ func setupTestEnv(t *testing.T) (*APIServer, sqlmock.Sqlmock) {
 
 	// Mock configuration
 	cfg := &config.Config{
-		DBuser:     "testuser",
-		DBpassword: "testpassword",
-		DBaddr:     "localhost",
-		DBname:     "testdb",
-		Address:    ":8080",
+		Environment: "test",
+		DBuser:      "testuser",
+		DBpassword:  "testpassword",
+		DBaddr:      "localhost",
+		DBname:      "testdb",
+		Address:     ":8080",
+		Mail:        config.MailConfig{Driver: "memory"},
 	}
 
 	// Initialize the mock database with MonitorPingsOption
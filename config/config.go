@@ -10,8 +10,25 @@ import (
 )
 
 type JWTConfig struct {
-	Expiration int64  `yaml:"expiration"`
-	Secret     string `yaml:"secret"`
+	Expiration        int64  `yaml:"expiration"`
+	RefreshExpiration int64  `yaml:"refresh_expiration"`
+	Secret            string `yaml:"secret"`
+
+	// Keys are asymmetric keys tokens are signed and verified with. When any
+	// are configured Secret is no longer used. To rotate, add the new key,
+	// switch SigningKey to it and remove the old key once every token it
+	// signed has expired; until then it keeps verifying and stays published.
+	Keys       []JWTKeyConfig `yaml:"keys"`
+	SigningKey string         `yaml:"signing_key"`
+}
+
+// JWTKeyConfig points at the PEM files of a single key. A key only kept to
+// verify tokens signed before a rotation needs just its public key.
+type JWTKeyConfig struct {
+	ID             string `yaml:"kid"`
+	Algorithm      string `yaml:"algorithm"` // RS256 or EdDSA
+	PrivateKeyFile string `yaml:"private_key_file"`
+	PublicKeyFile  string `yaml:"public_key_file"`
 }
 
 type Config struct {
@@ -22,6 +39,44 @@ type Config struct {
 	DBname      string    `yaml:"db_name"`
 	JWT         JWTConfig `yaml:"jwt"`
 	Address     string    `yaml:"address"`
+	// AppURL is the base URL of the web app that links in emails point to.
+	// Without it emails carry bare tokens.
+	AppURL string `yaml:"app_url"`
+	// TrustedProxies lists the IPs or CIDRs of the load balancers and
+	// proxies in front of the server. Only requests from them have their
+	// X-Forwarded-For header read to find the client address.
+	TrustedProxies []string   `yaml:"trusted_proxies"`
+	Mail           MailConfig `yaml:"mail"`
+	// RequireVerifiedEmailForCheckout refuses checkout to users who have not
+	// verified their email address yet.
+	RequireVerifiedEmailForCheckout bool      `yaml:"require_verified_email_for_checkout"`
+	MFA                             MFAConfig `yaml:"mfa"`
+}
+
+type MFAConfig struct {
+	// Issuer names the shop in authenticator apps. Defaults to "ecom".
+	Issuer string `yaml:"issuer"`
+	// RequiredForAdmins makes admins enroll in two-factor authentication
+	// before they can log in again.
+	RequiredForAdmins bool `yaml:"required_for_admins"`
+}
+
+type MailConfig struct {
+	// Driver picks how email is delivered and must be set: log writes it to
+	// the server log, file writes one file per email to Directory, memory
+	// keeps it for tests to inspect and smtp sends it through the SMTP
+	// server. log and memory are refused outside local environments.
+	Driver    string     `yaml:"driver"`
+	From      string     `yaml:"from"`
+	Directory string     `yaml:"directory"`
+	SMTP      SMTPConfig `yaml:"smtp"`
+}
+
+type SMTPConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
 }
 
 // DefaultConfig creates a default config
@@ -35,8 +90,9 @@ func DefaultConfig(environment string) *Config {
 
 func DefaultJWTConfig() JWTConfig {
 	return JWTConfig{
-		Expiration: 3600, // Default to 1 hour
-		Secret:     "default_secret",
+		Expiration:        3600,    // Default to 1 hour
+		RefreshExpiration: 2592000, // Default to 30 days
+		Secret:            "default_secret",
 	}
 }
 
@@ -70,6 +126,9 @@ func LoadConfig(ctx context.Context, directory string, environment string, deplo
 	cfg.DBaddr = getEnv("DB_HOSTNAME")
 	cfg.DBname = getEnv("DB_NAME")
 	cfg.JWT.Secret = getEnv("JWT_SECRET")
+	cfg.Mail.SMTP.Host = getEnv("SMTP_HOST")
+	cfg.Mail.SMTP.Username = getEnv("SMTP_USERNAME")
+	cfg.Mail.SMTP.Password = getEnv("SMTP_PASSWORD")
 
 	// Load YAML configuration based on the environment
 	fileName := fmt.Sprintf("%s/%s.yml", directory, environment)
@@ -77,8 +77,9 @@ address: :8080
 				DBaddr:      "test_hostname",
 				DBname:      "test_db",
 				JWT: JWTConfig{
-					Expiration: 7200,
-					Secret:     "test_secret",
+					Expiration:        7200,
+					RefreshExpiration: 2592000,
+					Secret:            "test_secret",
 				},
 				Address: ":8080",
 			},
@@ -141,8 +142,9 @@ address: :8080
 				DBaddr:      "test_hostname",
 				DBname:      "test_db",
 				JWT: JWTConfig{
-					Expiration: 7200,
-					Secret:     "test_secret",
+					Expiration:        7200,
+					RefreshExpiration: 2592000,
+					Secret:            "test_secret",
 				},
 				Address: ":8080",
 			},
@@ -0,0 +1,34 @@
+package db
+
+import "database/sql"
+
+// DBTX is satisfied by both *sql.DB and *sql.Tx, letting stores run their
+// queries either directly against the pool or inside a caller's transaction.
+type DBTX interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// WithTransaction runs fn inside a new transaction. The transaction is
+// committed if fn succeeds and rolled back if it returns an error or panics.
+func WithTransaction(conn *sql.DB, fn func(tx *sql.Tx) error) (err error) {
+	tx, err := conn.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback() // Rollback in case of panic
+			panic(p)
+		} else if err != nil {
+			tx.Rollback() // Rollback in case of error
+		} else {
+			err = tx.Commit() // Commit if no errors
+		}
+	}()
+
+	err = fn(tx)
+	return err
+}
@@ -0,0 +1,241 @@
+package address
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/loloDawit/ecom/config"
+	"github.com/loloDawit/ecom/services/auth"
+	"github.com/loloDawit/ecom/types"
+	"github.com/loloDawit/ecom/utils"
+	"gopkg.in/go-playground/validator.v9"
+)
+
+type Handler struct {
+	store types.AddressStore
+	auth  auth.Authenticator
+	cfg   *config.Config
+}
+
+func NewHandlers(store types.AddressStore, authenticator auth.Authenticator, cfg *config.Config) *Handler {
+	return &Handler{store: store, auth: authenticator, cfg: cfg}
+}
+
+func (h *Handler) RegisterRoutes(r *mux.Router) {
+	jwtMiddleware := auth.Middleware(h.auth)
+
+	r.HandleFunc("/users/me/addresses", jwtMiddleware(h.getAddresses)).Methods("GET")
+	r.HandleFunc("/users/me/addresses", jwtMiddleware(h.createAddress)).Methods("POST")
+	r.HandleFunc("/users/me/addresses/{id}", jwtMiddleware(h.getAddress)).Methods("GET")
+	r.HandleFunc("/users/me/addresses/{id}", jwtMiddleware(h.updateAddress)).Methods("PUT")
+	r.HandleFunc("/users/me/addresses/{id}", jwtMiddleware(h.deleteAddress)).Methods("DELETE")
+	r.HandleFunc("/users/me/addresses/{id}/default", jwtMiddleware(h.setDefaultAddress)).Methods("POST")
+}
+
+// Format renders an address as the single line snapshotted onto orders.
+func Format(a types.Address) string {
+	parts := []string{a.Line1}
+	if a.Line2 != "" {
+		parts = append(parts, a.Line2)
+	}
+	parts = append(parts, a.City)
+	if a.Region != "" {
+		parts = append(parts, a.Region+" "+a.PostalCode)
+	} else {
+		parts = append(parts, a.PostalCode)
+	}
+	parts = append(parts, a.Country)
+	return strings.Join(parts, ", ")
+}
+
+// FromPayload builds the address described by a validated payload.
+func FromPayload(userID int, payload types.AddressPayload) types.Address {
+	return types.Address{
+		UserID:     userID,
+		Line1:      strings.TrimSpace(payload.Line1),
+		Line2:      strings.TrimSpace(payload.Line2),
+		City:       strings.TrimSpace(payload.City),
+		Region:     strings.TrimSpace(payload.Region),
+		PostalCode: strings.TrimSpace(payload.PostalCode),
+		Country:    strings.ToUpper(payload.Country),
+		IsDefault:  payload.IsDefault,
+	}
+}
+
+func (h *Handler) getAddresses(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	addresses, err := h.store.GetAddressesByUserID(userID)
+	if err != nil {
+		log.Printf("error getting addresses for user %d: %v", userID, err)
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrInternalServerError)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, addresses)
+}
+
+func (h *Handler) getAddress(w http.ResponseWriter, r *http.Request) {
+	userID, id, ok := readIDs(w, r)
+	if !ok {
+		return
+	}
+
+	address, err := h.store.GetAddressByID(userID, id)
+	if err != nil {
+		writeStoreError(w, id, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, address)
+}
+
+func (h *Handler) createAddress(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	payload, ok := readPayload(w, r)
+	if !ok {
+		return
+	}
+
+	address := FromPayload(userID, payload)
+
+	// the first address in the book becomes the default
+	if !address.IsDefault {
+		if _, err := h.store.GetDefaultAddress(userID); errors.Is(err, sql.ErrNoRows) {
+			address.IsDefault = true
+		}
+	}
+
+	address.ID, err = h.store.CreateAddress(address)
+	if err != nil {
+		log.Printf("error creating address for user %d: %v", userID, err)
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrInternalServerError)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, address)
+}
+
+func (h *Handler) updateAddress(w http.ResponseWriter, r *http.Request) {
+	userID, id, ok := readIDs(w, r)
+	if !ok {
+		return
+	}
+
+	payload, ok := readPayload(w, r)
+	if !ok {
+		return
+	}
+
+	address := FromPayload(userID, payload)
+	address.ID = id
+	if err := h.store.UpdateAddress(address); err != nil {
+		writeStoreError(w, id, err)
+		return
+	}
+
+	updated, err := h.store.GetAddressByID(userID, id)
+	if err != nil {
+		writeStoreError(w, id, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, updated)
+}
+
+func (h *Handler) deleteAddress(w http.ResponseWriter, r *http.Request) {
+	userID, id, ok := readIDs(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.store.DeleteAddress(userID, id); err != nil {
+		writeStoreError(w, id, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) setDefaultAddress(w http.ResponseWriter, r *http.Request) {
+	userID, id, ok := readIDs(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.store.SetDefaultAddress(userID, id); err != nil {
+		writeStoreError(w, id, err)
+		return
+	}
+
+	address, err := h.store.GetAddressByID(userID, id)
+	if err != nil {
+		writeStoreError(w, id, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, address)
+}
+
+// readIDs returns the authenticated user and the address ID from the path,
+// writing the error response itself when either is missing.
+func readIDs(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	userID, err := auth.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return 0, 0, false
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid address ID")
+		return 0, 0, false
+	}
+
+	return userID, id, true
+}
+
+func readPayload(w http.ResponseWriter, r *http.Request) (types.AddressPayload, bool) {
+	var payload types.AddressPayload
+	if r.Body == nil {
+		utils.WriteError(w, http.StatusBadRequest, utils.ErrInvalidRequestBody)
+		return payload, false
+	}
+
+	if err := utils.ReadJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, utils.ErrInvalidPayload)
+		return payload, false
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Sprintf("%s: %v", utils.ErrInvalidPayload, validationErrors))
+		return payload, false
+	}
+
+	return payload, true
+}
+
+func writeStoreError(w http.ResponseWriter, id int, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteError(w, http.StatusNotFound, utils.ErrAddressNotFound)
+		return
+	}
+	log.Printf("error accessing address %d: %v", id, err)
+	utils.WriteError(w, http.StatusInternalServerError, utils.ErrInternalServerError)
+}
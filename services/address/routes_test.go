@@ -0,0 +1,227 @@
+package address
+
+import (
+	"bytes"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/gorilla/mux"
+	"github.com/loloDawit/ecom/config"
+	"github.com/loloDawit/ecom/services/auth"
+	"github.com/loloDawit/ecom/types"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockAddressStore struct {
+	GetAddressesByUserIDFunc func(userID int) ([]types.Address, error)
+	GetAddressByIDFunc       func(userID int, id int) (*types.Address, error)
+	GetDefaultAddressFunc    func(userID int) (*types.Address, error)
+	CreateAddressFunc        func(address types.Address) (int, error)
+	UpdateAddressFunc        func(address types.Address) error
+	DeleteAddressFunc        func(userID int, id int) error
+	SetDefaultAddressFunc    func(userID int, id int) error
+}
+
+func (m *mockAddressStore) GetAddressesByUserID(userID int) ([]types.Address, error) {
+	if m.GetAddressesByUserIDFunc != nil {
+		return m.GetAddressesByUserIDFunc(userID)
+	}
+	return []types.Address{}, nil
+}
+
+func (m *mockAddressStore) GetAddressByID(userID int, id int) (*types.Address, error) {
+	if m.GetAddressByIDFunc != nil {
+		return m.GetAddressByIDFunc(userID, id)
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *mockAddressStore) GetDefaultAddress(userID int) (*types.Address, error) {
+	if m.GetDefaultAddressFunc != nil {
+		return m.GetDefaultAddressFunc(userID)
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *mockAddressStore) CreateAddress(address types.Address) (int, error) {
+	if m.CreateAddressFunc != nil {
+		return m.CreateAddressFunc(address)
+	}
+	return 1, nil
+}
+
+func (m *mockAddressStore) UpdateAddress(address types.Address) error {
+	if m.UpdateAddressFunc != nil {
+		return m.UpdateAddressFunc(address)
+	}
+	return nil
+}
+
+func (m *mockAddressStore) DeleteAddress(userID int, id int) error {
+	if m.DeleteAddressFunc != nil {
+		return m.DeleteAddressFunc(userID, id)
+	}
+	return nil
+}
+
+func (m *mockAddressStore) SetDefaultAddress(userID int, id int) error {
+	if m.SetDefaultAddressFunc != nil {
+		return m.SetDefaultAddressFunc(userID, id)
+	}
+	return nil
+}
+
+func generateTestToken(secret []byte, userID int) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"userID": strconv.Itoa(userID),
+		"exp":    time.Now().Add(time.Hour).Unix(),
+	})
+	tokenString, _ := token.SignedString(secret)
+	return tokenString
+}
+
+func TestAddressRoutes(t *testing.T) {
+	cfg := &config.Config{
+		JWT: config.JWTConfig{
+			Secret: "testsecret",
+		},
+	}
+
+	tests := []struct {
+		name                 string
+		method               string
+		path                 string
+		payload              string
+		withToken            bool
+		mockStore            *mockAddressStore
+		expectedStatus       int
+		expectedResponseBody string
+	}{
+		{
+			name:                 "Requires authentication",
+			method:               "GET",
+			path:                 "/users/me/addresses",
+			mockStore:            &mockAddressStore{},
+			expectedStatus:       http.StatusUnauthorized,
+			expectedResponseBody: `{"error":"Authorization header is missing"}`,
+		},
+		{
+			name:      "List addresses",
+			method:    "GET",
+			path:      "/users/me/addresses",
+			withToken: true,
+			mockStore: &mockAddressStore{
+				GetAddressesByUserIDFunc: func(userID int) ([]types.Address, error) {
+					return []types.Address{{ID: 1, UserID: userID, Line1: "1 Main St", City: "Portland", PostalCode: "97201", Country: "US", IsDefault: true}}, nil
+				},
+			},
+			expectedStatus:       http.StatusOK,
+			expectedResponseBody: `[{"id":1,"userId":1,"line1":"1 Main St","line2":"","city":"Portland","region":"","postalCode":"97201","country":"US","isDefault":true,"createdAt":"0001-01-01T00:00:00Z"}]`,
+		},
+		{
+			name:      "First address becomes the default",
+			method:    "POST",
+			path:      "/users/me/addresses",
+			payload:   `{"line1":" 1 Main St ","city":"Portland","postalCode":"97201","country":"us"}`,
+			withToken: true,
+			mockStore: &mockAddressStore{
+				CreateAddressFunc: func(address types.Address) (int, error) {
+					if !address.IsDefault {
+						return 0, sql.ErrConnDone
+					}
+					return 3, nil
+				},
+			},
+			expectedStatus:       http.StatusCreated,
+			expectedResponseBody: `{"id":3,"userId":1,"line1":"1 Main St","line2":"","city":"Portland","region":"","postalCode":"97201","country":"US","isDefault":true,"createdAt":"0001-01-01T00:00:00Z"}`,
+		},
+		{
+			name:                 "Invalid address",
+			method:               "POST",
+			path:                 "/users/me/addresses",
+			payload:              `{"line1":"1 Main St","city":"Portland","postalCode":"97201"}`,
+			withToken:            true,
+			mockStore:            &mockAddressStore{},
+			expectedStatus:       http.StatusBadRequest,
+			expectedResponseBody: `{"error":"invalid payload: Key: 'AddressPayload.Country' Error:Field validation for 'Country' failed on the 'required' tag"}`,
+		},
+		{
+			name:                 "Another user's address is not found",
+			method:               "GET",
+			path:                 "/users/me/addresses/9",
+			withToken:            true,
+			mockStore:            &mockAddressStore{},
+			expectedStatus:       http.StatusNotFound,
+			expectedResponseBody: `{"error":"address not found"}`,
+		},
+		{
+			name:      "Update address",
+			method:    "PUT",
+			path:      "/users/me/addresses/2",
+			payload:   `{"line1":"2 Main St","city":"Portland","postalCode":"97201","country":"US"}`,
+			withToken: true,
+			mockStore: &mockAddressStore{
+				GetAddressByIDFunc: func(userID int, id int) (*types.Address, error) {
+					return &types.Address{ID: id, UserID: userID, Line1: "2 Main St", City: "Portland", PostalCode: "97201", Country: "US"}, nil
+				},
+			},
+			expectedStatus:       http.StatusOK,
+			expectedResponseBody: `{"id":2,"userId":1,"line1":"2 Main St","line2":"","city":"Portland","region":"","postalCode":"97201","country":"US","isDefault":false,"createdAt":"0001-01-01T00:00:00Z"}`,
+		},
+		{
+			name:      "Set default address",
+			method:    "POST",
+			path:      "/users/me/addresses/2/default",
+			withToken: true,
+			mockStore: &mockAddressStore{
+				GetAddressByIDFunc: func(userID int, id int) (*types.Address, error) {
+					return &types.Address{ID: id, UserID: userID, Line1: "2 Main St", City: "Portland", PostalCode: "97201", Country: "US", IsDefault: true}, nil
+				},
+			},
+			expectedStatus:       http.StatusOK,
+			expectedResponseBody: `{"id":2,"userId":1,"line1":"2 Main St","line2":"","city":"Portland","region":"","postalCode":"97201","country":"US","isDefault":true,"createdAt":"0001-01-01T00:00:00Z"}`,
+		},
+		{
+			name:      "Delete unknown address",
+			method:    "DELETE",
+			path:      "/users/me/addresses/2",
+			withToken: true,
+			mockStore: &mockAddressStore{
+				DeleteAddressFunc: func(userID int, id int) error {
+					return sql.ErrNoRows
+				},
+			},
+			expectedStatus:       http.StatusNotFound,
+			expectedResponseBody: `{"error":"address not found"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := mux.NewRouter()
+			NewHandlers(tt.mockStore, auth.NewJWTAuthenticator([]byte(cfg.JWT.Secret)), cfg).RegisterRoutes(router)
+
+			req, err := http.NewRequest(tt.method, tt.path, bytes.NewReader([]byte(tt.payload)))
+			assert.NoError(t, err)
+			if tt.withToken {
+				req.Header.Set("Authorization", "Bearer "+generateTestToken([]byte(cfg.JWT.Secret), 1))
+			}
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			assert.JSONEq(t, tt.expectedResponseBody, rr.Body.String())
+		})
+	}
+}
+
+func TestFormat(t *testing.T) {
+	assert.Equal(t, "1 Main St, Apt 2, Portland, OR 97201, US", Format(types.Address{Line1: "1 Main St", Line2: "Apt 2", City: "Portland", Region: "OR", PostalCode: "97201", Country: "US"}))
+	assert.Equal(t, "10 Downing St, London, SW1A 2AA, GB", Format(types.Address{Line1: "10 Downing St", City: "London", PostalCode: "SW1A 2AA", Country: "GB"}))
+}
@@ -0,0 +1,154 @@
+package address
+
+import (
+	"database/sql"
+
+	"github.com/loloDawit/ecom/config"
+	"github.com/loloDawit/ecom/db"
+	"github.com/loloDawit/ecom/types"
+)
+
+const addressColumns = "id, userId, line1, line2, city, region, postalCode, country, isDefault, createdAt"
+
+type AddressStore struct {
+	db  *sql.DB
+	cfg *config.Config
+}
+
+func NewAddressStore(db *sql.DB, cfg *config.Config) *AddressStore {
+	return &AddressStore{db: db, cfg: cfg}
+}
+
+func (s *AddressStore) GetAddressesByUserID(userID int) ([]types.Address, error) {
+	rows, err := s.db.Query("SELECT "+addressColumns+" FROM addresses WHERE userId = $1 ORDER BY isDefault DESC, id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	addresses := []types.Address{}
+	for rows.Next() {
+		a, err := scanAddress(rows)
+		if err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, *a)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return addresses, nil
+}
+
+func (s *AddressStore) GetAddressByID(userID int, id int) (*types.Address, error) {
+	row := s.db.QueryRow("SELECT "+addressColumns+" FROM addresses WHERE id = $1 AND userId = $2", id, userID)
+	return scanAddress(row)
+}
+
+func (s *AddressStore) GetDefaultAddress(userID int) (*types.Address, error) {
+	row := s.db.QueryRow("SELECT "+addressColumns+" FROM addresses WHERE userId = $1 AND isDefault", userID)
+	return scanAddress(row)
+}
+
+// CreateAddress saves a new address. When it is flagged as the default, the
+// user's previous default is cleared in the same transaction.
+func (s *AddressStore) CreateAddress(a types.Address) (int, error) {
+	var id int
+	err := db.WithTransaction(s.db, func(tx *sql.Tx) error {
+		if a.IsDefault {
+			if err := clearDefault(tx, a.UserID); err != nil {
+				return err
+			}
+		}
+
+		return tx.QueryRow(
+			"INSERT INTO addresses (userId, line1, line2, city, region, postalCode, country, isDefault) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id",
+			a.UserID, a.Line1, a.Line2, a.City, a.Region, a.PostalCode, a.Country, a.IsDefault,
+		).Scan(&id)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// UpdateAddress replaces the fields of an existing address, moving the
+// default flag to it when requested.
+func (s *AddressStore) UpdateAddress(a types.Address) error {
+	return db.WithTransaction(s.db, func(tx *sql.Tx) error {
+		if a.IsDefault {
+			if err := clearDefault(tx, a.UserID); err != nil {
+				return err
+			}
+		}
+
+		result, err := tx.Exec(
+			"UPDATE addresses SET line1 = $1, line2 = $2, city = $3, region = $4, postalCode = $5, country = $6, isDefault = $7 WHERE id = $8 AND userId = $9",
+			a.Line1, a.Line2, a.City, a.Region, a.PostalCode, a.Country, a.IsDefault, a.ID, a.UserID,
+		)
+		if err != nil {
+			return err
+		}
+
+		return requireRowsAffected(result)
+	})
+}
+
+func (s *AddressStore) DeleteAddress(userID int, id int) error {
+	result, err := s.db.Exec("DELETE FROM addresses WHERE id = $1 AND userId = $2", id, userID)
+	if err != nil {
+		return err
+	}
+
+	return requireRowsAffected(result)
+}
+
+// SetDefaultAddress makes the address the user's default, clearing the
+// previous one.
+func (s *AddressStore) SetDefaultAddress(userID int, id int) error {
+	return db.WithTransaction(s.db, func(tx *sql.Tx) error {
+		if err := clearDefault(tx, userID); err != nil {
+			return err
+		}
+
+		result, err := tx.Exec("UPDATE addresses SET isDefault = TRUE WHERE id = $1 AND userId = $2", id, userID)
+		if err != nil {
+			return err
+		}
+
+		return requireRowsAffected(result)
+	})
+}
+
+func clearDefault(tx *sql.Tx, userID int) error {
+	_, err := tx.Exec("UPDATE addresses SET isDefault = FALSE WHERE userId = $1 AND isDefault", userID)
+	return err
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanAddress(row scanner) (*types.Address, error) {
+	a := new(types.Address)
+	err := row.Scan(&a.ID, &a.UserID, &a.Line1, &a.Line2, &a.City, &a.Region, &a.PostalCode, &a.Country, &a.IsDefault, &a.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+func requireRowsAffected(result sql.Result) error {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+package address
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/loloDawit/ecom/config"
+	"github.com/loloDawit/ecom/types"
+	"github.com/stretchr/testify/assert"
+)
+
+var addressRowColumns = []string{"id", "userId", "line1", "line2", "city", "region", "postalCode", "country", "isDefault", "createdAt"}
+
+func TestGetAddressesByUserID(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	store := NewAddressStore(db, &config.Config{})
+	createdAt := time.Now()
+
+	rows := sqlmock.NewRows(addressRowColumns).
+		AddRow(2, 1, "1 Main St", "", "Portland", "OR", "97201", "US", true, createdAt).
+		AddRow(1, 1, "2 Side St", "Apt 3", "Seattle", "WA", "98101", "US", false, createdAt)
+	mock.ExpectQuery("SELECT (.+) FROM addresses WHERE userId = \\$1 ORDER BY isDefault DESC, id").
+		WithArgs(1).
+		WillReturnRows(rows)
+
+	addresses, err := store.GetAddressesByUserID(1)
+	assert.NoError(t, err)
+	assert.Len(t, addresses, 2)
+	assert.True(t, addresses[0].IsDefault)
+	assert.Equal(t, "Apt 3", addresses[1].Line2)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetAddressByID(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	store := NewAddressStore(db, &config.Config{})
+
+	tests := []struct {
+		name        string
+		mockQuery   func()
+		expectedErr error
+	}{
+		{
+			name: "Own address",
+			mockQuery: func() {
+				mock.ExpectQuery("SELECT (.+) FROM addresses WHERE id = \\$1 AND userId = \\$2").
+					WithArgs(5, 1).
+					WillReturnRows(sqlmock.NewRows(addressRowColumns).
+						AddRow(5, 1, "1 Main St", "", "Portland", "OR", "97201", "US", true, time.Now()))
+			},
+			expectedErr: nil,
+		},
+		{
+			name: "Someone else's address",
+			mockQuery: func() {
+				mock.ExpectQuery("SELECT (.+) FROM addresses WHERE id = \\$1 AND userId = \\$2").
+					WithArgs(5, 1).
+					WillReturnError(sql.ErrNoRows)
+			},
+			expectedErr: sql.ErrNoRows,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockQuery()
+
+			address, err := store.GetAddressByID(1, 5)
+			assert.Equal(t, tt.expectedErr, err)
+			if tt.expectedErr == nil {
+				assert.Equal(t, 5, address.ID)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestCreateAddress(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	store := NewAddressStore(db, &config.Config{})
+
+	tests := []struct {
+		name       string
+		address    types.Address
+		mockQuery  func()
+		expectedID int
+	}{
+		{
+			name:    "Non-default address",
+			address: types.Address{UserID: 1, Line1: "1 Main St", City: "Portland", PostalCode: "97201", Country: "US"},
+			mockQuery: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery("INSERT INTO addresses \\(userId, line1, line2, city, region, postalCode, country, isDefault\\) VALUES \\(\\$1, \\$2, \\$3, \\$4, \\$5, \\$6, \\$7, \\$8\\) RETURNING id").
+					WithArgs(1, "1 Main St", "", "Portland", "", "97201", "US", false).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+				mock.ExpectCommit()
+			},
+			expectedID: 7,
+		},
+		{
+			name:    "Default address clears the previous default",
+			address: types.Address{UserID: 1, Line1: "1 Main St", City: "Portland", PostalCode: "97201", Country: "US", IsDefault: true},
+			mockQuery: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec("UPDATE addresses SET isDefault = FALSE WHERE userId = \\$1 AND isDefault").
+					WithArgs(1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery("INSERT INTO addresses (.+) RETURNING id").
+					WithArgs(1, "1 Main St", "", "Portland", "", "97201", "US", true).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(8))
+				mock.ExpectCommit()
+			},
+			expectedID: 8,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockQuery()
+
+			id, err := store.CreateAddress(tt.address)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedID, id)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestSetDefaultAddress(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	store := NewAddressStore(db, &config.Config{})
+
+	tests := []struct {
+		name        string
+		mockQuery   func()
+		expectedErr error
+	}{
+		{
+			name: "Success",
+			mockQuery: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec("UPDATE addresses SET isDefault = FALSE WHERE userId = \\$1 AND isDefault").
+					WithArgs(1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("UPDATE addresses SET isDefault = TRUE WHERE id = \\$1 AND userId = \\$2").
+					WithArgs(5, 1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			expectedErr: nil,
+		},
+		{
+			name: "Unknown address rolls back",
+			mockQuery: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec("UPDATE addresses SET isDefault = FALSE WHERE userId = \\$1 AND isDefault").
+					WithArgs(1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("UPDATE addresses SET isDefault = TRUE WHERE id = \\$1 AND userId = \\$2").
+					WithArgs(5, 1).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+			},
+			expectedErr: sql.ErrNoRows,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockQuery()
+
+			err := store.SetDefaultAddress(1, 5)
+			assert.Equal(t, tt.expectedErr, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestDeleteAddress(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	store := NewAddressStore(db, &config.Config{})
+
+	mock.ExpectExec("DELETE FROM addresses WHERE id = \\$1 AND userId = \\$2").
+		WithArgs(5, 1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err = store.DeleteAddress(1, 5)
+	assert.Equal(t, sql.ErrNoRows, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
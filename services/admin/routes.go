@@ -0,0 +1,241 @@
+package admin
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/loloDawit/ecom/config"
+	"github.com/loloDawit/ecom/services/auth"
+	"github.com/loloDawit/ecom/services/user"
+	"github.com/loloDawit/ecom/types"
+	"github.com/loloDawit/ecom/utils"
+	"gopkg.in/go-playground/validator.v9"
+)
+
+type Handler struct {
+	users    types.UserStore
+	sessions types.SessionRevoker
+	auth     auth.Authenticator
+	cfg      *config.Config
+	now      func() time.Time
+}
+
+func NewHandlers(users types.UserStore, sessions types.SessionRevoker, authenticator auth.Authenticator, cfg *config.Config) *Handler {
+	return &Handler{users: users, sessions: sessions, auth: authenticator, cfg: cfg, now: time.Now}
+}
+
+func (h *Handler) RegisterRoutes(r *mux.Router) {
+	jwtMiddleware := auth.Middleware(h.auth)
+	adminOnly := func(next http.HandlerFunc) http.HandlerFunc {
+		return jwtMiddleware(auth.RequireRole(types.RoleAdmin)(next))
+	}
+
+	r.HandleFunc("/admin/users", adminOnly(h.getUsers)).Methods("GET")
+	r.HandleFunc("/admin/users/{id}", adminOnly(h.getUser)).Methods("GET")
+	r.HandleFunc("/admin/users/{id}/disable", adminOnly(h.disableUser)).Methods("POST")
+	r.HandleFunc("/admin/users/{id}/enable", adminOnly(h.enableUser)).Methods("POST")
+	r.HandleFunc("/admin/users/{id}/role", adminOnly(h.changeRole)).Methods("PUT")
+	r.HandleFunc("/admin/users/{id}/logout", adminOnly(h.logoutUser)).Methods("POST")
+}
+
+// getUsers lists users one page at a time, optionally filtered by role and
+// by a search term matched against email and name.
+func (h *Handler) getUsers(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := utils.ParsePagination(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	query := types.UserQuery{
+		Limit:  limit,
+		Offset: offset,
+		Search: strings.TrimSpace(r.URL.Query().Get("search")),
+		Role:   types.Role(r.URL.Query().Get("role")),
+	}
+	switch query.Role {
+	case "", types.RoleCustomer, types.RoleStaff, types.RoleAdmin:
+	default:
+		utils.WriteError(w, http.StatusBadRequest, fmt.Sprintf("invalid role: %s", query.Role))
+		return
+	}
+
+	users, err := h.users.GetUsers(query)
+	if err != nil {
+		log.Printf("error listing users: %v", err)
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrInternalServerError)
+		return
+	}
+
+	response := types.UserListResponse{Users: make([]types.UserResponse, 0, len(users)), Limit: limit, Offset: offset}
+	for i := range users {
+		response.Users = append(response.Users, user.ToResponse(&users[i]))
+	}
+
+	utils.WriteJSON(w, http.StatusOK, response)
+}
+
+func (h *Handler) getUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := readUserID(w, r)
+	if !ok {
+		return
+	}
+
+	h.writeUser(w, id)
+}
+
+// disableUser locks the user out: they cannot log in, and their sessions
+// and tokens stop working, on other instances once their cached revocation
+// cutoff expires (revocation.CacheTTL).
+func (h *Handler) disableUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.readOtherUserID(w, r)
+	if !ok {
+		return
+	}
+
+	now := h.now()
+	if err := h.users.SetUserDisabled(id, &now); err != nil {
+		writeStoreError(w, id, err)
+		return
+	}
+	if !h.revokeSessions(w, id) {
+		return
+	}
+
+	h.writeUser(w, id)
+}
+
+// enableUser lets a disabled user log in again.
+func (h *Handler) enableUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := readUserID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.users.SetUserDisabled(id, nil); err != nil {
+		writeStoreError(w, id, err)
+		return
+	}
+
+	h.writeUser(w, id)
+}
+
+// changeRole ends the user's sessions, since their tokens still carry the
+// old role.
+func (h *Handler) changeRole(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.readOtherUserID(w, r)
+	if !ok {
+		return
+	}
+
+	if r.Body == nil {
+		utils.WriteError(w, http.StatusBadRequest, utils.ErrInvalidRequestBody)
+		return
+	}
+
+	var payload types.UpdateRolePayload
+	if err := utils.ReadJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, utils.ErrInvalidPayload)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Sprintf("%s: %v", utils.ErrInvalidPayload, validationErrors))
+		return
+	}
+
+	if err := h.users.UpdateUserRole(id, payload.Role); err != nil {
+		writeStoreError(w, id, err)
+		return
+	}
+	if !h.revokeSessions(w, id) {
+		return
+	}
+
+	h.writeUser(w, id)
+}
+
+func (h *Handler) logoutUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := readUserID(w, r)
+	if !ok {
+		return
+	}
+
+	if _, err := h.users.GetUserByID(id); err != nil {
+		writeStoreError(w, id, err)
+		return
+	}
+	if !h.revokeSessions(w, id) {
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) writeUser(w http.ResponseWriter, id int) {
+	u, err := h.users.GetUserByID(id)
+	if err != nil {
+		writeStoreError(w, id, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, user.ToResponse(u))
+}
+
+// writeStoreError answers a failed read or change of user id with 404 when
+// the user does not exist.
+func writeStoreError(w http.ResponseWriter, id int, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteError(w, http.StatusNotFound, utils.ErrUserNotFound)
+		return
+	}
+	log.Printf("error accessing user %d: %v", id, err)
+	utils.WriteError(w, http.StatusInternalServerError, utils.ErrInternalServerError)
+}
+
+func (h *Handler) revokeSessions(w http.ResponseWriter, id int) bool {
+	if err := h.sessions.RevokeSessions(id); err != nil {
+		log.Printf("error revoking sessions of user %d: %v", id, err)
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrInternalServerError)
+		return false
+	}
+	return true
+}
+
+func readUserID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid user ID")
+		return 0, false
+	}
+	return id, true
+}
+
+// readOtherUserID reads the user id like readUserID but refuses the
+// caller's own, so the last admin cannot lock everyone out.
+func (h *Handler) readOtherUserID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, ok := readUserID(w, r)
+	if !ok {
+		return 0, false
+	}
+
+	callerID, err := auth.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return 0, false
+	}
+	if id == callerID {
+		utils.WriteError(w, http.StatusBadRequest, utils.ErrCannotChangeSelf)
+		return 0, false
+	}
+
+	return id, true
+}
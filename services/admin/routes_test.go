@@ -0,0 +1,304 @@
+package admin
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/loloDawit/ecom/config"
+	"github.com/loloDawit/ecom/services/auth/authtest"
+	"github.com/loloDawit/ecom/types"
+	"github.com/loloDawit/ecom/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryUsers is an in-memory UserStore whose search only matches emails.
+type memoryUsers struct {
+	users []*types.User
+	query types.UserQuery
+}
+
+func newMemoryUsers() *memoryUsers {
+	return &memoryUsers{users: []*types.User{
+		{ID: 1, FirstName: "Ada", LastName: "Admin", Email: "ada@example.com", Password: "hash-1", Role: types.RoleAdmin},
+		{ID: 2, FirstName: "Jane", LastName: "Doe", Email: "jane@example.com", Password: "hash-2", Role: types.RoleCustomer},
+		{ID: 3, FirstName: "John", LastName: "Doe", Email: "john@example.com", Password: "hash-3", Role: types.RoleCustomer},
+	}}
+}
+
+func (m *memoryUsers) find(id int) *types.User {
+	for _, user := range m.users {
+		if user.ID == id {
+			return user
+		}
+	}
+	return nil
+}
+
+func (m *memoryUsers) GetUserByEmail(email string) (*types.User, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (m *memoryUsers) CreateUser(user types.User) error {
+	return nil
+}
+
+func (m *memoryUsers) GetUserByID(id int) (*types.User, error) {
+	if user := m.find(id); user != nil {
+		copied := *user
+		return &copied, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *memoryUsers) UpdateUser(user types.User) error {
+	return nil
+}
+
+func (m *memoryUsers) UpdatePassword(userID int, passwordHash string) error {
+	return nil
+}
+
+func (m *memoryUsers) DeleteUser(userID int, now time.Time) error {
+	return nil
+}
+
+func (m *memoryUsers) GetUsers(query types.UserQuery) ([]types.User, error) {
+	m.query = query
+	users := []types.User{}
+	for _, user := range m.users {
+		if strings.Contains(user.Email, query.Search) && (query.Role == "" || user.Role == query.Role) {
+			users = append(users, *user)
+		}
+	}
+	return users, nil
+}
+
+func (m *memoryUsers) SetUserDisabled(userID int, disabledAt *time.Time) error {
+	user := m.find(userID)
+	if user == nil {
+		return sql.ErrNoRows
+	}
+	user.DisabledAt = disabledAt
+	return nil
+}
+
+func (m *memoryUsers) UpdateUserRole(userID int, role types.Role) error {
+	user := m.find(userID)
+	if user == nil {
+		return sql.ErrNoRows
+	}
+	user.Role = role
+	return nil
+}
+
+type recordingSessions struct {
+	revoked []int
+}
+
+func (m *recordingSessions) RevokeSessions(userID int) error {
+	m.revoked = append(m.revoked, userID)
+	return nil
+}
+
+type testHandler struct {
+	router   *mux.Router
+	users    *memoryUsers
+	sessions *recordingSessions
+}
+
+func newTestHandler(role types.Role) *testHandler {
+	th := &testHandler{users: newMemoryUsers(), sessions: &recordingSessions{}}
+	handler := NewHandlers(th.users, th.sessions, authtest.As(1, role), &config.Config{})
+	handler.now = func() time.Time { return time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC) }
+	th.router = mux.NewRouter()
+	handler.RegisterRoutes(th.router)
+	return th
+}
+
+func (th *testHandler) do(t *testing.T, method string, path string, body string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest(method, path, bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	th.router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestGetUsers(t *testing.T) {
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+		expectedIDs    []int
+		expectedQuery  types.UserQuery
+	}{
+		{
+			name:           "All users",
+			path:           "/admin/users",
+			expectedStatus: http.StatusOK,
+			expectedIDs:    []int{1, 2, 3},
+			expectedQuery:  types.UserQuery{Limit: utils.DefaultPageLimit},
+		},
+		{
+			name:           "Search, role and page",
+			path:           "/admin/users?search=jane&role=customer&limit=5&offset=10",
+			expectedStatus: http.StatusOK,
+			expectedIDs:    []int{2},
+			expectedQuery:  types.UserQuery{Limit: 5, Offset: 10, Search: "jane", Role: types.RoleCustomer},
+		},
+		{
+			name:           "Invalid role",
+			path:           "/admin/users?role=owner",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Invalid limit",
+			path:           "/admin/users?limit=0",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			th := newTestHandler(types.RoleAdmin)
+
+			rr := th.do(t, http.MethodGet, tc.path, "")
+			assert.Equal(t, tc.expectedStatus, rr.Code)
+			if tc.expectedStatus != http.StatusOK {
+				return
+			}
+
+			assert.NotContains(t, rr.Body.String(), "hash-")
+			var response types.UserListResponse
+			assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+			var ids []int
+			for _, user := range response.Users {
+				ids = append(ids, user.ID)
+			}
+			assert.Equal(t, tc.expectedIDs, ids)
+			assert.Equal(t, tc.expectedQuery, th.users.query)
+		})
+	}
+}
+
+func TestGetUser(t *testing.T) {
+	th := newTestHandler(types.RoleAdmin)
+
+	rr := th.do(t, http.MethodGet, "/admin/users/2", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"id":2,"firstName":"Jane","lastName":"Doe","email":"jane@example.com","role":"customer","emailVerifiedAt":null}`, rr.Body.String())
+
+	rr = th.do(t, http.MethodGet, "/admin/users/99", "")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = th.do(t, http.MethodGet, "/admin/users/abc", "")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestDisableAndEnableUser(t *testing.T) {
+	th := newTestHandler(types.RoleAdmin)
+
+	rr := th.do(t, http.MethodPost, "/admin/users/2/disable", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"disabledAt":"2026-10-17T12:00:00Z"`)
+	assert.NotNil(t, th.users.find(2).DisabledAt)
+	assert.Equal(t, []int{2}, th.sessions.revoked)
+
+	rr = th.do(t, http.MethodPost, "/admin/users/2/enable", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NotContains(t, rr.Body.String(), "disabledAt")
+	assert.Nil(t, th.users.find(2).DisabledAt)
+
+	rr = th.do(t, http.MethodPost, "/admin/users/99/disable", "")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestChangeRole(t *testing.T) {
+	tests := []struct {
+		name           string
+		path           string
+		body           string
+		expectedStatus int
+		expectedRole   types.Role
+		expectRevoked  bool
+	}{
+		{
+			name:           "Promote",
+			path:           "/admin/users/2/role",
+			body:           `{"role": "staff"}`,
+			expectedStatus: http.StatusOK,
+			expectedRole:   types.RoleStaff,
+			expectRevoked:  true,
+		},
+		{
+			name:           "Unknown role",
+			path:           "/admin/users/2/role",
+			body:           `{"role": "owner"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedRole:   types.RoleCustomer,
+		},
+		{
+			name:           "Unknown user",
+			path:           "/admin/users/99/role",
+			body:           `{"role": "staff"}`,
+			expectedStatus: http.StatusNotFound,
+			expectedRole:   types.RoleCustomer,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			th := newTestHandler(types.RoleAdmin)
+
+			rr := th.do(t, http.MethodPut, tc.path, tc.body)
+			assert.Equal(t, tc.expectedStatus, rr.Code)
+			assert.Equal(t, tc.expectedRole, th.users.find(2).Role)
+			assert.Equal(t, tc.expectRevoked, len(th.sessions.revoked) > 0)
+		})
+	}
+}
+
+func TestAdminCannotChangeThemselves(t *testing.T) {
+	th := newTestHandler(types.RoleAdmin)
+
+	rr := th.do(t, http.MethodPost, "/admin/users/1/disable", "")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.JSONEq(t, `{"error":"`+utils.ErrCannotChangeSelf+`"}`, rr.Body.String())
+
+	rr = th.do(t, http.MethodPut, "/admin/users/1/role", `{"role": "customer"}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Equal(t, types.RoleAdmin, th.users.find(1).Role)
+	assert.Nil(t, th.users.find(1).DisabledAt)
+}
+
+func TestLogoutUser(t *testing.T) {
+	th := newTestHandler(types.RoleAdmin)
+
+	rr := th.do(t, http.MethodPost, "/admin/users/3/logout", "")
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	assert.Equal(t, []int{3}, th.sessions.revoked)
+
+	rr = th.do(t, http.MethodPost, "/admin/users/99/logout", "")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestAdminOnly(t *testing.T) {
+	for _, role := range []types.Role{types.RoleCustomer, types.RoleStaff} {
+		th := newTestHandler(role)
+
+		rr := th.do(t, http.MethodGet, "/admin/users", "")
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+
+		rr = th.do(t, http.MethodPost, "/admin/users/2/disable", "")
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		assert.Nil(t, th.users.find(2).DisabledAt)
+	}
+}
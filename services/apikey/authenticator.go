@@ -0,0 +1,27 @@
+package apikey
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/loloDawit/ecom/services/auth"
+)
+
+// Authenticator accepts "Authorization: ApiKey <key>" and leaves every
+// other request to next, which checks bearer tokens.
+type Authenticator struct {
+	service *Service
+	next    auth.Authenticator
+}
+
+func NewAuthenticator(service *Service, next auth.Authenticator) *Authenticator {
+	return &Authenticator{service: service, next: next}
+}
+
+func (a *Authenticator) Authenticate(r *http.Request) (*auth.Identity, error) {
+	key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "ApiKey ")
+	if !ok {
+		return a.next.Authenticate(r)
+	}
+	return a.service.Authenticate(strings.TrimSpace(key))
+}
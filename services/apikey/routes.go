@@ -0,0 +1,129 @@
+package apikey
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/loloDawit/ecom/config"
+	"github.com/loloDawit/ecom/services/auth"
+	"github.com/loloDawit/ecom/types"
+	"github.com/loloDawit/ecom/utils"
+	"gopkg.in/go-playground/validator.v9"
+)
+
+type Handler struct {
+	service *Service
+	auth    auth.Authenticator
+	cfg     *config.Config
+}
+
+func NewHandlers(service *Service, authenticator auth.Authenticator, cfg *config.Config) *Handler {
+	return &Handler{service: service, auth: authenticator, cfg: cfg}
+}
+
+// RegisterRoutes only accepts access tokens, so an API key cannot be used
+// to mint or revoke keys.
+func (h *Handler) RegisterRoutes(r *mux.Router) {
+	jwtMiddleware := auth.Middleware(h.auth)
+
+	r.HandleFunc("/users/me/api-keys", jwtMiddleware(h.getAPIKeys)).Methods("GET")
+	r.HandleFunc("/users/me/api-keys", jwtMiddleware(h.createAPIKey)).Methods("POST")
+	r.HandleFunc("/users/me/api-keys/{id}", jwtMiddleware(h.revokeAPIKey)).Methods("DELETE")
+}
+
+func (h *Handler) getAPIKeys(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	keys, err := h.service.List(userID)
+	if err != nil {
+		log.Printf("error getting api keys for user %d: %v", userID, err)
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrInternalServerError)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, keys)
+}
+
+func (h *Handler) createAPIKey(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var payload types.CreateAPIKeyPayload
+	if r.Body == nil {
+		utils.WriteError(w, http.StatusBadRequest, utils.ErrInvalidRequestBody)
+		return
+	}
+
+	if err := utils.ReadJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, utils.ErrInvalidPayload)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Sprintf("%s: %v", utils.ErrInvalidPayload, validationErrors))
+		return
+	}
+
+	key, err := h.service.Create(userID, strings.TrimSpace(payload.Name), uniqueScopes(payload.Scopes))
+	if err != nil {
+		log.Printf("error creating api key for user %d: %v", userID, err)
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrInternalServerError)
+		return
+	}
+
+	// the key is in the clear only in this response
+	utils.WriteSecretJSON(w, http.StatusCreated, key)
+}
+
+func (h *Handler) revokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid API key ID")
+		return
+	}
+
+	if err := h.service.Revoke(userID, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.WriteError(w, http.StatusNotFound, utils.ErrAPIKeyNotFound)
+			return
+		}
+		log.Printf("error revoking api key %d: %v", id, err)
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// uniqueScopes drops repeated scopes, keeping the order they were given in.
+func uniqueScopes(scopes []types.Scope) []types.Scope {
+	seen := map[types.Scope]bool{}
+	unique := make([]types.Scope, 0, len(scopes))
+	for _, scope := range scopes {
+		if !seen[scope] {
+			seen[scope] = true
+			unique = append(unique, scope)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,214 @@
+package apikey
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/loloDawit/ecom/config"
+	"github.com/loloDawit/ecom/services/auth"
+	"github.com/loloDawit/ecom/services/auth/authtest"
+	"github.com/loloDawit/ecom/services/idempotency"
+	"github.com/loloDawit/ecom/types"
+	"github.com/loloDawit/ecom/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+type testHandler struct {
+	router  *mux.Router
+	handler *Handler
+	service *Service
+	store   *memoryStore
+}
+
+func newTestHandler(identity *authtest.Authenticator) *testHandler {
+	th := &testHandler{store: &memoryStore{}}
+	th.service = NewService(th.store, &mockUserStore{})
+	th.handler = NewHandlers(th.service, identity, &config.Config{})
+	th.router = mux.NewRouter()
+	th.handler.RegisterRoutes(th.router)
+	return th
+}
+
+func (th *testHandler) do(t *testing.T, method string, path string, body string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest(method, path, bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	th.router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestCreateAPIKeyRoute(t *testing.T) {
+	th := newTestHandler(authtest.As(7, types.RoleCustomer))
+
+	rr := th.do(t, http.MethodPost, "/users/me/api-keys", `{"name":" ci ","scopes":["orders:read","orders:read","orders:write"]}`)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	var created map[string]any
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &created))
+	assert.Equal(t, "ci", created["name"])
+	assert.Equal(t, []any{"orders:read", "orders:write"}, created["scopes"])
+	assert.NotEmpty(t, created["key"])
+	assert.NotContains(t, created, "keyHash")
+
+	// the key works, and is never shown again
+	_, err := th.service.Authenticate(created["key"].(string))
+	assert.NoError(t, err)
+
+	rr = th.do(t, http.MethodGet, "/users/me/api-keys", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NotContains(t, rr.Body.String(), created["key"].(string))
+
+	var keys []map[string]any
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &keys))
+	assert.Len(t, keys, 1)
+	assert.Equal(t, created["prefix"], keys[0]["prefix"])
+	assert.NotContains(t, keys[0], "key")
+	assert.NotContains(t, keys[0], "keyHash")
+}
+
+// memoryIdempotencyStore is an in-memory IdempotencyStore keyed by key.
+type memoryIdempotencyStore struct {
+	records map[string]types.IdempotencyRecord
+}
+
+func (m *memoryIdempotencyStore) ReserveIdempotencyKey(record types.IdempotencyRecord, expiredBefore time.Time) (bool, error) {
+	if _, ok := m.records[record.Key]; ok {
+		return false, nil
+	}
+	m.records[record.Key] = record
+	return true, nil
+}
+
+func (m *memoryIdempotencyStore) GetIdempotencyRecord(key string, userID int) (*types.IdempotencyRecord, error) {
+	record, ok := m.records[key]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &record, nil
+}
+
+func (m *memoryIdempotencyStore) SaveIdempotencyResponse(record types.IdempotencyRecord) error {
+	m.records[record.Key] = record
+	return nil
+}
+
+func (m *memoryIdempotencyStore) DeleteIdempotencyRecord(key string, userID int) error {
+	delete(m.records, key)
+	return nil
+}
+
+func (m *memoryIdempotencyStore) DeleteExpiredIdempotencyRecords(expiredBefore time.Time) (int64, error) {
+	return 0, nil
+}
+
+func TestCreateAPIKeyNeverPersistsPlaintext(t *testing.T) {
+	th := newTestHandler(authtest.As(7, types.RoleCustomer))
+	idempotencyStore := &memoryIdempotencyStore{records: map[string]types.IdempotencyRecord{}}
+
+	// even behind the idempotency middleware, the created key is not kept
+	router := mux.NewRouter()
+	router.HandleFunc("/users/me/api-keys", auth.Middleware(authtest.As(7, types.RoleCustomer))(idempotency.Middleware(idempotencyStore)(th.handler.createAPIKey))).Methods("POST")
+
+	var keys []string
+	for i := 0; i < 2; i++ {
+		req, err := http.NewRequest(http.MethodPost, "/users/me/api-keys", bytes.NewBufferString(`{"name":"ci","scopes":["orders:read"]}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set(idempotency.Header, "abc")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		assert.Equal(t, "no-store", rr.Header().Get("Cache-Control"))
+		assert.Empty(t, rr.Header().Get(idempotency.ReplayedHeader))
+
+		var created types.CreatedAPIKey
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &created))
+		keys = append(keys, created.Key)
+	}
+
+	assert.NotEqual(t, keys[0], keys[1])
+	assert.Empty(t, idempotencyStore.records)
+	for i, stored := range th.store.keys {
+		assert.NotEqual(t, keys[i], stored.KeyHash)
+		assert.Equal(t, auth.HashOpaqueToken(keys[i]), stored.KeyHash)
+	}
+}
+
+func TestCreateAPIKeyValidation(t *testing.T) {
+	th := newTestHandler(authtest.As(7, types.RoleCustomer))
+
+	for _, body := range []string{
+		`{"scopes":["orders:read"]}`,
+		`{"name":"ci"}`,
+		`{"name":"ci","scopes":[]}`,
+		`{"name":"ci","scopes":["users:admin"]}`,
+	} {
+		rr := th.do(t, http.MethodPost, "/users/me/api-keys", body)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, body)
+	}
+	assert.Empty(t, th.store.keys)
+}
+
+func TestListAPIKeysEmpty(t *testing.T) {
+	th := newTestHandler(authtest.As(7, types.RoleCustomer))
+
+	rr := th.do(t, http.MethodGet, "/users/me/api-keys", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `[]`, rr.Body.String())
+}
+
+func TestRevokeAPIKeyRoute(t *testing.T) {
+	th := newTestHandler(authtest.As(7, types.RoleCustomer))
+	created, _ := th.service.Create(7, "ci", []types.Scope{types.ScopeOrdersRead})
+	other, _ := th.service.Create(8, "ci", []types.Scope{types.ScopeOrdersRead})
+
+	rr := th.do(t, http.MethodDelete, "/users/me/api-keys/2", "")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.JSONEq(t, `{"error":"`+utils.ErrAPIKeyNotFound+`"}`, rr.Body.String())
+	_, err := th.service.Authenticate(other.Key)
+	assert.NoError(t, err)
+
+	rr = th.do(t, http.MethodDelete, "/users/me/api-keys/1", "")
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	_, err = th.service.Authenticate(created.Key)
+	assert.Equal(t, ErrInvalidKey, err)
+
+	rr = th.do(t, http.MethodDelete, "/users/me/api-keys/1", "")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = th.do(t, http.MethodDelete, "/users/me/api-keys/abc", "")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestAPIKeysCannotManageKeys(t *testing.T) {
+	th := newTestHandler(&authtest.Authenticator{Identity: &auth.Identity{
+		UserID:   7,
+		Role:     types.RoleCustomer,
+		APIKeyID: 1,
+		Scopes:   []types.Scope{types.ScopeProductsWrite, types.ScopeOrdersRead, types.ScopeOrdersWrite},
+	}})
+
+	rr := th.do(t, http.MethodPost, "/users/me/api-keys", `{"name":"ci","scopes":["orders:read"]}`)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Empty(t, th.store.keys)
+
+	rr = th.do(t, http.MethodGet, "/users/me/api-keys", "")
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+}
+
+func TestAPIKeyRoutesRequireAuthentication(t *testing.T) {
+	th := newTestHandler(authtest.Anonymous())
+
+	rr := th.do(t, http.MethodGet, "/users/me/api-keys", "")
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
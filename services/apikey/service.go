@@ -0,0 +1,132 @@
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/loloDawit/ecom/services/auth"
+	"github.com/loloDawit/ecom/types"
+)
+
+const (
+	// KeyPrefix starts every key, so leaked keys are easy to recognise.
+	KeyPrefix = "ecom_"
+	// prefixBytes is the random part of the lookup prefix that follows
+	// KeyPrefix.
+	prefixBytes = 6
+	// LastUsedResolution is how far lastUsedAt may lag behind, which saves
+	// a write on every request.
+	LastUsedResolution = time.Minute
+)
+
+// ErrInvalidKey is returned for keys that are malformed, unknown or
+// revoked. Its message is shown to the caller.
+var ErrInvalidKey = errors.New("Invalid API key")
+
+// ErrDisabledUser rejects the keys of a user an admin disabled. Access
+// tokens need no such check: disabling a user revokes their tokens.
+var ErrDisabledUser = errors.New("Account has been disabled")
+
+// Service issues API keys and authenticates requests made with them.
+type Service struct {
+	store types.APIKeyStore
+	users types.UserStore
+	now   func() time.Time
+}
+
+func NewService(store types.APIKeyStore, users types.UserStore) *Service {
+	return &Service{store: store, users: users, now: time.Now}
+}
+
+// Create issues a key of the form ecom_<prefix>_<secret>. The key is only
+// returned here; afterwards it cannot be recovered.
+func (s *Service) Create(userID int, name string, scopes []types.Scope) (*types.CreatedAPIKey, error) {
+	buf := make([]byte, prefixBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	prefix := hex.EncodeToString(buf)
+
+	secret, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	key := KeyPrefix + prefix + "_" + secret
+
+	record := types.APIKey{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    prefix,
+		KeyHash:   auth.HashOpaqueToken(key),
+		Scopes:    scopes,
+		CreatedAt: s.now().UTC(),
+	}
+	record.ID, err = s.store.CreateAPIKey(record)
+	if err != nil {
+		return nil, err
+	}
+
+	return &types.CreatedAPIKey{APIKey: record, Key: key}, nil
+}
+
+func (s *Service) List(userID int) ([]types.APIKey, error) {
+	return s.store.GetAPIKeysByUserID(userID)
+}
+
+// Revoke returns sql.ErrNoRows unless the user holds an active key with
+// the id.
+func (s *Service) Revoke(userID int, id int) error {
+	return s.store.RevokeAPIKey(userID, id, s.now())
+}
+
+// Authenticate identifies the owner of the key, with their current role
+// and the scopes of the key.
+func (s *Service) Authenticate(key string) (*auth.Identity, error) {
+	rest, ok := strings.CutPrefix(key, KeyPrefix)
+	if !ok {
+		return nil, ErrInvalidKey
+	}
+	prefix, _, ok := strings.Cut(rest, "_")
+	if !ok || len(prefix) != 2*prefixBytes {
+		return nil, ErrInvalidKey
+	}
+
+	record, err := s.store.GetAPIKeyByPrefix(prefix)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidKey
+	}
+	if err != nil {
+		log.Printf("error getting api key %s: %v", prefix, err)
+		return nil, ErrInvalidKey
+	}
+	if subtle.ConstantTimeCompare([]byte(auth.HashOpaqueToken(key)), []byte(record.KeyHash)) != 1 || record.RevokedAt != nil {
+		return nil, ErrInvalidKey
+	}
+
+	user, err := s.users.GetUserByID(record.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidKey
+	}
+	if err != nil {
+		log.Printf("error getting owner of api key %d: %v", record.ID, err)
+		return nil, ErrInvalidKey
+	}
+	if user.DisabledAt != nil {
+		return nil, ErrDisabledUser
+	}
+
+	now := s.now()
+	if record.LastUsedAt == nil || now.Sub(*record.LastUsedAt) >= LastUsedResolution {
+		if err := s.store.TouchAPIKey(record.ID, now); err != nil {
+			log.Printf("error recording use of api key %d: %v", record.ID, err)
+		}
+	}
+
+	return &auth.Identity{UserID: user.ID, Role: user.Role, APIKeyID: record.ID, Scopes: record.Scopes}, nil
+}
@@ -0,0 +1,234 @@
+package apikey
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/loloDawit/ecom/services/auth"
+	"github.com/loloDawit/ecom/services/auth/authtest"
+	"github.com/loloDawit/ecom/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryStore is an in-memory APIKeyStore.
+type memoryStore struct {
+	keys    []*types.APIKey
+	touches int
+}
+
+func (m *memoryStore) CreateAPIKey(key types.APIKey) (int, error) {
+	key.ID = len(m.keys) + 1
+	m.keys = append(m.keys, &key)
+	return key.ID, nil
+}
+
+func (m *memoryStore) GetAPIKeysByUserID(userID int) ([]types.APIKey, error) {
+	keys := []types.APIKey{}
+	for _, key := range m.keys {
+		if key.UserID == userID && key.RevokedAt == nil {
+			keys = append(keys, *key)
+		}
+	}
+	return keys, nil
+}
+
+func (m *memoryStore) GetAPIKeyByPrefix(prefix string) (*types.APIKey, error) {
+	for _, key := range m.keys {
+		if key.Prefix == prefix {
+			copied := *key
+			return &copied, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *memoryStore) RevokeAPIKey(userID int, id int, now time.Time) error {
+	for _, key := range m.keys {
+		if key.ID == id && key.UserID == userID && key.RevokedAt == nil {
+			key.RevokedAt = &now
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func (m *memoryStore) TouchAPIKey(id int, now time.Time) error {
+	m.touches++
+	m.keys[id-1].LastUsedAt = &now
+	return nil
+}
+
+// mockUserStore finds every user except the deleted ones, as staff.
+type mockUserStore struct {
+	disabled map[int]bool
+	deleted  map[int]bool
+}
+
+func (m *mockUserStore) GetUserByEmail(email string) (*types.User, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (m *mockUserStore) CreateUser(user types.User) error {
+	return nil
+}
+
+func (m *mockUserStore) GetUserByID(id int) (*types.User, error) {
+	if m.deleted[id] {
+		return nil, sql.ErrNoRows
+	}
+	user := &types.User{ID: id, Role: types.RoleStaff}
+	if m.disabled[id] {
+		disabledAt := time.Now()
+		user.DisabledAt = &disabledAt
+	}
+	return user, nil
+}
+
+func (m *mockUserStore) UpdateUser(user types.User) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdatePassword(userID int, passwordHash string) error {
+	return nil
+}
+
+func (m *mockUserStore) DeleteUser(userID int, now time.Time) error {
+	return nil
+}
+
+func (m *mockUserStore) GetUsers(query types.UserQuery) ([]types.User, error) {
+	return nil, nil
+}
+
+func (m *mockUserStore) SetUserDisabled(userID int, disabledAt *time.Time) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdateUserRole(userID int, role types.Role) error {
+	return nil
+}
+
+func TestCreate(t *testing.T) {
+	store := &memoryStore{}
+	service := NewService(store, &mockUserStore{})
+
+	created, err := service.Create(7, "ci", []types.Scope{types.ScopeOrdersRead})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, created.ID)
+	assert.True(t, strings.HasPrefix(created.Key, KeyPrefix+created.Prefix+"_"))
+	assert.Len(t, created.Prefix, 12)
+
+	// only the hash of the key is stored
+	assert.Equal(t, auth.HashOpaqueToken(created.Key), store.keys[0].KeyHash)
+	assert.NotContains(t, store.keys[0].KeyHash, created.Key)
+
+	other, _ := service.Create(7, "ci", []types.Scope{types.ScopeOrdersRead})
+	assert.NotEqual(t, created.Prefix, other.Prefix)
+}
+
+func TestAuthenticate(t *testing.T) {
+	t.Run("Identifies the owner with the key's scopes", func(t *testing.T) {
+		store := &memoryStore{}
+		service := NewService(store, &mockUserStore{})
+		created, _ := service.Create(7, "ci", []types.Scope{types.ScopeProductsWrite})
+
+		identity, err := service.Authenticate(created.Key)
+		assert.NoError(t, err)
+		assert.Equal(t, &auth.Identity{UserID: 7, Role: types.RoleStaff, APIKeyID: 1, Scopes: []types.Scope{types.ScopeProductsWrite}}, identity)
+		assert.True(t, identity.HasScope(types.ScopeProductsWrite))
+		assert.False(t, identity.HasScope(types.ScopeOrdersRead))
+	})
+
+	t.Run("Records when the key was last used", func(t *testing.T) {
+		store := &memoryStore{}
+		service := NewService(store, &mockUserStore{})
+		now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+		service.now = func() time.Time { return now }
+		created, _ := service.Create(7, "ci", []types.Scope{types.ScopeOrdersRead})
+
+		_, err := service.Authenticate(created.Key)
+		assert.NoError(t, err)
+		assert.Equal(t, now, *store.keys[0].LastUsedAt)
+
+		// within the resolution the timestamp is left alone
+		service.now = func() time.Time { return now.Add(time.Second) }
+		_, err = service.Authenticate(created.Key)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, store.touches)
+
+		service.now = func() time.Time { return now.Add(LastUsedResolution) }
+		_, err = service.Authenticate(created.Key)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, store.touches)
+	})
+
+	t.Run("Rejects bad keys", func(t *testing.T) {
+		store := &memoryStore{}
+		service := NewService(store, &mockUserStore{})
+		created, _ := service.Create(7, "ci", []types.Scope{types.ScopeOrdersRead})
+
+		for _, key := range []string{
+			"",
+			"not-a-key",
+			KeyPrefix + "unknown_secret",
+			KeyPrefix + created.Prefix + "_wrong",
+			strings.TrimPrefix(created.Key, KeyPrefix),
+		} {
+			_, err := service.Authenticate(key)
+			assert.Equal(t, ErrInvalidKey, err, key)
+		}
+		assert.Equal(t, 0, store.touches)
+	})
+
+	t.Run("Rejects revoked keys", func(t *testing.T) {
+		service := NewService(&memoryStore{}, &mockUserStore{})
+		created, _ := service.Create(7, "ci", []types.Scope{types.ScopeOrdersRead})
+		assert.NoError(t, service.Revoke(7, created.ID))
+
+		_, err := service.Authenticate(created.Key)
+		assert.Equal(t, ErrInvalidKey, err)
+	})
+
+	t.Run("Rejects keys of disabled or deleted users", func(t *testing.T) {
+		service := NewService(&memoryStore{}, &mockUserStore{disabled: map[int]bool{7: true}, deleted: map[int]bool{8: true}})
+		disabled, _ := service.Create(7, "ci", []types.Scope{types.ScopeOrdersRead})
+		deleted, _ := service.Create(8, "ci", []types.Scope{types.ScopeOrdersRead})
+
+		_, err := service.Authenticate(disabled.Key)
+		assert.Equal(t, ErrDisabledUser, err)
+		_, err = service.Authenticate(deleted.Key)
+		assert.Equal(t, ErrInvalidKey, err)
+	})
+}
+
+func TestAuthenticator(t *testing.T) {
+	service := NewService(&memoryStore{}, &mockUserStore{})
+	created, _ := service.Create(7, "ci", []types.Scope{types.ScopeOrdersRead})
+	authenticator := NewAuthenticator(service, authtest.As(9, types.RoleCustomer))
+
+	newRequest := func(header string) *http.Request {
+		req := httptest.NewRequest("GET", "/orders", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		return req
+	}
+
+	identity, err := authenticator.Authenticate(newRequest("ApiKey " + created.Key))
+	assert.NoError(t, err)
+	assert.Equal(t, 7, identity.UserID)
+	assert.Equal(t, 1, identity.APIKeyID)
+
+	_, err = authenticator.Authenticate(newRequest("ApiKey wrong"))
+	assert.Equal(t, ErrInvalidKey, err)
+
+	// anything else goes to the token authenticator
+	identity, err = authenticator.Authenticate(newRequest("Bearer token"))
+	assert.NoError(t, err)
+	assert.Equal(t, 9, identity.UserID)
+	assert.Zero(t, identity.APIKeyID)
+}
@@ -0,0 +1,106 @@
+package apikey
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/loloDawit/ecom/config"
+	"github.com/loloDawit/ecom/types"
+)
+
+type APIKeyStore struct {
+	db  *sql.DB
+	cfg *config.Config
+}
+
+func NewAPIKeyStore(db *sql.DB, cfg *config.Config) *APIKeyStore {
+	return &APIKeyStore{db: db, cfg: cfg}
+}
+
+const apiKeyColumns = "id, userId, name, prefix, keyHash, scopes, lastUsedAt, revokedAt, createdAt"
+
+// scanAPIKey reads apiKeyColumns from a *sql.Row or *sql.Rows. Scopes are
+// stored space-separated.
+func scanAPIKey(row interface{ Scan(...any) error }) (*types.APIKey, error) {
+	key := new(types.APIKey)
+	var scopes string
+	err := row.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.KeyHash, &scopes, &key.LastUsedAt, &key.RevokedAt, &key.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	for _, scope := range strings.Fields(scopes) {
+		key.Scopes = append(key.Scopes, types.Scope(scope))
+	}
+	return key, nil
+}
+
+func joinScopes(scopes []types.Scope) string {
+	parts := make([]string, len(scopes))
+	for i, scope := range scopes {
+		parts[i] = string(scope)
+	}
+	return strings.Join(parts, " ")
+}
+
+func (s *APIKeyStore) CreateAPIKey(key types.APIKey) (int, error) {
+	var id int
+	err := s.db.QueryRow(
+		"INSERT INTO api_keys (userId, name, prefix, keyHash, scopes, createdAt) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id",
+		key.UserID, key.Name, key.Prefix, key.KeyHash, joinScopes(key.Scopes), key.CreatedAt,
+	).Scan(&id)
+	return id, err
+}
+
+func (s *APIKeyStore) GetAPIKeysByUserID(userID int) ([]types.APIKey, error) {
+	rows, err := s.db.Query(
+		"SELECT "+apiKeyColumns+" FROM api_keys WHERE userId = $1 AND revokedAt IS NULL ORDER BY createdAt DESC, id DESC",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []types.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+func (s *APIKeyStore) GetAPIKeyByPrefix(prefix string) (*types.APIKey, error) {
+	return scanAPIKey(s.db.QueryRow("SELECT "+apiKeyColumns+" FROM api_keys WHERE prefix = $1", prefix))
+}
+
+func (s *APIKeyStore) RevokeAPIKey(userID int, id int, now time.Time) error {
+	result, err := s.db.Exec("UPDATE api_keys SET revokedAt = $1 WHERE id = $2 AND userId = $3 AND revokedAt IS NULL", now, id, userID)
+	if err != nil {
+		return err
+	}
+	return requireRowsAffected(result)
+}
+
+func (s *APIKeyStore) TouchAPIKey(id int, now time.Time) error {
+	_, err := s.db.Exec("UPDATE api_keys SET lastUsedAt = $1 WHERE id = $2", now, id)
+	return err
+}
+
+func requireRowsAffected(result sql.Result) error {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
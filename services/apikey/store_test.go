@@ -0,0 +1,129 @@
+package apikey
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/loloDawit/ecom/config"
+	"github.com/loloDawit/ecom/types"
+	"github.com/stretchr/testify/assert"
+)
+
+var apiKeyRows = []string{"id", "userId", "name", "prefix", "keyHash", "scopes", "lastUsedAt", "revokedAt", "createdAt"}
+
+func TestCreateAPIKey(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	store := NewAPIKeyStore(db, &config.Config{})
+	now := time.Now()
+
+	mock.ExpectQuery("INSERT INTO api_keys \\(userId, name, prefix, keyHash, scopes, createdAt\\) VALUES \\(\\$1, \\$2, \\$3, \\$4, \\$5, \\$6\\) RETURNING id").
+		WithArgs(7, "ci", "0123456789ab", "hash", "products:write orders:read", now).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+
+	id, err := store.CreateAPIKey(types.APIKey{
+		UserID:    7,
+		Name:      "ci",
+		Prefix:    "0123456789ab",
+		KeyHash:   "hash",
+		Scopes:    []types.Scope{types.ScopeProductsWrite, types.ScopeOrdersRead},
+		CreatedAt: now,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, id)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetAPIKeys(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	store := NewAPIKeyStore(db, &config.Config{})
+	now := time.Now()
+
+	t.Run("By user", func(t *testing.T) {
+		mock.ExpectQuery("SELECT (.+) FROM api_keys WHERE userId = \\$1 AND revokedAt IS NULL ORDER BY createdAt DESC, id DESC").
+			WithArgs(7).
+			WillReturnRows(sqlmock.NewRows(apiKeyRows).
+				AddRow(3, 7, "ci", "0123456789ab", "hash", "orders:read orders:write", now, nil, now))
+
+		keys, err := store.GetAPIKeysByUserID(7)
+		assert.NoError(t, err)
+		assert.Len(t, keys, 1)
+		assert.Equal(t, []types.Scope{types.ScopeOrdersRead, types.ScopeOrdersWrite}, keys[0].Scopes)
+		assert.NotNil(t, keys[0].LastUsedAt)
+	})
+
+	t.Run("No keys", func(t *testing.T) {
+		mock.ExpectQuery("SELECT (.+) FROM api_keys WHERE userId = \\$1").
+			WithArgs(7).
+			WillReturnRows(sqlmock.NewRows(apiKeyRows))
+
+		keys, err := store.GetAPIKeysByUserID(7)
+		assert.NoError(t, err)
+		assert.NotNil(t, keys)
+		assert.Empty(t, keys)
+	})
+
+	t.Run("By prefix", func(t *testing.T) {
+		mock.ExpectQuery("SELECT (.+) FROM api_keys WHERE prefix = \\$1").
+			WithArgs("0123456789ab").
+			WillReturnRows(sqlmock.NewRows(apiKeyRows).
+				AddRow(3, 7, "ci", "0123456789ab", "hash", "products:write", nil, nil, now))
+
+		key, err := store.GetAPIKeyByPrefix("0123456789ab")
+		assert.NoError(t, err)
+		assert.Equal(t, 7, key.UserID)
+		assert.Equal(t, []types.Scope{types.ScopeProductsWrite}, key.Scopes)
+		assert.Nil(t, key.LastUsedAt)
+	})
+
+	t.Run("Unknown prefix", func(t *testing.T) {
+		mock.ExpectQuery("SELECT (.+) FROM api_keys WHERE prefix = \\$1").
+			WithArgs("unknown").
+			WillReturnError(sql.ErrNoRows)
+
+		_, err := store.GetAPIKeyByPrefix("unknown")
+		assert.Equal(t, sql.ErrNoRows, err)
+	})
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRevokeAPIKey(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	store := NewAPIKeyStore(db, &config.Config{})
+	now := time.Now()
+
+	t.Run("Revokes the key", func(t *testing.T) {
+		mock.ExpectExec("UPDATE api_keys SET revokedAt = \\$1 WHERE id = \\$2 AND userId = \\$3 AND revokedAt IS NULL").
+			WithArgs(now, 3, 7).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		assert.NoError(t, store.RevokeAPIKey(7, 3, now))
+	})
+
+	t.Run("Another user's or already revoked", func(t *testing.T) {
+		mock.ExpectExec("UPDATE api_keys SET revokedAt").
+			WithArgs(now, 3, 8).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		assert.Equal(t, sql.ErrNoRows, store.RevokeAPIKey(8, 3, now))
+	})
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/loloDawit/ecom/types"
+	"github.com/loloDawit/ecom/utils"
+)
+
+// Identity is the caller an Authenticator recognised. TokenID, IssuedAt and
+// ExpiresAt describe the credential used and are zero when it has none.
+// APIKeyID and Scopes are set for callers using an API key.
+type Identity struct {
+	UserID    int
+	Role      types.Role
+	TokenID   string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+	APIKeyID  int
+	Scopes    []types.Scope
+}
+
+// HasScope reports whether the identity was granted scope.
+func (i Identity) HasScope(scope types.Scope) bool {
+	for _, granted := range i.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticator identifies the caller of a request. The message of a
+// returned error is sent back to the client with a 401, so it must not leak
+// anything about why a credential was rejected beyond what is already public.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Identity, error)
+}
+
+// Middleware rejects requests the authenticator cannot identify and stores
+// the caller's identity in the request context for the next handler. API
+// keys are refused; routes open to them use ScopedMiddleware.
+func Middleware(authenticator Authenticator) func(http.HandlerFunc) http.HandlerFunc {
+	return ScopedMiddleware(authenticator, "")
+}
+
+// ScopedMiddleware is Middleware for routes that API keys granted scope may
+// call as well.
+func ScopedMiddleware(authenticator Authenticator, scope types.Scope) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			identity, err := authenticator.Authenticate(r)
+			if err != nil {
+				utils.WriteError(w, http.StatusUnauthorized, err.Error())
+				return
+			}
+			if identity.APIKeyID != 0 && (scope == "" || !identity.HasScope(scope)) {
+				utils.WriteError(w, http.StatusForbidden, utils.ErrInsufficientScope)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(WithIdentity(r.Context(), *identity)))
+		}
+	}
+}
+
+// WithIdentity returns a copy of ctx carrying the identity, where
+// GetUserIDFromContext, GetRoleFromContext and GetIdentityFromContext will
+// find it.
+func WithIdentity(ctx context.Context, identity Identity) context.Context {
+	ctx = context.WithValue(ctx, types.UserIDKey, strconv.Itoa(identity.UserID))
+	ctx = context.WithValue(ctx, types.IdentityKey, identity)
+	return context.WithValue(ctx, types.UserRoleKey, identity.Role)
+}
+
+// GetIdentityFromContext returns the identity Middleware authenticated.
+func GetIdentityFromContext(ctx context.Context) (Identity, error) {
+	identity, ok := ctx.Value(types.IdentityKey).(Identity)
+	if !ok {
+		return Identity{}, fmt.Errorf("identity not found in context")
+	}
+	return identity, nil
+}
@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/loloDawit/ecom/types"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeAuthenticator struct {
+	identity *Identity
+	err      error
+}
+
+func (f *fakeAuthenticator) Authenticate(r *http.Request) (*Identity, error) {
+	return f.identity, f.err
+}
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name             string
+		authenticator    *fakeAuthenticator
+		expectedStatus   int
+		expectedResponse string
+		expectedUserID   int
+		expectedRole     types.Role
+	}{
+		{
+			name:           "Authenticated",
+			authenticator:  &fakeAuthenticator{identity: &Identity{UserID: 7, Role: types.RoleStaff}},
+			expectedStatus: http.StatusOK,
+			expectedUserID: 7,
+			expectedRole:   types.RoleStaff,
+		},
+		{
+			name:             "Rejected",
+			authenticator:    &fakeAuthenticator{err: errors.New("Invalid token")},
+			expectedStatus:   http.StatusUnauthorized,
+			expectedResponse: `{"error":"Invalid token"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := Middleware(tt.authenticator)(func(w http.ResponseWriter, r *http.Request) {
+				userID, err := GetUserIDFromContext(r.Context())
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedUserID, userID)
+				assert.Equal(t, tt.expectedRole, GetRoleFromContext(r.Context()))
+				w.WriteHeader(http.StatusOK)
+			})
+
+			req, err := http.NewRequest("GET", "/", nil)
+			assert.NoError(t, err)
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedResponse != "" {
+				assert.JSONEq(t, tt.expectedResponse, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestScopedMiddleware(t *testing.T) {
+	apiKey := &Identity{UserID: 7, Role: types.RoleStaff, APIKeyID: 3, Scopes: []types.Scope{types.ScopeOrdersRead}}
+
+	tests := []struct {
+		name           string
+		identity       *Identity
+		scope          types.Scope
+		expectedStatus int
+	}{
+		{
+			name:           "Token on a scoped route",
+			identity:       &Identity{UserID: 7, Role: types.RoleStaff},
+			scope:          types.ScopeOrdersRead,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "API key with the scope",
+			identity:       apiKey,
+			scope:          types.ScopeOrdersRead,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "API key without the scope",
+			identity:       apiKey,
+			scope:          types.ScopeProductsWrite,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "API key on a route without a scope",
+			identity:       apiKey,
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := ScopedMiddleware(&fakeAuthenticator{identity: tt.identity}, tt.scope)(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/loloDawit/ecom/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJWKS(t *testing.T) {
+	withKeyFiles(t)
+
+	keys, err := LoadKeySet(config.JWTConfig{SigningKey: "b", Keys: []config.JWTKeyConfig{
+		{ID: "a", Algorithm: "RS256", PublicKeyFile: "rsa.pub.pem"},
+		{ID: "b", Algorithm: "EdDSA", PrivateKeyFile: "ed.pem"},
+	}})
+	assert.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	JWKSHandler(keys)(rr, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+
+	var jwks JWKS
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &jwks))
+	assert.Len(t, jwks.Keys, 2)
+
+	// the published keys reproduce the ones we verify with
+	rsaKey := jwks.Keys[0]
+	assert.Equal(t, JWK{KeyType: "RSA", KeyID: "a", Use: "sig", Algorithm: "RS256", N: rsaKey.N, E: "AQAB"}, rsaKey)
+	n, _ := base64.RawURLEncoding.DecodeString(rsaKey.N)
+	assert.Equal(t, 0, keys.keys["a"].verifyKey.(*rsa.PublicKey).N.Cmp(new(big.Int).SetBytes(n)))
+
+	edKey := jwks.Keys[1]
+	assert.Equal(t, JWK{KeyType: "OKP", KeyID: "b", Use: "sig", Algorithm: "EdDSA", Curve: "Ed25519", X: edKey.X}, edKey)
+	x, _ := base64.RawURLEncoding.DecodeString(edKey.X)
+	assert.Equal(t, keys.keys["b"].verifyKey, ed25519.PublicKey(x))
+}
+
+func TestJWKSNeverPublishesSecrets(t *testing.T) {
+	rr := httptest.NewRecorder()
+	JWKSHandler(NewHMACKeySet([]byte("secret")))(rr, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"keys":[]}`, rr.Body.String())
+}
@@ -2,7 +2,12 @@ package auth
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"log"
+	"math"
 	"net/http"
 	"strconv"
 	"strings"
@@ -10,87 +15,145 @@ import (
 
 	"github.com/golang-jwt/jwt"
 	"github.com/loloDawit/ecom/types"
-	"github.com/loloDawit/ecom/utils"
 )
 
-func GenerateToken(secret []byte, userID int, expiration time.Duration) (string, error) {
-	if len(secret) == 0 {
-		return "", jwt.ErrInvalidKey
+// GenerateToken issues an HS256 token signed with a shared secret.
+func GenerateToken(secret []byte, userID int, role types.Role, expiration time.Duration) (string, error) {
+	return NewHMACKeySet(secret).GenerateToken(userID, role, expiration)
+}
+
+var (
+	errMissingAuthorization = errors.New("Authorization header is missing")
+	errMissingToken         = errors.New("Token is missing")
+	errInvalidToken         = errors.New("Invalid token")
+	errInvalidClaims        = errors.New("Invalid token claims")
+	errRevokedToken         = errors.New("Token has been revoked")
+)
+
+// JWTAuthenticator accepts bearer tokens signed by any key of its key set.
+type JWTAuthenticator struct {
+	keys        *KeySet
+	revocations types.TokenRevocationStore
+}
+
+// NewJWTAuthenticator accepts HS256 tokens signed with a shared secret.
+func NewJWTAuthenticator(secret []byte) *JWTAuthenticator {
+	return NewKeySetAuthenticator(NewHMACKeySet(secret))
+}
+
+func NewKeySetAuthenticator(keys *KeySet) *JWTAuthenticator {
+	return &JWTAuthenticator{keys: keys}
+}
+
+// WithRevocationStore returns a copy of the authenticator that also rejects
+// tokens revoked through the store.
+func (a *JWTAuthenticator) WithRevocationStore(store types.TokenRevocationStore) *JWTAuthenticator {
+	copied := *a
+	copied.revocations = store
+	return &copied
+}
+
+func (a *JWTAuthenticator) Authenticate(r *http.Request) (*Identity, error) {
+	// Extract the token from the Authorization header
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		return nil, errMissingAuthorization
+	}
+
+	tokenString := strings.TrimSpace(strings.TrimPrefix(authHeader, "Bearer "))
+	if tokenString == "" {
+		return nil, errMissingToken
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"userID": strconv.Itoa(userID),
-		"exp":    time.Now().Add(expiration).Unix(),
-	})
+	// Parse and validate the token
+	token, err := jwt.Parse(tokenString, a.keys.keyFunc)
+	if err != nil || !token.Valid {
+		return nil, errInvalidToken
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errInvalidClaims
+	}
 
-	tokenString, err := token.SignedString(secret)
+	userIDClaim, ok := claims["userID"].(string)
+	if !ok {
+		return nil, errInvalidClaims
+	}
+	userID, err := strconv.Atoi(userIDClaim)
 	if err != nil {
-		return "", err
+		return nil, errInvalidClaims
+	}
+
+	// tokens issued before roles existed carry no role claim
+	role, _ := claims["role"].(string)
+	if role == "" {
+		role = string(types.RoleCustomer)
+	}
+
+	identity := &Identity{UserID: userID, Role: types.Role(role)}
+	identity.TokenID, _ = claims["jti"].(string)
+	if iat, ok := claims["iat"].(float64); ok {
+		identity.IssuedAt = time.UnixMicro(int64(math.Round(iat * 1e6)))
+	}
+	if exp, ok := claims["exp"].(float64); ok {
+		identity.ExpiresAt = time.Unix(int64(exp), 0)
+	}
+
+	if a.revocations != nil {
+		if err := a.checkRevoked(identity); err != nil {
+			return nil, err
+		}
+	}
+
+	return identity, nil
+}
+
+// checkRevoked rejects a token that was revoked on its own or issued before
+// the user last logged out everywhere. Tokens are refused if the store
+// cannot be reached.
+func (a *JWTAuthenticator) checkRevoked(identity *Identity) error {
+	if identity.TokenID != "" {
+		revoked, err := a.revocations.IsTokenRevoked(identity.TokenID)
+		if err != nil {
+			log.Printf("error checking token revocation: %v", err)
+			return errInvalidToken
+		}
+		if revoked {
+			return errRevokedToken
+		}
 	}
 
-	return tokenString, nil
+	revokedBefore, err := a.revocations.GetUserTokensRevokedBefore(identity.UserID)
+	if err != nil {
+		log.Printf("error checking token revocation for user %d: %v", identity.UserID, err)
+		return errInvalidToken
+	}
+	if identity.IssuedAt.Before(revokedBefore) {
+		return errRevokedToken
+	}
+
+	return nil
+}
+
+func newTokenID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
 }
 
 // JWTMiddleware is a middleware function for validating JWT tokens
 func JWTMiddleware(secret []byte) func(http.HandlerFunc) http.HandlerFunc {
-	return func(next http.HandlerFunc) http.HandlerFunc {
-		return func(w http.ResponseWriter, r *http.Request) {
-			// Check for a special header to bypass setting the user ID
-			if r.Header.Get("X-Bypass-UserID") == "true" {
-				next.ServeHTTP(w, r)
-				return
-			}
-
-			// Extract the token from the Authorization header
-			authHeader := r.Header.Get("Authorization")
-			if authHeader == "" {
-				utils.WriteError(w, http.StatusUnauthorized, "Authorization header is missing")
-				return
-			}
-
-			tokenString := strings.TrimSpace(strings.TrimPrefix(authHeader, "Bearer "))
-			if tokenString == "" {
-				utils.WriteError(w, http.StatusUnauthorized, "Token is missing")
-				return
-			}
-
-			// Parse and validate the token
-			token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-				// Validate the algorithm
-				if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-					return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-				}
-				return secret, nil
-			})
-
-			if err != nil {
-				fmt.Printf("Error parsing token: %v\n", err)
-				utils.WriteError(w, http.StatusUnauthorized, "Invalid token")
-				return
-			}
-
-			if !token.Valid {
-				fmt.Printf("Token is not valid: %v\n", token)
-				utils.WriteError(w, http.StatusUnauthorized, "Invalid token")
-				return
-			}
-
-			// Add user information to the request context if needed
-			if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-				userID, ok := claims["userID"].(string)
-				if !ok {
-					utils.WriteError(w, http.StatusUnauthorized, "Invalid token claims")
-					return
-				}
-				ctx := context.WithValue(r.Context(), types.UserIDKey, userID)
-				r = r.WithContext(ctx)
-			} else {
-				utils.WriteError(w, http.StatusUnauthorized, "Invalid token claims")
-				return
-			}
-
-			// Call the next handler
-			next.ServeHTTP(w, r)
-		}
+	return Middleware(NewJWTAuthenticator(secret))
+}
+
+// GetUserIDFromContext returns the ID of the user Middleware authenticated.
+func GetUserIDFromContext(ctx context.Context) (int, error) {
+	userIDStr, ok := ctx.Value(types.UserIDKey).(string)
+	if !ok || userIDStr == "" {
+		return 0, fmt.Errorf("user ID not found in context")
 	}
+	return strconv.Atoi(userIDStr)
 }
@@ -1,6 +1,8 @@
 package auth
 
 import (
+	"errors"
+	"math"
 	"net/http"
 	"net/http/httptest"
 	"strconv"
@@ -46,7 +48,7 @@ func TestGenerateToken(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := GenerateToken(tt.secret, tt.userID, tt.expiration)
+			got, err := GenerateToken(tt.secret, tt.userID, types.RoleStaff, tt.expiration)
 
 			if (err != nil) != tt.wantErr {
 				t.Errorf("GenerateToken() error = %v, wantErr %v", err, tt.wantErr)
@@ -60,6 +62,9 @@ func TestGenerateToken(t *testing.T) {
 
 				if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
 					assert.Equal(t, strconv.Itoa(tt.userID), claims["userID"])
+					assert.Equal(t, "staff", claims["role"])
+					assert.Len(t, claims["jti"], 32)
+					assert.WithinDuration(t, time.Now(), time.UnixMicro(int64(claims["iat"].(float64)*1e6)), time.Second*5)
 					assert.WithinDuration(t, time.Now().Add(tt.expiration), time.Unix(int64(claims["exp"].(float64)), 0), time.Second*5)
 				} else {
 					t.Errorf("Token is invalid or claims are not as expected")
@@ -123,7 +128,7 @@ func TestJWTMiddleware(t *testing.T) {
 			expectUserIDInCtx: true,
 		},
 		{
-			name: "Bypass User ID",
+			name: "Bypass header is ignored",
 			authHeader: func() string {
 				token, _ := generateToken(secret, "12345")
 				return "Bearer " + token
@@ -131,6 +136,25 @@ func TestJWTMiddleware(t *testing.T) {
 			bypassUserID:      true,
 			expectedStatus:    http.StatusOK,
 			expectedResponse:  "",
+			expectUserIDInCtx: true,
+		},
+		{
+			name:              "Bypass header without a token",
+			authHeader:        "",
+			bypassUserID:      true,
+			expectedStatus:    http.StatusUnauthorized,
+			expectedResponse:  `{"error":"Authorization header is missing"}`,
+			expectUserIDInCtx: false,
+		},
+		{
+			name: "Non-numeric user ID",
+			authHeader: func() string {
+				token, _ := generateToken(secret, "abc")
+				return "Bearer " + token
+			}(),
+			bypassUserID:      false,
+			expectedStatus:    http.StatusUnauthorized,
+			expectedResponse:  `{"error":"Invalid token claims"}`,
 			expectUserIDInCtx: false,
 		},
 	}
@@ -166,3 +190,90 @@ func TestJWTMiddleware(t *testing.T) {
 		})
 	}
 }
+
+type fakeRevocations struct {
+	revoked       map[string]bool
+	revokedBefore time.Time
+	err           error
+}
+
+func (f *fakeRevocations) RevokeToken(tokenID string, userID int, expiresAt time.Time) error {
+	return nil
+}
+
+func (f *fakeRevocations) IsTokenRevoked(tokenID string) (bool, error) {
+	return f.revoked[tokenID], f.err
+}
+
+func (f *fakeRevocations) RevokeUserTokens(userID int, issuedBefore time.Time) error {
+	return nil
+}
+
+func (f *fakeRevocations) GetUserTokensRevokedBefore(userID int) (time.Time, error) {
+	return f.revokedBefore, f.err
+}
+
+func TestJWTAuthenticatorRevocations(t *testing.T) {
+	secret := []byte("my_secret_key")
+	token, err := GenerateToken(secret, 7, types.RoleCustomer, time.Minute)
+	assert.NoError(t, err)
+	parsed, _ := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) { return secret, nil })
+	jti := parsed.Claims.(jwt.MapClaims)["jti"].(string)
+	issued := time.UnixMicro(int64(math.Round(parsed.Claims.(jwt.MapClaims)["iat"].(float64) * 1e6)))
+
+	tests := []struct {
+		name          string
+		revocations   *fakeRevocations
+		expectedError error
+	}{
+		{
+			name:        "Not revoked",
+			revocations: &fakeRevocations{},
+		},
+		{
+			name:          "Token revoked",
+			revocations:   &fakeRevocations{revoked: map[string]bool{jti: true}},
+			expectedError: errRevokedToken,
+		},
+		{
+			name:          "Issued before the user logged out everywhere",
+			revocations:   &fakeRevocations{revokedBefore: time.Now().Add(time.Minute)},
+			expectedError: errRevokedToken,
+		},
+		{
+			name:        "Issued after the user logged out everywhere",
+			revocations: &fakeRevocations{revokedBefore: time.Now().Add(-time.Minute)},
+		},
+		{
+			name:          "Issued a microsecond before the cutoff",
+			revocations:   &fakeRevocations{revokedBefore: issued.Add(time.Microsecond)},
+			expectedError: errRevokedToken,
+		},
+		{
+			name:        "Issued at the cutoff",
+			revocations: &fakeRevocations{revokedBefore: issued},
+		},
+		{
+			name:          "Store unavailable",
+			revocations:   &fakeRevocations{err: errors.New("connection refused")},
+			expectedError: errInvalidToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authenticator := NewJWTAuthenticator(secret).WithRevocationStore(tt.revocations)
+
+			req, _ := http.NewRequest("GET", "/", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+
+			identity, err := authenticator.Authenticate(req)
+			assert.Equal(t, tt.expectedError, err)
+			if tt.expectedError == nil {
+				assert.Equal(t, 7, identity.UserID)
+				assert.Equal(t, jti, identity.TokenID)
+				assert.WithinDuration(t, time.Now().Add(time.Minute), identity.ExpiresAt, time.Second*5)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/loloDawit/ecom/config"
+	"github.com/loloDawit/ecom/types"
+)
+
+var readKeyFile = os.ReadFile
+
+// signingKey is a key tokens are verified with and, when it has a private
+// half, signed with.
+type signingKey struct {
+	id        string
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// KeySet holds the keys tokens are signed and verified with. Tokens are
+// signed with a single key and carry its ID in the kid header; every key in
+// the set verifies tokens carrying its kid.
+type KeySet struct {
+	signing *signingKey
+	keys    map[string]*signingKey
+}
+
+// NewHMACKeySet returns a key set that signs and verifies HS256 tokens with
+// a shared secret. Its tokens carry no kid.
+func NewHMACKeySet(secret []byte) *KeySet {
+	key := &signingKey{method: jwt.SigningMethodHS256, signKey: secret, verifyKey: secret}
+	return &KeySet{signing: key, keys: map[string]*signingKey{"": key}}
+}
+
+// LoadKeySet reads the keys configured in cfg, falling back to the shared
+// secret when there are none.
+func LoadKeySet(cfg config.JWTConfig) (*KeySet, error) {
+	if len(cfg.Keys) == 0 {
+		return NewHMACKeySet([]byte(cfg.Secret)), nil
+	}
+
+	set := &KeySet{keys: make(map[string]*signingKey, len(cfg.Keys))}
+	for _, keyConfig := range cfg.Keys {
+		if keyConfig.ID == "" {
+			return nil, fmt.Errorf("jwt key is missing a kid")
+		}
+		if _, ok := set.keys[keyConfig.ID]; ok {
+			return nil, fmt.Errorf("jwt key %q is configured twice", keyConfig.ID)
+		}
+
+		key, err := loadKey(keyConfig)
+		if err != nil {
+			return nil, fmt.Errorf("could not load jwt key %q: %w", keyConfig.ID, err)
+		}
+		set.keys[key.id] = key
+	}
+
+	signing, ok := set.keys[cfg.SigningKey]
+	if !ok {
+		return nil, fmt.Errorf("jwt signing key %q is not configured", cfg.SigningKey)
+	}
+	if signing.signKey == nil {
+		return nil, fmt.Errorf("jwt signing key %q has no private key", cfg.SigningKey)
+	}
+	set.signing = signing
+
+	return set, nil
+}
+
+func loadKey(cfg config.JWTKeyConfig) (*signingKey, error) {
+	file := cfg.PrivateKeyFile
+	if file == "" {
+		file = cfg.PublicKeyFile
+	}
+	if file == "" {
+		return nil, fmt.Errorf("private_key_file or public_key_file is required")
+	}
+
+	pem, err := readKeyFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &signingKey{id: cfg.ID}
+	switch cfg.Algorithm {
+	case jwt.SigningMethodRS256.Alg():
+		key.method = jwt.SigningMethodRS256
+		if cfg.PrivateKeyFile != "" {
+			private, err := jwt.ParseRSAPrivateKeyFromPEM(pem)
+			if err != nil {
+				return nil, err
+			}
+			key.signKey, key.verifyKey = private, &private.PublicKey
+		} else {
+			key.verifyKey, err = jwt.ParseRSAPublicKeyFromPEM(pem)
+			if err != nil {
+				return nil, err
+			}
+		}
+	case jwt.SigningMethodEdDSA.Alg():
+		key.method = jwt.SigningMethodEdDSA
+		if cfg.PrivateKeyFile != "" {
+			private, err := jwt.ParseEdPrivateKeyFromPEM(pem)
+			if err != nil {
+				return nil, err
+			}
+			key.signKey, key.verifyKey = private, private.(ed25519.PrivateKey).Public()
+		} else {
+			key.verifyKey, err = jwt.ParseEdPublicKeyFromPEM(pem)
+			if err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", cfg.Algorithm)
+	}
+
+	return key, nil
+}
+
+// GenerateToken issues a token identifying the user and carrying their
+// role, signed with the set's signing key. Every token gets a unique jti so
+// that it can be revoked on its own.
+func (k *KeySet) GenerateToken(userID int, role types.Role, expiration time.Duration) (string, error) {
+	if secret, ok := k.signing.signKey.([]byte); ok && len(secret) == 0 {
+		return "", jwt.ErrInvalidKey
+	}
+
+	jti, err := newTokenID()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	token := jwt.NewWithClaims(k.signing.method, jwt.MapClaims{
+		"userID": strconv.Itoa(userID),
+		"role":   string(role),
+		"jti":    jti,
+		"iat":    issuedAt(now),
+		"exp":    now.Add(expiration).Unix(),
+	})
+	if k.signing.id != "" {
+		token.Header["kid"] = k.signing.id
+	}
+
+	return token.SignedString(k.signing.signKey)
+}
+
+// keyFunc picks the key named by the token's kid and refuses tokens signed
+// with any other algorithm than that key's.
+func (k *KeySet) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := k.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key: %q", kid)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.verifyKey, nil
+}
+
+// issuedAt renders the iat claim in seconds with microsecond precision, so a
+// token issued a moment before the user's revocation cutoff is still caught
+// by it. JWT allows fractional NumericDate values.
+func issuedAt(t time.Time) float64 {
+	return float64(t.UnixMicro()) / 1e6
+}
@@ -0,0 +1,232 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/loloDawit/ecom/config"
+	"github.com/loloDawit/ecom/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// testKeyFiles returns a readKeyFile replacement serving freshly generated
+// RSA and Ed25519 keys in the PEM forms openssl writes.
+func testKeyFiles(t *testing.T) func(string) ([]byte, error) {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	rsaPublic, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	assert.NoError(t, err)
+
+	edPublicKey, edPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	edPrivate, err := x509.MarshalPKCS8PrivateKey(edPrivateKey)
+	assert.NoError(t, err)
+	edPublic, err := x509.MarshalPKIXPublicKey(edPublicKey)
+	assert.NoError(t, err)
+
+	files := map[string][]byte{
+		"rsa.pem":     pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}),
+		"rsa.pub.pem": pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: rsaPublic}),
+		"ed.pem":      pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: edPrivate}),
+		"ed.pub.pem":  pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: edPublic}),
+	}
+	return func(name string) ([]byte, error) {
+		if data, ok := files[name]; ok {
+			return data, nil
+		}
+		return nil, fmt.Errorf("open %s: no such file or directory", name)
+	}
+}
+
+func withKeyFiles(t *testing.T) {
+	original := readKeyFile
+	readKeyFile = testKeyFiles(t)
+	t.Cleanup(func() { readKeyFile = original })
+}
+
+func authenticate(keys *KeySet, token string) (*Identity, error) {
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	return NewKeySetAuthenticator(keys).Authenticate(req)
+}
+
+func TestLoadKeySet(t *testing.T) {
+	withKeyFiles(t)
+
+	tests := []struct {
+		name          string
+		cfg           config.JWTConfig
+		expectedError string
+	}{
+		{
+			name: "RS256",
+			cfg: config.JWTConfig{SigningKey: "a", Keys: []config.JWTKeyConfig{
+				{ID: "a", Algorithm: "RS256", PrivateKeyFile: "rsa.pem"},
+			}},
+		},
+		{
+			name: "EdDSA with a verify-only RS256 key",
+			cfg: config.JWTConfig{SigningKey: "b", Keys: []config.JWTKeyConfig{
+				{ID: "a", Algorithm: "RS256", PublicKeyFile: "rsa.pub.pem"},
+				{ID: "b", Algorithm: "EdDSA", PrivateKeyFile: "ed.pem"},
+			}},
+		},
+		{
+			name: "Signing key without a private key",
+			cfg: config.JWTConfig{SigningKey: "a", Keys: []config.JWTKeyConfig{
+				{ID: "a", Algorithm: "EdDSA", PublicKeyFile: "ed.pub.pem"},
+			}},
+			expectedError: `jwt signing key "a" has no private key`,
+		},
+		{
+			name: "Unknown signing key",
+			cfg: config.JWTConfig{SigningKey: "b", Keys: []config.JWTKeyConfig{
+				{ID: "a", Algorithm: "RS256", PrivateKeyFile: "rsa.pem"},
+			}},
+			expectedError: `jwt signing key "b" is not configured`,
+		},
+		{
+			name: "Duplicate kid",
+			cfg: config.JWTConfig{SigningKey: "a", Keys: []config.JWTKeyConfig{
+				{ID: "a", Algorithm: "RS256", PrivateKeyFile: "rsa.pem"},
+				{ID: "a", Algorithm: "EdDSA", PrivateKeyFile: "ed.pem"},
+			}},
+			expectedError: `jwt key "a" is configured twice`,
+		},
+		{
+			name: "Key that does not match the algorithm",
+			cfg: config.JWTConfig{SigningKey: "a", Keys: []config.JWTKeyConfig{
+				{ID: "a", Algorithm: "RS256", PrivateKeyFile: "ed.pem"},
+			}},
+			expectedError: `could not load jwt key "a"`,
+		},
+		{
+			name: "Unsupported algorithm",
+			cfg: config.JWTConfig{SigningKey: "a", Keys: []config.JWTKeyConfig{
+				{ID: "a", Algorithm: "HS256", PrivateKeyFile: "rsa.pem"},
+			}},
+			expectedError: `could not load jwt key "a": unsupported algorithm "HS256"`,
+		},
+		{
+			name: "Missing file",
+			cfg: config.JWTConfig{SigningKey: "a", Keys: []config.JWTKeyConfig{
+				{ID: "a", Algorithm: "RS256", PrivateKeyFile: "missing.pem"},
+			}},
+			expectedError: `could not load jwt key "a": open missing.pem`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := LoadKeySet(tt.cfg)
+			if tt.expectedError != "" {
+				assert.ErrorContains(t, err, tt.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+
+			token, err := keys.GenerateToken(7, types.RoleStaff, time.Minute)
+			assert.NoError(t, err)
+
+			identity, err := authenticate(keys, token)
+			assert.NoError(t, err)
+			assert.Equal(t, 7, identity.UserID)
+			assert.Equal(t, types.RoleStaff, identity.Role)
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	withKeyFiles(t)
+
+	before, err := LoadKeySet(config.JWTConfig{SigningKey: "old", Keys: []config.JWTKeyConfig{
+		{ID: "old", Algorithm: "RS256", PrivateKeyFile: "rsa.pem"},
+	}})
+	assert.NoError(t, err)
+	oldToken, _ := before.GenerateToken(7, types.RoleCustomer, time.Minute)
+
+	// the new key signs, the old one keeps verifying
+	rotating, err := LoadKeySet(config.JWTConfig{SigningKey: "new", Keys: []config.JWTKeyConfig{
+		{ID: "old", Algorithm: "RS256", PublicKeyFile: "rsa.pub.pem"},
+		{ID: "new", Algorithm: "EdDSA", PrivateKeyFile: "ed.pem"},
+	}})
+	assert.NoError(t, err)
+	newToken, _ := rotating.GenerateToken(7, types.RoleCustomer, time.Minute)
+
+	parsed, _ := jwt.Parse(newToken, rotating.keyFunc)
+	assert.Equal(t, "new", parsed.Header["kid"])
+	assert.Equal(t, "EdDSA", parsed.Header["alg"])
+
+	_, err = authenticate(rotating, oldToken)
+	assert.NoError(t, err)
+	_, err = authenticate(rotating, newToken)
+	assert.NoError(t, err)
+
+	// once retired the old key no longer verifies
+	retired, err := LoadKeySet(config.JWTConfig{SigningKey: "new", Keys: []config.JWTKeyConfig{
+		{ID: "new", Algorithm: "EdDSA", PrivateKeyFile: "ed.pem"},
+	}})
+	assert.NoError(t, err)
+	_, err = authenticate(retired, oldToken)
+	assert.Equal(t, errInvalidToken, err)
+	_, err = authenticate(retired, newToken)
+	assert.NoError(t, err)
+}
+
+func TestKeySetRejectsForeignTokens(t *testing.T) {
+	withKeyFiles(t)
+
+	keys, err := LoadKeySet(config.JWTConfig{SigningKey: "a", Keys: []config.JWTKeyConfig{
+		{ID: "a", Algorithm: "RS256", PrivateKeyFile: "rsa.pem"},
+	}})
+	assert.NoError(t, err)
+	publicPEM, _ := readKeyFile("rsa.pub.pem")
+
+	tests := []struct {
+		name  string
+		token func() string
+	}{
+		{
+			name: "Shared secret token once keys are configured",
+			token: func() string {
+				token, _ := GenerateToken([]byte("default_secret"), 7, types.RoleAdmin, time.Minute)
+				return token
+			},
+		},
+		{
+			name: "HS256 signed with the public key",
+			token: func() string {
+				token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"userID": "7", "exp": time.Now().Add(time.Minute).Unix()})
+				token.Header["kid"] = "a"
+				signed, _ := token.SignedString(publicPEM)
+				return signed
+			},
+		},
+		{
+			name: "Unknown kid",
+			token: func() string {
+				token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"userID": "7"})
+				token.Header["kid"] = "b"
+				signed, _ := token.SignedString([]byte("secret"))
+				return signed
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := authenticate(keys, tt.token())
+			assert.Equal(t, errInvalidToken, err)
+		})
+	}
+}
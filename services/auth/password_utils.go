@@ -1,6 +1,10 @@
 package auth
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
 
 // HashPasswordFunc defines the type for the hashing function.
 type HashPasswordFunc func(password []byte, cost int) ([]byte, error)
@@ -23,3 +27,14 @@ func hashPasswordWithFunc(password string, hashFunc HashPasswordFunc) (string, e
 func ComparePasswords(hashedPassword, password string) error {
 	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
 }
+
+// DummyPasswordHash returns a hash made like every stored password. Logins
+// for unknown users compare against it, so they take as long as logins with
+// a wrong password and response times don't reveal which emails exist.
+var DummyPasswordHash = sync.OnceValue(func() string {
+	hash, err := HashPassword("not the password of any user")
+	if err != nil {
+		panic(err)
+	}
+	return hash
+})
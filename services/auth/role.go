@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/loloDawit/ecom/types"
+	"github.com/loloDawit/ecom/utils"
+)
+
+// RequireRole only lets through users holding one of roles. It must run
+// after Middleware so the user and their role are already in the request
+// context.
+func RequireRole(roles ...types.Role) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if _, err := GetUserIDFromContext(r.Context()); err != nil {
+				utils.WriteError(w, http.StatusUnauthorized, utils.ErrUnauthorized)
+				return
+			}
+
+			role := GetRoleFromContext(r.Context())
+			for _, allowed := range roles {
+				if role == allowed {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			utils.WriteError(w, http.StatusForbidden, utils.ErrForbidden)
+		}
+	}
+}
+
+// GetRoleFromContext returns the role of the authenticated caller, or
+// an empty role when the request is not authenticated.
+func GetRoleFromContext(ctx context.Context) types.Role {
+	role, _ := ctx.Value(types.UserRoleKey).(types.Role)
+	return role
+}
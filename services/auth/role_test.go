@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/loloDawit/ecom/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequireRole(t *testing.T) {
+	tests := []struct {
+		name           string
+		userID         interface{}
+		role           interface{}
+		expectedStatus int
+	}{
+		{
+			name:           "Admin user",
+			userID:         "1",
+			role:           types.RoleAdmin,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Staff user",
+			userID:         "1",
+			role:           types.RoleStaff,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Customer",
+			userID:         "2",
+			role:           types.RoleCustomer,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "User without a role",
+			userID:         "2",
+			role:           nil,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "No user in context",
+			userID:         nil,
+			role:           types.RoleAdmin,
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := RequireRole(types.RoleStaff, types.RoleAdmin)(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+
+			req, err := http.NewRequest("GET", "/", nil)
+			assert.NoError(t, err)
+			ctx := req.Context()
+			if tt.userID != nil {
+				ctx = context.WithValue(ctx, types.UserIDKey, tt.userID)
+			}
+			if tt.role != nil {
+				ctx = context.WithValue(ctx, types.UserRoleKey, tt.role)
+			}
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req.WithContext(ctx))
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+		})
+	}
+}
+
+func TestJWTMiddlewareSetsRole(t *testing.T) {
+	secret := []byte("my_secret_key")
+
+	tests := []struct {
+		name         string
+		token        func() string
+		expectedRole types.Role
+	}{
+		{
+			name: "Role claim",
+			token: func() string {
+				token, _ := GenerateToken(secret, 1, types.RoleAdmin, time.Minute)
+				return token
+			},
+			expectedRole: types.RoleAdmin,
+		},
+		{
+			name: "Token without a role claim",
+			token: func() string {
+				token, _ := generateToken(secret, "1")
+				return token
+			},
+			expectedRole: types.RoleCustomer,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var role types.Role
+			handler := JWTMiddleware(secret)(func(w http.ResponseWriter, r *http.Request) {
+				role = GetRoleFromContext(r.Context())
+			})
+
+			req, err := http.NewRequest("GET", "/", nil)
+			assert.NoError(t, err)
+			req.Header.Set("Authorization", "Bearer "+tt.token())
+
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			assert.Equal(t, tt.expectedRole, role)
+		})
+	}
+}
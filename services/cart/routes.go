@@ -1,117 +1,367 @@
 package cart
 
 import (
-	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"io"
+	"log"
 	"net/http"
 	"strconv"
 
 	"github.com/gorilla/mux"
 	"github.com/loloDawit/ecom/config"
+	"github.com/loloDawit/ecom/services/address"
 	"github.com/loloDawit/ecom/services/auth"
+	"github.com/loloDawit/ecom/services/idempotency"
 	"github.com/loloDawit/ecom/types"
 	"github.com/loloDawit/ecom/utils"
 	"gopkg.in/go-playground/validator.v9"
 )
 
 type Handler struct {
-	store        types.OrderStore
+	store        types.CartStore
 	productStore types.ProductStore
+	addressStore types.AddressStore
+	userStore    types.UserStore
+	notifier     types.Notifier
+	transactor   types.Transactor
+	auth         auth.Authenticator
 	cfg          *config.Config
+	// idempotency makes checkout safe to retry when set
+	idempotency types.IdempotencyStore
+	// async sends the order confirmation after the response is written
+	async func(func())
 }
 
-func NewHandlers(store types.OrderStore, productStore types.ProductStore, cfg *config.Config) *Handler {
-	return &Handler{store: store, productStore: productStore, cfg: cfg}
+func NewHandlers(store types.CartStore, productStore types.ProductStore, addressStore types.AddressStore, userStore types.UserStore, notifier types.Notifier, transactor types.Transactor, authenticator auth.Authenticator, cfg *config.Config) *Handler {
+	return &Handler{
+		store:        store,
+		productStore: productStore,
+		addressStore: addressStore,
+		userStore:    userStore,
+		notifier:     notifier,
+		transactor:   transactor,
+		auth:         authenticator,
+		cfg:          cfg,
+		async:        func(fn func()) { go fn() },
+	}
+}
+
+// checkoutError aborts the checkout transaction with the response to send.
+type checkoutError struct {
+	status  int
+	message string
+}
+
+func (e *checkoutError) Error() string {
+	return e.message
+}
+
+// WithIdempotency returns a copy of the handler whose checkout honours the
+// Idempotency-Key header, so retries cannot place the order twice.
+func (h *Handler) WithIdempotency(store types.IdempotencyStore) *Handler {
+	copied := *h
+	copied.idempotency = store
+	return &copied
 }
 
 func (h *Handler) RegisterRoutes(r *mux.Router) {
-	r.HandleFunc("/cart/checkout", auth.JWTMiddleware([]byte(h.cfg.JWT.Secret))(h.checkout)).Methods("POST")
+	jwtMiddleware := auth.Middleware(h.auth)
+	idempotent := func(next http.HandlerFunc) http.HandlerFunc { return next }
+	if h.idempotency != nil {
+		idempotent = idempotency.Middleware(h.idempotency)
+	}
+
+	r.HandleFunc("/cart", jwtMiddleware(h.getCart)).Methods("GET")
+	r.HandleFunc("/cart/items", jwtMiddleware(h.addCartItem)).Methods("POST")
+	r.HandleFunc("/cart/items/{productId}", jwtMiddleware(h.updateCartItem)).Methods("PATCH")
+	r.HandleFunc("/cart/items/{productId}", jwtMiddleware(h.removeCartItem)).Methods("DELETE")
+	r.HandleFunc("/cart/checkout", jwtMiddleware(idempotent(h.checkout))).Methods("POST")
 }
 
-func (h *Handler) checkout(w http.ResponseWriter, r *http.Request) {
-	userID, err := getUserIDFromContext(r.Context())
+func (h *Handler) getCart(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.GetUserIDFromContext(r.Context())
 	if err != nil {
-		fmt.Println("Error getting user ID from context:", err)
 		utils.WriteError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	fmt.Println("User ID:", userID)
+	h.writeCart(w, userID)
+}
 
-	var cartPayload types.CartCheckoutPayload
-	err = utils.ReadJSON(r, &cartPayload)
+func (h *Handler) addCartItem(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.GetUserIDFromContext(r.Context())
 	if err != nil {
-		utils.WriteError(w, http.StatusBadRequest, "invalid payload")
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	if err := utils.Validate.Struct(cartPayload); err != nil {
-		validationErrors := err.(validator.ValidationErrors)
-		utils.WriteError(w, http.StatusBadRequest, fmt.Sprintf("invalid payload: %v", validationErrors))
+	if r.Body == nil {
+		utils.WriteError(w, http.StatusBadRequest, utils.ErrInvalidRequestBody)
 		return
 	}
 
-	if len(cartPayload.Items) == 0 {
-		utils.WriteError(w, http.StatusBadRequest, "Cart is empty")
+	var payload types.AddCartItemPayload
+	if err := utils.ReadJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, utils.ErrInvalidPayload)
 		return
 	}
 
-	var totalPrice float64
-	for _, item := range cartPayload.Items {
-		product, err := h.productStore.GetProductByID(item.ProductID)
-		if err != nil {
-			utils.WriteError(w, http.StatusInternalServerError, "Product not found")
+	if err := utils.Validate.Struct(payload); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Sprintf("%s: %v", utils.ErrInvalidPayload, validationErrors))
+		return
+	}
+
+	// make sure the product exists before it lands in the cart
+	if _, err := h.productStore.GetProductByID(payload.ProductID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.WriteError(w, http.StatusNotFound, utils.ErrProductNotFound)
 			return
 		}
+		log.Printf("error getting product %d: %v", payload.ProductID, err)
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrInternalServerError)
+		return
+	}
+
+	err = h.store.AddCartItem(userID, types.CartItem{
+		ProductID: payload.ProductID,
+		Quantity:  payload.Quantity,
+	})
+	if err != nil {
+		log.Printf("error adding product %d to cart: %v", payload.ProductID, err)
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrInternalServerError)
+		return
+	}
+
+	h.writeCart(w, userID)
+}
+
+func (h *Handler) updateCartItem(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
 
-		if product.Quantity <= 0 {
-			utils.WriteError(w, http.StatusBadRequest, fmt.Sprintf("Product %s is out of stock", product.Name))
+	productID, err := strconv.Atoi(mux.Vars(r)["productId"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid product ID")
+		return
+	}
+
+	if r.Body == nil {
+		utils.WriteError(w, http.StatusBadRequest, utils.ErrInvalidRequestBody)
+		return
+	}
+
+	var payload types.UpdateCartItemPayload
+	if err := utils.ReadJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, utils.ErrInvalidPayload)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Sprintf("%s: %v", utils.ErrInvalidPayload, validationErrors))
+		return
+	}
+
+	err = h.store.UpdateCartItem(userID, types.CartItem{
+		ProductID: productID,
+		Quantity:  payload.Quantity,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.WriteError(w, http.StatusNotFound, utils.ErrCartItemNotFound)
 			return
 		}
+		log.Printf("error updating product %d in cart: %v", productID, err)
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrInternalServerError)
+		return
+	}
 
-		if item.Quantity > product.Quantity {
-			utils.WriteError(w, http.StatusBadRequest, fmt.Sprintf("Product %s has only %d items left", product.Name, product.Quantity))
+	h.writeCart(w, userID)
+}
+
+func (h *Handler) removeCartItem(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	productID, err := strconv.Atoi(mux.Vars(r)["productId"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid product ID")
+		return
+	}
+
+	if err := h.store.RemoveCartItem(userID, productID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.WriteError(w, http.StatusNotFound, utils.ErrCartItemNotFound)
 			return
 		}
+		log.Printf("error removing product %d from cart: %v", productID, err)
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrInternalServerError)
+		return
+	}
 
-		totalPrice += float64(product.Price) * float64(item.Quantity)
+	h.writeCart(w, userID)
+}
 
-		err = h.productStore.UpdateProductQuantityWithTransaction(types.Product{
-			ID:       product.ID,
-			Quantity: item.Quantity,
-		})
-		if err != nil {
-			utils.WriteError(w, http.StatusInternalServerError, "Failed to update product quantity")
+// writeCart responds with the current contents of the user's cart.
+func (h *Handler) writeCart(w http.ResponseWriter, userID int) {
+	cart, err := h.store.GetCartByUserID(userID)
+	if err != nil {
+		log.Printf("error getting cart for user %d: %v", userID, err)
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrInternalServerError)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, cart)
+}
+
+func (h *Handler) checkout(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if checkoutErr := h.requireVerifiedEmail(userID); checkoutErr != nil {
+		utils.WriteError(w, checkoutErr.status, checkoutErr.message)
+		return
+	}
+
+	// a request without a body or without items checks out the cart stored
+	// for the user, still honouring the shipping address it names
+	var cartPayload types.CartCheckoutPayload
+	if r.Body != nil {
+		err = utils.ReadJSON(r, &cartPayload)
+		if err != nil && !errors.Is(err, io.EOF) {
+			utils.WriteError(w, http.StatusBadRequest, "invalid payload")
 			return
 		}
 	}
 
-	// create the order
-	orderID, err := h.store.CreateOrder(types.Order{
-		UserID:  userID,
-		Total:   totalPrice,
-		Status:  "pending",
-		Address: "Seattle, WA",
-	})
+	if err := utils.Validate.Struct(cartPayload); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Sprintf("invalid payload: %v", validationErrors))
+		return
+	}
+	useStoredCart := len(cartPayload.Items) == 0
 
-	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, "Failed to create order")
+	shippingAddress, checkoutErr := h.shippingAddress(userID, cartPayload)
+	if checkoutErr != nil {
+		utils.WriteError(w, checkoutErr.status, checkoutErr.message)
 		return
 	}
 
-	// create the order item
-	for _, item := range cartPayload.Items {
-		err = h.store.CreateOrderItem(types.OrderItem{
-			OrderID:   orderID,
-			ProductID: item.ProductID,
-			Quantity:  item.Quantity,
-			Price:     totalPrice,
+	// reserve stock, create the order and its items in a single transaction
+	var orderID int
+	var totalPrice float64
+	var orderItems []types.OrderItem
+	err = h.transactor.WithinTransaction(func(tx types.Transaction) error {
+		items := cartPayload.Items
+		if useStoredCart {
+			cart, err := tx.Carts().GetCartByUserID(userID)
+			if err != nil {
+				return err
+			}
+			if len(cart.Items) == 0 {
+				return &checkoutError{http.StatusBadRequest, "Cart is empty"}
+			}
+			items = cart.Items
+		}
+
+		orderItems = make([]types.OrderItem, 0, len(items))
+		for _, item := range items {
+			product, err := tx.Products().GetProductByID(item.ProductID)
+			if err != nil {
+				return &checkoutError{http.StatusInternalServerError, "Product not found"}
+			}
+
+			if product.Quantity <= 0 {
+				return &checkoutError{http.StatusBadRequest, fmt.Sprintf("Product %s is out of stock", product.Name)}
+			}
+
+			if item.Quantity > product.Quantity {
+				return &checkoutError{http.StatusBadRequest, fmt.Sprintf("Product %s has only %d items left", product.Name, product.Quantity)}
+			}
+
+			subtotal := product.Price * float64(item.Quantity)
+			totalPrice += subtotal
+
+			// snapshot the product as it was sold
+			orderItems = append(orderItems, types.OrderItem{
+				ProductID:    product.ID,
+				Quantity:     item.Quantity,
+				Price:        product.Price,
+				Subtotal:     subtotal,
+				ProductName:  product.Name,
+				ProductImage: product.Image,
+			})
+
+			err = tx.Products().UpdateProductQuantityWithTransaction(types.Product{
+				ID:       product.ID,
+				Quantity: item.Quantity,
+			})
+			if err != nil {
+				return &checkoutError{http.StatusInternalServerError, "Failed to update product quantity"}
+			}
+		}
+
+		// create the order
+		orderID, err = tx.Orders().CreateOrder(types.Order{
+			UserID:  userID,
+			Total:   totalPrice,
+			Status:  types.OrderStatusPending,
+			Address: shippingAddress,
 		})
 		if err != nil {
-			utils.WriteError(w, http.StatusInternalServerError, "Failed to create order item")
+			return &checkoutError{http.StatusInternalServerError, "Failed to create order"}
+		}
+
+		// create the order items
+		for i := range orderItems {
+			orderItems[i].OrderID = orderID
+			err = tx.Orders().CreateOrderItem(orderItems[i])
+			if err != nil {
+				return &checkoutError{http.StatusInternalServerError, "Failed to create order item"}
+			}
+		}
+
+		// the stored cart has been turned into an order
+		if useStoredCart {
+			if err := tx.Carts().ClearCart(userID); err != nil {
+				return &checkoutError{http.StatusInternalServerError, "Failed to clear cart"}
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		var checkoutErr *checkoutError
+		if errors.As(err, &checkoutErr) {
+			utils.WriteError(w, checkoutErr.status, checkoutErr.message)
 			return
 		}
+		log.Printf("checkout transaction failed: %v", err)
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrInternalServerError)
+		return
+	}
+
+	order := &types.Order{
+		ID:      orderID,
+		UserID:  userID,
+		Total:   totalPrice,
+		Status:  types.OrderStatusPending,
+		Address: shippingAddress,
+		Items:   orderItems,
 	}
+	h.async(func() { h.sendOrderConfirmation(order) })
 
 	utils.WriteJSON(w, http.StatusOK, types.CreateOrderResponse{
 		ID:      orderID,
@@ -120,10 +370,67 @@ func (h *Handler) checkout(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func getUserIDFromContext(ctx context.Context) (int, error) {
-	userIDStr, ok := ctx.Value(types.UserIDKey).(string)
-	if !ok || userIDStr == "" {
-		return 0, fmt.Errorf("user ID not found in context")
+// sendOrderConfirmation mails the order to its user. The order stands even
+// if the email cannot be sent, so failures are only logged.
+func (h *Handler) sendOrderConfirmation(order *types.Order) {
+	user, err := h.userStore.GetUserByID(order.UserID)
+	if err != nil {
+		log.Printf("error getting user %d for order confirmation: %v", order.UserID, err)
+		return
+	}
+
+	if err := h.notifier.SendOrderConfirmation(user, order); err != nil {
+		log.Printf("error sending confirmation of order %d: %v", order.ID, err)
 	}
-	return strconv.Atoi(userIDStr)
+}
+
+// requireVerifiedEmail stops users who have not verified their email from
+// checking out when the config asks for it.
+func (h *Handler) requireVerifiedEmail(userID int) *checkoutError {
+	if !h.cfg.RequireVerifiedEmailForCheckout {
+		return nil
+	}
+
+	user, err := h.userStore.GetUserByID(userID)
+	if err != nil {
+		log.Printf("error getting user %d: %v", userID, err)
+		return &checkoutError{status: http.StatusInternalServerError, message: utils.ErrInternalServerError}
+	}
+	if user.EmailVerifiedAt == nil {
+		return &checkoutError{status: http.StatusForbidden, message: utils.ErrEmailNotVerified}
+	}
+
+	return nil
+}
+
+// shippingAddress resolves the address the order ships to and returns it
+// formatted for the order snapshot: the saved address the payload refers to,
+// the inline address it carries, or else the user's default address.
+func (h *Handler) shippingAddress(userID int, payload types.CartCheckoutPayload) (string, *checkoutError) {
+	var saved *types.Address
+	var err error
+
+	switch {
+	case payload.AddressID != 0 && payload.Address != nil:
+		return "", &checkoutError{http.StatusBadRequest, "provide either addressId or address, not both"}
+	case payload.Address != nil:
+		return address.Format(address.FromPayload(userID, *payload.Address)), nil
+	case payload.AddressID != 0:
+		saved, err = h.addressStore.GetAddressByID(userID, payload.AddressID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", &checkoutError{http.StatusBadRequest, utils.ErrAddressNotFound}
+		}
+	default:
+		saved, err = h.addressStore.GetDefaultAddress(userID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", &checkoutError{http.StatusBadRequest, utils.ErrAddressRequired}
+		}
+	}
+
+	if err != nil {
+		log.Printf("error getting shipping address for user %d: %v", userID, err)
+		return "", &checkoutError{http.StatusInternalServerError, utils.ErrInternalServerError}
+	}
+
+	return address.Format(*saved), nil
 }
@@ -3,7 +3,10 @@ package cart
 import (
 	"bytes"
 	"context"
+	"database/sql"
 	"encoding/json"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"net/http/httptest"
@@ -15,7 +18,9 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/loloDawit/ecom/config"
 	"github.com/loloDawit/ecom/services/auth"
+	"github.com/loloDawit/ecom/services/auth/authtest"
 	"github.com/loloDawit/ecom/types"
+	"github.com/loloDawit/ecom/utils"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -38,20 +43,48 @@ func (m *mockOrderStore) CreateOrderItem(item types.OrderItem) error {
 	return nil
 }
 
+func (m *mockOrderStore) GetOrdersByUserID(userID int, limit int, offset int) ([]types.Order, error) {
+	return nil, nil
+}
+
+func (m *mockOrderStore) GetOrderByID(id int) (*types.Order, error) {
+	return nil, nil
+}
+
+func (m *mockOrderStore) GetOrderItems(orderID int) ([]types.OrderItem, error) {
+	return nil, nil
+}
+
+func (m *mockOrderStore) GetOrderForUpdate(id int) (*types.Order, error) {
+	return nil, nil
+}
+
+func (m *mockOrderStore) UpdateOrderStatus(id int, status types.OrderStatus) error {
+	return nil
+}
+
+func (m *mockOrderStore) CreateStatusHistory(h types.StatusHistory) error {
+	return nil
+}
+
 type mockProductStore struct {
-	GetProductsFunc                          func() ([]types.Product, error)
+	GetProductsFunc                          func(query types.ProductQuery) ([]types.Product, error)
 	GetProductByIDFunc                       func(id int) (*types.Product, error)
 	UpdateProductQuantityWithTransactionFunc func(product types.Product) error
 	CreateProductFunc                        func(product types.Product) (int, error)
 }
 
-func (m *mockProductStore) GetProducts() ([]types.Product, error) {
+func (m *mockProductStore) GetProducts(query types.ProductQuery) ([]types.Product, error) {
 	if m.GetProductsFunc != nil {
-		return m.GetProductsFunc()
+		return m.GetProductsFunc(query)
 	}
 	return nil, nil
 }
 
+func (m *mockProductStore) SearchProducts(query string, limit int, offset int) ([]types.ProductSearchResult, error) {
+	return nil, nil
+}
+
 func (m *mockProductStore) GetProductByID(id int) (*types.Product, error) {
 	if m.GetProductByIDFunc != nil {
 		return m.GetProductByIDFunc(id)
@@ -59,6 +92,14 @@ func (m *mockProductStore) GetProductByID(id int) (*types.Product, error) {
 	return nil, nil
 }
 
+func (m *mockProductStore) UpdateProduct(product types.Product, expectedVersion int) (*types.Product, error) {
+	return &product, nil
+}
+
+func (m *mockProductStore) DeleteProduct(id int, expectedVersion int) error {
+	return nil
+}
+
 func (m *mockProductStore) UpdateProductQuantityWithTransaction(product types.Product) error {
 	if m.UpdateProductQuantityWithTransactionFunc != nil {
 		return m.UpdateProductQuantityWithTransactionFunc(product)
@@ -66,6 +107,10 @@ func (m *mockProductStore) UpdateProductQuantityWithTransaction(product types.Pr
 	return nil
 }
 
+func (m *mockProductStore) RestoreProductQuantityWithTransaction(product types.Product) error {
+	return nil
+}
+
 func (m *mockProductStore) CreateProduct(product types.Product) (int, error) {
 	if m.CreateProductFunc != nil {
 		return m.CreateProductFunc(product)
@@ -73,6 +118,186 @@ func (m *mockProductStore) CreateProduct(product types.Product) (int, error) {
 	return 0, nil
 }
 
+type mockCartStore struct {
+	GetCartByUserIDFunc func(userID int) (*types.Cart, error)
+	AddCartItemFunc     func(userID int, item types.CartItem) error
+	UpdateCartItemFunc  func(userID int, item types.CartItem) error
+	RemoveCartItemFunc  func(userID int, productID int) error
+	ClearCartFunc       func(userID int) error
+}
+
+func (m *mockCartStore) GetCartByUserID(userID int) (*types.Cart, error) {
+	if m.GetCartByUserIDFunc != nil {
+		return m.GetCartByUserIDFunc(userID)
+	}
+	return &types.Cart{UserID: userID, Items: []types.CartItem{}}, nil
+}
+
+func (m *mockCartStore) AddCartItem(userID int, item types.CartItem) error {
+	if m.AddCartItemFunc != nil {
+		return m.AddCartItemFunc(userID, item)
+	}
+	return nil
+}
+
+func (m *mockCartStore) UpdateCartItem(userID int, item types.CartItem) error {
+	if m.UpdateCartItemFunc != nil {
+		return m.UpdateCartItemFunc(userID, item)
+	}
+	return nil
+}
+
+func (m *mockCartStore) RemoveCartItem(userID int, productID int) error {
+	if m.RemoveCartItemFunc != nil {
+		return m.RemoveCartItemFunc(userID, productID)
+	}
+	return nil
+}
+
+func (m *mockCartStore) ClearCart(userID int) error {
+	if m.ClearCartFunc != nil {
+		return m.ClearCartFunc(userID)
+	}
+	return nil
+}
+
+type mockAddressStore struct {
+	GetAddressByIDFunc    func(userID int, id int) (*types.Address, error)
+	GetDefaultAddressFunc func(userID int) (*types.Address, error)
+}
+
+func (m *mockAddressStore) GetAddressesByUserID(userID int) ([]types.Address, error) {
+	return nil, nil
+}
+
+func (m *mockAddressStore) GetAddressByID(userID int, id int) (*types.Address, error) {
+	if m.GetAddressByIDFunc != nil {
+		return m.GetAddressByIDFunc(userID, id)
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *mockAddressStore) GetDefaultAddress(userID int) (*types.Address, error) {
+	if m.GetDefaultAddressFunc != nil {
+		return m.GetDefaultAddressFunc(userID)
+	}
+	return &types.Address{ID: 1, UserID: userID, Line1: "1 Pike St", City: "Seattle", Region: "WA", PostalCode: "98101", Country: "US", IsDefault: true}, nil
+}
+
+func (m *mockAddressStore) CreateAddress(address types.Address) (int, error) {
+	return 0, nil
+}
+
+func (m *mockAddressStore) UpdateAddress(address types.Address) error {
+	return nil
+}
+
+func (m *mockAddressStore) DeleteAddress(userID int, id int) error {
+	return nil
+}
+
+func (m *mockAddressStore) SetDefaultAddress(userID int, id int) error {
+	return nil
+}
+
+type mockUserStore struct {
+	GetUserByIDFunc func(id int) (*types.User, error)
+}
+
+func (m *mockUserStore) GetUserByEmail(email string) (*types.User, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (m *mockUserStore) CreateUser(user types.User) error {
+	return nil
+}
+
+func (m *mockUserStore) GetUserByID(id int) (*types.User, error) {
+	if m.GetUserByIDFunc != nil {
+		return m.GetUserByIDFunc(id)
+	}
+	return &types.User{ID: id}, nil
+}
+
+func (m *mockUserStore) UpdateUser(user types.User) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdatePassword(userID int, passwordHash string) error {
+	return nil
+}
+
+func (m *mockUserStore) DeleteUser(userID int, now time.Time) error {
+	return nil
+}
+
+func (m *mockUserStore) GetUsers(query types.UserQuery) ([]types.User, error) {
+	return nil, nil
+}
+
+func (m *mockUserStore) SetUserDisabled(userID int, disabledAt *time.Time) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdateUserRole(userID int, role types.Role) error {
+	return nil
+}
+
+type mockNotifier struct {
+	orders []*types.Order
+}
+
+func (m *mockNotifier) SendEmailVerification(user *types.User, token string, expiresIn time.Duration) error {
+	return nil
+}
+
+func (m *mockNotifier) SendPasswordReset(user *types.User, token string, expiresIn time.Duration) error {
+	return nil
+}
+
+func (m *mockNotifier) SendOrderConfirmation(user *types.User, order *types.Order) error {
+	m.orders = append(m.orders, order)
+	return nil
+}
+
+type mockTransaction struct {
+	orders   types.OrderStore
+	products types.ProductStore
+	carts    types.CartStore
+}
+
+func (m *mockTransaction) Products() types.ProductStore {
+	return m.products
+}
+
+func (m *mockTransaction) Orders() types.OrderStore {
+	return m.orders
+}
+
+func (m *mockTransaction) Carts() types.CartStore {
+	return m.carts
+}
+
+// mockTransactor runs the unit of work directly and records its outcome.
+type mockTransactor struct {
+	tx         *mockTransaction
+	committed  bool
+	rolledBack bool
+}
+
+func newMockTransactor(orders types.OrderStore, products types.ProductStore) *mockTransactor {
+	return &mockTransactor{tx: &mockTransaction{orders: orders, products: products, carts: &mockCartStore{}}}
+}
+
+func (m *mockTransactor) WithinTransaction(fn func(tx types.Transaction) error) error {
+	if err := fn(m.tx); err != nil {
+		m.rolledBack = true
+		return err
+	}
+	m.committed = true
+	return nil
+}
+
 func generateTestToken(secret []byte, userID int, expiration time.Duration) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"userID": strconv.Itoa(userID),
@@ -143,8 +368,11 @@ func TestCheckoutRoute(t *testing.T) {
 			expectedResponseBody: `{"error":"invalid payload"}`,
 		},
 		{
-			name:    "Validation Errors",
-			payload: types.CartCheckoutPayload{},
+			name: "Validation Errors",
+			payload: types.CartCheckoutPayload{
+				Items:   []types.CartItem{{ProductID: 1, Quantity: 2}},
+				Address: &types.AddressPayload{Line1: "1 Main St", City: "Springfield", PostalCode: "12345", Country: "USA"},
+			},
 			mockOrderStore: &mockOrderStore{
 				CreateOrderFunc: func(order types.Order) (int, error) {
 					return 123, nil
@@ -155,7 +383,7 @@ func TestCheckoutRoute(t *testing.T) {
 			},
 			mockProductStore:     &mockProductStore{},
 			expectedStatus:       http.StatusBadRequest,
-			expectedResponseBody: `{"error":"invalid payload: Key: 'CartCheckoutPayload.Items' Error:Field validation for 'Items' failed on the 'required' tag"}`,
+			expectedResponseBody: `{"error":"invalid payload: Key: 'CartCheckoutPayload.Address.Country' Error:Field validation for 'Country' failed on the 'len' tag"}`,
 		},
 		{
 			name: "Empty Cart",
@@ -381,7 +609,7 @@ func TestCheckoutRoute(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			handler := NewHandlers(tt.mockOrderStore, tt.mockProductStore, cfg)
+			handler := NewHandlers(&mockCartStore{}, tt.mockProductStore, &mockAddressStore{}, &mockUserStore{}, &mockNotifier{}, newMockTransactor(tt.mockOrderStore, tt.mockProductStore), auth.NewJWTAuthenticator([]byte(cfg.JWT.Secret)), cfg)
 
 			// Create a router instance without middleware for this specific test case
 			var router *mux.Router
@@ -422,7 +650,7 @@ func TestCheckoutRouteErrorGettingUserID(t *testing.T) {
 		},
 	}
 
-	handler := NewHandlers(&mockOrderStore{
+	handler := NewHandlers(&mockCartStore{}, &mockProductStore{}, &mockAddressStore{}, &mockUserStore{}, &mockNotifier{}, newMockTransactor(&mockOrderStore{
 		CreateOrderFunc: func(order types.Order) (int, error) {
 			return 123, nil
 		},
@@ -441,42 +669,685 @@ func TestCheckoutRouteErrorGettingUserID(t *testing.T) {
 		UpdateProductQuantityWithTransactionFunc: func(product types.Product) error {
 			return nil
 		},
-	}, cfg)
+	}), auth.NewJWTAuthenticator([]byte(cfg.JWT.Secret)), cfg)
+
+	body, err := json.Marshal(types.CartCheckoutPayload{
+		Items: []types.CartItem{
+			{ProductID: 1, Quantity: 2},
+		},
+	})
+	assert.NoError(t, err)
+
+	// call the handler without the authentication middleware so the
+	// request context carries no user
+	req, err := http.NewRequest("POST", "/cart/checkout", bytes.NewReader(body))
+	assert.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	handler.checkout(rr, req)
+
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.JSONEq(t, `{"error":"user ID not found in context"}`, rr.Body.String())
+}
+
+func TestCheckoutRejectsUnauthenticatedCaller(t *testing.T) {
+	products := &mockProductStore{}
+	transactor := newMockTransactor(&mockOrderStore{}, products)
+	handler := NewHandlers(&mockCartStore{}, products, &mockAddressStore{}, &mockUserStore{}, &mockNotifier{}, transactor, authtest.Anonymous(), &config.Config{})
 
-	// Create a router instance with the middleware
 	router := mux.NewRouter()
-	router.HandleFunc("/cart/checkout", auth.JWTMiddleware([]byte(cfg.JWT.Secret))(handler.checkout)).Methods("POST")
+	handler.RegisterRoutes(router)
+
+	req, err := http.NewRequest("POST", "/cart/checkout", bytes.NewReader([]byte(`{"items":[{"productId":1,"quantity":1}]}`)))
+	assert.NoError(t, err)
+	req.Header.Set("X-Bypass-UserID", "true")
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.JSONEq(t, `{"error":"Invalid token"}`, rr.Body.String())
+	assert.False(t, transactor.committed)
+}
+
+func TestCheckoutRollsBackOnFailure(t *testing.T) {
+	cfg := &config.Config{
+		JWT: config.JWTConfig{
+			Secret: "testsecret",
+		},
+	}
+
+	var reserved []int
+	orderCreated := false
+	transactor := newMockTransactor(&mockOrderStore{
+		CreateOrderFunc: func(order types.Order) (int, error) {
+			orderCreated = true
+			return 123, nil
+		},
+	}, &mockProductStore{
+		GetProductByIDFunc: func(id int) (*types.Product, error) {
+			quantity := 100
+			if id == 3 {
+				quantity = 0
+			}
+			return &types.Product{ID: id, Name: "Product " + strconv.Itoa(id), Price: 10, Quantity: quantity}, nil
+		},
+		UpdateProductQuantityWithTransactionFunc: func(product types.Product) error {
+			reserved = append(reserved, product.ID)
+			return nil
+		},
+	})
+
+	router := mux.NewRouter()
+	router.Use(MockJWTMiddleware([]byte(cfg.JWT.Secret)))
+	NewHandlers(&mockCartStore{}, &mockProductStore{}, &mockAddressStore{}, &mockUserStore{}, &mockNotifier{}, transactor, auth.NewJWTAuthenticator([]byte(cfg.JWT.Secret)), cfg).RegisterRoutes(router)
 
 	body, err := json.Marshal(types.CartCheckoutPayload{
 		Items: []types.CartItem{
-			{ProductID: 1, Quantity: 2},
+			{ProductID: 1, Quantity: 1},
+			{ProductID: 2, Quantity: 1},
+			{ProductID: 3, Quantity: 1},
 		},
 	})
 	assert.NoError(t, err)
 
 	req, err := http.NewRequest("POST", "/cart/checkout", bytes.NewReader(body))
 	assert.NoError(t, err)
+	token, err := generateTestToken([]byte(cfg.JWT.Secret), 1, time.Hour)
+	assert.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
 
-	// Generate a test token and add it to the request header
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"userID": "1",
-		"exp":    time.Now().Add(time.Hour).Unix(),
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.JSONEq(t, `{"error":"Product Product 3 is out of stock"}`, rr.Body.String())
+	assert.Equal(t, []int{1, 2}, reserved)
+	assert.False(t, orderCreated)
+	assert.True(t, transactor.rolledBack)
+	assert.False(t, transactor.committed)
+}
+
+func TestCheckoutStoredCart(t *testing.T) {
+	cfg := &config.Config{
+		JWT: config.JWTConfig{
+			Secret: "testsecret",
+		},
+	}
+
+	tests := []struct {
+		name                 string
+		cartItems            []types.CartItem
+		expectedStatus       int
+		expectedResponseBody string
+		expectCleared        bool
+	}{
+		{
+			name:                 "Checks out and clears the stored cart",
+			cartItems:            []types.CartItem{{ProductID: 1, Quantity: 2}},
+			expectedStatus:       http.StatusOK,
+			expectedResponseBody: `{"id":123,"total":20,"message":"Order created successfully"}`,
+			expectCleared:        true,
+		},
+		{
+			name:                 "Empty stored cart",
+			cartItems:            []types.CartItem{},
+			expectedStatus:       http.StatusBadRequest,
+			expectedResponseBody: `{"error":"Cart is empty"}`,
+			expectCleared:        false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleared := false
+			carts := &mockCartStore{
+				GetCartByUserIDFunc: func(userID int) (*types.Cart, error) {
+					return &types.Cart{UserID: userID, Items: tt.cartItems}, nil
+				},
+				ClearCartFunc: func(userID int) error {
+					cleared = true
+					return nil
+				},
+			}
+			products := &mockProductStore{
+				GetProductByIDFunc: func(id int) (*types.Product, error) {
+					return &types.Product{ID: id, Name: "Test Product", Price: 10, Quantity: 100}, nil
+				},
+			}
+			orders := &mockOrderStore{
+				CreateOrderFunc: func(order types.Order) (int, error) {
+					return 123, nil
+				},
+			}
+			transactor := &mockTransactor{tx: &mockTransaction{orders: orders, products: products, carts: carts}}
+
+			router := mux.NewRouter()
+			NewHandlers(carts, products, &mockAddressStore{}, &mockUserStore{}, &mockNotifier{}, transactor, auth.NewJWTAuthenticator([]byte(cfg.JWT.Secret)), cfg).RegisterRoutes(router)
+
+			req, err := http.NewRequest("POST", "/cart/checkout", nil)
+			assert.NoError(t, err)
+			token, err := generateTestToken([]byte(cfg.JWT.Secret), 1, time.Hour)
+			assert.NoError(t, err)
+			req.Header.Set("Authorization", "Bearer "+token)
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			assert.JSONEq(t, tt.expectedResponseBody, rr.Body.String())
+			assert.Equal(t, tt.expectCleared, cleared)
+		})
+	}
+}
+
+func TestCheckoutStoredCartWithAddress(t *testing.T) {
+	cfg := &config.Config{
+		JWT: config.JWTConfig{
+			Secret: "testsecret",
+		},
+	}
+
+	cleared := false
+	carts := &mockCartStore{
+		GetCartByUserIDFunc: func(userID int) (*types.Cart, error) {
+			return &types.Cart{UserID: userID, Items: []types.CartItem{{ProductID: 1, Quantity: 2}}}, nil
+		},
+		ClearCartFunc: func(userID int) error {
+			cleared = true
+			return nil
+		},
+	}
+	products := &mockProductStore{
+		GetProductByIDFunc: func(id int) (*types.Product, error) {
+			return &types.Product{ID: id, Name: "Test Product", Price: 10, Quantity: 100}, nil
+		},
+	}
+	addresses := &mockAddressStore{
+		GetAddressByIDFunc: func(userID int, id int) (*types.Address, error) {
+			return &types.Address{ID: id, UserID: userID, Line1: "10 Downing St", City: "London", PostalCode: "SW1A 2AA", Country: "GB"}, nil
+		},
+	}
+	var address string
+	orders := &mockOrderStore{
+		CreateOrderFunc: func(order types.Order) (int, error) {
+			address = order.Address
+			return 123, nil
+		},
+	}
+	transactor := &mockTransactor{tx: &mockTransaction{orders: orders, products: products, carts: carts}}
+
+	router := mux.NewRouter()
+	NewHandlers(carts, products, addresses, &mockUserStore{}, &mockNotifier{}, transactor, auth.NewJWTAuthenticator([]byte(cfg.JWT.Secret)), cfg).RegisterRoutes(router)
+
+	req, err := http.NewRequest("POST", "/cart/checkout", bytes.NewBufferString(`{"addressId":5}`))
+	assert.NoError(t, err)
+	token, err := generateTestToken([]byte(cfg.JWT.Secret), 1, time.Hour)
+	assert.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"id":123,"total":20,"message":"Order created successfully"}`, rr.Body.String())
+	assert.Equal(t, "10 Downing St, London, SW1A 2AA, GB", address)
+	assert.True(t, cleared)
+}
+
+func TestCartItemRoutes(t *testing.T) {
+	cfg := &config.Config{
+		JWT: config.JWTConfig{
+			Secret: "testsecret",
+		},
+	}
+
+	storedCart := func(userID int) (*types.Cart, error) {
+		return &types.Cart{UserID: userID, Items: []types.CartItem{{ProductID: 1, Quantity: 3}}}, nil
+	}
+
+	tests := []struct {
+		name                 string
+		method               string
+		path                 string
+		payload              interface{}
+		mockCartStore        *mockCartStore
+		mockProductStore     *mockProductStore
+		expectedStatus       int
+		expectedResponseBody string
+	}{
+		{
+			name:   "Get cart",
+			method: "GET",
+			path:   "/cart",
+			mockCartStore: &mockCartStore{
+				GetCartByUserIDFunc: storedCart,
+			},
+			mockProductStore:     &mockProductStore{},
+			expectedStatus:       http.StatusOK,
+			expectedResponseBody: `{"userId":1,"items":[{"productId":1,"quantity":3}]}`,
+		},
+		{
+			name:    "Add item",
+			method:  "POST",
+			path:    "/cart/items",
+			payload: types.AddCartItemPayload{ProductID: 1, Quantity: 3},
+			mockCartStore: &mockCartStore{
+				AddCartItemFunc: func(userID int, item types.CartItem) error {
+					if userID != 1 || item.ProductID != 1 || item.Quantity != 3 {
+						return fmt.Errorf("unexpected item %+v for user %d", item, userID)
+					}
+					return nil
+				},
+				GetCartByUserIDFunc: storedCart,
+			},
+			mockProductStore: &mockProductStore{
+				GetProductByIDFunc: func(id int) (*types.Product, error) {
+					return &types.Product{ID: id}, nil
+				},
+			},
+			expectedStatus:       http.StatusOK,
+			expectedResponseBody: `{"userId":1,"items":[{"productId":1,"quantity":3}]}`,
+		},
+		{
+			name:          "Add unknown product",
+			method:        "POST",
+			path:          "/cart/items",
+			payload:       types.AddCartItemPayload{ProductID: 42, Quantity: 1},
+			mockCartStore: &mockCartStore{},
+			mockProductStore: &mockProductStore{
+				GetProductByIDFunc: func(id int) (*types.Product, error) {
+					return nil, sql.ErrNoRows
+				},
+			},
+			expectedStatus:       http.StatusNotFound,
+			expectedResponseBody: `{"error":"product not found"}`,
+		},
+		{
+			name:                 "Add item with invalid quantity",
+			method:               "POST",
+			path:                 "/cart/items",
+			payload:              types.AddCartItemPayload{ProductID: 1, Quantity: -1},
+			mockCartStore:        &mockCartStore{},
+			mockProductStore:     &mockProductStore{},
+			expectedStatus:       http.StatusBadRequest,
+			expectedResponseBody: `{"error":"invalid payload: Key: 'AddCartItemPayload.Quantity' Error:Field validation for 'Quantity' failed on the 'min' tag"}`,
+		},
+		{
+			name:    "Update item",
+			method:  "PATCH",
+			path:    "/cart/items/1",
+			payload: types.UpdateCartItemPayload{Quantity: 3},
+			mockCartStore: &mockCartStore{
+				GetCartByUserIDFunc: storedCart,
+			},
+			mockProductStore:     &mockProductStore{},
+			expectedStatus:       http.StatusOK,
+			expectedResponseBody: `{"userId":1,"items":[{"productId":1,"quantity":3}]}`,
+		},
+		{
+			name:    "Update item not in cart",
+			method:  "PATCH",
+			path:    "/cart/items/2",
+			payload: types.UpdateCartItemPayload{Quantity: 3},
+			mockCartStore: &mockCartStore{
+				UpdateCartItemFunc: func(userID int, item types.CartItem) error {
+					return sql.ErrNoRows
+				},
+			},
+			mockProductStore:     &mockProductStore{},
+			expectedStatus:       http.StatusNotFound,
+			expectedResponseBody: `{"error":"cart item not found"}`,
+		},
+		{
+			name:                 "Update item with invalid product ID",
+			method:               "PATCH",
+			path:                 "/cart/items/abc",
+			payload:              types.UpdateCartItemPayload{Quantity: 3},
+			mockCartStore:        &mockCartStore{},
+			mockProductStore:     &mockProductStore{},
+			expectedStatus:       http.StatusBadRequest,
+			expectedResponseBody: `{"error":"Invalid product ID"}`,
+		},
+		{
+			name:   "Remove item",
+			method: "DELETE",
+			path:   "/cart/items/1",
+			mockCartStore: &mockCartStore{
+				RemoveCartItemFunc: func(userID int, productID int) error {
+					return nil
+				},
+			},
+			mockProductStore:     &mockProductStore{},
+			expectedStatus:       http.StatusOK,
+			expectedResponseBody: `{"userId":1,"items":[]}`,
+		},
+		{
+			name:   "Remove item not in cart",
+			method: "DELETE",
+			path:   "/cart/items/2",
+			mockCartStore: &mockCartStore{
+				RemoveCartItemFunc: func(userID int, productID int) error {
+					return sql.ErrNoRows
+				},
+			},
+			mockProductStore:     &mockProductStore{},
+			expectedStatus:       http.StatusNotFound,
+			expectedResponseBody: `{"error":"cart item not found"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewHandlers(tt.mockCartStore, tt.mockProductStore, &mockAddressStore{}, &mockUserStore{}, &mockNotifier{}, newMockTransactor(&mockOrderStore{}, tt.mockProductStore), auth.NewJWTAuthenticator([]byte(cfg.JWT.Secret)), cfg)
+			router := mux.NewRouter()
+			handler.RegisterRoutes(router)
+
+			var body io.Reader
+			if tt.payload != nil {
+				payload, err := json.Marshal(tt.payload)
+				assert.NoError(t, err)
+				body = bytes.NewReader(payload)
+			}
+
+			req, err := http.NewRequest(tt.method, tt.path, body)
+			assert.NoError(t, err)
+			token, err := generateTestToken([]byte(cfg.JWT.Secret), 1, time.Hour)
+			assert.NoError(t, err)
+			req.Header.Set("Authorization", "Bearer "+token)
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			assert.JSONEq(t, tt.expectedResponseBody, rr.Body.String())
+		})
+	}
+}
+
+func TestCheckoutRecordsUnitPrices(t *testing.T) {
+	cfg := &config.Config{
+		JWT: config.JWTConfig{
+			Secret: "testsecret",
+		},
+	}
+
+	prices := map[int]float64{1: 10, 2: 2.5}
+	var items []types.OrderItem
+	transactor := newMockTransactor(&mockOrderStore{
+		CreateOrderFunc: func(order types.Order) (int, error) {
+			assert.Equal(t, 27.5, order.Total)
+			return 123, nil
+		},
+		CreateOrderItemFunc: func(item types.OrderItem) error {
+			items = append(items, item)
+			return nil
+		},
+	}, &mockProductStore{
+		GetProductByIDFunc: func(id int) (*types.Product, error) {
+			return &types.Product{ID: id, Name: "Product " + strconv.Itoa(id), Image: "image.jpg", Price: prices[id], Quantity: 100}, nil
+		},
+	})
+
+	router := mux.NewRouter()
+	NewHandlers(&mockCartStore{}, &mockProductStore{}, &mockAddressStore{}, &mockUserStore{}, &mockNotifier{}, transactor, auth.NewJWTAuthenticator([]byte(cfg.JWT.Secret)), cfg).RegisterRoutes(router)
+
+	body, err := json.Marshal(types.CartCheckoutPayload{
+		Items: []types.CartItem{
+			{ProductID: 1, Quantity: 2},
+			{ProductID: 2, Quantity: 3},
+		},
 	})
-	tokenString, err := token.SignedString([]byte(cfg.JWT.Secret))
 	assert.NoError(t, err)
-	req.Header.Set("Authorization", "Bearer "+tokenString)
 
-	// Set the special header to bypass setting the user ID in the middleware
-	req.Header.Set("X-Bypass-UserID", "true")
-	log.Println("Set special header to bypass setting the user ID for test: Error Getting User ID from Context")
+	req, err := http.NewRequest("POST", "/cart/checkout", bytes.NewReader(body))
+	assert.NoError(t, err)
+	token, err := generateTestToken([]byte(cfg.JWT.Secret), 1, time.Hour)
+	assert.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
 
 	rr := httptest.NewRecorder()
 	router.ServeHTTP(rr, req)
 
-	log.Println("Test: Error Getting User ID from Context")
-	log.Println("Expected Status: 500, Actual Status:", rr.Code)
-	log.Println("Expected Body: {\"error\":\"user ID not found in context\"}, Actual Body:", rr.Body.String())
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, []types.OrderItem{
+		{OrderID: 123, ProductID: 1, Quantity: 2, Price: 10, Subtotal: 20, ProductName: "Product 1", ProductImage: "image.jpg"},
+		{OrderID: 123, ProductID: 2, Quantity: 3, Price: 2.5, Subtotal: 7.5, ProductName: "Product 2", ProductImage: "image.jpg"},
+	}, items)
+}
 
-	assert.Equal(t, http.StatusInternalServerError, rr.Code)
-	assert.JSONEq(t, `{"error":"user ID not found in context"}`, rr.Body.String())
+func TestCheckoutShippingAddress(t *testing.T) {
+	cfg := &config.Config{
+		JWT: config.JWTConfig{
+			Secret: "testsecret",
+		},
+	}
+
+	tests := []struct {
+		name                 string
+		payload              string
+		mockAddressStore     *mockAddressStore
+		expectedStatus       int
+		expectedResponseBody string
+		expectedAddress      string
+	}{
+		{
+			name:                 "Default address",
+			payload:              `{"items":[{"productId":1,"quantity":1}]}`,
+			mockAddressStore:     &mockAddressStore{},
+			expectedStatus:       http.StatusOK,
+			expectedResponseBody: `{"id":123,"total":10,"message":"Order created successfully"}`,
+			expectedAddress:      "1 Pike St, Seattle, WA 98101, US",
+		},
+		{
+			name:    "Saved address",
+			payload: `{"items":[{"productId":1,"quantity":1}],"addressId":5}`,
+			mockAddressStore: &mockAddressStore{
+				GetAddressByIDFunc: func(userID int, id int) (*types.Address, error) {
+					return &types.Address{ID: id, UserID: userID, Line1: "10 Downing St", City: "London", PostalCode: "SW1A 2AA", Country: "GB"}, nil
+				},
+			},
+			expectedStatus:       http.StatusOK,
+			expectedResponseBody: `{"id":123,"total":10,"message":"Order created successfully"}`,
+			expectedAddress:      "10 Downing St, London, SW1A 2AA, GB",
+		},
+		{
+			name:                 "Inline address",
+			payload:              `{"items":[{"productId":1,"quantity":1}],"address":{"line1":"1 Main St","line2":"Apt 2","city":"Portland","region":"OR","postalCode":"97201","country":"us"}}`,
+			mockAddressStore:     &mockAddressStore{},
+			expectedStatus:       http.StatusOK,
+			expectedResponseBody: `{"id":123,"total":10,"message":"Order created successfully"}`,
+			expectedAddress:      "1 Main St, Apt 2, Portland, OR 97201, US",
+		},
+		{
+			name:                 "Invalid inline address",
+			payload:              `{"items":[{"productId":1,"quantity":1}],"address":{"line1":"1 Main St","postalCode":"97201","country":"USA"}}`,
+			mockAddressStore:     &mockAddressStore{},
+			expectedStatus:       http.StatusBadRequest,
+			expectedResponseBody: `{"error":"invalid payload: Key: 'CartCheckoutPayload.Address.City' Error:Field validation for 'City' failed on the 'required' tag\nKey: 'CartCheckoutPayload.Address.Country' Error:Field validation for 'Country' failed on the 'len' tag"}`,
+		},
+		{
+			name:                 "Unknown saved address",
+			payload:              `{"items":[{"productId":1,"quantity":1}],"addressId":5}`,
+			mockAddressStore:     &mockAddressStore{},
+			expectedStatus:       http.StatusBadRequest,
+			expectedResponseBody: `{"error":"address not found"}`,
+		},
+		{
+			name:                 "Both saved and inline address",
+			payload:              `{"items":[{"productId":1,"quantity":1}],"addressId":5,"address":{"line1":"1 Main St","city":"Portland","postalCode":"97201","country":"US"}}`,
+			mockAddressStore:     &mockAddressStore{},
+			expectedStatus:       http.StatusBadRequest,
+			expectedResponseBody: `{"error":"provide either addressId or address, not both"}`,
+		},
+		{
+			name:    "No address at all",
+			payload: `{"items":[{"productId":1,"quantity":1}]}`,
+			mockAddressStore: &mockAddressStore{
+				GetDefaultAddressFunc: func(userID int) (*types.Address, error) {
+					return nil, sql.ErrNoRows
+				},
+			},
+			expectedStatus:       http.StatusBadRequest,
+			expectedResponseBody: `{"error":"shipping address is required"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var orderAddress string
+			products := &mockProductStore{
+				GetProductByIDFunc: func(id int) (*types.Product, error) {
+					return &types.Product{ID: id, Name: "Test Product", Price: 10, Quantity: 100}, nil
+				},
+			}
+			transactor := newMockTransactor(&mockOrderStore{
+				CreateOrderFunc: func(order types.Order) (int, error) {
+					orderAddress = order.Address
+					return 123, nil
+				},
+			}, products)
+
+			router := mux.NewRouter()
+			NewHandlers(&mockCartStore{}, products, tt.mockAddressStore, &mockUserStore{}, &mockNotifier{}, transactor, auth.NewJWTAuthenticator([]byte(cfg.JWT.Secret)), cfg).RegisterRoutes(router)
+
+			req, err := http.NewRequest("POST", "/cart/checkout", bytes.NewReader([]byte(tt.payload)))
+			assert.NoError(t, err)
+			token, err := generateTestToken([]byte(cfg.JWT.Secret), 1, time.Hour)
+			assert.NoError(t, err)
+			req.Header.Set("Authorization", "Bearer "+token)
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			assert.JSONEq(t, tt.expectedResponseBody, rr.Body.String())
+			assert.Equal(t, tt.expectedAddress, orderAddress)
+		})
+	}
+}
+
+func TestCheckoutRequiresVerifiedEmail(t *testing.T) {
+	verifiedAt := time.Now()
+
+	tests := []struct {
+		name                 string
+		requireVerified      bool
+		user                 *types.User
+		userErr              error
+		expectedStatus       int
+		expectedResponseBody string
+	}{
+		{
+			name:                 "Not required",
+			user:                 &types.User{ID: 1},
+			expectedStatus:       http.StatusOK,
+			expectedResponseBody: `{"id":123,"total":10,"message":"Order created successfully"}`,
+		},
+		{
+			name:                 "Verified user",
+			requireVerified:      true,
+			user:                 &types.User{ID: 1, EmailVerifiedAt: &verifiedAt},
+			expectedStatus:       http.StatusOK,
+			expectedResponseBody: `{"id":123,"total":10,"message":"Order created successfully"}`,
+		},
+		{
+			name:                 "Unverified user",
+			requireVerified:      true,
+			user:                 &types.User{ID: 1},
+			expectedStatus:       http.StatusForbidden,
+			expectedResponseBody: `{"error":"` + utils.ErrEmailNotVerified + `"}`,
+		},
+		{
+			name:                 "Error getting user",
+			requireVerified:      true,
+			userErr:              fmt.Errorf("db error"),
+			expectedStatus:       http.StatusInternalServerError,
+			expectedResponseBody: `{"error":"` + utils.ErrInternalServerError + `"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				JWT:                             config.JWTConfig{Secret: "testsecret"},
+				RequireVerifiedEmailForCheckout: tt.requireVerified,
+			}
+			products := &mockProductStore{
+				GetProductByIDFunc: func(id int) (*types.Product, error) {
+					return &types.Product{ID: id, Price: 10, Quantity: 100}, nil
+				},
+			}
+			users := &mockUserStore{
+				GetUserByIDFunc: func(id int) (*types.User, error) {
+					return tt.user, tt.userErr
+				},
+			}
+			transactor := newMockTransactor(&mockOrderStore{
+				CreateOrderFunc: func(order types.Order) (int, error) {
+					return 123, nil
+				},
+			}, products)
+
+			router := mux.NewRouter()
+			NewHandlers(&mockCartStore{}, products, &mockAddressStore{}, users, &mockNotifier{}, transactor, auth.NewJWTAuthenticator([]byte(cfg.JWT.Secret)), cfg).RegisterRoutes(router)
+
+			req, err := http.NewRequest("POST", "/cart/checkout", bytes.NewReader([]byte(`{"items":[{"productId":1,"quantity":1}]}`)))
+			assert.NoError(t, err)
+			token, err := generateTestToken([]byte(cfg.JWT.Secret), 1, time.Hour)
+			assert.NoError(t, err)
+			req.Header.Set("Authorization", "Bearer "+token)
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			assert.JSONEq(t, tt.expectedResponseBody, rr.Body.String())
+		})
+	}
+}
+
+func TestCheckoutSendsOrderConfirmation(t *testing.T) {
+	cfg := &config.Config{
+		JWT: config.JWTConfig{
+			Secret: "testsecret",
+		},
+	}
+	products := &mockProductStore{
+		GetProductByIDFunc: func(id int) (*types.Product, error) {
+			return &types.Product{ID: id, Name: "Product " + strconv.Itoa(id), Price: 10, Quantity: 100}, nil
+		},
+	}
+	transactor := newMockTransactor(&mockOrderStore{
+		CreateOrderFunc: func(order types.Order) (int, error) {
+			return 123, nil
+		},
+	}, products)
+	notifier := &mockNotifier{}
+
+	handler := NewHandlers(&mockCartStore{}, products, &mockAddressStore{}, &mockUserStore{}, notifier, transactor, auth.NewJWTAuthenticator([]byte(cfg.JWT.Secret)), cfg)
+	handler.async = func(fn func()) { fn() }
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	req, err := http.NewRequest("POST", "/cart/checkout", bytes.NewReader([]byte(`{"items":[{"productId":1,"quantity":2}]}`)))
+	assert.NoError(t, err)
+	token, err := generateTestToken([]byte(cfg.JWT.Secret), 1, time.Hour)
+	assert.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, []*types.Order{{
+		ID:      123,
+		UserID:  1,
+		Total:   20,
+		Status:  types.OrderStatusPending,
+		Address: "1 Pike St, Seattle, WA 98101, US",
+		Items: []types.OrderItem{
+			{OrderID: 123, ProductID: 1, Quantity: 2, Price: 10, Subtotal: 20, ProductName: "Product 1"},
+		},
+	}}, notifier.orders)
 }
@@ -0,0 +1,124 @@
+package cart
+
+import (
+	"database/sql"
+
+	"github.com/loloDawit/ecom/config"
+	"github.com/loloDawit/ecom/db"
+	"github.com/loloDawit/ecom/types"
+)
+
+type CartStore struct {
+	db  *sql.DB
+	tx  *sql.Tx
+	cfg *config.Config
+}
+
+func NewCartStore(db *sql.DB, cfg *config.Config) *CartStore {
+	return &CartStore{db: db, cfg: cfg}
+}
+
+// WithTx returns a copy of the store whose queries run inside tx.
+func (s *CartStore) WithTx(tx *sql.Tx) *CartStore {
+	return &CartStore{db: s.db, tx: tx, cfg: s.cfg}
+}
+
+// conn returns the transaction the store is bound to, or the pool otherwise.
+func (s *CartStore) conn() db.DBTX {
+	if s.tx != nil {
+		return s.tx
+	}
+	return s.db
+}
+
+// GetCartByUserID returns the user's cart. A user who never added anything
+// gets an empty cart rather than an error.
+func (s *CartStore) GetCartByUserID(userID int) (*types.Cart, error) {
+	rows, err := s.conn().Query(
+		"SELECT ci.productId, ci.quantity FROM cart_items ci JOIN carts c ON c.id = ci.cartId WHERE c.userId = $1 ORDER BY ci.id",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cart := &types.Cart{UserID: userID, Items: []types.CartItem{}}
+	for rows.Next() {
+		item := types.CartItem{}
+		if err := rows.Scan(&item.ProductID, &item.Quantity); err != nil {
+			return nil, err
+		}
+		cart.Items = append(cart.Items, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return cart, nil
+}
+
+// AddCartItem adds item to the user's cart, creating the cart on first use.
+// Adding a product that is already in the cart increases its quantity.
+func (s *CartStore) AddCartItem(userID int, item types.CartItem) error {
+	var cartID int
+	err := s.conn().QueryRow(
+		"INSERT INTO carts (userId) VALUES ($1) ON CONFLICT (userId) DO UPDATE SET updatedAt = CURRENT_TIMESTAMP RETURNING id",
+		userID,
+	).Scan(&cartID)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.conn().Exec(
+		"INSERT INTO cart_items (cartId, productId, quantity) VALUES ($1, $2, $3) ON CONFLICT (cartId, productId) DO UPDATE SET quantity = cart_items.quantity + EXCLUDED.quantity",
+		cartID, item.ProductID, item.Quantity,
+	)
+	return err
+}
+
+// UpdateCartItem sets the quantity of a product already in the user's cart.
+// It returns sql.ErrNoRows if the product is not in the cart.
+func (s *CartStore) UpdateCartItem(userID int, item types.CartItem) error {
+	result, err := s.conn().Exec(
+		"UPDATE cart_items SET quantity = $1 WHERE productId = $2 AND cartId = (SELECT id FROM carts WHERE userId = $3)",
+		item.Quantity, item.ProductID, userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	return requireRowsAffected(result)
+}
+
+// RemoveCartItem deletes a product from the user's cart. It returns
+// sql.ErrNoRows if the product is not in the cart.
+func (s *CartStore) RemoveCartItem(userID int, productID int) error {
+	result, err := s.conn().Exec(
+		"DELETE FROM cart_items WHERE productId = $1 AND cartId = (SELECT id FROM carts WHERE userId = $2)",
+		productID, userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	return requireRowsAffected(result)
+}
+
+// ClearCart removes every item from the user's cart.
+func (s *CartStore) ClearCart(userID int) error {
+	_, err := s.conn().Exec("DELETE FROM cart_items WHERE cartId = (SELECT id FROM carts WHERE userId = $1)", userID)
+	return err
+}
+
+func requireRowsAffected(result sql.Result) error {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
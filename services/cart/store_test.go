@@ -0,0 +1,194 @@
+package cart
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/loloDawit/ecom/config"
+	"github.com/loloDawit/ecom/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetCartByUserID(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	store := NewCartStore(db, &config.Config{})
+
+	tests := []struct {
+		name         string
+		mockQuery    func()
+		expectedCart *types.Cart
+		expectedErr  error
+	}{
+		{
+			name: "Cart with items",
+			mockQuery: func() {
+				rows := sqlmock.NewRows([]string{"productId", "quantity"}).
+					AddRow(1, 2).
+					AddRow(3, 1)
+				mock.ExpectQuery("SELECT ci.productId, ci.quantity FROM cart_items ci JOIN carts c ON c.id = ci.cartId WHERE c.userId = \\$1").
+					WithArgs(1).
+					WillReturnRows(rows)
+			},
+			expectedCart: &types.Cart{UserID: 1, Items: []types.CartItem{{ProductID: 1, Quantity: 2}, {ProductID: 3, Quantity: 1}}},
+			expectedErr:  nil,
+		},
+		{
+			name: "No cart yet",
+			mockQuery: func() {
+				mock.ExpectQuery("SELECT ci.productId, ci.quantity FROM cart_items ci JOIN carts c ON c.id = ci.cartId WHERE c.userId = \\$1").
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"productId", "quantity"}))
+			},
+			expectedCart: &types.Cart{UserID: 1, Items: []types.CartItem{}},
+			expectedErr:  nil,
+		},
+		{
+			name: "Database error",
+			mockQuery: func() {
+				mock.ExpectQuery("SELECT ci.productId, ci.quantity FROM cart_items ci JOIN carts c ON c.id = ci.cartId WHERE c.userId = \\$1").
+					WithArgs(1).
+					WillReturnError(sql.ErrConnDone)
+			},
+			expectedCart: nil,
+			expectedErr:  sql.ErrConnDone,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockQuery()
+			cart, err := store.GetCartByUserID(1)
+			assert.Equal(t, tt.expectedErr, err)
+			assert.Equal(t, tt.expectedCart, cart)
+		})
+	}
+}
+
+func TestAddCartItem(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	store := NewCartStore(db, &config.Config{})
+
+	tests := []struct {
+		name        string
+		mockQuery   func()
+		expectedErr error
+	}{
+		{
+			name: "Successful add",
+			mockQuery: func() {
+				mock.ExpectQuery("INSERT INTO carts \\(userId\\) VALUES \\(\\$1\\) ON CONFLICT \\(userId\\)").
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+				mock.ExpectExec("INSERT INTO cart_items \\(cartId, productId, quantity\\) VALUES \\(\\$1, \\$2, \\$3\\) ON CONFLICT \\(cartId, productId\\)").
+					WithArgs(5, 2, 3).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+			},
+			expectedErr: nil,
+		},
+		{
+			name: "Database error creating cart",
+			mockQuery: func() {
+				mock.ExpectQuery("INSERT INTO carts \\(userId\\) VALUES \\(\\$1\\) ON CONFLICT \\(userId\\)").
+					WithArgs(1).
+					WillReturnError(sql.ErrConnDone)
+			},
+			expectedErr: sql.ErrConnDone,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockQuery()
+			err := store.AddCartItem(1, types.CartItem{ProductID: 2, Quantity: 3})
+			assert.Equal(t, tt.expectedErr, err)
+		})
+	}
+}
+
+func TestUpdateAndRemoveCartItem(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	store := NewCartStore(db, &config.Config{})
+
+	tests := []struct {
+		name        string
+		mockExec    func()
+		call        func() error
+		expectedErr error
+	}{
+		{
+			name: "Update existing item",
+			mockExec: func() {
+				mock.ExpectExec("UPDATE cart_items SET quantity = \\$1 WHERE productId = \\$2").
+					WithArgs(4, 2, 1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			call:        func() error { return store.UpdateCartItem(1, types.CartItem{ProductID: 2, Quantity: 4}) },
+			expectedErr: nil,
+		},
+		{
+			name: "Update missing item",
+			mockExec: func() {
+				mock.ExpectExec("UPDATE cart_items SET quantity = \\$1 WHERE productId = \\$2").
+					WithArgs(4, 2, 1).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			call:        func() error { return store.UpdateCartItem(1, types.CartItem{ProductID: 2, Quantity: 4}) },
+			expectedErr: sql.ErrNoRows,
+		},
+		{
+			name: "Remove existing item",
+			mockExec: func() {
+				mock.ExpectExec("DELETE FROM cart_items WHERE productId = \\$1").
+					WithArgs(2, 1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			call:        func() error { return store.RemoveCartItem(1, 2) },
+			expectedErr: nil,
+		},
+		{
+			name: "Remove missing item",
+			mockExec: func() {
+				mock.ExpectExec("DELETE FROM cart_items WHERE productId = \\$1").
+					WithArgs(2, 1).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			call:        func() error { return store.RemoveCartItem(1, 2) },
+			expectedErr: sql.ErrNoRows,
+		},
+		{
+			name: "Clear cart",
+			mockExec: func() {
+				mock.ExpectExec("DELETE FROM cart_items WHERE cartId = \\(SELECT id FROM carts WHERE userId = \\$1\\)").
+					WithArgs(1).
+					WillReturnResult(sqlmock.NewResult(0, 2))
+			},
+			call:        func() error { return store.ClearCart(1) },
+			expectedErr: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockExec()
+			err := tt.call()
+			assert.Equal(t, tt.expectedErr, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
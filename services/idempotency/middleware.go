@@ -0,0 +1,231 @@
+package idempotency
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/loloDawit/ecom/services/auth"
+	"github.com/loloDawit/ecom/types"
+	"github.com/loloDawit/ecom/utils"
+)
+
+const (
+	// Header is the request header clients use to make a request safe to retry.
+	Header = "Idempotency-Key"
+	// ReplayedHeader is set on responses served from a stored record.
+	ReplayedHeader = "Idempotent-Replayed"
+	// RecordTTL is how long a key is remembered before it can be reused.
+	RecordTTL = 24 * time.Hour
+	// PurgeInterval is how often expired records are deleted.
+	PurgeInterval = time.Hour
+
+	maxKeyLength = 255
+)
+
+// Middleware makes unsafe requests carrying an Idempotency-Key header run at
+// most once. The first response is stored and replayed for retries with the
+// same key; a retry whose method, path or body differs is rejected with 422.
+// Responses with a 5xx status are not stored, leaving the key free to retry,
+// and neither are responses marked Cache-Control: no-store.
+//
+// Keys belong to the authenticated user, so it must run after
+// auth.Middleware. Responses are kept in plaintext for RecordTTL: only wrap
+// routes whose responses hold no credentials, and never the login, token,
+// password, two-factor or API key routes.
+func Middleware(store types.IdempotencyStore) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(Header)
+			if key == "" || !isUnsafe(r.Method) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if len(key) > maxKeyLength {
+				utils.WriteError(w, http.StatusBadRequest, utils.ErrInvalidIdempotency)
+				return
+			}
+
+			userID, err := auth.GetUserIDFromContext(r.Context())
+			if err != nil {
+				utils.WriteError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+
+			var body []byte
+			if r.Body != nil {
+				body, err = io.ReadAll(r.Body)
+				if err != nil {
+					utils.WriteError(w, http.StatusBadRequest, utils.ErrInvalidRequestBody)
+					return
+				}
+				r.Body = io.NopCloser(bytes.NewReader(body))
+			}
+
+			record := types.IdempotencyRecord{
+				Key:         key,
+				UserID:      userID,
+				Fingerprint: fingerprint(r, body),
+			}
+
+			reserved, err := store.ReserveIdempotencyKey(record, time.Now().Add(-RecordTTL))
+			if err != nil {
+				log.Printf("error reserving idempotency key %q: %v", key, err)
+				utils.WriteError(w, http.StatusInternalServerError, utils.ErrInternalServerError)
+				return
+			}
+
+			if !reserved {
+				replay(w, store, record)
+				return
+			}
+
+			recorder := &responseRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+			completed := false
+			defer func() {
+				if completed {
+					return
+				}
+				if err := store.DeleteIdempotencyRecord(record.Key, record.UserID); err != nil {
+					log.Printf("error releasing idempotency key %q: %v", key, err)
+				}
+			}()
+
+			next.ServeHTTP(recorder, r)
+
+			// responses carrying secrets are marked no-store and must not be
+			// kept; the key is released instead, like after a server error
+			if recorder.statusCode >= http.StatusInternalServerError || noStore(recorder.Header()) {
+				return
+			}
+
+			record.StatusCode = recorder.statusCode
+			record.ContentType = recorder.Header().Get("Content-Type")
+			record.ResponseBody = recorder.body.Bytes()
+			if err := store.SaveIdempotencyResponse(record); err != nil {
+				log.Printf("error saving response for idempotency key %q: %v", key, err)
+				return
+			}
+			completed = true
+		}
+	}
+}
+
+// PurgeExpired deletes the records older than RecordTTL, which could no
+// longer be replayed anyway.
+func PurgeExpired(store types.IdempotencyStore, now time.Time) (int64, error) {
+	return store.DeleteExpiredIdempotencyRecords(now.Add(-RecordTTL))
+}
+
+// StartPurging runs PurgeExpired every interval in the background for the
+// life of the process.
+func StartPurging(store types.IdempotencyStore, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			purged, err := PurgeExpired(store, now)
+			if err != nil {
+				log.Printf("error purging expired idempotency keys: %v", err)
+				continue
+			}
+			if purged > 0 {
+				log.Printf("purged %d expired idempotency keys", purged)
+			}
+		}
+	}()
+}
+
+// replay answers a retry of a request whose key is already held.
+func replay(w http.ResponseWriter, store types.IdempotencyStore, record types.IdempotencyRecord) {
+	existing, err := store.GetIdempotencyRecord(record.Key, record.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		// the original request failed and released the key in the meantime
+		utils.WriteError(w, http.StatusConflict, utils.ErrIdempotencyInFlight)
+		return
+	}
+	if err != nil {
+		log.Printf("error loading idempotency key %q: %v", record.Key, err)
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrInternalServerError)
+		return
+	}
+
+	if existing.Fingerprint != record.Fingerprint {
+		utils.WriteError(w, http.StatusUnprocessableEntity, utils.ErrIdempotencyMismatch)
+		return
+	}
+
+	if existing.StatusCode == 0 {
+		utils.WriteError(w, http.StatusConflict, utils.ErrIdempotencyInFlight)
+		return
+	}
+
+	if existing.ContentType != "" {
+		w.Header().Set("Content-Type", existing.ContentType)
+	}
+	w.Header().Set(ReplayedHeader, "true")
+	w.WriteHeader(existing.StatusCode)
+	w.Write(existing.ResponseBody)
+}
+
+func noStore(header http.Header) bool {
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		if strings.EqualFold(strings.TrimSpace(directive), "no-store") {
+			return true
+		}
+	}
+	return false
+}
+
+func isUnsafe(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func fingerprint(r *http.Request, body []byte) string {
+	var b bytes.Buffer
+	b.WriteString(r.Method)
+	b.WriteByte('\n')
+	b.WriteString(r.URL.RequestURI())
+	b.WriteByte('\n')
+	b.Write(body)
+	return hash(b.Bytes())
+}
+
+func hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// responseRecorder passes the response through while keeping a copy of it.
+type responseRecorder struct {
+	http.ResponseWriter
+	statusCode  int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (rr *responseRecorder) WriteHeader(statusCode int) {
+	if !rr.wroteHeader {
+		rr.statusCode = statusCode
+		rr.wroteHeader = true
+	}
+	rr.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	rr.wroteHeader = true
+	rr.body.Write(b)
+	return rr.ResponseWriter.Write(b)
+}
@@ -0,0 +1,298 @@
+package idempotency
+
+import (
+	"bytes"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/loloDawit/ecom/services/auth"
+	"github.com/loloDawit/ecom/types"
+	"github.com/loloDawit/ecom/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordID identifies a record in memoryStore.
+type recordID struct {
+	key    string
+	userID int
+}
+
+// memoryStore is an in-memory IdempotencyStore keyed by key and user.
+type memoryStore struct {
+	records map[recordID]types.IdempotencyRecord
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{records: map[recordID]types.IdempotencyRecord{}}
+}
+
+func (m *memoryStore) ReserveIdempotencyKey(record types.IdempotencyRecord, expiredBefore time.Time) (bool, error) {
+	id := recordID{record.Key, record.UserID}
+	if existing, ok := m.records[id]; ok && !existing.CreatedAt.Before(expiredBefore) {
+		return false, nil
+	}
+	record.CreatedAt = time.Now()
+	m.records[id] = record
+	return true, nil
+}
+
+func (m *memoryStore) GetIdempotencyRecord(key string, userID int) (*types.IdempotencyRecord, error) {
+	record, ok := m.records[recordID{key, userID}]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &record, nil
+}
+
+func (m *memoryStore) SaveIdempotencyResponse(record types.IdempotencyRecord) error {
+	id := recordID{record.Key, record.UserID}
+	record.CreatedAt = m.records[id].CreatedAt
+	m.records[id] = record
+	return nil
+}
+
+func (m *memoryStore) DeleteIdempotencyRecord(key string, userID int) error {
+	delete(m.records, recordID{key, userID})
+	return nil
+}
+
+func (m *memoryStore) DeleteExpiredIdempotencyRecords(expiredBefore time.Time) (int64, error) {
+	var deleted int64
+	for id, record := range m.records {
+		if record.CreatedAt.Before(expiredBefore) {
+			delete(m.records, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// countingHandler creates a new order ID on every call so replays are easy
+// to tell apart from fresh executions.
+func countingHandler(calls *int, status int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		*calls++
+		utils.WriteJSON(w, status, map[string]int{"id": *calls})
+	}
+}
+
+// send makes the request as the given user, as auth.Middleware would have
+// authenticated it.
+func send(handler http.HandlerFunc, method string, key string, userID int, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/cart/checkout", bytes.NewReader([]byte(body)))
+	if key != "" {
+		req.Header.Set(Header, key)
+	}
+	req = req.WithContext(auth.WithIdentity(req.Context(), auth.Identity{UserID: userID}))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestMiddlewareReplaysStoredResponse(t *testing.T) {
+	calls := 0
+	handler := Middleware(newMemoryStore())(countingHandler(&calls, http.StatusCreated))
+
+	first := send(handler, "POST", "abc", 7, `{"items":[]}`)
+	assert.Equal(t, http.StatusCreated, first.Code)
+	assert.JSONEq(t, `{"id":1}`, first.Body.String())
+	assert.Empty(t, first.Header().Get(ReplayedHeader))
+
+	retry := send(handler, "POST", "abc", 7, `{"items":[]}`)
+	assert.Equal(t, http.StatusCreated, retry.Code)
+	assert.JSONEq(t, `{"id":1}`, retry.Body.String())
+	assert.Equal(t, "application/json", retry.Header().Get("Content-Type"))
+	assert.Equal(t, "true", retry.Header().Get(ReplayedHeader))
+	assert.Equal(t, 1, calls)
+}
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name                 string
+		setup                func(store *memoryStore, handler http.HandlerFunc)
+		method               string
+		key                  string
+		userID               int
+		body                 string
+		status               int
+		expectedStatus       int
+		expectedResponseBody string
+		expectedCalls        int
+	}{
+		{
+			name:                 "No key runs the handler every time",
+			setup:                func(store *memoryStore, handler http.HandlerFunc) { send(handler, "POST", "", 7, `{}`) },
+			method:               "POST",
+			body:                 `{}`,
+			status:               http.StatusCreated,
+			expectedStatus:       http.StatusCreated,
+			expectedResponseBody: `{"id":2}`,
+			expectedCalls:        2,
+		},
+		{
+			name:                 "Safe methods ignore the key",
+			setup:                func(store *memoryStore, handler http.HandlerFunc) { send(handler, "GET", "abc", 7, "") },
+			method:               "GET",
+			key:                  "abc",
+			status:               http.StatusOK,
+			expectedStatus:       http.StatusOK,
+			expectedResponseBody: `{"id":2}`,
+			expectedCalls:        2,
+		},
+		{
+			name:                 "Different body with the same key",
+			setup:                func(store *memoryStore, handler http.HandlerFunc) { send(handler, "POST", "abc", 7, `{"quantity":1}`) },
+			method:               "POST",
+			key:                  "abc",
+			body:                 `{"quantity":2}`,
+			status:               http.StatusCreated,
+			expectedStatus:       http.StatusUnprocessableEntity,
+			expectedResponseBody: `{"error":"idempotency key was already used with a different request"}`,
+			expectedCalls:        1,
+		},
+		{
+			name:                 "Same key from another client",
+			setup:                func(store *memoryStore, handler http.HandlerFunc) { send(handler, "POST", "abc", 7, `{}`) },
+			method:               "POST",
+			key:                  "abc",
+			userID:               8,
+			body:                 `{}`,
+			status:               http.StatusCreated,
+			expectedStatus:       http.StatusCreated,
+			expectedResponseBody: `{"id":2}`,
+			expectedCalls:        2,
+		},
+		{
+			name: "Original request still in flight",
+			setup: func(store *memoryStore, handler http.HandlerFunc) {
+				req := httptest.NewRequest("POST", "/cart/checkout", strings.NewReader(`{}`))
+				store.ReserveIdempotencyKey(types.IdempotencyRecord{Key: "abc", UserID: 7, Fingerprint: fingerprint(req, []byte(`{}`))}, time.Now())
+			},
+			method:               "POST",
+			key:                  "abc",
+			body:                 `{}`,
+			status:               http.StatusCreated,
+			expectedStatus:       http.StatusConflict,
+			expectedResponseBody: `{"error":"a request with this idempotency key is still being processed"}`,
+			expectedCalls:        0,
+		},
+		{
+			name: "Expired key runs again",
+			setup: func(store *memoryStore, handler http.HandlerFunc) {
+				send(handler, "POST", "abc", 7, `{}`)
+				record := store.records[recordID{"abc", 7}]
+				record.CreatedAt = time.Now().Add(-2 * RecordTTL)
+				store.records[recordID{"abc", 7}] = record
+			},
+			method:               "POST",
+			key:                  "abc",
+			body:                 `{}`,
+			status:               http.StatusCreated,
+			expectedStatus:       http.StatusCreated,
+			expectedResponseBody: `{"id":2}`,
+			expectedCalls:        2,
+		},
+		{
+			name:                 "Server errors are not stored",
+			setup:                func(store *memoryStore, handler http.HandlerFunc) { send(handler, "POST", "abc", 7, `{}`) },
+			method:               "POST",
+			key:                  "abc",
+			body:                 `{}`,
+			status:               http.StatusInternalServerError,
+			expectedStatus:       http.StatusInternalServerError,
+			expectedResponseBody: `{"id":2}`,
+			expectedCalls:        2,
+		},
+		{
+			name:                 "Key too long",
+			setup:                func(store *memoryStore, handler http.HandlerFunc) {},
+			method:               "POST",
+			key:                  strings.Repeat("k", maxKeyLength+1),
+			body:                 `{}`,
+			status:               http.StatusCreated,
+			expectedStatus:       http.StatusBadRequest,
+			expectedResponseBody: `{"error":"idempotency key must be between 1 and 255 characters"}`,
+			expectedCalls:        0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			store := newMemoryStore()
+			handler := Middleware(store)(countingHandler(&calls, tt.status))
+
+			tt.setup(store, handler)
+			userID := tt.userID
+			if userID == 0 {
+				userID = 7
+			}
+			rr := send(handler, tt.method, tt.key, userID, tt.body)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			assert.JSONEq(t, tt.expectedResponseBody, rr.Body.String())
+			assert.Equal(t, tt.expectedCalls, calls)
+		})
+	}
+}
+
+func TestMiddlewareReleasesKeyOnPanic(t *testing.T) {
+	store := newMemoryStore()
+	handler := Middleware(store)(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+
+	assert.Panics(t, func() { send(handler, "POST", "abc", 7, `{}`) })
+	assert.Empty(t, store.records)
+}
+
+func TestMiddlewareSkipsNoStoreResponses(t *testing.T) {
+	calls := 0
+	store := newMemoryStore()
+	handler := Middleware(store)(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Cache-Control", "private, no-store")
+		utils.WriteJSON(w, http.StatusCreated, map[string]string{"secret": "s3cr3t"})
+	})
+
+	first := send(handler, "POST", "abc", 7, `{}`)
+	assert.Equal(t, http.StatusCreated, first.Code)
+	assert.Empty(t, store.records)
+
+	retry := send(handler, "POST", "abc", 7, `{}`)
+	assert.Equal(t, http.StatusCreated, retry.Code)
+	assert.Empty(t, retry.Header().Get(ReplayedHeader))
+	assert.Equal(t, 2, calls)
+}
+
+func TestMiddlewareRequiresAuthenticatedUser(t *testing.T) {
+	calls := 0
+	store := newMemoryStore()
+	handler := Middleware(store)(countingHandler(&calls, http.StatusCreated))
+
+	req := httptest.NewRequest("POST", "/cart/checkout", strings.NewReader(`{}`))
+	req.Header.Set(Header, "abc")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.Equal(t, 0, calls)
+	assert.Empty(t, store.records)
+}
+
+func TestPurgeExpired(t *testing.T) {
+	store := newMemoryStore()
+	now := time.Now()
+	store.records[recordID{"old", 7}] = types.IdempotencyRecord{Key: "old", UserID: 7, CreatedAt: now.Add(-RecordTTL - time.Minute)}
+	store.records[recordID{"new", 7}] = types.IdempotencyRecord{Key: "new", UserID: 7, CreatedAt: now.Add(-time.Minute)}
+
+	purged, err := PurgeExpired(store, now)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+	assert.Contains(t, store.records, recordID{"new", 7})
+	assert.NotContains(t, store.records, recordID{"old", 7})
+}
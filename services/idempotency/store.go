@@ -0,0 +1,77 @@
+package idempotency
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/loloDawit/ecom/config"
+	"github.com/loloDawit/ecom/types"
+)
+
+type IdempotencyStore struct {
+	db  *sql.DB
+	cfg *config.Config
+}
+
+func NewIdempotencyStore(db *sql.DB, cfg *config.Config) *IdempotencyStore {
+	return &IdempotencyStore{db: db, cfg: cfg}
+}
+
+// ReserveIdempotencyKey inserts an in-flight record for the key. A record
+// older than expiredBefore is overwritten so keys can be reused once they
+// have aged out.
+func (s *IdempotencyStore) ReserveIdempotencyKey(record types.IdempotencyRecord, expiredBefore time.Time) (bool, error) {
+	var key string
+	err := s.db.QueryRow(
+		`INSERT INTO idempotency_keys (key, userId, fingerprint) VALUES ($1, $2, $3)
+		ON CONFLICT (key, userId) DO UPDATE SET fingerprint = EXCLUDED.fingerprint, statusCode = NULL, contentType = '', responseBody = NULL, createdAt = CURRENT_TIMESTAMP
+		WHERE idempotency_keys.createdAt < $4
+		RETURNING key`,
+		record.Key, record.UserID, record.Fingerprint, expiredBefore,
+	).Scan(&key)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (s *IdempotencyStore) GetIdempotencyRecord(key string, userID int) (*types.IdempotencyRecord, error) {
+	record := types.IdempotencyRecord{Key: key, UserID: userID}
+	var statusCode sql.NullInt64
+	err := s.db.QueryRow(
+		"SELECT fingerprint, statusCode, contentType, responseBody, createdAt FROM idempotency_keys WHERE key = $1 AND userId = $2",
+		key, userID,
+	).Scan(&record.Fingerprint, &statusCode, &record.ContentType, &record.ResponseBody, &record.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	record.StatusCode = int(statusCode.Int64)
+
+	return &record, nil
+}
+
+func (s *IdempotencyStore) SaveIdempotencyResponse(record types.IdempotencyRecord) error {
+	_, err := s.db.Exec(
+		"UPDATE idempotency_keys SET statusCode = $1, contentType = $2, responseBody = $3 WHERE key = $4 AND userId = $5",
+		record.StatusCode, record.ContentType, record.ResponseBody, record.Key, record.UserID,
+	)
+	return err
+}
+
+func (s *IdempotencyStore) DeleteIdempotencyRecord(key string, userID int) error {
+	_, err := s.db.Exec("DELETE FROM idempotency_keys WHERE key = $1 AND userId = $2", key, userID)
+	return err
+}
+
+func (s *IdempotencyStore) DeleteExpiredIdempotencyRecords(expiredBefore time.Time) (int64, error) {
+	result, err := s.db.Exec("DELETE FROM idempotency_keys WHERE createdAt < $1", expiredBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,129 @@
+package idempotency
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/loloDawit/ecom/config"
+	"github.com/loloDawit/ecom/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReserveIdempotencyKey(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	store := NewIdempotencyStore(db, &config.Config{})
+	record := types.IdempotencyRecord{Key: "abc", UserID: 7, Fingerprint: "fp"}
+	expiredBefore := time.Now().Add(-RecordTTL)
+
+	tests := []struct {
+		name             string
+		mockQuery        func()
+		expectedReserved bool
+		expectedErr      error
+	}{
+		{
+			name: "New key",
+			mockQuery: func() {
+				mock.ExpectQuery("INSERT INTO idempotency_keys \\(key, userId, fingerprint\\) VALUES \\(\\$1, \\$2, \\$3\\) ON CONFLICT \\(key, userId\\) DO UPDATE (.+) WHERE idempotency_keys.createdAt < \\$4 RETURNING key").
+					WithArgs("abc", 7, "fp", expiredBefore).
+					WillReturnRows(sqlmock.NewRows([]string{"key"}).AddRow("abc"))
+			},
+			expectedReserved: true,
+		},
+		{
+			name: "Key already held",
+			mockQuery: func() {
+				mock.ExpectQuery("INSERT INTO idempotency_keys (.+) RETURNING key").
+					WithArgs("abc", 7, "fp", expiredBefore).
+					WillReturnRows(sqlmock.NewRows([]string{"key"}))
+			},
+			expectedReserved: false,
+		},
+		{
+			name: "Database error",
+			mockQuery: func() {
+				mock.ExpectQuery("INSERT INTO idempotency_keys (.+) RETURNING key").
+					WithArgs("abc", 7, "fp", expiredBefore).
+					WillReturnError(sql.ErrConnDone)
+			},
+			expectedErr: sql.ErrConnDone,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockQuery()
+
+			reserved, err := store.ReserveIdempotencyKey(record, expiredBefore)
+			assert.Equal(t, tt.expectedErr, err)
+			assert.Equal(t, tt.expectedReserved, reserved)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestGetIdempotencyRecord(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	store := NewIdempotencyStore(db, &config.Config{})
+	createdAt := time.Now()
+
+	mock.ExpectQuery("SELECT fingerprint, statusCode, contentType, responseBody, createdAt FROM idempotency_keys WHERE key = \\$1 AND userId = \\$2").
+		WithArgs("abc", 7).
+		WillReturnRows(sqlmock.NewRows([]string{"fingerprint", "statusCode", "contentType", "responseBody", "createdAt"}).
+			AddRow("fp", nil, "", nil, createdAt))
+
+	record, err := store.GetIdempotencyRecord("abc", 7)
+	assert.NoError(t, err)
+	assert.Equal(t, &types.IdempotencyRecord{Key: "abc", UserID: 7, Fingerprint: "fp", CreatedAt: createdAt}, record)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSaveIdempotencyResponse(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	store := NewIdempotencyStore(db, &config.Config{})
+
+	mock.ExpectExec("UPDATE idempotency_keys SET statusCode = \\$1, contentType = \\$2, responseBody = \\$3 WHERE key = \\$4 AND userId = \\$5").
+		WithArgs(201, "application/json", []byte(`{"id":1}`), "abc", 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err = store.SaveIdempotencyResponse(types.IdempotencyRecord{Key: "abc", UserID: 7, StatusCode: 201, ContentType: "application/json", ResponseBody: []byte(`{"id":1}`)})
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeleteExpiredIdempotencyRecords(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	store := NewIdempotencyStore(db, &config.Config{})
+	expiredBefore := time.Now().Add(-RecordTTL)
+
+	mock.ExpectExec("DELETE FROM idempotency_keys WHERE createdAt < \\$1").
+		WithArgs(expiredBefore).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	deleted, err := store.DeleteExpiredIdempotencyRecords(expiredBefore)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), deleted)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,102 @@
+package lockout
+
+import (
+	"strings"
+	"time"
+
+	"github.com/loloDawit/ecom/types"
+)
+
+// Policy is how many failed logins lock a key and how the lockout grows:
+// Delay once MaxFailures is reached, doubling with each further failure up
+// to MaxDelay.
+type Policy struct {
+	MaxFailures int
+	Delay       time.Duration
+	MaxDelay    time.Duration
+}
+
+var (
+	// AccountPolicy throttles guesses at one account from anywhere.
+	AccountPolicy = Policy{MaxFailures: 5, Delay: 30 * time.Second, MaxDelay: 15 * time.Minute}
+	// IPPolicy throttles one client guessing across accounts. It is looser
+	// since many users can share an address.
+	IPPolicy = Policy{MaxFailures: 20, Delay: 30 * time.Second, MaxDelay: time.Hour}
+)
+
+// FailureWindow is how long failures are remembered after the last one.
+const FailureWindow = time.Hour
+
+// lockout returns how long a key with the given failures is locked for.
+func (p Policy) lockout(failures int) time.Duration {
+	if failures < p.MaxFailures {
+		return 0
+	}
+
+	delay := p.Delay
+	for i := p.MaxFailures; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, p.MaxDelay)
+}
+
+// Limiter implements types.LoginLimiter, throttling logins per account and
+// per client IP. Accounts are keyed by email whether or not they exist, so
+// the throttle does not tell which emails have one.
+type Limiter struct {
+	store   types.LoginThrottleStore
+	account Policy
+	ip      Policy
+	now     func() time.Time
+}
+
+func NewLimiter(store types.LoginThrottleStore) *Limiter {
+	return &Limiter{store: store, account: AccountPolicy, ip: IPPolicy, now: time.Now}
+}
+
+// AccountKey is the throttle key of the account with the given email.
+func AccountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+func (l *Limiter) LoginAllowed(email string, ip string) (time.Duration, error) {
+	var wait time.Duration
+	for _, key := range []string{AccountKey(email), ipKey(ip)} {
+		lockedUntil, err := l.store.GetLoginLockedUntil(key)
+		if err != nil {
+			return 0, err
+		}
+		wait = max(wait, lockedUntil.Sub(l.now()))
+	}
+	return wait, nil
+}
+
+func (l *Limiter) LoginFailed(email string, ip string) error {
+	if err := l.recordFailure(AccountKey(email), l.account); err != nil {
+		return err
+	}
+	return l.recordFailure(ipKey(ip), l.ip)
+}
+
+// LoginSucceeded forgets the account's failures. The IP's are kept, or one
+// account of their own would let a client reset its count between guesses.
+func (l *Limiter) LoginSucceeded(email string) error {
+	return l.store.ClearLoginFailures(AccountKey(email))
+}
+
+func (l *Limiter) recordFailure(key string, policy Policy) error {
+	now := l.now()
+	failures, err := l.store.RecordLoginFailure(key, now, now.Add(-FailureWindow))
+	if err != nil {
+		return err
+	}
+
+	if delay := policy.lockout(failures); delay > 0 {
+		return l.store.LockLogin(key, now.Add(delay))
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package lockout
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type throttle struct {
+	failures      int
+	lastFailureAt time.Time
+	lockedUntil   time.Time
+}
+
+// memoryStore is an in-memory LoginThrottleStore.
+type memoryStore struct {
+	throttles map[string]*throttle
+}
+
+func (m *memoryStore) RecordLoginFailure(key string, now time.Time, resetBefore time.Time) (int, error) {
+	t, ok := m.throttles[key]
+	if !ok {
+		t = &throttle{}
+		m.throttles[key] = t
+	}
+	if t.lastFailureAt.Before(resetBefore) {
+		t.failures = 0
+	}
+	t.failures++
+	t.lastFailureAt = now
+	return t.failures, nil
+}
+
+func (m *memoryStore) LockLogin(key string, until time.Time) error {
+	if t := m.throttles[key]; until.After(t.lockedUntil) {
+		t.lockedUntil = until
+	}
+	return nil
+}
+
+func (m *memoryStore) GetLoginLockedUntil(key string) (time.Time, error) {
+	if t, ok := m.throttles[key]; ok {
+		return t.lockedUntil, nil
+	}
+	return time.Time{}, nil
+}
+
+func (m *memoryStore) ClearLoginFailures(key string) error {
+	delete(m.throttles, key)
+	return nil
+}
+
+func newTestLimiter() (*Limiter, *time.Time) {
+	now := time.Date(2026, 10, 17, 9, 30, 0, 0, time.UTC)
+	limiter := NewLimiter(&memoryStore{throttles: map[string]*throttle{}})
+	limiter.now = func() time.Time { return now }
+	return limiter, &now
+}
+
+func TestPolicyLockout(t *testing.T) {
+	policy := Policy{MaxFailures: 3, Delay: 10 * time.Second, MaxDelay: time.Minute}
+
+	var lockouts []time.Duration
+	for failures := 1; failures <= 8; failures++ {
+		lockouts = append(lockouts, policy.lockout(failures))
+	}
+	assert.Equal(t, []time.Duration{0, 0, 10 * time.Second, 20 * time.Second, 40 * time.Second, time.Minute, time.Minute, time.Minute}, lockouts)
+}
+
+func TestLimiterLocksOutAnAccount(t *testing.T) {
+	limiter, now := newTestLimiter()
+
+	for i := 0; i < AccountPolicy.MaxFailures; i++ {
+		wait, err := limiter.LoginAllowed("jane@example.com", "203.0.113.7")
+		assert.NoError(t, err)
+		assert.Zero(t, wait)
+		assert.NoError(t, limiter.LoginFailed("jane@example.com", "203.0.113.7"))
+	}
+
+	// over the limit from any address, in any case
+	wait, _ := limiter.LoginAllowed("Jane@Example.com ", "198.51.100.1")
+	assert.Equal(t, AccountPolicy.Delay, wait)
+
+	// other accounts from the same address are not affected
+	wait, _ = limiter.LoginAllowed("john@example.com", "203.0.113.7")
+	assert.Zero(t, wait)
+
+	// each further failure doubles the lockout
+	*now = now.Add(AccountPolicy.Delay)
+	assert.NoError(t, limiter.LoginFailed("jane@example.com", "203.0.113.7"))
+	wait, _ = limiter.LoginAllowed("jane@example.com", "203.0.113.7")
+	assert.Equal(t, 2*AccountPolicy.Delay, wait)
+
+	// a successful login starts the count over
+	assert.NoError(t, limiter.LoginSucceeded("jane@example.com"))
+	wait, _ = limiter.LoginAllowed("jane@example.com", "203.0.113.7")
+	assert.Zero(t, wait)
+}
+
+func TestLimiterLocksOutAnIP(t *testing.T) {
+	limiter, _ := newTestLimiter()
+
+	for i := 0; i < IPPolicy.MaxFailures; i++ {
+		assert.NoError(t, limiter.LoginFailed("user"+string(rune('a'+i))+"@example.com", "203.0.113.7"))
+	}
+
+	wait, _ := limiter.LoginAllowed("john@example.com", "203.0.113.7")
+	assert.Equal(t, IPPolicy.Delay, wait)
+	wait, _ = limiter.LoginAllowed("john@example.com", "198.51.100.1")
+	assert.Zero(t, wait)
+}
+
+func TestLimiterForgetsOldFailures(t *testing.T) {
+	limiter, now := newTestLimiter()
+
+	for i := 0; i < AccountPolicy.MaxFailures-1; i++ {
+		assert.NoError(t, limiter.LoginFailed("jane@example.com", "203.0.113.7"))
+	}
+	*now = now.Add(FailureWindow + time.Second)
+
+	// the count restarts, so one more failure does not lock the account
+	assert.NoError(t, limiter.LoginFailed("jane@example.com", "203.0.113.7"))
+	wait, _ := limiter.LoginAllowed("jane@example.com", "203.0.113.7")
+	assert.Zero(t, wait)
+}
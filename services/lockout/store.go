@@ -0,0 +1,55 @@
+package lockout
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/loloDawit/ecom/config"
+)
+
+type LoginThrottleStore struct {
+	db  *sql.DB
+	cfg *config.Config
+}
+
+func NewLoginThrottleStore(db *sql.DB, cfg *config.Config) *LoginThrottleStore {
+	return &LoginThrottleStore{db: db, cfg: cfg}
+}
+
+// RecordLoginFailure counts the failure in a single upsert, so concurrent
+// guesses cannot overwrite each other's count.
+func (s *LoginThrottleStore) RecordLoginFailure(key string, now time.Time, resetBefore time.Time) (int, error) {
+	var failures int
+	err := s.db.QueryRow(
+		`INSERT INTO login_throttles (throttleKey, failures, lastFailureAt) VALUES ($1, 1, $2)
+		ON CONFLICT (throttleKey) DO UPDATE SET
+			failures = CASE WHEN login_throttles.lastFailureAt < $3 THEN 1 ELSE login_throttles.failures + 1 END,
+			lastFailureAt = EXCLUDED.lastFailureAt
+		RETURNING failures`,
+		key, now, resetBefore,
+	).Scan(&failures)
+	return failures, err
+}
+
+func (s *LoginThrottleStore) LockLogin(key string, until time.Time) error {
+	_, err := s.db.Exec(
+		"UPDATE login_throttles SET lockedUntil = GREATEST(COALESCE(lockedUntil, $2), $2) WHERE throttleKey = $1",
+		key, until,
+	)
+	return err
+}
+
+func (s *LoginThrottleStore) GetLoginLockedUntil(key string) (time.Time, error) {
+	var lockedUntil sql.NullTime
+	err := s.db.QueryRow("SELECT lockedUntil FROM login_throttles WHERE throttleKey = $1", key).Scan(&lockedUntil)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	return lockedUntil.Time, err
+}
+
+func (s *LoginThrottleStore) ClearLoginFailures(key string) error {
+	_, err := s.db.Exec("DELETE FROM login_throttles WHERE throttleKey = $1", key)
+	return err
+}
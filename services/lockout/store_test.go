@@ -0,0 +1,120 @@
+package lockout
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/loloDawit/ecom/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordLoginFailure(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	store := NewLoginThrottleStore(db, &config.Config{})
+	now := time.Now()
+
+	mock.ExpectQuery("INSERT INTO login_throttles \\(throttleKey, failures, lastFailureAt\\) VALUES \\(\\$1, 1, \\$2\\) ON CONFLICT \\(throttleKey\\) DO UPDATE SET (.+) RETURNING failures").
+		WithArgs("account:jane@example.com", now, now.Add(-FailureWindow)).
+		WillReturnRows(sqlmock.NewRows([]string{"failures"}).AddRow(3))
+
+	failures, err := store.RecordLoginFailure("account:jane@example.com", now, now.Add(-FailureWindow))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, failures)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLockLogin(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	store := NewLoginThrottleStore(db, &config.Config{})
+	until := time.Now().Add(time.Minute)
+
+	mock.ExpectExec("UPDATE login_throttles SET lockedUntil = GREATEST\\(COALESCE\\(lockedUntil, \\$2\\), \\$2\\) WHERE throttleKey = \\$1").
+		WithArgs("ip:203.0.113.7", until).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	assert.NoError(t, store.LockLogin("ip:203.0.113.7", until))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetLoginLockedUntil(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	store := NewLoginThrottleStore(db, &config.Config{})
+	until := time.Now().Add(time.Minute)
+
+	tests := []struct {
+		name          string
+		mockQuery     func()
+		expectedUntil time.Time
+	}{
+		{
+			name: "Locked",
+			mockQuery: func() {
+				mock.ExpectQuery("SELECT lockedUntil FROM login_throttles WHERE throttleKey = \\$1").
+					WithArgs("account:jane@example.com").
+					WillReturnRows(sqlmock.NewRows([]string{"lockedUntil"}).AddRow(until))
+			},
+			expectedUntil: until,
+		},
+		{
+			name: "Failed but not locked",
+			mockQuery: func() {
+				mock.ExpectQuery("SELECT lockedUntil FROM login_throttles").
+					WithArgs("account:jane@example.com").
+					WillReturnRows(sqlmock.NewRows([]string{"lockedUntil"}).AddRow(nil))
+			},
+		},
+		{
+			name: "Never failed",
+			mockQuery: func() {
+				mock.ExpectQuery("SELECT lockedUntil FROM login_throttles").
+					WithArgs("account:jane@example.com").
+					WillReturnError(sql.ErrNoRows)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockQuery()
+
+			lockedUntil, err := store.GetLoginLockedUntil("account:jane@example.com")
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedUntil, lockedUntil)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestClearLoginFailures(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	store := NewLoginThrottleStore(db, &config.Config{})
+
+	mock.ExpectExec("DELETE FROM login_throttles WHERE throttleKey = \\$1").
+		WithArgs("account:jane@example.com").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	assert.NoError(t, store.ClearLoginFailures("account:jane@example.com"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
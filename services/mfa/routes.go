@@ -0,0 +1,232 @@
+package mfa
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/loloDawit/ecom/config"
+	"github.com/loloDawit/ecom/services/auth"
+	"github.com/loloDawit/ecom/types"
+	"github.com/loloDawit/ecom/utils"
+	"gopkg.in/go-playground/validator.v9"
+)
+
+type Handler struct {
+	service *Service
+	users   types.UserStore
+	tokens  types.TokenIssuer
+	limiter types.LoginLimiter
+	auth    auth.Authenticator
+	cfg     *config.Config
+}
+
+func NewHandlers(service *Service, users types.UserStore, tokens types.TokenIssuer, limiter types.LoginLimiter, authenticator auth.Authenticator, cfg *config.Config) *Handler {
+	return &Handler{service: service, users: users, tokens: tokens, limiter: limiter, auth: authenticator, cfg: cfg}
+}
+
+func (h *Handler) RegisterRoutes(r *mux.Router) {
+	jwtMiddleware := auth.Middleware(h.auth)
+
+	r.HandleFunc("/users/me/mfa/totp", jwtMiddleware(h.beginEnrollment)).Methods("POST")
+	r.HandleFunc("/users/me/mfa/totp/confirm", jwtMiddleware(h.confirmEnrollment)).Methods("POST")
+
+	// the second step of /login, authenticated by its mfa token
+	r.HandleFunc("/login/mfa", h.completeLogin).Methods("POST")
+	r.HandleFunc("/login/mfa/totp", h.beginLoginEnrollment).Methods("POST")
+	r.HandleFunc("/login/mfa/totp/confirm", h.confirmLoginEnrollment).Methods("POST")
+}
+
+func (h *Handler) beginEnrollment(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.writeEnrollment(w, userID)
+}
+
+func (h *Handler) confirmEnrollment(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var payload types.MFACodePayload
+	if !readPayload(w, r, &payload) {
+		return
+	}
+
+	codes, err := h.service.ConfirmEnrollment(userID, payload.Code)
+	if errors.Is(err, ErrInvalidCode) {
+		// the caller is signed in; only the code is wrong
+		utils.WriteError(w, http.StatusBadRequest, utils.ErrInvalidMFACode)
+		return
+	}
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	utils.WriteSecretJSON(w, http.StatusOK, map[string][]string{"recoveryCodes": codes})
+}
+
+func (h *Handler) completeLogin(w http.ResponseWriter, r *http.Request) {
+	var payload types.MFALoginPayload
+	if !readPayload(w, r, &payload) {
+		return
+	}
+
+	userID, err := h.service.CompleteChallenge(payload.MFAToken, payload.Code)
+	if errors.Is(err, ErrInvalidCode) {
+		h.loginFailed(r, userID)
+	}
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	pair, ok := h.issueTokens(w, userID)
+	if !ok {
+		return
+	}
+	utils.WriteSecretJSON(w, http.StatusOK, pair)
+}
+
+func (h *Handler) beginLoginEnrollment(w http.ResponseWriter, r *http.Request) {
+	var payload types.MFATokenPayload
+	if !readPayload(w, r, &payload) {
+		return
+	}
+
+	userID, err := h.service.ChallengeUser(payload.MFAToken)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	h.writeEnrollment(w, userID)
+}
+
+func (h *Handler) confirmLoginEnrollment(w http.ResponseWriter, r *http.Request) {
+	var payload types.MFALoginPayload
+	if !readPayload(w, r, &payload) {
+		return
+	}
+
+	userID, codes, err := h.service.CompleteEnrollmentChallenge(payload.MFAToken, payload.Code)
+	if errors.Is(err, ErrInvalidCode) {
+		h.loginFailed(r, userID)
+	}
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	pair, ok := h.issueTokens(w, userID)
+	if !ok {
+		return
+	}
+	utils.WriteSecretJSON(w, http.StatusOK, struct {
+		*types.TokenPair
+		RecoveryCodes []string `json:"recoveryCodes"`
+	}{pair, codes})
+}
+
+func (h *Handler) writeEnrollment(w http.ResponseWriter, userID int) {
+	user, err := h.users.GetUserByID(userID)
+	if err != nil {
+		log.Printf("error getting user %d: %v", userID, err)
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrInternalServerError)
+		return
+	}
+
+	enrollment, err := h.service.BeginEnrollment(user)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	utils.WriteSecretJSON(w, http.StatusOK, enrollment)
+}
+
+func (h *Handler) issueTokens(w http.ResponseWriter, userID int) (*types.TokenPair, bool) {
+	user, err := h.users.GetUserByID(userID)
+	if err != nil {
+		log.Printf("error getting user %d: %v", userID, err)
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrInternalServerError)
+		return nil, false
+	}
+
+	// the account may have been disabled since the password was checked
+	if user.DisabledAt != nil {
+		utils.WriteError(w, http.StatusForbidden, utils.ErrAccountDisabled)
+		return nil, false
+	}
+
+	// the login is complete, so the failures that led up to it are forgotten
+	if err := h.limiter.LoginSucceeded(user.Email); err != nil {
+		log.Printf("error clearing failed logins of user %d: %v", user.ID, err)
+	}
+
+	pair, err := h.tokens.IssueTokens(user)
+	if err != nil {
+		log.Printf("error issuing tokens for user %d: %v", user.ID, err)
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrInternalServerError)
+		return nil, false
+	}
+	return pair, true
+}
+
+// loginFailed counts a wrong code like a wrong password, against both the
+// account and the client, so a stolen password does not buy unthrottled
+// guesses at the second step.
+func (h *Handler) loginFailed(r *http.Request, userID int) {
+	user, err := h.users.GetUserByID(userID)
+	if err != nil {
+		log.Printf("error getting user %d: %v", userID, err)
+		return
+	}
+	if err := h.limiter.LoginFailed(user.Email, utils.ClientIP(r, h.cfg.TrustedProxies)); err != nil {
+		log.Printf("error recording failed login: %v", err)
+	}
+}
+
+func readPayload(w http.ResponseWriter, r *http.Request, payload interface{}) bool {
+	if r.Body == nil {
+		utils.WriteError(w, http.StatusBadRequest, utils.ErrInvalidRequestBody)
+		return false
+	}
+
+	if err := utils.ReadJSON(r, payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, utils.ErrInvalidPayload)
+		return false
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Sprintf("%s: %v", utils.ErrInvalidPayload, validationErrors))
+		return false
+	}
+	return true
+}
+
+func writeServiceError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidChallenge):
+		utils.WriteError(w, http.StatusUnauthorized, utils.ErrInvalidMFAToken)
+	case errors.Is(err, ErrInvalidCode):
+		utils.WriteError(w, http.StatusUnauthorized, utils.ErrInvalidMFACode)
+	case errors.Is(err, ErrAlreadyEnrolled):
+		utils.WriteError(w, http.StatusConflict, utils.ErrMFAEnabled)
+	case errors.Is(err, ErrNotEnrolling):
+		utils.WriteError(w, http.StatusBadRequest, utils.ErrMFANotStarted)
+	default:
+		log.Printf("mfa error: %v", err)
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrInternalServerError)
+	}
+}
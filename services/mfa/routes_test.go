@@ -0,0 +1,442 @@
+package mfa
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/loloDawit/ecom/config"
+	"github.com/loloDawit/ecom/services/auth"
+	"github.com/loloDawit/ecom/services/auth/authtest"
+	"github.com/loloDawit/ecom/types"
+	"github.com/loloDawit/ecom/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryStore is an in-memory MFAStore. Only claiming attempts is safe for
+// concurrent use.
+type memoryStore struct {
+	mu            sync.Mutex
+	enrollments   map[int]*types.TOTPEnrollment
+	recoveryCodes map[string]*recoveryCode
+	challenges    []*types.MFAChallengeToken
+}
+
+type recoveryCode struct {
+	userID int
+	used   bool
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{enrollments: map[int]*types.TOTPEnrollment{}, recoveryCodes: map[string]*recoveryCode{}}
+}
+
+func (m *memoryStore) GetTOTPEnrollment(userID int) (*types.TOTPEnrollment, error) {
+	if enrollment, ok := m.enrollments[userID]; ok {
+		copied := *enrollment
+		return &copied, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *memoryStore) SaveTOTPSecret(userID int, secret string) error {
+	if enrollment, ok := m.enrollments[userID]; ok && enrollment.ConfirmedAt != nil {
+		return sql.ErrNoRows
+	}
+	m.enrollments[userID] = &types.TOTPEnrollment{UserID: userID, Secret: secret}
+	return nil
+}
+
+func (m *memoryStore) ConfirmTOTP(userID int, step int64, recoveryCodeHashes []string, now time.Time) error {
+	enrollment, ok := m.enrollments[userID]
+	if !ok || enrollment.ConfirmedAt != nil {
+		return sql.ErrNoRows
+	}
+	enrollment.ConfirmedAt = &now
+	enrollment.LastUsedStep = step
+	for hash, code := range m.recoveryCodes {
+		if code.userID == userID {
+			delete(m.recoveryCodes, hash)
+		}
+	}
+	for _, hash := range recoveryCodeHashes {
+		m.recoveryCodes[hash] = &recoveryCode{userID: userID}
+	}
+	return nil
+}
+
+func (m *memoryStore) UseTOTPStep(userID int, step int64) (bool, error) {
+	enrollment, ok := m.enrollments[userID]
+	if !ok || enrollment.ConfirmedAt == nil || enrollment.LastUsedStep >= step {
+		return false, nil
+	}
+	enrollment.LastUsedStep = step
+	return true, nil
+}
+
+func (m *memoryStore) UseRecoveryCode(userID int, codeHash string, now time.Time) (bool, error) {
+	code, ok := m.recoveryCodes[codeHash]
+	if !ok || code.userID != userID || code.used {
+		return false, nil
+	}
+	code.used = true
+	return true, nil
+}
+
+func (m *memoryStore) CreateMFAChallenge(challenge types.MFAChallengeToken) error {
+	challenge.ID = len(m.challenges) + 1
+	m.challenges = append(m.challenges, &challenge)
+	return nil
+}
+
+func (m *memoryStore) GetMFAChallenge(tokenHash string) (*types.MFAChallengeToken, error) {
+	for _, challenge := range m.challenges {
+		if challenge.TokenHash == tokenHash {
+			copied := *challenge
+			return &copied, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *memoryStore) ClaimMFAChallengeAttempt(tokenHash string, maxAttempts int, now time.Time) (*types.MFAChallengeToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, challenge := range m.challenges {
+		if challenge.TokenHash == tokenHash && challenge.UsedAt == nil && challenge.Attempts < maxAttempts && now.Before(challenge.ExpiresAt) {
+			challenge.Attempts++
+			copied := *challenge
+			return &copied, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *memoryStore) UseMFAChallenge(id int, now time.Time) (bool, error) {
+	if m.challenges[id-1].UsedAt != nil {
+		return false, nil
+	}
+	m.challenges[id-1].UsedAt = &now
+	return true, nil
+}
+
+type mockUserStore struct {
+	users map[int]*types.User
+}
+
+func (m *mockUserStore) GetUserByEmail(email string) (*types.User, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (m *mockUserStore) CreateUser(user types.User) error {
+	return nil
+}
+
+func (m *mockUserStore) GetUserByID(id int) (*types.User, error) {
+	if user, ok := m.users[id]; ok {
+		return user, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *mockUserStore) UpdateUser(user types.User) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdatePassword(userID int, passwordHash string) error {
+	return nil
+}
+
+func (m *mockUserStore) DeleteUser(userID int, now time.Time) error {
+	return nil
+}
+
+func (m *mockUserStore) GetUsers(query types.UserQuery) ([]types.User, error) {
+	return nil, nil
+}
+
+func (m *mockUserStore) SetUserDisabled(userID int, disabledAt *time.Time) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdateUserRole(userID int, role types.Role) error {
+	return nil
+}
+
+type mockTokenIssuer struct{}
+
+func (m *mockTokenIssuer) IssueTokens(user *types.User) (*types.TokenPair, error) {
+	return &types.TokenPair{Token: "access-" + user.Email, RefreshToken: "refresh", ExpiresIn: 60}, nil
+}
+
+// recordingLimiter records the logins reported to it.
+type recordingLimiter struct {
+	failed    []string
+	succeeded []string
+}
+
+func (m *recordingLimiter) LoginAllowed(email string, ip string) (time.Duration, error) {
+	return 0, nil
+}
+
+func (m *recordingLimiter) LoginFailed(email string, ip string) error {
+	m.failed = append(m.failed, email+" "+ip)
+	return nil
+}
+
+func (m *recordingLimiter) LoginSucceeded(email string) error {
+	m.succeeded = append(m.succeeded, email)
+	return nil
+}
+
+type testHandler struct {
+	router  *mux.Router
+	service *Service
+	store   *memoryStore
+	users   *mockUserStore
+	limiter *recordingLimiter
+	now     time.Time
+}
+
+func newTestHandler(cfg *config.Config, identity *authtest.Authenticator) *testHandler {
+	th := &testHandler{store: newMemoryStore(), now: time.Date(2026, 10, 17, 9, 30, 0, 0, time.UTC)}
+	th.service = NewService(th.store, cfg)
+	th.service.now = func() time.Time { return th.now }
+
+	th.users = &mockUserStore{users: map[int]*types.User{
+		7: {ID: 7, Email: "jane@example.com", Role: types.RoleCustomer},
+		8: {ID: 8, Email: "admin@example.com", Role: types.RoleAdmin},
+	}}
+	th.limiter = &recordingLimiter{}
+	th.router = mux.NewRouter()
+	NewHandlers(th.service, th.users, &mockTokenIssuer{}, th.limiter, identity, cfg).RegisterRoutes(th.router)
+	return th
+}
+
+func (th *testHandler) post(t *testing.T, path string, body string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.RemoteAddr = "203.0.113.7:51234"
+	rr := httptest.NewRecorder()
+	th.router.ServeHTTP(rr, req)
+	return rr
+}
+
+// code returns the current TOTP code of the user's secret.
+func (th *testHandler) code(userID int) string {
+	key, _ := secretEncoding.DecodeString(th.store.enrollments[userID].Secret)
+	return totpCode(key, totpStep(th.now))
+}
+
+// enroll enrolls the signed in user and returns their recovery codes.
+func (th *testHandler) enroll(t *testing.T, userID int) []string {
+	rr := th.post(t, "/users/me/mfa/totp", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = th.post(t, "/users/me/mfa/totp/confirm", `{"code": "`+th.code(userID)+`"}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var response map[string][]string
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	return response["recoveryCodes"]
+}
+
+func TestEnrollment(t *testing.T) {
+	th := newTestHandler(&config.Config{MFA: config.MFAConfig{Issuer: "Shop"}}, authtest.As(7, types.RoleCustomer))
+
+	rr := th.post(t, "/users/me/mfa/totp", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var enrollment types.TOTPEnrollmentResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &enrollment))
+	assert.Equal(t, th.store.enrollments[7].Secret, enrollment.Secret)
+	assert.Equal(t, otpauthURI("Shop", "jane@example.com", enrollment.Secret), enrollment.OTPAuthURI)
+
+	// not enabled until confirmed
+	challenge, err := th.service.Challenge(&types.User{ID: 7})
+	assert.NoError(t, err)
+	assert.Nil(t, challenge)
+
+	rr = th.post(t, "/users/me/mfa/totp/confirm", `{"code": "000000"}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.JSONEq(t, `{"error":"`+utils.ErrInvalidMFACode+`"}`, rr.Body.String())
+
+	rr = th.post(t, "/users/me/mfa/totp/confirm", `{"code": "`+th.code(7)+`"}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var response map[string][]string
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Len(t, response["recoveryCodes"], RecoveryCodeCount)
+
+	// only hashes of the recovery codes are stored
+	assert.Contains(t, th.store.recoveryCodes, auth.HashOpaqueToken(normalizeCode(response["recoveryCodes"][0])))
+
+	rr = th.post(t, "/users/me/mfa/totp", "")
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	assert.JSONEq(t, `{"error":"`+utils.ErrMFAEnabled+`"}`, rr.Body.String())
+}
+
+func TestConfirmWithoutEnrollment(t *testing.T) {
+	th := newTestHandler(&config.Config{}, authtest.As(7, types.RoleCustomer))
+
+	rr := th.post(t, "/users/me/mfa/totp/confirm", `{"code": "123456"}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.JSONEq(t, `{"error":"`+utils.ErrMFANotStarted+`"}`, rr.Body.String())
+}
+
+func TestEnrollmentRequiresAuthentication(t *testing.T) {
+	th := newTestHandler(&config.Config{}, authtest.Anonymous())
+
+	rr := th.post(t, "/users/me/mfa/totp", "")
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
+func TestCompleteLogin(t *testing.T) {
+	th := newTestHandler(&config.Config{}, authtest.As(7, types.RoleCustomer))
+	recoveryCodes := th.enroll(t, 7)
+	th.now = th.now.Add(totpPeriod)
+
+	challenge := func() string {
+		challenge, err := th.service.Challenge(&types.User{ID: 7})
+		assert.NoError(t, err)
+		assert.True(t, challenge.MFARequired)
+		return challenge.MFAToken
+	}
+
+	t.Run("TOTP code", func(t *testing.T) {
+		token := challenge()
+		code := th.code(7)
+
+		rr := th.post(t, "/login/mfa", `{"mfaToken": "`+token+`", "code": "`+code+`"}`)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.JSONEq(t, `{"token":"access-jane@example.com","refreshToken":"refresh","expiresIn":60}`, rr.Body.String())
+		assert.Equal(t, []string{"jane@example.com"}, th.limiter.succeeded)
+
+		// neither the challenge nor the code can be used twice
+		rr = th.post(t, "/login/mfa", `{"mfaToken": "`+token+`", "code": "`+code+`"}`)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		assert.JSONEq(t, `{"error":"`+utils.ErrInvalidMFAToken+`"}`, rr.Body.String())
+
+		rr = th.post(t, "/login/mfa", `{"mfaToken": "`+challenge()+`", "code": "`+code+`"}`)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		assert.JSONEq(t, `{"error":"`+utils.ErrInvalidMFACode+`"}`, rr.Body.String())
+	})
+
+	t.Run("Recovery code", func(t *testing.T) {
+		rr := th.post(t, "/login/mfa", `{"mfaToken": "`+challenge()+`", "code": "`+recoveryCodes[0]+`"}`)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		rr = th.post(t, "/login/mfa", `{"mfaToken": "`+challenge()+`", "code": "`+recoveryCodes[0]+`"}`)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("Wrong codes count as failed logins", func(t *testing.T) {
+		th.limiter.failed, th.limiter.succeeded = nil, nil
+
+		rr := th.post(t, "/login/mfa", `{"mfaToken": "`+challenge()+`", "code": "000000"}`)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		assert.Equal(t, []string{"jane@example.com 203.0.113.7"}, th.limiter.failed)
+		assert.Empty(t, th.limiter.succeeded)
+	})
+
+	t.Run("Too many wrong codes", func(t *testing.T) {
+		token := challenge()
+		for i := 0; i < MaxChallengeAttempts; i++ {
+			rr := th.post(t, "/login/mfa", `{"mfaToken": "`+token+`", "code": "000000"}`)
+			assert.JSONEq(t, `{"error":"`+utils.ErrInvalidMFACode+`"}`, rr.Body.String())
+		}
+
+		th.now = th.now.Add(totpPeriod)
+		rr := th.post(t, "/login/mfa", `{"mfaToken": "`+token+`", "code": "`+th.code(7)+`"}`)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		assert.JSONEq(t, `{"error":"`+utils.ErrInvalidMFAToken+`"}`, rr.Body.String())
+	})
+
+	t.Run("Concurrent wrong codes", func(t *testing.T) {
+		token := challenge()
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 4*MaxChallengeAttempts)
+		for i := 0; i < 4*MaxChallengeAttempts; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := th.service.CompleteChallenge(token, "000000")
+				errs <- err
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		// no more codes are checked than the limit allows
+		counts := map[error]int{}
+		for err := range errs {
+			counts[err]++
+		}
+		assert.Equal(t, map[error]int{ErrInvalidCode: MaxChallengeAttempts, ErrInvalidChallenge: 3 * MaxChallengeAttempts}, counts)
+	})
+
+	t.Run("Expired challenge", func(t *testing.T) {
+		token := challenge()
+		th.now = th.now.Add(ChallengeTTL)
+
+		rr := th.post(t, "/login/mfa", `{"mfaToken": "`+token+`", "code": "`+th.code(7)+`"}`)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		assert.JSONEq(t, `{"error":"`+utils.ErrInvalidMFAToken+`"}`, rr.Body.String())
+	})
+
+	t.Run("Disabled after the challenge", func(t *testing.T) {
+		token := challenge()
+		disabledAt := th.now
+		th.users.users[7].DisabledAt = &disabledAt
+		defer func() { th.users.users[7].DisabledAt = nil }()
+		th.now = th.now.Add(totpPeriod)
+
+		rr := th.post(t, "/login/mfa", `{"mfaToken": "`+token+`", "code": "`+th.code(7)+`"}`)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		assert.JSONEq(t, `{"error":"`+utils.ErrAccountDisabled+`"}`, rr.Body.String())
+	})
+}
+
+func TestAdminEnrollmentAtLogin(t *testing.T) {
+	cfg := &config.Config{MFA: config.MFAConfig{RequiredForAdmins: true}}
+	th := newTestHandler(cfg, authtest.Anonymous())
+
+	// customers are not affected
+	challenge, err := th.service.Challenge(&types.User{ID: 7, Role: types.RoleCustomer})
+	assert.NoError(t, err)
+	assert.Nil(t, challenge)
+
+	challenge, err = th.service.Challenge(&types.User{ID: 8, Role: types.RoleAdmin})
+	assert.NoError(t, err)
+	assert.True(t, challenge.MFAEnrollmentRequired)
+	assert.False(t, challenge.MFARequired)
+
+	// the challenge cannot be completed without enrolling
+	rr := th.post(t, "/login/mfa", `{"mfaToken": "`+challenge.MFAToken+`", "code": "123456"}`)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	rr = th.post(t, "/login/mfa/totp", `{"mfaToken": "`+challenge.MFAToken+`"}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = th.post(t, "/login/mfa/totp/confirm", `{"mfaToken": "`+challenge.MFAToken+`", "code": "`+th.code(8)+`"}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var response struct {
+		types.TokenPair
+		RecoveryCodes []string `json:"recoveryCodes"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, "access-admin@example.com", response.Token)
+	assert.Len(t, response.RecoveryCodes, RecoveryCodeCount)
+
+	// from now on the admin is asked for a code
+	challenge, err = th.service.Challenge(&types.User{ID: 8, Role: types.RoleAdmin})
+	assert.NoError(t, err)
+	assert.True(t, challenge.MFARequired)
+}
@@ -0,0 +1,277 @@
+package mfa
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/loloDawit/ecom/config"
+	"github.com/loloDawit/ecom/services/auth"
+	"github.com/loloDawit/ecom/types"
+)
+
+const (
+	// ChallengeTTL is how long the second step of a login may take.
+	ChallengeTTL = 5 * time.Minute
+	// MaxChallengeAttempts is how many codes may be tried against a
+	// challenge, so a six digit code cannot be guessed.
+	MaxChallengeAttempts = 5
+	// RecoveryCodeCount is how many recovery codes an enrollment gets.
+	RecoveryCodeCount = 10
+
+	defaultIssuer = "ecom"
+)
+
+var (
+	ErrInvalidChallenge = errors.New("invalid mfa challenge")
+	ErrInvalidCode      = errors.New("invalid mfa code")
+	ErrAlreadyEnrolled  = errors.New("totp is already enabled")
+	ErrNotEnrolling     = errors.New("no totp enrollment to confirm")
+)
+
+// Service enrolls users in TOTP and runs the second step of their logins.
+// Secrets are kept as is, since codes are computed from them; recovery
+// codes and challenge tokens only as hashes.
+type Service struct {
+	store types.MFAStore
+	cfg   *config.Config
+	now   func() time.Time
+}
+
+func NewService(store types.MFAStore, cfg *config.Config) *Service {
+	return &Service{store: store, cfg: cfg, now: time.Now}
+}
+
+// BeginEnrollment gives the user a new secret to add to their
+// authenticator app. It takes effect once confirmed with a code.
+func (s *Service) BeginEnrollment(user *types.User) (*types.TOTPEnrollmentResponse, error) {
+	secret, err := generateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.store.SaveTOTPSecret(user.ID, secret); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAlreadyEnrolled
+		}
+		return nil, err
+	}
+
+	issuer := s.cfg.MFA.Issuer
+	if issuer == "" {
+		issuer = defaultIssuer
+	}
+	return &types.TOTPEnrollmentResponse{Secret: secret, OTPAuthURI: otpauthURI(issuer, user.Email, secret)}, nil
+}
+
+// ConfirmEnrollment turns on TOTP for the user once they prove their app
+// has the secret, and returns their recovery codes. They are never shown
+// again.
+func (s *Service) ConfirmEnrollment(userID int, code string) ([]string, error) {
+	enrollment, err := s.store.GetTOTPEnrollment(userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotEnrolling
+		}
+		return nil, err
+	}
+	if enrollment.ConfirmedAt != nil {
+		return nil, ErrAlreadyEnrolled
+	}
+
+	now := s.now()
+	step, ok := matchTOTP(enrollment.Secret, normalizeCode(code), now)
+	if !ok {
+		return nil, ErrInvalidCode
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.store.ConfirmTOTP(userID, step, hashes, now); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAlreadyEnrolled
+		}
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// Challenge asks users with TOTP for a code, and admins without it to
+// enroll when the config requires it.
+func (s *Service) Challenge(user *types.User) (*types.MFAChallenge, error) {
+	enrollment, err := s.store.GetTOTPEnrollment(user.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	challenge := &types.MFAChallenge{ExpiresIn: int64(ChallengeTTL.Seconds())}
+	switch {
+	case enrollment != nil && enrollment.ConfirmedAt != nil:
+		challenge.MFARequired = true
+	case user.Role == types.RoleAdmin && s.cfg.MFA.RequiredForAdmins:
+		challenge.MFAEnrollmentRequired = true
+	default:
+		return nil, nil
+	}
+
+	token, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	err = s.store.CreateMFAChallenge(types.MFAChallengeToken{
+		UserID:    user.ID,
+		TokenHash: auth.HashOpaqueToken(token),
+		ExpiresAt: s.now().Add(ChallengeTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	challenge.MFAToken = token
+	return challenge, nil
+}
+
+// CompleteChallenge checks a TOTP or recovery code against the user of the
+// challenge and uses the challenge up. It returns the user's id, also along
+// with ErrInvalidCode so the failure can be counted against the account.
+func (s *Service) CompleteChallenge(token string, code string) (int, error) {
+	challenge, err := s.claimAttempt(token)
+	if err != nil {
+		return 0, err
+	}
+
+	ok, err := s.verifyCode(challenge.UserID, code)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return challenge.UserID, ErrInvalidCode
+	}
+
+	return challenge.UserID, s.useChallenge(challenge)
+}
+
+// ChallengeUser returns the user of an open challenge, for admins who
+// enroll during login.
+func (s *Service) ChallengeUser(token string) (int, error) {
+	challenge, err := s.openChallenge(token)
+	if err != nil {
+		return 0, err
+	}
+	return challenge.UserID, nil
+}
+
+// CompleteEnrollmentChallenge confirms the enrollment of the challenge's
+// user and uses the challenge up. It returns the user's id and recovery
+// codes, and like CompleteChallenge the user's id along with ErrInvalidCode.
+func (s *Service) CompleteEnrollmentChallenge(token string, code string) (int, []string, error) {
+	challenge, err := s.claimAttempt(token)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	codes, err := s.ConfirmEnrollment(challenge.UserID, code)
+	if errors.Is(err, ErrInvalidCode) {
+		return challenge.UserID, nil, err
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return challenge.UserID, codes, s.useChallenge(challenge)
+}
+
+func (s *Service) openChallenge(token string) (*types.MFAChallengeToken, error) {
+	challenge, err := s.store.GetMFAChallenge(auth.HashOpaqueToken(token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidChallenge
+		}
+		return nil, err
+	}
+
+	if challenge.UsedAt != nil || !s.now().Before(challenge.ExpiresAt) || challenge.Attempts >= MaxChallengeAttempts {
+		return nil, ErrInvalidChallenge
+	}
+	return challenge, nil
+}
+
+// claimAttempt opens the challenge for one code. The attempt is counted
+// before the code is checked, so it cannot be raced past the limit.
+func (s *Service) claimAttempt(token string) (*types.MFAChallengeToken, error) {
+	challenge, err := s.store.ClaimMFAChallengeAttempt(auth.HashOpaqueToken(token), MaxChallengeAttempts, s.now())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidChallenge
+		}
+		return nil, err
+	}
+	return challenge, nil
+}
+
+func (s *Service) useChallenge(challenge *types.MFAChallengeToken) error {
+	used, err := s.store.UseMFAChallenge(challenge.ID, s.now())
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidChallenge
+	}
+	return nil
+}
+
+// verifyCode accepts a current TOTP code that was not used before, or an
+// unused recovery code.
+func (s *Service) verifyCode(userID int, code string) (bool, error) {
+	code = normalizeCode(code)
+	if len(code) != totpDigits {
+		return s.store.UseRecoveryCode(userID, auth.HashOpaqueToken(code), s.now())
+	}
+
+	enrollment, err := s.store.GetTOTPEnrollment(userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+	if enrollment.ConfirmedAt == nil {
+		return false, nil
+	}
+
+	step, ok := matchTOTP(enrollment.Secret, code, s.now())
+	if !ok {
+		return false, nil
+	}
+	return s.store.UseTOTPStep(userID, step)
+}
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// generateRecoveryCodes returns codes formatted like "abcde-fghij" and the
+// hashes to store.
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, RecoveryCodeCount)
+	hashes := make([]string, RecoveryCodeCount)
+	for i := range codes {
+		buf := make([]byte, 7)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(recoveryCodeEncoding.EncodeToString(buf)[:10])
+		codes[i] = code[:5] + "-" + code[5:]
+		hashes[i] = auth.HashOpaqueToken(code)
+	}
+	return codes, hashes, nil
+}
+
+// normalizeCode drops the separators users type along with codes.
+func normalizeCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
@@ -0,0 +1,156 @@
+package mfa
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/loloDawit/ecom/config"
+	"github.com/loloDawit/ecom/db"
+	"github.com/loloDawit/ecom/types"
+)
+
+type MFAStore struct {
+	db  *sql.DB
+	cfg *config.Config
+}
+
+func NewMFAStore(db *sql.DB, cfg *config.Config) *MFAStore {
+	return &MFAStore{db: db, cfg: cfg}
+}
+
+func (s *MFAStore) GetTOTPEnrollment(userID int) (*types.TOTPEnrollment, error) {
+	enrollment := &types.TOTPEnrollment{}
+	err := s.db.QueryRow(
+		"SELECT userId, secret, confirmedAt, lastUsedStep FROM user_totp WHERE userId = $1",
+		userID,
+	).Scan(&enrollment.UserID, &enrollment.Secret, &enrollment.ConfirmedAt, &enrollment.LastUsedStep)
+	if err != nil {
+		return nil, err
+	}
+	return enrollment, nil
+}
+
+func (s *MFAStore) SaveTOTPSecret(userID int, secret string) error {
+	result, err := s.db.Exec(
+		`INSERT INTO user_totp (userId, secret) VALUES ($1, $2)
+		ON CONFLICT (userId) DO UPDATE SET secret = EXCLUDED.secret, lastUsedStep = 0, createdAt = CURRENT_TIMESTAMP
+		WHERE user_totp.confirmedAt IS NULL`,
+		userID, secret,
+	)
+	if err != nil {
+		return err
+	}
+	return requireRowsAffected(result)
+}
+
+func (s *MFAStore) ConfirmTOTP(userID int, step int64, recoveryCodeHashes []string, now time.Time) error {
+	return db.WithTransaction(s.db, func(tx *sql.Tx) error {
+		result, err := tx.Exec(
+			"UPDATE user_totp SET confirmedAt = $1, lastUsedStep = $2 WHERE userId = $3 AND confirmedAt IS NULL",
+			now, step, userID,
+		)
+		if err != nil {
+			return err
+		}
+		if err := requireRowsAffected(result); err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec("DELETE FROM mfa_recovery_codes WHERE userId = $1", userID); err != nil {
+			return err
+		}
+		for _, codeHash := range recoveryCodeHashes {
+			if _, err := tx.Exec("INSERT INTO mfa_recovery_codes (userId, codeHash) VALUES ($1, $2)", userID, codeHash); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// UseTOTPStep only moves lastUsedStep forward, so of two requests racing
+// with the same code only one succeeds.
+func (s *MFAStore) UseTOTPStep(userID int, step int64) (bool, error) {
+	result, err := s.db.Exec(
+		"UPDATE user_totp SET lastUsedStep = $1 WHERE userId = $2 AND confirmedAt IS NOT NULL AND lastUsedStep < $1",
+		step, userID,
+	)
+	if err != nil {
+		return false, err
+	}
+	return anyRowsAffected(result)
+}
+
+func (s *MFAStore) UseRecoveryCode(userID int, codeHash string, now time.Time) (bool, error) {
+	result, err := s.db.Exec(
+		"UPDATE mfa_recovery_codes SET usedAt = $1 WHERE userId = $2 AND codeHash = $3 AND usedAt IS NULL",
+		now, userID, codeHash,
+	)
+	if err != nil {
+		return false, err
+	}
+	return anyRowsAffected(result)
+}
+
+func (s *MFAStore) CreateMFAChallenge(challenge types.MFAChallengeToken) error {
+	_, err := s.db.Exec(
+		"INSERT INTO mfa_challenges (userId, tokenHash, expiresAt) VALUES ($1, $2, $3)",
+		challenge.UserID, challenge.TokenHash, challenge.ExpiresAt,
+	)
+	return err
+}
+
+func (s *MFAStore) GetMFAChallenge(tokenHash string) (*types.MFAChallengeToken, error) {
+	challenge := &types.MFAChallengeToken{}
+	err := s.db.QueryRow(
+		"SELECT id, userId, tokenHash, expiresAt, usedAt, failedAttempts FROM mfa_challenges WHERE tokenHash = $1",
+		tokenHash,
+	).Scan(&challenge.ID, &challenge.UserID, &challenge.TokenHash, &challenge.ExpiresAt, &challenge.UsedAt, &challenge.Attempts)
+	if err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// ClaimMFAChallengeAttempt checks and counts the attempt in one statement,
+// so of requests racing on the last attempt only one gets a row back. The
+// failedAttempts column counts every attempt, including the one that
+// succeeds and uses the challenge up.
+func (s *MFAStore) ClaimMFAChallengeAttempt(tokenHash string, maxAttempts int, now time.Time) (*types.MFAChallengeToken, error) {
+	challenge := &types.MFAChallengeToken{}
+	err := s.db.QueryRow(
+		`UPDATE mfa_challenges SET failedAttempts = failedAttempts + 1
+		WHERE tokenHash = $1 AND usedAt IS NULL AND failedAttempts < $2 AND expiresAt > $3
+		RETURNING id, userId, tokenHash, expiresAt, usedAt, failedAttempts`,
+		tokenHash, maxAttempts, now,
+	).Scan(&challenge.ID, &challenge.UserID, &challenge.TokenHash, &challenge.ExpiresAt, &challenge.UsedAt, &challenge.Attempts)
+	if err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+func (s *MFAStore) UseMFAChallenge(id int, now time.Time) (bool, error) {
+	result, err := s.db.Exec("UPDATE mfa_challenges SET usedAt = $1 WHERE id = $2 AND usedAt IS NULL", now, id)
+	if err != nil {
+		return false, err
+	}
+	return anyRowsAffected(result)
+}
+
+// anyRowsAffected reports whether a conditional update matched a row.
+func anyRowsAffected(result sql.Result) (bool, error) {
+	rowsAffected, err := result.RowsAffected()
+	return rowsAffected > 0, err
+}
+
+func requireRowsAffected(result sql.Result) error {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
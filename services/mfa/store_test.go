@@ -0,0 +1,189 @@
+package mfa
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/loloDawit/ecom/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSaveTOTPSecret(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	store := NewMFAStore(db, &config.Config{})
+
+	t.Run("Not yet confirmed", func(t *testing.T) {
+		mock.ExpectExec("INSERT INTO user_totp \\(userId, secret\\) VALUES \\(\\$1, \\$2\\) ON CONFLICT \\(userId\\) DO UPDATE (.+) WHERE user_totp.confirmedAt IS NULL").
+			WithArgs(7, "SECRET").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		assert.NoError(t, store.SaveTOTPSecret(7, "SECRET"))
+	})
+
+	t.Run("Already confirmed", func(t *testing.T) {
+		mock.ExpectExec("INSERT INTO user_totp").
+			WithArgs(7, "SECRET").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		assert.Equal(t, sql.ErrNoRows, store.SaveTOTPSecret(7, "SECRET"))
+	})
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestConfirmTOTP(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	store := NewMFAStore(db, &config.Config{})
+	now := time.Now()
+
+	t.Run("Stores the recovery codes", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE user_totp SET confirmedAt = \\$1, lastUsedStep = \\$2 WHERE userId = \\$3 AND confirmedAt IS NULL").
+			WithArgs(now, int64(42), 7).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("DELETE FROM mfa_recovery_codes WHERE userId = \\$1").
+			WithArgs(7).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("INSERT INTO mfa_recovery_codes \\(userId, codeHash\\) VALUES \\(\\$1, \\$2\\)").
+			WithArgs(7, "hash-1").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("INSERT INTO mfa_recovery_codes").
+			WithArgs(7, "hash-2").
+			WillReturnResult(sqlmock.NewResult(2, 1))
+		mock.ExpectCommit()
+
+		assert.NoError(t, store.ConfirmTOTP(7, 42, []string{"hash-1", "hash-2"}, now))
+	})
+
+	t.Run("Already confirmed", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE user_totp SET confirmedAt").
+			WithArgs(now, int64(42), 7).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		assert.Equal(t, sql.ErrNoRows, store.ConfirmTOTP(7, 42, []string{"hash-1"}, now))
+	})
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUseTOTPStep(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	store := NewMFAStore(db, &config.Config{})
+
+	tests := []struct {
+		name         string
+		rowsAffected int64
+		expectedUsed bool
+	}{
+		{name: "Newer step", rowsAffected: 1, expectedUsed: true},
+		{name: "Replayed step", rowsAffected: 0, expectedUsed: false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mock.ExpectExec("UPDATE user_totp SET lastUsedStep = \\$1 WHERE userId = \\$2 AND confirmedAt IS NOT NULL AND lastUsedStep < \\$1").
+				WithArgs(int64(42), 7).
+				WillReturnResult(sqlmock.NewResult(0, tc.rowsAffected))
+
+			used, err := store.UseTOTPStep(7, 42)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedUsed, used)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestUseRecoveryCode(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	store := NewMFAStore(db, &config.Config{})
+	now := time.Now()
+
+	mock.ExpectExec("UPDATE mfa_recovery_codes SET usedAt = \\$1 WHERE userId = \\$2 AND codeHash = \\$3 AND usedAt IS NULL").
+		WithArgs(now, 7, "hash-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	used, err := store.UseRecoveryCode(7, "hash-1", now)
+	assert.NoError(t, err)
+	assert.True(t, used)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetMFAChallenge(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	store := NewMFAStore(db, &config.Config{})
+	expiresAt := time.Now().Add(ChallengeTTL)
+
+	mock.ExpectQuery("SELECT id, userId, tokenHash, expiresAt, usedAt, failedAttempts FROM mfa_challenges WHERE tokenHash = \\$1").
+		WithArgs("hash").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "userId", "tokenHash", "expiresAt", "usedAt", "failedAttempts"}).
+			AddRow(3, 7, "hash", expiresAt, nil, 2))
+
+	challenge, err := store.GetMFAChallenge("hash")
+	assert.NoError(t, err)
+	assert.Equal(t, 7, challenge.UserID)
+	assert.Equal(t, 2, challenge.Attempts)
+	assert.Nil(t, challenge.UsedAt)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestClaimMFAChallengeAttempt(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	store := NewMFAStore(db, &config.Config{})
+	now := time.Now()
+	expiresAt := now.Add(ChallengeTTL)
+	query := "UPDATE mfa_challenges SET failedAttempts = failedAttempts \\+ 1\\s+WHERE tokenHash = \\$1 AND usedAt IS NULL AND failedAttempts < \\$2 AND expiresAt > \\$3\\s+RETURNING id, userId, tokenHash, expiresAt, usedAt, failedAttempts"
+
+	mock.ExpectQuery(query).
+		WithArgs("hash", MaxChallengeAttempts, now).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "userId", "tokenHash", "expiresAt", "usedAt", "failedAttempts"}).
+			AddRow(3, 7, "hash", expiresAt, nil, 4))
+
+	challenge, err := store.ClaimMFAChallengeAttempt("hash", MaxChallengeAttempts, now)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, challenge.ID)
+	assert.Equal(t, 7, challenge.UserID)
+	assert.Equal(t, 4, challenge.Attempts)
+
+	// used, expired or exhausted challenges match no row
+	mock.ExpectQuery(query).
+		WithArgs("hash", MaxChallengeAttempts, now).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "userId", "tokenHash", "expiresAt", "usedAt", "failedAttempts"}))
+
+	_, err = store.ClaimMFAChallengeAttempt("hash", MaxChallengeAttempts, now)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,72 @@
+package mfa
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// rfc6238Secret is the SHA1 seed of the RFC 6238 test vectors.
+var rfc6238Secret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestTOTPCode(t *testing.T) {
+	// the RFC's 8 digit codes cut to their last 6 digits
+	tests := []struct {
+		unix     int64
+		expected string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	key := []byte("12345678901234567890")
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, totpCode(key, totpStep(time.Unix(tt.unix, 0))), "at %d", tt.unix)
+	}
+}
+
+func TestMatchTOTP(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := totpStep(now)
+
+	tests := []struct {
+		name         string
+		code         string
+		expectedStep int64
+		expectedOK   bool
+	}{
+		{name: "Current step", code: "050471", expectedStep: step, expectedOK: true},
+		{name: "Previous step", code: "081804", expectedStep: step - 1, expectedOK: true},
+		{name: "Two steps old", code: totpCode([]byte("12345678901234567890"), step-2)},
+		{name: "Wrong code", code: "000000"},
+		{name: "Wrong length", code: "50471"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matched, ok := matchTOTP(rfc6238Secret, tt.code, now)
+			assert.Equal(t, tt.expectedOK, ok)
+			assert.Equal(t, tt.expectedStep, matched)
+		})
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := generateSecret()
+	assert.NoError(t, err)
+	assert.Len(t, secret, 32)
+
+	other, _ := generateSecret()
+	assert.NotEqual(t, secret, other)
+}
+
+func TestOTPAuthURI(t *testing.T) {
+	uri := otpauthURI("ecom", "jane@example.com", "JBSWY3DPEHPK3PXP")
+	assert.Equal(t, "otpauth://totp/ecom:jane@example.com?algorithm=SHA1&digits=6&issuer=ecom&period=30&secret=JBSWY3DPEHPK3PXP", uri)
+}
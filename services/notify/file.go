@@ -0,0 +1,39 @@
+package notify
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/loloDawit/ecom/types"
+)
+
+// FileMailer writes every email as an .eml file to a directory, where it can
+// be opened with a mail client during local development.
+type FileMailer struct {
+	dir  string
+	from string
+	seq  atomic.Int64
+	now  func() time.Time
+}
+
+func NewFileMailer(dir string, from string) (*FileMailer, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("mail directory is required for the file driver")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileMailer{dir: dir, from: from, now: time.Now}, nil
+}
+
+func (m *FileMailer) Send(email types.Email) error {
+	now := m.now()
+	recipient := strings.NewReplacer("@", "_at_", "/", "_", "\\", "_").Replace(headerValue(email.To))
+	name := fmt.Sprintf("%s-%d-%s.eml", now.Format("20060102T150405"), m.seq.Add(1), recipient)
+
+	return os.WriteFile(filepath.Join(m.dir, name), formatMessage(m.from, email, now), 0o644)
+}
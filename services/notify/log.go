@@ -0,0 +1,25 @@
+package notify
+
+import (
+	"log"
+
+	"github.com/loloDawit/ecom/types"
+)
+
+// LogMailer writes email to the log instead of sending it. It is meant for
+// local development, where the log is the easiest place to find a link.
+type LogMailer struct {
+	logger *log.Logger
+}
+
+func NewLogMailer(logger *log.Logger) *LogMailer {
+	if logger == nil {
+		logger = log.Default()
+	}
+	return &LogMailer{logger: logger}
+}
+
+func (m *LogMailer) Send(email types.Email) error {
+	m.logger.Printf("mail to %s: %s\n%s", email.To, email.Subject, email.Body)
+	return nil
+}
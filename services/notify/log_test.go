@@ -0,0 +1,19 @@
+package notify
+
+import (
+	"bytes"
+	"log"
+	"testing"
+
+	"github.com/loloDawit/ecom/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogMailer(t *testing.T) {
+	var buf bytes.Buffer
+	mailer := NewLogMailer(log.New(&buf, "", 0))
+
+	err := mailer.Send(types.Email{To: "jane@example.com", Subject: "Hello", Body: "Hi Jane"})
+	assert.NoError(t, err)
+	assert.Equal(t, "mail to jane@example.com: Hello\nHi Jane\n", buf.String())
+}
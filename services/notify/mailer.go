@@ -0,0 +1,98 @@
+package notify
+
+import (
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/loloDawit/ecom/config"
+	"github.com/loloDawit/ecom/types"
+)
+
+// localEnvironments are the environments that may use the log and memory
+// drivers. Neither delivers email, so anywhere else they would silently drop
+// password resets and verification links.
+var localEnvironments = map[string]bool{
+	"development": true,
+	"dev":         true,
+	"local":       true,
+	"integration": true,
+	"test":        true,
+}
+
+// NewMailer returns the mailer selected by cfg.Driver. The driver has no
+// default; a config without one is refused.
+func NewMailer(cfg config.MailConfig, environment string) (types.Mailer, error) {
+	switch cfg.Driver {
+	case "":
+		return nil, fmt.Errorf("mail driver is required")
+	case "log", "memory":
+		if !localEnvironments[environment] {
+			return nil, fmt.Errorf("mail driver %q does not deliver email and is not allowed in the %s environment", cfg.Driver, environment)
+		}
+	}
+
+	switch cfg.Driver {
+	case "log":
+		return NewLogMailer(nil), nil
+	case "file":
+		return NewFileMailer(cfg.Directory, cfg.From)
+	case "memory":
+		return NewMemoryMailer(), nil
+	case "smtp":
+		return NewSMTPMailer(cfg.SMTP, cfg.From)
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", cfg.Driver)
+	}
+}
+
+// formatMessage renders the email as an RFC 5322 message: plain text, or
+// multipart/alternative when the email has an HTML part.
+func formatMessage(from string, email types.Email, date time.Time) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", headerValue(from))
+	fmt.Fprintf(&buf, "To: %s\r\n", headerValue(email.To))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", headerValue(email.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+
+	if email.HTML == "" {
+		buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+		buf.WriteString("\r\n")
+		buf.WriteString(crlf(email.Body))
+		return buf.Bytes()
+	}
+
+	parts := multipart.NewWriter(&buf)
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%s\r\n", parts.Boundary())
+	buf.WriteString("\r\n")
+	writePart(parts, "text/plain; charset=UTF-8", crlf(email.Body))
+	writePart(parts, "text/html; charset=UTF-8", crlf(email.HTML))
+	parts.Close()
+	return buf.Bytes()
+}
+
+// writePart adds a quoted-printable part, which keeps long HTML lines under
+// the SMTP line length limit. Writes to a bytes.Buffer cannot fail.
+func writePart(parts *multipart.Writer, contentType string, body string) {
+	part, _ := parts.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	encoder := quotedprintable.NewWriter(part)
+	encoder.Write([]byte(body))
+	encoder.Close()
+}
+
+func crlf(body string) string {
+	return strings.ReplaceAll(body, "\n", "\r\n")
+}
+
+// headerValue keeps user supplied values from adding headers of their own.
+func headerValue(value string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(value)
+}
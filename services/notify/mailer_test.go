@@ -0,0 +1,141 @@
+package notify
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/loloDawit/ecom/config"
+	"github.com/loloDawit/ecom/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewMailer(t *testing.T) {
+	tests := []struct {
+		name          string
+		environment   string
+		cfg           config.MailConfig
+		expected      types.Mailer
+		expectedError string
+	}{
+		{name: "No driver", cfg: config.MailConfig{}, expectedError: "mail driver is required"},
+		{name: "Log", cfg: config.MailConfig{Driver: "log"}, expected: &LogMailer{}},
+		{name: "Log in production", environment: "prod", cfg: config.MailConfig{Driver: "log"}, expectedError: `mail driver "log" does not deliver email and is not allowed in the prod environment`},
+		{name: "Memory in production", environment: "prod", cfg: config.MailConfig{Driver: "memory"}, expectedError: `mail driver "memory" does not deliver email and is not allowed in the prod environment`},
+		{name: "SMTP in production", environment: "prod", cfg: config.MailConfig{Driver: "smtp", From: "shop@example.com", SMTP: config.SMTPConfig{Host: "smtp.example.com"}}, expected: &SMTPMailer{}},
+		{name: "File", cfg: config.MailConfig{Driver: "file", Directory: t.TempDir()}, expected: &FileMailer{}},
+		{name: "File without a directory", cfg: config.MailConfig{Driver: "file"}, expectedError: "mail directory is required for the file driver"},
+		{name: "Memory", cfg: config.MailConfig{Driver: "memory"}, expected: &MemoryMailer{}},
+		{name: "SMTP", cfg: config.MailConfig{Driver: "smtp", From: "shop@example.com", SMTP: config.SMTPConfig{Host: "smtp.example.com"}}, expected: &SMTPMailer{}},
+		{name: "SMTP without a host", cfg: config.MailConfig{Driver: "smtp", From: "shop@example.com"}, expectedError: "smtp host is required for the smtp driver"},
+		{name: "Unknown driver", cfg: config.MailConfig{Driver: "pigeon"}, expectedError: `unknown mail driver "pigeon"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			environment := tt.environment
+			if environment == "" {
+				environment = "development"
+			}
+			mailer, err := NewMailer(tt.cfg, environment)
+			if tt.expectedError != "" {
+				assert.EqualError(t, err, tt.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.IsType(t, tt.expected, mailer)
+		})
+	}
+}
+
+func TestFormatMessage(t *testing.T) {
+	date := time.Date(2026, 10, 17, 9, 30, 0, 0, time.UTC)
+	email := types.Email{To: "jane@example.com\r\nBcc: eve@example.com", Subject: "Hello", Body: "Hi Jane,\nwelcome."}
+
+	message := formatMessage("shop@example.com", email, date)
+
+	assert.Equal(t, "From: shop@example.com\r\n"+
+		"To: jane@example.comBcc: eve@example.com\r\n"+
+		"Subject: Hello\r\n"+
+		"Date: Sat, 17 Oct 2026 09:30:00 +0000\r\n"+
+		"MIME-Version: 1.0\r\n"+
+		"Content-Type: text/plain; charset=UTF-8\r\n"+
+		"\r\n"+
+		"Hi Jane,\r\nwelcome.", string(message))
+}
+
+func TestFormatMultipartMessage(t *testing.T) {
+	date := time.Date(2026, 10, 17, 9, 30, 0, 0, time.UTC)
+	html := "<p>" + strings.Repeat("a", 100) + "</p>"
+	email := types.Email{To: "jane@example.com", Subject: "Hello", Body: "Hi Jane,\nwelcome.", HTML: html}
+
+	message, err := mail.ReadMessage(bytes.NewReader(formatMessage("shop@example.com", email, date)))
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello", message.Header.Get("Subject"))
+
+	mediaType, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	assert.NoError(t, err)
+	assert.Equal(t, "multipart/alternative", mediaType)
+
+	// multipart.Reader undoes the quoted-printable encoding
+	parts := multipart.NewReader(message.Body, params["boundary"])
+	var bodies []string
+	for {
+		part, err := parts.NextPart()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		body, err := io.ReadAll(part)
+		assert.NoError(t, err)
+		bodies = append(bodies, strings.Split(part.Header.Get("Content-Type"), ";")[0]+": "+string(body))
+	}
+	assert.Equal(t, []string{"text/plain: Hi Jane,\r\nwelcome.", "text/html: " + html}, bodies)
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	mailer, err := NewFileMailer(dir, "shop@example.com")
+	assert.NoError(t, err)
+	mailer.now = func() time.Time { return time.Date(2026, 10, 17, 9, 30, 0, 0, time.UTC) }
+
+	assert.NoError(t, mailer.Send(types.Email{To: "jane@example.com", Subject: "First", Body: "one"}))
+	assert.NoError(t, mailer.Send(types.Email{To: "jane@example.com", Subject: "Second", Body: "two"}))
+
+	files, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, files, 2)
+	assert.Equal(t, "20261017T093000-1-jane_at_example.com.eml", files[0].Name())
+
+	data, err := os.ReadFile(filepath.Join(dir, files[0].Name()))
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "Subject: First\r\n")
+	assert.Contains(t, string(data), "\r\n\r\none")
+}
+
+func TestSMTPMailer(t *testing.T) {
+	mailer, err := NewSMTPMailer(config.SMTPConfig{Host: "smtp.example.com", Username: "shop", Password: "secret"}, "shop@example.com")
+	assert.NoError(t, err)
+
+	var sentAddr, sentFrom string
+	var sentTo []string
+	var sentAuth smtp.Auth
+	mailer.sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		sentAddr, sentAuth, sentFrom, sentTo = addr, a, from, to
+		return nil
+	}
+
+	assert.NoError(t, mailer.Send(types.Email{To: "jane@example.com", Subject: "Hello", Body: "Hi"}))
+	assert.Equal(t, "smtp.example.com:587", sentAddr)
+	assert.NotNil(t, sentAuth)
+	assert.Equal(t, "shop@example.com", sentFrom)
+	assert.Equal(t, []string{"jane@example.com"}, sentTo)
+}
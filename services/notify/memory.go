@@ -0,0 +1,49 @@
+package notify
+
+import (
+	"sync"
+
+	"github.com/loloDawit/ecom/types"
+)
+
+// MemoryMailer keeps every email it is handed, so tests can assert on what
+// was sent without a mail server.
+type MemoryMailer struct {
+	mu   sync.Mutex
+	sent []types.Email
+}
+
+func NewMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{}
+}
+
+func (m *MemoryMailer) Send(email types.Email) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, email)
+	return nil
+}
+
+// Sent returns the emails sent so far, oldest first.
+func (m *MemoryMailer) Sent() []types.Email {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]types.Email(nil), m.sent...)
+}
+
+// Last returns the latest email sent, if any.
+func (m *MemoryMailer) Last() (types.Email, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.sent) == 0 {
+		return types.Email{}, false
+	}
+	return m.sent[len(m.sent)-1], true
+}
+
+// Reset forgets the emails sent so far.
+func (m *MemoryMailer) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = nil
+}
@@ -0,0 +1,81 @@
+// Package notify sends users email. Messages are rendered from the
+// templates embedded in the package and handed to a types.Mailer, which
+// writes them to the log, a directory or memory, or sends them over SMTP.
+package notify
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/loloDawit/ecom/config"
+	"github.com/loloDawit/ecom/types"
+)
+
+// Notifier implements types.Notifier.
+type Notifier struct {
+	mailer types.Mailer
+	cfg    *config.Config
+}
+
+func NewNotifier(mailer types.Mailer, cfg *config.Config) *Notifier {
+	return &Notifier{mailer: mailer, cfg: cfg}
+}
+
+// tokenData is passed to the templates of emails carrying a token. URL is
+// empty without an AppURL, and the templates show the bare token instead.
+type tokenData struct {
+	Name      string
+	Token     string
+	URL       string
+	ExpiresIn time.Duration
+}
+
+type orderData struct {
+	Name  string
+	Order *types.Order
+	URL   string
+}
+
+func (n *Notifier) SendEmailVerification(user *types.User, token string, expiresIn time.Duration) error {
+	return n.send(emailVerificationTemplate, user, tokenData{
+		Name:      user.FirstName,
+		Token:     token,
+		URL:       n.link("/verify-email?token=" + url.QueryEscape(token)),
+		ExpiresIn: expiresIn,
+	})
+}
+
+func (n *Notifier) SendPasswordReset(user *types.User, token string, expiresIn time.Duration) error {
+	return n.send(passwordResetTemplate, user, tokenData{
+		Name:      user.FirstName,
+		Token:     token,
+		URL:       n.link("/password/reset?token=" + url.QueryEscape(token)),
+		ExpiresIn: expiresIn,
+	})
+}
+
+func (n *Notifier) SendOrderConfirmation(user *types.User, order *types.Order) error {
+	return n.send(orderConfirmationTemplate, user, orderData{
+		Name:  user.FirstName,
+		Order: order,
+		URL:   n.link("/orders/" + strconv.Itoa(order.ID)),
+	})
+}
+
+func (n *Notifier) send(template *emailTemplate, user *types.User, data any) error {
+	email, err := template.render(user.Email, data)
+	if err != nil {
+		return fmt.Errorf("could not render email: %w", err)
+	}
+	return n.mailer.Send(email)
+}
+
+// link returns the web app URL of path, or "" when no AppURL is configured.
+func (n *Notifier) link(path string) string {
+	if n.cfg.AppURL == "" {
+		return ""
+	}
+	return n.cfg.AppURL + path
+}
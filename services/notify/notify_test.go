@@ -0,0 +1,117 @@
+package notify
+
+import (
+	"testing"
+	"time"
+
+	"github.com/loloDawit/ecom/config"
+	"github.com/loloDawit/ecom/types"
+	"github.com/stretchr/testify/assert"
+)
+
+var testUser = &types.User{ID: 7, FirstName: "Jane <3", Email: "jane@example.com"}
+
+func TestNotifierTokenEmails(t *testing.T) {
+	tests := []struct {
+		name            string
+		appURL          string
+		send            func(n *Notifier) error
+		expectedSubject string
+		expectedText    string
+		expectedHTML    string
+	}{
+		{
+			name:            "Email verification",
+			appURL:          "https://shop.example.com",
+			send:            func(n *Notifier) error { return n.SendEmailVerification(testUser, "a+b", 24*time.Hour) },
+			expectedSubject: "Verify your email address",
+			expectedText:    "within 24 hours:\n\nhttps://shop.example.com/verify-email?token=a%2Bb\n\n",
+			expectedHTML:    `<a href="https://shop.example.com/verify-email?token=a%2Bb"`,
+		},
+		{
+			name:            "Email verification without an app URL",
+			send:            func(n *Notifier) error { return n.SendEmailVerification(testUser, "a+b", 24*time.Hour) },
+			expectedSubject: "Verify your email address",
+			expectedText:    "within 24 hours:\n\na+b\n\n",
+			expectedHTML:    "<code>a&#43;b</code>",
+		},
+		{
+			name:            "Password reset",
+			appURL:          "https://shop.example.com",
+			send:            func(n *Notifier) error { return n.SendPasswordReset(testUser, "a+b", time.Hour) },
+			expectedSubject: "Reset your password",
+			expectedText:    "within 60 minutes to choose a new one:\n\nhttps://shop.example.com/password/reset?token=a%2Bb\n\n",
+			expectedHTML:    `<a href="https://shop.example.com/password/reset?token=a%2Bb"`,
+		},
+		{
+			name:            "Password reset without an app URL",
+			send:            func(n *Notifier) error { return n.SendPasswordReset(testUser, "a+b", time.Hour) },
+			expectedSubject: "Reset your password",
+			expectedText:    "within 60 minutes to choose a new one:\n\na+b\n\n",
+			expectedHTML:    "<code>a&#43;b</code>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mailer := NewMemoryMailer()
+			assert.NoError(t, tt.send(NewNotifier(mailer, &config.Config{AppURL: tt.appURL})))
+
+			email, ok := mailer.Last()
+			assert.True(t, ok)
+			assert.Equal(t, "jane@example.com", email.To)
+			assert.Equal(t, tt.expectedSubject, email.Subject)
+			assert.Contains(t, email.Body, "Hi Jane <3,\n\n")
+			assert.Contains(t, email.Body, tt.expectedText)
+			assert.Contains(t, email.HTML, "<p>Hi Jane &lt;3,</p>")
+			assert.Contains(t, email.HTML, tt.expectedHTML)
+		})
+	}
+}
+
+func TestNotifierOrderConfirmation(t *testing.T) {
+	mailer := NewMemoryMailer()
+	notifier := NewNotifier(mailer, &config.Config{AppURL: "https://shop.example.com"})
+
+	err := notifier.SendOrderConfirmation(testUser, &types.Order{
+		ID:      123,
+		Total:   27.5,
+		Address: "1 Pike St, Seattle, WA 98101, US",
+		Items: []types.OrderItem{
+			{ProductID: 1, Quantity: 2, Price: 10, Subtotal: 20, ProductName: "Mug"},
+			{ProductID: 2, Quantity: 3, Price: 2.5, Subtotal: 7.5, ProductName: "Pen & pencil"},
+		},
+	})
+	assert.NoError(t, err)
+
+	email, _ := mailer.Last()
+	assert.Equal(t, "Your order #123", email.Subject)
+	assert.Equal(t, "Hi Jane <3,\n\n"+
+		"Thanks for your order. We'll let you know once it ships.\n\n"+
+		"Order #123\n"+
+		"  2 x Mug at 10.00: 20.00\n"+
+		"  3 x Pen & pencil at 2.50: 7.50\n\n"+
+		"Total: 27.50\n"+
+		"Ships to: 1 Pike St, Seattle, WA 98101, US\n\n"+
+		"View your order at https://shop.example.com/orders/123\n", email.Body)
+	assert.Contains(t, email.HTML, "3 &times; Pen &amp; pencil")
+	assert.Contains(t, email.HTML, "<strong>27.50</strong>")
+	assert.Contains(t, email.HTML, `<a href="https://shop.example.com/orders/123">`)
+}
+
+func TestMemoryMailer(t *testing.T) {
+	mailer := NewMemoryMailer()
+	_, ok := mailer.Last()
+	assert.False(t, ok)
+
+	assert.NoError(t, mailer.Send(types.Email{To: "a@example.com"}))
+	assert.NoError(t, mailer.Send(types.Email{To: "b@example.com"}))
+
+	last, ok := mailer.Last()
+	assert.True(t, ok)
+	assert.Equal(t, "b@example.com", last.To)
+	assert.Equal(t, []types.Email{{To: "a@example.com"}, {To: "b@example.com"}}, mailer.Sent())
+
+	mailer.Reset()
+	assert.Empty(t, mailer.Sent())
+}
@@ -0,0 +1,51 @@
+package notify
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"time"
+
+	"github.com/loloDawit/ecom/config"
+	"github.com/loloDawit/ecom/types"
+)
+
+// SMTPMailer sends email through an SMTP server, authenticating with PLAIN
+// auth when a username is configured. net/smtp upgrades to TLS whenever the
+// server offers STARTTLS.
+type SMTPMailer struct {
+	addr     string
+	from     string
+	auth     smtp.Auth
+	sendMail func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+func NewSMTPMailer(cfg config.SMTPConfig, from string) (*SMTPMailer, error) {
+	if cfg.Host == "" {
+		return nil, fmt.Errorf("smtp host is required for the smtp driver")
+	}
+	if from == "" {
+		return nil, fmt.Errorf("a from address is required for the smtp driver")
+	}
+
+	port := cfg.Port
+	if port == 0 {
+		port = 587
+	}
+
+	mailer := &SMTPMailer{
+		addr:     net.JoinHostPort(cfg.Host, strconv.Itoa(port)),
+		from:     from,
+		sendMail: smtp.SendMail,
+	}
+	if cfg.Username != "" {
+		mailer.auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
+	}
+
+	return mailer, nil
+}
+
+func (m *SMTPMailer) Send(email types.Email) error {
+	return m.sendMail(m.addr, m.auth, m.from, []string{headerValue(email.To)}, formatMessage(m.from, email, time.Now()))
+}
@@ -0,0 +1,57 @@
+package notify
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/loloDawit/ecom/types"
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+var templateFuncs = map[string]any{
+	"hours":   func(d time.Duration) int { return int(d.Hours()) },
+	"minutes": func(d time.Duration) int { return int(d.Minutes()) },
+	"money":   func(amount float64) string { return fmt.Sprintf("%.2f", amount) },
+}
+
+// emailTemplate is one email: templates/<name>.txt defines its "subject" and
+// plain text "body", templates/<name>.html its HTML "content", which is
+// wrapped in templates/layout.html.
+type emailTemplate struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+func mustParseTemplate(name string) *emailTemplate {
+	return &emailTemplate{
+		text: texttemplate.Must(texttemplate.New(name).Funcs(templateFuncs).ParseFS(templateFS, "templates/"+name+".txt")),
+		html: htmltemplate.Must(htmltemplate.New(name).Funcs(templateFuncs).ParseFS(templateFS, "templates/layout.html", "templates/"+name+".html")),
+	}
+}
+
+var (
+	emailVerificationTemplate = mustParseTemplate("email_verification")
+	passwordResetTemplate     = mustParseTemplate("password_reset")
+	orderConfirmationTemplate = mustParseTemplate("order_confirmation")
+)
+
+func (t *emailTemplate) render(to string, data any) (types.Email, error) {
+	var subject, text, html bytes.Buffer
+	if err := t.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return types.Email{}, err
+	}
+	if err := t.text.ExecuteTemplate(&text, "body", data); err != nil {
+		return types.Email{}, err
+	}
+	if err := t.html.ExecuteTemplate(&html, "layout", data); err != nil {
+		return types.Email{}, err
+	}
+
+	return types.Email{To: to, Subject: subject.String(), Body: text.String(), HTML: html.String()}, nil
+}
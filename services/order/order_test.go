@@ -3,6 +3,7 @@ package order
 import (
 	"database/sql"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/loloDawit/ecom/config"
@@ -90,14 +91,17 @@ func TestCreateOrderItem(t *testing.T) {
 		{
 			name: "Successful creation",
 			orderItem: types.OrderItem{
-				OrderID:   1,
-				ProductID: 1,
-				Quantity:  2,
-				Price:     50.25,
+				OrderID:      1,
+				ProductID:    1,
+				Quantity:     2,
+				Price:        50.25,
+				Subtotal:     100.50,
+				ProductName:  "Product 1",
+				ProductImage: "image1.jpg",
 			},
 			mockExec: func() {
-				mock.ExpectExec("INSERT INTO order_items \\(orderID, productID, quantity, price\\) VALUES \\(\\$1, \\$2, \\$3, \\$4\\)").
-					WithArgs(1, 1, 2, 50.25).
+				mock.ExpectExec("INSERT INTO order_items \\(orderID, productID, quantity, price, subtotal, productName, productImage\\) VALUES \\(\\$1, \\$2, \\$3, \\$4, \\$5, \\$6, \\$7\\)").
+					WithArgs(1, 1, 2, 50.25, 100.50, "Product 1", "image1.jpg").
 					WillReturnResult(sqlmock.NewResult(1, 1))
 			},
 			expectedErr: nil,
@@ -105,14 +109,17 @@ func TestCreateOrderItem(t *testing.T) {
 		{
 			name: "Database error",
 			orderItem: types.OrderItem{
-				OrderID:   1,
-				ProductID: 1,
-				Quantity:  2,
-				Price:     50.25,
+				OrderID:      1,
+				ProductID:    1,
+				Quantity:     2,
+				Price:        50.25,
+				Subtotal:     100.50,
+				ProductName:  "Product 1",
+				ProductImage: "image1.jpg",
 			},
 			mockExec: func() {
-				mock.ExpectExec("INSERT INTO order_items \\(orderID, productID, quantity, price\\) VALUES \\(\\$1, \\$2, \\$3, \\$4\\)").
-					WithArgs(1, 1, 2, 50.25).
+				mock.ExpectExec("INSERT INTO order_items \\(orderID, productID, quantity, price, subtotal, productName, productImage\\) VALUES \\(\\$1, \\$2, \\$3, \\$4, \\$5, \\$6, \\$7\\)").
+					WithArgs(1, 1, 2, 50.25, 100.50, "Product 1", "image1.jpg").
 					WillReturnError(sql.ErrConnDone)
 			},
 			expectedErr: sql.ErrConnDone,
@@ -127,3 +134,191 @@ func TestCreateOrderItem(t *testing.T) {
 		})
 	}
 }
+
+func TestGetOrdersByUserID(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	cfg := &config.Config{}
+	store := NewOrderStore(db, cfg)
+	createdAt := time.Date(2024, 7, 6, 8, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name           string
+		mockQuery      func()
+		expectedOrders []types.Order
+		expectedErr    error
+	}{
+		{
+			name: "Orders found",
+			mockQuery: func() {
+				rows := sqlmock.NewRows([]string{"id", "userId", "total", "status", "address", "createdAt"}).
+					AddRow(2, 1, 30.0, "pending", "Seattle, WA", createdAt).
+					AddRow(1, 1, 10.0, "pending", "Seattle, WA", createdAt)
+				mock.ExpectQuery("SELECT id, userId, total, status, address, createdAt FROM orders WHERE userId = \\$1 ORDER BY createdAt DESC, id DESC LIMIT \\$2 OFFSET \\$3").
+					WithArgs(1, 20, 0).
+					WillReturnRows(rows)
+			},
+			expectedOrders: []types.Order{
+				{ID: 2, UserID: 1, Total: 30, Status: "pending", Address: "Seattle, WA", CreatedAt: createdAt},
+				{ID: 1, UserID: 1, Total: 10, Status: "pending", Address: "Seattle, WA", CreatedAt: createdAt},
+			},
+			expectedErr: nil,
+		},
+		{
+			name: "Database error",
+			mockQuery: func() {
+				mock.ExpectQuery("SELECT id, userId, total, status, address, createdAt FROM orders WHERE userId = \\$1").
+					WithArgs(1, 20, 0).
+					WillReturnError(sql.ErrConnDone)
+			},
+			expectedOrders: nil,
+			expectedErr:    sql.ErrConnDone,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockQuery()
+			orders, err := store.GetOrdersByUserID(1, 20, 0)
+			assert.Equal(t, tt.expectedErr, err)
+			assert.Equal(t, tt.expectedOrders, orders)
+		})
+	}
+}
+
+func TestGetOrderByID(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	cfg := &config.Config{}
+	store := NewOrderStore(db, cfg)
+	createdAt := time.Date(2024, 7, 6, 8, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		mockQuery     func()
+		expectedOrder *types.Order
+		expectedErr   error
+	}{
+		{
+			name: "Order with items",
+			mockQuery: func() {
+				mock.ExpectQuery("SELECT id, userId, total, status, address, createdAt FROM orders WHERE id = \\$1").
+					WithArgs(7).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "userId", "total", "status", "address", "createdAt"}).
+						AddRow(7, 1, 20.0, "pending", "Seattle, WA", createdAt))
+				mock.ExpectQuery("SELECT oi.id, oi.orderId, oi.productId, oi.quantity, oi.price, COALESCE\\(oi.subtotal, oi.price \\* oi.quantity\\)").
+					WithArgs(7).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "orderId", "productId", "quantity", "price", "subtotal", "productName", "productImage", "createdAt"}).
+						AddRow(1, 7, 3, 2, 10.0, 20.0, "Product 3", "image3.jpg", createdAt))
+			},
+			expectedOrder: &types.Order{
+				ID: 7, UserID: 1, Total: 20, Status: "pending", Address: "Seattle, WA", CreatedAt: createdAt,
+				Items: []types.OrderItem{
+					{ID: 1, OrderID: 7, ProductID: 3, Quantity: 2, Price: 10, Subtotal: 20, CreatedAt: createdAt, ProductName: "Product 3", ProductImage: "image3.jpg"},
+				},
+			},
+			expectedErr: nil,
+		},
+		{
+			name: "Order not found",
+			mockQuery: func() {
+				mock.ExpectQuery("SELECT id, userId, total, status, address, createdAt FROM orders WHERE id = \\$1").
+					WithArgs(7).
+					WillReturnError(sql.ErrNoRows)
+			},
+			expectedOrder: nil,
+			expectedErr:   sql.ErrNoRows,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockQuery()
+			order, err := store.GetOrderByID(7)
+			assert.Equal(t, tt.expectedErr, err)
+			assert.Equal(t, tt.expectedOrder, order)
+		})
+	}
+}
+
+func TestUpdateOrderStatus(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	store := NewOrderStore(db, &config.Config{})
+
+	mock.ExpectQuery("SELECT id, userId, total, status, address, createdAt FROM orders WHERE id = \\$1 FOR UPDATE").
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "userId", "total", "status", "address", "createdAt"}).
+			AddRow(7, 1, 20.0, "pending", "Seattle, WA", time.Now()))
+	mock.ExpectExec("UPDATE orders SET status = \\$1 WHERE id = \\$2").
+		WithArgs("paid", 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO status_history \\(orderId, fromStatus, toStatus, actorId\\) VALUES \\(\\$1, \\$2, \\$3, \\$4\\)").
+		WithArgs(7, "pending", "paid", 1).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	order, err := store.GetOrderForUpdate(7)
+	assert.NoError(t, err)
+	assert.Equal(t, types.OrderStatusPending, order.Status)
+
+	assert.NoError(t, store.UpdateOrderStatus(7, types.OrderStatusPaid))
+	assert.NoError(t, store.CreateStatusHistory(types.StatusHistory{OrderID: 7, FromStatus: types.OrderStatusPending, ToStatus: types.OrderStatusPaid, ActorID: 1}))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestBackfillOrderItemSnapshots(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	store := NewOrderStore(db, &config.Config{})
+
+	tests := []struct {
+		name            string
+		mockExec        func()
+		expectedUpdated int64
+		expectedErr     error
+	}{
+		{
+			name: "Rows backfilled",
+			mockExec: func() {
+				mock.ExpectExec("UPDATE order_items oi\\s+SET price = b.unitPrice, subtotal = b.unitPrice \\* oi.quantity").
+					WillReturnResult(sqlmock.NewResult(0, 3))
+			},
+			expectedUpdated: 3,
+			expectedErr:     nil,
+		},
+		{
+			name: "Database error",
+			mockExec: func() {
+				mock.ExpectExec("UPDATE order_items oi").
+					WillReturnError(sql.ErrConnDone)
+			},
+			expectedUpdated: 0,
+			expectedErr:     sql.ErrConnDone,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockExec()
+			updated, err := store.BackfillOrderItemSnapshots()
+			assert.Equal(t, tt.expectedErr, err)
+			assert.Equal(t, tt.expectedUpdated, updated)
+		})
+	}
+}
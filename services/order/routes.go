@@ -0,0 +1,174 @@
+package order
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/loloDawit/ecom/config"
+	"github.com/loloDawit/ecom/services/auth"
+	"github.com/loloDawit/ecom/types"
+	"github.com/loloDawit/ecom/utils"
+	"gopkg.in/go-playground/validator.v9"
+)
+
+type Handler struct {
+	store   types.OrderStore
+	service *Service
+	auth    auth.Authenticator
+	cfg     *config.Config
+}
+
+func NewHandlers(store types.OrderStore, service *Service, authenticator auth.Authenticator, cfg *config.Config) *Handler {
+	return &Handler{store: store, service: service, auth: authenticator, cfg: cfg}
+}
+
+func (h *Handler) RegisterRoutes(r *mux.Router) {
+	// API keys need orders:read to look and orders:write to change anything
+	readMiddleware := auth.ScopedMiddleware(h.auth, types.ScopeOrdersRead)
+	writeMiddleware := auth.ScopedMiddleware(h.auth, types.ScopeOrdersWrite)
+
+	r.HandleFunc("/orders", readMiddleware(h.getOrders)).Methods("GET")
+	r.HandleFunc("/orders/{id}", readMiddleware(h.getOrder)).Methods("GET")
+	r.HandleFunc("/orders/{id}/cancel", writeMiddleware(h.cancelOrder)).Methods("POST")
+	r.HandleFunc("/orders/{id}/transitions", writeMiddleware(auth.RequireRole(types.RoleStaff, types.RoleAdmin)(h.transitionOrder))).Methods("POST")
+}
+
+func (h *Handler) getOrders(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	limit, offset, err := utils.ParsePagination(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	orders, err := h.store.GetOrdersByUserID(userID, limit, offset)
+	if err != nil {
+		log.Printf("error getting orders for user %d: %v", userID, err)
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrInternalServerError)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.OrderListResponse{
+		Orders: orders,
+		Limit:  limit,
+		Offset: offset,
+	})
+}
+
+func (h *Handler) getOrder(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid order ID")
+		return
+	}
+
+	order, err := h.store.GetOrderByID(id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.WriteError(w, http.StatusNotFound, utils.ErrOrderNotFound)
+			return
+		}
+		log.Printf("error getting order %d: %v", id, err)
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrInternalServerError)
+		return
+	}
+
+	// other users' orders are reported as missing so their IDs don't leak
+	if order.UserID != userID {
+		utils.WriteError(w, http.StatusNotFound, utils.ErrOrderNotFound)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, order)
+}
+
+func (h *Handler) transitionOrder(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid order ID")
+		return
+	}
+
+	if r.Body == nil {
+		utils.WriteError(w, http.StatusBadRequest, utils.ErrInvalidRequestBody)
+		return
+	}
+
+	var payload types.OrderTransitionPayload
+	if err := utils.ReadJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, utils.ErrInvalidPayload)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Sprintf("%s: %v", utils.ErrInvalidPayload, validationErrors))
+		return
+	}
+
+	order, err := h.service.Transition(id, payload.Status, userID)
+	if err != nil {
+		h.writeServiceError(w, id, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, order)
+}
+
+func (h *Handler) cancelOrder(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid order ID")
+		return
+	}
+
+	order, err := h.service.Cancel(id, userID)
+	if err != nil {
+		h.writeServiceError(w, id, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, order)
+}
+
+// writeServiceError maps errors from the order service to responses.
+func (h *Handler) writeServiceError(w http.ResponseWriter, orderID int, err error) {
+	var transitionErr *TransitionError
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		utils.WriteError(w, http.StatusNotFound, utils.ErrOrderNotFound)
+	case errors.As(err, &transitionErr):
+		utils.WriteError(w, http.StatusConflict, transitionErr.Error())
+	default:
+		log.Printf("error updating order %d: %v", orderID, err)
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrInternalServerError)
+	}
+}
@@ -0,0 +1,502 @@
+package order
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/gorilla/mux"
+	"github.com/loloDawit/ecom/config"
+	"github.com/loloDawit/ecom/services/auth"
+	"github.com/loloDawit/ecom/services/auth/authtest"
+	"github.com/loloDawit/ecom/types"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockOrderStore struct {
+	CreateOrderFunc         func(order types.Order) (int, error)
+	CreateOrderItemFunc     func(item types.OrderItem) error
+	GetOrdersByUserIDFunc   func(userID int, limit int, offset int) ([]types.Order, error)
+	GetOrderByIDFunc        func(id int) (*types.Order, error)
+	GetOrderItemsFunc       func(orderID int) ([]types.OrderItem, error)
+	GetOrderForUpdateFunc   func(id int) (*types.Order, error)
+	UpdateOrderStatusFunc   func(id int, status types.OrderStatus) error
+	CreateStatusHistoryFunc func(h types.StatusHistory) error
+}
+
+func (m *mockOrderStore) CreateOrder(order types.Order) (int, error) {
+	if m.CreateOrderFunc != nil {
+		return m.CreateOrderFunc(order)
+	}
+	return 0, nil
+}
+
+func (m *mockOrderStore) CreateOrderItem(item types.OrderItem) error {
+	if m.CreateOrderItemFunc != nil {
+		return m.CreateOrderItemFunc(item)
+	}
+	return nil
+}
+
+func (m *mockOrderStore) GetOrdersByUserID(userID int, limit int, offset int) ([]types.Order, error) {
+	if m.GetOrdersByUserIDFunc != nil {
+		return m.GetOrdersByUserIDFunc(userID, limit, offset)
+	}
+	return []types.Order{}, nil
+}
+
+func (m *mockOrderStore) GetOrderByID(id int) (*types.Order, error) {
+	if m.GetOrderByIDFunc != nil {
+		return m.GetOrderByIDFunc(id)
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *mockOrderStore) GetOrderItems(orderID int) ([]types.OrderItem, error) {
+	if m.GetOrderItemsFunc != nil {
+		return m.GetOrderItemsFunc(orderID)
+	}
+	return []types.OrderItem{}, nil
+}
+
+func (m *mockOrderStore) GetOrderForUpdate(id int) (*types.Order, error) {
+	if m.GetOrderForUpdateFunc != nil {
+		return m.GetOrderForUpdateFunc(id)
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *mockOrderStore) UpdateOrderStatus(id int, status types.OrderStatus) error {
+	if m.UpdateOrderStatusFunc != nil {
+		return m.UpdateOrderStatusFunc(id, status)
+	}
+	return nil
+}
+
+func (m *mockOrderStore) CreateStatusHistory(h types.StatusHistory) error {
+	if m.CreateStatusHistoryFunc != nil {
+		return m.CreateStatusHistoryFunc(h)
+	}
+	return nil
+}
+
+// mockProductStore only records stock being returned by cancellations.
+type mockProductStore struct {
+	restored []types.Product
+}
+
+func (m *mockProductStore) SearchProducts(query string, limit int, offset int) ([]types.ProductSearchResult, error) {
+	return nil, nil
+}
+
+func (m *mockProductStore) GetProductByID(id int) (*types.Product, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (m *mockProductStore) GetProducts(query types.ProductQuery) ([]types.Product, error) {
+	return nil, nil
+}
+
+func (m *mockProductStore) CreateProduct(product types.Product) (int, error) {
+	return 0, nil
+}
+
+func (m *mockProductStore) UpdateProduct(product types.Product, expectedVersion int) (*types.Product, error) {
+	return &product, nil
+}
+
+func (m *mockProductStore) DeleteProduct(id int, expectedVersion int) error {
+	return nil
+}
+
+func (m *mockProductStore) UpdateProductQuantityWithTransaction(product types.Product) error {
+	return nil
+}
+
+func (m *mockProductStore) RestoreProductQuantityWithTransaction(product types.Product) error {
+	m.restored = append(m.restored, product)
+	return nil
+}
+
+type mockTransaction struct {
+	orders   types.OrderStore
+	products *mockProductStore
+}
+
+func (m *mockTransaction) Products() types.ProductStore {
+	return m.products
+}
+
+func (m *mockTransaction) Orders() types.OrderStore {
+	return m.orders
+}
+
+func (m *mockTransaction) Carts() types.CartStore {
+	return nil
+}
+
+// mockTransactor runs the unit of work directly and records its outcome.
+type mockTransactor struct {
+	tx         *mockTransaction
+	committed  bool
+	rolledBack bool
+}
+
+func newMockTransactor(orders types.OrderStore) *mockTransactor {
+	return &mockTransactor{tx: &mockTransaction{orders: orders, products: &mockProductStore{}}}
+}
+
+func (m *mockTransactor) WithinTransaction(fn func(tx types.Transaction) error) error {
+	if err := fn(m.tx); err != nil {
+		m.rolledBack = true
+		return err
+	}
+	m.committed = true
+	return nil
+}
+
+func generateTestToken(secret []byte, userID int) string {
+	return generateRoleToken(secret, userID, types.RoleCustomer)
+}
+
+func generateRoleToken(secret []byte, userID int, role types.Role) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"userID": strconv.Itoa(userID),
+		"role":   string(role),
+		"exp":    time.Now().Add(time.Hour).Unix(),
+	})
+	tokenString, _ := token.SignedString(secret)
+	return tokenString
+}
+
+func TestOrderRoutes(t *testing.T) {
+	cfg := &config.Config{
+		JWT: config.JWTConfig{
+			Secret: "testsecret",
+		},
+	}
+	createdAt := time.Date(2024, 7, 6, 8, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name                 string
+		path                 string
+		mockStore            *mockOrderStore
+		expectedStatus       int
+		expectedResponseBody string
+	}{
+		{
+			name: "List orders with default pagination",
+			path: "/orders",
+			mockStore: &mockOrderStore{
+				GetOrdersByUserIDFunc: func(userID int, limit int, offset int) ([]types.Order, error) {
+					assert.Equal(t, 1, userID)
+					assert.Equal(t, 20, limit)
+					assert.Equal(t, 0, offset)
+					return []types.Order{{ID: 7, UserID: 1, Total: 20, Status: "pending", Address: "Seattle, WA", CreatedAt: createdAt}}, nil
+				},
+			},
+			expectedStatus:       http.StatusOK,
+			expectedResponseBody: `{"orders":[{"id":7,"userId":1,"total":20,"status":"pending","address":"Seattle, WA","createdAt":"2024-07-06T08:00:00Z"}],"limit":20,"offset":0}`,
+		},
+		{
+			name: "List orders with explicit pagination",
+			path: "/orders?limit=5&offset=10",
+			mockStore: &mockOrderStore{
+				GetOrdersByUserIDFunc: func(userID int, limit int, offset int) ([]types.Order, error) {
+					assert.Equal(t, 5, limit)
+					assert.Equal(t, 10, offset)
+					return []types.Order{}, nil
+				},
+			},
+			expectedStatus:       http.StatusOK,
+			expectedResponseBody: `{"orders":[],"limit":5,"offset":10}`,
+		},
+		{
+			name:                 "List orders with invalid limit",
+			path:                 "/orders?limit=abc",
+			mockStore:            &mockOrderStore{},
+			expectedStatus:       http.StatusBadRequest,
+			expectedResponseBody: `{"error":"invalid limit: abc"}`,
+		},
+		{
+			name: "Get own order",
+			path: "/orders/7",
+			mockStore: &mockOrderStore{
+				GetOrderByIDFunc: func(id int) (*types.Order, error) {
+					return &types.Order{
+						ID: id, UserID: 1, Total: 20, Status: "pending", Address: "Seattle, WA", CreatedAt: createdAt,
+						Items: []types.OrderItem{{ID: 1, OrderID: id, ProductID: 3, Quantity: 2, Price: 10, Subtotal: 20, ProductName: "Product 3", ProductImage: "image3.jpg"}},
+					}, nil
+				},
+			},
+			expectedStatus:       http.StatusOK,
+			expectedResponseBody: `{"id":7,"userId":1,"total":20,"status":"pending","address":"Seattle, WA","createdAt":"2024-07-06T08:00:00Z","items":[{"id":1,"orderId":7,"productId":3,"quantity":2,"price":10,"subtotal":20,"createdAt":"0001-01-01T00:00:00Z","productName":"Product 3","productImage":"image3.jpg"}]}`,
+		},
+		{
+			name: "Get another user's order",
+			path: "/orders/8",
+			mockStore: &mockOrderStore{
+				GetOrderByIDFunc: func(id int) (*types.Order, error) {
+					return &types.Order{ID: id, UserID: 2}, nil
+				},
+			},
+			expectedStatus:       http.StatusNotFound,
+			expectedResponseBody: `{"error":"order not found"}`,
+		},
+		{
+			name:                 "Get missing order",
+			path:                 "/orders/9",
+			mockStore:            &mockOrderStore{},
+			expectedStatus:       http.StatusNotFound,
+			expectedResponseBody: `{"error":"order not found"}`,
+		},
+		{
+			name:                 "Get order with invalid ID",
+			path:                 "/orders/abc",
+			mockStore:            &mockOrderStore{},
+			expectedStatus:       http.StatusBadRequest,
+			expectedResponseBody: `{"error":"Invalid order ID"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewHandlers(tt.mockStore, NewService(newMockTransactor(tt.mockStore)), auth.NewJWTAuthenticator([]byte(cfg.JWT.Secret)), cfg)
+			router := mux.NewRouter()
+			handler.RegisterRoutes(router)
+
+			req, err := http.NewRequest("GET", tt.path, nil)
+			assert.NoError(t, err)
+			req.Header.Set("Authorization", "Bearer "+generateTestToken([]byte(cfg.JWT.Secret), 1))
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			assert.JSONEq(t, tt.expectedResponseBody, rr.Body.String())
+		})
+	}
+}
+
+func TestOrderRoutesRequireToken(t *testing.T) {
+	cfg := &config.Config{
+		JWT: config.JWTConfig{
+			Secret: "testsecret",
+		},
+	}
+
+	handler := NewHandlers(&mockOrderStore{}, NewService(newMockTransactor(&mockOrderStore{})), auth.NewJWTAuthenticator([]byte(cfg.JWT.Secret)), cfg)
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	req, err := http.NewRequest("GET", "/orders", nil)
+	assert.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
+func TestOrderRoutesRequireScope(t *testing.T) {
+	// an API key that may only read orders
+	authenticator := &authtest.Authenticator{Identity: &auth.Identity{
+		UserID:   1,
+		Role:     types.RoleStaff,
+		APIKeyID: 3,
+		Scopes:   []types.Scope{types.ScopeOrdersRead},
+	}}
+	handler := NewHandlers(&mockOrderStore{}, NewService(newMockTransactor(&mockOrderStore{})), authenticator, &config.Config{})
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	tests := []struct {
+		method         string
+		path           string
+		expectedStatus int
+	}{
+		{"GET", "/orders", http.StatusOK},
+		{"POST", "/orders/1/cancel", http.StatusForbidden},
+		{"POST", "/orders/1/transitions", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest(tt.method, tt.path, strings.NewReader(`{"status":"shipped"}`))
+		assert.NoError(t, err)
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, tt.expectedStatus, rr.Code, tt.method+" "+tt.path)
+	}
+}
+
+func TestTransitionOrderRoute(t *testing.T) {
+	cfg := &config.Config{
+		JWT: config.JWTConfig{
+			Secret: "testsecret",
+		},
+	}
+
+	pendingOrder := func(id int) (*types.Order, error) {
+		return &types.Order{ID: id, UserID: 2, Total: 20, Status: types.OrderStatusPending, Address: "Seattle, WA"}, nil
+	}
+
+	tests := []struct {
+		name                 string
+		userID               int
+		role                 types.Role
+		path                 string
+		body                 string
+		mockStore            *mockOrderStore
+		expectedStatus       int
+		expectedResponseBody string
+	}{
+		{
+			name:   "Valid transition",
+			userID: 1,
+			role:   types.RoleStaff,
+			path:   "/orders/7/transitions",
+			body:   `{"status":"paid"}`,
+			mockStore: &mockOrderStore{
+				GetOrderForUpdateFunc: pendingOrder,
+				CreateStatusHistoryFunc: func(h types.StatusHistory) error {
+					assert.Equal(t, types.StatusHistory{OrderID: 7, FromStatus: types.OrderStatusPending, ToStatus: types.OrderStatusPaid, ActorID: 1}, h)
+					return nil
+				},
+			},
+			expectedStatus:       http.StatusOK,
+			expectedResponseBody: `{"id":7,"userId":2,"total":20,"status":"paid","address":"Seattle, WA","createdAt":"0001-01-01T00:00:00Z"}`,
+		},
+		{
+			name:   "Illegal transition",
+			userID: 1,
+			role:   types.RoleStaff,
+			path:   "/orders/7/transitions",
+			body:   `{"status":"shipped"}`,
+			mockStore: &mockOrderStore{
+				GetOrderForUpdateFunc: pendingOrder,
+				UpdateOrderStatusFunc: func(id int, status types.OrderStatus) error {
+					t.Fatal("illegal transitions must not update the order")
+					return nil
+				},
+			},
+			expectedStatus:       http.StatusConflict,
+			expectedResponseBody: `{"error":"cannot move order from pending to shipped"}`,
+		},
+		{
+			name:                 "Unknown status",
+			userID:               1,
+			role:                 types.RoleStaff,
+			path:                 "/orders/7/transitions",
+			body:                 `{"status":"lost"}`,
+			mockStore:            &mockOrderStore{},
+			expectedStatus:       http.StatusBadRequest,
+			expectedResponseBody: `{"error":"invalid payload: Key: 'OrderTransitionPayload.Status' Error:Field validation for 'Status' failed on the 'oneof' tag"}`,
+		},
+		{
+			name:                 "Missing order",
+			userID:               1,
+			role:                 types.RoleAdmin,
+			path:                 "/orders/9/transitions",
+			body:                 `{"status":"paid"}`,
+			mockStore:            &mockOrderStore{},
+			expectedStatus:       http.StatusNotFound,
+			expectedResponseBody: `{"error":"order not found"}`,
+		},
+		{
+			name:                 "Customer",
+			userID:               2,
+			role:                 types.RoleCustomer,
+			path:                 "/orders/7/transitions",
+			body:                 `{"status":"paid"}`,
+			mockStore:            &mockOrderStore{GetOrderForUpdateFunc: pendingOrder},
+			expectedStatus:       http.StatusForbidden,
+			expectedResponseBody: `{"error":"forbidden"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewHandlers(tt.mockStore, NewService(newMockTransactor(tt.mockStore)), auth.NewJWTAuthenticator([]byte(cfg.JWT.Secret)), cfg)
+			router := mux.NewRouter()
+			handler.RegisterRoutes(router)
+
+			req, err := http.NewRequest("POST", tt.path, strings.NewReader(tt.body))
+			assert.NoError(t, err)
+			req.Header.Set("Authorization", "Bearer "+generateRoleToken([]byte(cfg.JWT.Secret), tt.userID, tt.role))
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			assert.JSONEq(t, tt.expectedResponseBody, rr.Body.String())
+		})
+	}
+}
+
+func TestCancelOrderRoute(t *testing.T) {
+	cfg := &config.Config{
+		JWT: config.JWTConfig{
+			Secret: "testsecret",
+		},
+	}
+
+	tests := []struct {
+		name                 string
+		status               types.OrderStatus
+		ownerID              int
+		expectedStatus       int
+		expectedResponseBody string
+	}{
+		{
+			name:                 "Cancel pending order",
+			status:               types.OrderStatusPending,
+			ownerID:              1,
+			expectedStatus:       http.StatusOK,
+			expectedResponseBody: `{"id":7,"userId":1,"total":20,"status":"cancelled","address":"Seattle, WA","createdAt":"0001-01-01T00:00:00Z"}`,
+		},
+		{
+			name:                 "Cancel shipped order",
+			status:               types.OrderStatusShipped,
+			ownerID:              1,
+			expectedStatus:       http.StatusConflict,
+			expectedResponseBody: `{"error":"cannot move order from shipped to cancelled"}`,
+		},
+		{
+			name:                 "Cancel another user's order",
+			status:               types.OrderStatusPending,
+			ownerID:              2,
+			expectedStatus:       http.StatusNotFound,
+			expectedResponseBody: `{"error":"order not found"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &mockOrderStore{
+				GetOrderForUpdateFunc: func(id int) (*types.Order, error) {
+					return &types.Order{ID: id, UserID: tt.ownerID, Total: 20, Status: tt.status, Address: "Seattle, WA"}, nil
+				},
+			}
+			handler := NewHandlers(store, NewService(newMockTransactor(store)), auth.NewJWTAuthenticator([]byte(cfg.JWT.Secret)), cfg)
+			router := mux.NewRouter()
+			handler.RegisterRoutes(router)
+
+			req, err := http.NewRequest("POST", "/orders/7/cancel", nil)
+			assert.NoError(t, err)
+			req.Header.Set("Authorization", "Bearer "+generateTestToken([]byte(cfg.JWT.Secret), 1))
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			assert.JSONEq(t, tt.expectedResponseBody, rr.Body.String())
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package order
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/loloDawit/ecom/types"
+)
+
+// transitions lists the statuses an order may move to from each status.
+// Cancelled and refunded orders are final.
+var transitions = map[types.OrderStatus][]types.OrderStatus{
+	types.OrderStatusPending:   {types.OrderStatusPaid, types.OrderStatusCancelled},
+	types.OrderStatusPaid:      {types.OrderStatusFulfilled, types.OrderStatusCancelled, types.OrderStatusRefunded},
+	types.OrderStatusFulfilled: {types.OrderStatusShipped, types.OrderStatusRefunded},
+	types.OrderStatusShipped:   {types.OrderStatusDelivered},
+	types.OrderStatusDelivered: {types.OrderStatusRefunded},
+}
+
+// CanTransition reports whether an order may move from one status to another.
+func CanTransition(from, to types.OrderStatus) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// TransitionError is returned when a status change breaks the order lifecycle.
+type TransitionError struct {
+	From types.OrderStatus
+	To   types.OrderStatus
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("cannot move order from %s to %s", e.From, e.To)
+}
+
+// Service applies the order lifecycle on top of the order store.
+type Service struct {
+	transactor types.Transactor
+}
+
+func NewService(transactor types.Transactor) *Service {
+	return &Service{transactor: transactor}
+}
+
+// Transition moves the order to status on behalf of actorID and records the
+// change in the status history.
+func (s *Service) Transition(orderID int, status types.OrderStatus, actorID int) (*types.Order, error) {
+	var order *types.Order
+	err := s.transactor.WithinTransaction(func(tx types.Transaction) error {
+		var err error
+		order, err = transition(tx, orderID, status, actorID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// Cancel cancels a pending order owned by userID. Orders belonging to someone
+// else are reported as sql.ErrNoRows.
+func (s *Service) Cancel(orderID int, userID int) (*types.Order, error) {
+	var order *types.Order
+	err := s.transactor.WithinTransaction(func(tx types.Transaction) error {
+		var err error
+		order, err = tx.Orders().GetOrderForUpdate(orderID)
+		if err != nil {
+			return err
+		}
+
+		if order.UserID != userID {
+			return sql.ErrNoRows
+		}
+
+		// customers may only cancel orders that have not been paid yet
+		if order.Status != types.OrderStatusPending {
+			return &TransitionError{From: order.Status, To: types.OrderStatusCancelled}
+		}
+
+		return applyTransition(tx, order, types.OrderStatusCancelled, userID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// transition applies a single status change inside tx, locking the order row
+// so concurrent changes are serialised.
+func transition(tx types.Transaction, orderID int, status types.OrderStatus, actorID int) (*types.Order, error) {
+	order, err := tx.Orders().GetOrderForUpdate(orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := applyTransition(tx, order, status, actorID); err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// releasesStock reports whether moving to status gives the order's items
+// back to stock. Both statuses are final, so it happens once per order.
+func releasesStock(status types.OrderStatus) bool {
+	return status == types.OrderStatusCancelled || status == types.OrderStatusRefunded
+}
+
+// applyTransition validates and records the move of a locked order to status,
+// returning every item's quantity to stock when the order is cancelled or
+// refunded.
+func applyTransition(tx types.Transaction, order *types.Order, status types.OrderStatus, actorID int) error {
+	if !CanTransition(order.Status, status) {
+		return &TransitionError{From: order.Status, To: status}
+	}
+
+	if err := tx.Orders().UpdateOrderStatus(order.ID, status); err != nil {
+		return err
+	}
+
+	err := tx.Orders().CreateStatusHistory(types.StatusHistory{
+		OrderID:    order.ID,
+		FromStatus: order.Status,
+		ToStatus:   status,
+		ActorID:    actorID,
+	})
+	if err != nil {
+		return err
+	}
+
+	if releasesStock(status) {
+		if err := restoreStock(tx, order.ID); err != nil {
+			return err
+		}
+	}
+
+	order.Status = status
+	return nil
+}
+
+func restoreStock(tx types.Transaction, orderID int) error {
+	items, err := tx.Orders().GetOrderItems(orderID)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		err := tx.Products().RestoreProductQuantityWithTransaction(types.Product{
+			ID:       item.ProductID,
+			Quantity: item.Quantity,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,173 @@
+package order
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/loloDawit/ecom/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from     types.OrderStatus
+		to       types.OrderStatus
+		expected bool
+	}{
+		{types.OrderStatusPending, types.OrderStatusPaid, true},
+		{types.OrderStatusPending, types.OrderStatusCancelled, true},
+		{types.OrderStatusPending, types.OrderStatusShipped, false},
+		{types.OrderStatusPaid, types.OrderStatusFulfilled, true},
+		{types.OrderStatusPaid, types.OrderStatusRefunded, true},
+		{types.OrderStatusFulfilled, types.OrderStatusShipped, true},
+		{types.OrderStatusShipped, types.OrderStatusDelivered, true},
+		{types.OrderStatusShipped, types.OrderStatusCancelled, false},
+		{types.OrderStatusDelivered, types.OrderStatusRefunded, true},
+		{types.OrderStatusDelivered, types.OrderStatusPending, false},
+		{types.OrderStatusCancelled, types.OrderStatusPending, false},
+		{types.OrderStatusRefunded, types.OrderStatusPaid, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.from)+"->"+string(tt.to), func(t *testing.T) {
+			assert.Equal(t, tt.expected, CanTransition(tt.from, tt.to))
+		})
+	}
+}
+
+func TestServiceTransition(t *testing.T) {
+	t.Run("Records the transition", func(t *testing.T) {
+		var history []types.StatusHistory
+		store := &mockOrderStore{
+			GetOrderForUpdateFunc: func(id int) (*types.Order, error) {
+				return &types.Order{ID: id, Status: types.OrderStatusPaid}, nil
+			},
+			CreateStatusHistoryFunc: func(h types.StatusHistory) error {
+				history = append(history, h)
+				return nil
+			},
+		}
+		transactor := newMockTransactor(store)
+
+		order, err := NewService(transactor).Transition(7, types.OrderStatusFulfilled, 1)
+		assert.NoError(t, err)
+		assert.Equal(t, types.OrderStatusFulfilled, order.Status)
+		assert.Equal(t, []types.StatusHistory{{OrderID: 7, FromStatus: types.OrderStatusPaid, ToStatus: types.OrderStatusFulfilled, ActorID: 1}}, history)
+		assert.Nil(t, transactor.tx.products.restored)
+		assert.True(t, transactor.committed)
+	})
+
+	t.Run("Admin cancel and refund restore stock", func(t *testing.T) {
+		for _, status := range []types.OrderStatus{types.OrderStatusCancelled, types.OrderStatusRefunded} {
+			store := &mockOrderStore{
+				GetOrderForUpdateFunc: func(id int) (*types.Order, error) {
+					return &types.Order{ID: id, UserID: 2, Status: types.OrderStatusPaid}, nil
+				},
+				GetOrderItemsFunc: func(orderID int) ([]types.OrderItem, error) {
+					return []types.OrderItem{{OrderID: orderID, ProductID: 1, Quantity: 2}, {OrderID: orderID, ProductID: 3, Quantity: 1}}, nil
+				},
+			}
+			transactor := newMockTransactor(store)
+
+			order, err := NewService(transactor).Transition(7, status, 1)
+			assert.NoError(t, err)
+			assert.Equal(t, status, order.Status)
+			assert.Equal(t, []types.Product{{ID: 1, Quantity: 2}, {ID: 3, Quantity: 1}}, transactor.tx.products.restored, status)
+			assert.True(t, transactor.committed)
+		}
+	})
+
+	t.Run("Rolls back when the history cannot be written", func(t *testing.T) {
+		historyErr := errors.New("history error")
+		store := &mockOrderStore{
+			GetOrderForUpdateFunc: func(id int) (*types.Order, error) {
+				return &types.Order{ID: id, Status: types.OrderStatusPending}, nil
+			},
+			CreateStatusHistoryFunc: func(h types.StatusHistory) error {
+				return historyErr
+			},
+		}
+		transactor := newMockTransactor(store)
+
+		order, err := NewService(transactor).Transition(7, types.OrderStatusPaid, 1)
+		assert.Equal(t, historyErr, err)
+		assert.Nil(t, order)
+		assert.True(t, transactor.rolledBack)
+	})
+
+	t.Run("Rejects illegal moves", func(t *testing.T) {
+		store := &mockOrderStore{
+			GetOrderForUpdateFunc: func(id int) (*types.Order, error) {
+				return &types.Order{ID: id, Status: types.OrderStatusCancelled}, nil
+			},
+		}
+
+		_, err := NewService(newMockTransactor(store)).Transition(7, types.OrderStatusPaid, 1)
+		var transitionErr *TransitionError
+		assert.ErrorAs(t, err, &transitionErr)
+		assert.Equal(t, &TransitionError{From: types.OrderStatusCancelled, To: types.OrderStatusPaid}, transitionErr)
+	})
+}
+
+func TestServiceCancel(t *testing.T) {
+	items := []types.OrderItem{
+		{OrderID: 7, ProductID: 1, Quantity: 2},
+		{OrderID: 7, ProductID: 3, Quantity: 1},
+	}
+
+	tests := []struct {
+		name            string
+		order           *types.Order
+		userID          int
+		expectedErr     error
+		expectedRestore []types.Product
+	}{
+		{
+			name:            "Cancels a pending order and restores stock",
+			order:           &types.Order{ID: 7, UserID: 1, Status: types.OrderStatusPending},
+			userID:          1,
+			expectedErr:     nil,
+			expectedRestore: []types.Product{{ID: 1, Quantity: 2}, {ID: 3, Quantity: 1}},
+		},
+		{
+			name:            "Order owned by another user",
+			order:           &types.Order{ID: 7, UserID: 2, Status: types.OrderStatusPending},
+			userID:          1,
+			expectedErr:     sql.ErrNoRows,
+			expectedRestore: nil,
+		},
+		{
+			name:            "Order already paid",
+			order:           &types.Order{ID: 7, UserID: 1, Status: types.OrderStatusPaid},
+			userID:          1,
+			expectedErr:     &TransitionError{From: types.OrderStatusPaid, To: types.OrderStatusCancelled},
+			expectedRestore: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &mockOrderStore{
+				GetOrderForUpdateFunc: func(id int) (*types.Order, error) {
+					order := *tt.order
+					return &order, nil
+				},
+				GetOrderItemsFunc: func(orderID int) ([]types.OrderItem, error) {
+					return items, nil
+				},
+			}
+			transactor := newMockTransactor(store)
+
+			order, err := NewService(transactor).Cancel(7, tt.userID)
+			assert.Equal(t, tt.expectedErr, err)
+			assert.Equal(t, tt.expectedRestore, transactor.tx.products.restored)
+			if tt.expectedErr == nil {
+				assert.Equal(t, types.OrderStatusCancelled, order.Status)
+				assert.True(t, transactor.committed)
+			} else {
+				assert.True(t, transactor.rolledBack)
+			}
+		})
+	}
+}
@@ -4,11 +4,13 @@ import (
 	"database/sql"
 
 	"github.com/loloDawit/ecom/config"
+	"github.com/loloDawit/ecom/db"
 	"github.com/loloDawit/ecom/types"
 )
 
 type OrderStore struct {
 	db  *sql.DB
+	tx  *sql.Tx
 	cfg *config.Config
 }
 
@@ -16,9 +18,22 @@ func NewOrderStore(db *sql.DB, cfg *config.Config) *OrderStore {
 	return &OrderStore{db: db, cfg: cfg}
 }
 
+// WithTx returns a copy of the store whose queries run inside tx.
+func (s *OrderStore) WithTx(tx *sql.Tx) *OrderStore {
+	return &OrderStore{db: s.db, tx: tx, cfg: s.cfg}
+}
+
+// conn returns the transaction the store is bound to, or the pool otherwise.
+func (s *OrderStore) conn() db.DBTX {
+	if s.tx != nil {
+		return s.tx
+	}
+	return s.db
+}
+
 func (s *OrderStore) CreateOrder(order types.Order) (int, error) {
 	var id int
-	err := s.db.QueryRow(
+	err := s.conn().QueryRow(
 		"INSERT INTO orders (userID, total, status, address) VALUES ($1, $2, $3, $4) RETURNING id",
 		order.UserID, order.Total, order.Status, order.Address,
 	).Scan(&id)
@@ -31,10 +46,146 @@ func (s *OrderStore) CreateOrder(order types.Order) (int, error) {
 }
 
 func (s *OrderStore) CreateOrderItem(orderItem types.OrderItem) error {
-	_, err := s.db.Exec("INSERT INTO order_items (orderID, productID, quantity, price) VALUES ($1, $2, $3, $4)", orderItem.OrderID, orderItem.ProductID, orderItem.Quantity, orderItem.Price)
+	_, err := s.conn().Exec(
+		"INSERT INTO order_items (orderID, productID, quantity, price, subtotal, productName, productImage) VALUES ($1, $2, $3, $4, $5, $6, $7)",
+		orderItem.OrderID, orderItem.ProductID, orderItem.Quantity, orderItem.Price, orderItem.Subtotal, orderItem.ProductName, orderItem.ProductImage,
+	)
 	if err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// GetOrdersByUserID returns a page of the user's orders, newest first. The
+// orders are returned without their items.
+func (s *OrderStore) GetOrdersByUserID(userID int, limit int, offset int) ([]types.Order, error) {
+	rows, err := s.conn().Query(
+		"SELECT id, userId, total, status, address, createdAt FROM orders WHERE userId = $1 ORDER BY createdAt DESC, id DESC LIMIT $2 OFFSET $3",
+		userID, limit, offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orders := []types.Order{}
+	for rows.Next() {
+		o := types.Order{}
+		if err := rows.Scan(&o.ID, &o.UserID, &o.Total, &o.Status, &o.Address, &o.CreatedAt); err != nil {
+			return nil, err
+		}
+		orders = append(orders, o)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return orders, nil
+}
+
+// GetOrderByID returns the order together with its items and the name and
+// image of each purchased product.
+func (s *OrderStore) GetOrderByID(id int) (*types.Order, error) {
+	o := new(types.Order)
+	err := s.conn().QueryRow(
+		"SELECT id, userId, total, status, address, createdAt FROM orders WHERE id = $1",
+		id,
+	).Scan(&o.ID, &o.UserID, &o.Total, &o.Status, &o.Address, &o.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	o.Items, err = s.GetOrderItems(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return o, nil
+}
+
+// GetOrderItems returns the items of an order with the product snapshot taken
+// at checkout. Rows written before snapshots existed fall back to the current
+// product data until BackfillOrderItemSnapshots has run.
+func (s *OrderStore) GetOrderItems(orderID int) ([]types.OrderItem, error) {
+	rows, err := s.conn().Query(
+		`SELECT oi.id, oi.orderId, oi.productId, oi.quantity, oi.price, COALESCE(oi.subtotal, oi.price * oi.quantity),
+			COALESCE(oi.productName, p.name), COALESCE(oi.productImage, p.image), oi.createdAt
+		FROM order_items oi JOIN products p ON p.id = oi.productId WHERE oi.orderId = $1 ORDER BY oi.id`,
+		orderID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []types.OrderItem{}
+	for rows.Next() {
+		item := types.OrderItem{}
+		if err := rows.Scan(&item.ID, &item.OrderID, &item.ProductID, &item.Quantity, &item.Price, &item.Subtotal, &item.ProductName, &item.ProductImage, &item.CreatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// BackfillOrderItemSnapshots fills in the unit price, subtotal and product
+// snapshot of order items written before those columns existed. Such rows
+// stored the whole order total as their price, so single-item orders get the
+// exact unit price back from the order total while the rest fall back to the
+// product's current price. It returns the number of rows updated.
+func (s *OrderStore) BackfillOrderItemSnapshots() (int64, error) {
+	result, err := s.conn().Exec(`WITH backfill AS (
+			SELECT oi.id,
+				CASE WHEN COUNT(*) OVER (PARTITION BY oi.orderId) = 1 THEN ROUND(o.total / oi.quantity, 2) ELSE p.price END AS unitPrice,
+				p.name, p.image
+			FROM order_items oi
+			JOIN orders o ON o.id = oi.orderId
+			JOIN products p ON p.id = oi.productId
+			WHERE oi.subtotal IS NULL
+		)
+		UPDATE order_items oi
+		SET price = b.unitPrice, subtotal = b.unitPrice * oi.quantity, productName = b.name, productImage = b.image
+		FROM backfill b
+		WHERE oi.id = b.id`)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// GetOrderForUpdate loads the order row without its items and locks it for
+// the rest of the surrounding transaction.
+func (s *OrderStore) GetOrderForUpdate(id int) (*types.Order, error) {
+	o := new(types.Order)
+	err := s.conn().QueryRow(
+		"SELECT id, userId, total, status, address, createdAt FROM orders WHERE id = $1 FOR UPDATE",
+		id,
+	).Scan(&o.ID, &o.UserID, &o.Total, &o.Status, &o.Address, &o.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return o, nil
+}
+
+func (s *OrderStore) UpdateOrderStatus(id int, status types.OrderStatus) error {
+	_, err := s.conn().Exec("UPDATE orders SET status = $1 WHERE id = $2", status, id)
+	return err
+}
+
+func (s *OrderStore) CreateStatusHistory(h types.StatusHistory) error {
+	_, err := s.conn().Exec(
+		"INSERT INTO status_history (orderId, fromStatus, toStatus, actorId) VALUES ($1, $2, $3, $4)",
+		h.OrderID, h.FromStatus, h.ToStatus, h.ActorID,
+	)
+	return err
+}
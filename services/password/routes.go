@@ -0,0 +1,149 @@
+package password
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/loloDawit/ecom/config"
+	"github.com/loloDawit/ecom/services/auth"
+	"github.com/loloDawit/ecom/types"
+	"github.com/loloDawit/ecom/utils"
+	"gopkg.in/go-playground/validator.v9"
+)
+
+// ResetTokenTTL is how long a mailed password reset token can be used.
+const ResetTokenTTL = time.Hour
+
+type Handler struct {
+	store    types.PasswordResetStore
+	users    types.UserStore
+	sessions types.SessionRevoker
+	notifier types.Notifier
+	cfg      *config.Config
+	// async runs the work behind /password/forgot after the response is
+	// sent, so its timing cannot tell whether the email has an account
+	async func(func())
+	now   func() time.Time
+}
+
+func NewHandlers(store types.PasswordResetStore, users types.UserStore, sessions types.SessionRevoker, notifier types.Notifier, cfg *config.Config) *Handler {
+	return &Handler{
+		store:    store,
+		users:    users,
+		sessions: sessions,
+		notifier: notifier,
+		cfg:      cfg,
+		async:    func(fn func()) { go fn() },
+		now:      time.Now,
+	}
+}
+
+func (h *Handler) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/password/forgot", h.forgotPassword).Methods("POST")
+	r.HandleFunc("/password/reset", h.resetPassword).Methods("POST")
+}
+
+func (h *Handler) forgotPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Body == nil {
+		utils.WriteError(w, http.StatusBadRequest, utils.ErrInvalidRequestBody)
+		return
+	}
+
+	var payload types.ForgotPasswordPayload
+	if err := utils.ReadJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, utils.ErrInvalidPayload)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Sprintf("%s: %v", utils.ErrInvalidPayload, validationErrors))
+		return
+	}
+
+	h.async(func() { h.sendResetToken(payload.Email) })
+
+	// the same answer whether or not the email has an account
+	utils.WriteJSON(w, http.StatusAccepted, map[string]string{"message": utils.PasswordResetRequested})
+}
+
+func (h *Handler) sendResetToken(email string) {
+	user, err := h.users.GetUserByEmail(email)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("error looking up user for password reset: %v", err)
+		}
+		return
+	}
+
+	token, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		log.Printf("error generating password reset token: %v", err)
+		return
+	}
+
+	err = h.store.CreatePasswordResetToken(types.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: auth.HashOpaqueToken(token),
+		ExpiresAt: h.now().Add(ResetTokenTTL),
+	})
+	if err != nil {
+		log.Printf("error creating password reset token for user %d: %v", user.ID, err)
+		return
+	}
+
+	if err := h.notifier.SendPasswordReset(user, token, ResetTokenTTL); err != nil {
+		log.Printf("error sending password reset email to user %d: %v", user.ID, err)
+	}
+}
+
+func (h *Handler) resetPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Body == nil {
+		utils.WriteError(w, http.StatusBadRequest, utils.ErrInvalidRequestBody)
+		return
+	}
+
+	var payload types.ResetPasswordPayload
+	if err := utils.ReadJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, utils.ErrInvalidPayload)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Sprintf("%s: %v", utils.ErrInvalidPayload, validationErrors))
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(payload.Password)
+	if err != nil {
+		log.Printf("%s: %v", utils.ErrHashingPassword, err)
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrInternalServerError)
+		return
+	}
+
+	userID, err := h.store.ResetPassword(auth.HashOpaqueToken(payload.Token), hashedPassword, h.now())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			utils.WriteError(w, http.StatusBadRequest, utils.ErrInvalidResetToken)
+			return
+		}
+		log.Printf("error resetting password: %v", err)
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrInternalServerError)
+		return
+	}
+
+	// whoever knew the old password must not stay signed in
+	if err := h.sessions.RevokeSessions(userID); err != nil {
+		log.Printf("error revoking sessions of user %d after password reset: %v", userID, err)
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrInternalServerError)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"message": utils.PasswordResetSuccessfully})
+}
@@ -0,0 +1,245 @@
+package password
+
+import (
+	"bytes"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/loloDawit/ecom/config"
+	"github.com/loloDawit/ecom/services/auth"
+	"github.com/loloDawit/ecom/services/notify"
+	"github.com/loloDawit/ecom/types"
+	"github.com/loloDawit/ecom/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryStore is an in-memory PasswordResetStore that also keeps the
+// passwords it sets.
+type memoryStore struct {
+	tokens    []*types.PasswordResetToken
+	passwords map[int]string
+}
+
+func (m *memoryStore) CreatePasswordResetToken(token types.PasswordResetToken) error {
+	now := time.Now()
+	for _, existing := range m.tokens {
+		if existing.UserID == token.UserID && existing.UsedAt == nil {
+			existing.UsedAt = &now
+		}
+	}
+	m.tokens = append(m.tokens, &token)
+	return nil
+}
+
+func (m *memoryStore) ResetPassword(tokenHash string, passwordHash string, now time.Time) (int, error) {
+	for _, token := range m.tokens {
+		if token.TokenHash == tokenHash && token.UsedAt == nil && token.ExpiresAt.After(now) {
+			token.UsedAt = &now
+			m.passwords[token.UserID] = passwordHash
+			return token.UserID, nil
+		}
+	}
+	return 0, sql.ErrNoRows
+}
+
+type mockUserStore struct{}
+
+func (m *mockUserStore) GetUserByEmail(email string) (*types.User, error) {
+	if email == "jane@example.com" {
+		return &types.User{ID: 7, FirstName: "Jane", Email: email}, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *mockUserStore) CreateUser(user types.User) error {
+	return nil
+}
+
+func (m *mockUserStore) GetUserByID(id int) (*types.User, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (m *mockUserStore) UpdateUser(user types.User) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdatePassword(userID int, passwordHash string) error {
+	return nil
+}
+
+func (m *mockUserStore) DeleteUser(userID int, now time.Time) error {
+	return nil
+}
+
+func (m *mockUserStore) GetUsers(query types.UserQuery) ([]types.User, error) {
+	return nil, nil
+}
+
+func (m *mockUserStore) SetUserDisabled(userID int, disabledAt *time.Time) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdateUserRole(userID int, role types.Role) error {
+	return nil
+}
+
+type recordingSessions struct {
+	revoked []int
+}
+
+func (m *recordingSessions) RevokeSessions(userID int) error {
+	m.revoked = append(m.revoked, userID)
+	return nil
+}
+
+type testHandler struct {
+	router   *mux.Router
+	handler  *Handler
+	store    *memoryStore
+	mailer   *notify.MemoryMailer
+	sessions *recordingSessions
+}
+
+func newTestHandler(cfg *config.Config) *testHandler {
+	th := &testHandler{
+		store:    &memoryStore{passwords: map[int]string{}},
+		mailer:   notify.NewMemoryMailer(),
+		sessions: &recordingSessions{},
+	}
+	th.handler = NewHandlers(th.store, &mockUserStore{}, th.sessions, notify.NewNotifier(th.mailer, cfg), cfg)
+	th.handler.async = func(fn func()) { fn() }
+	th.router = mux.NewRouter()
+	th.handler.RegisterRoutes(th.router)
+	return th
+}
+
+func (th *testHandler) post(t *testing.T, path string, body string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	th.router.ServeHTTP(rr, req)
+	return rr
+}
+
+// mailedToken pulls the token out of the last email sent.
+func (th *testHandler) mailedToken(t *testing.T) string {
+	email, ok := th.mailer.Last()
+	if !ok {
+		t.Fatal("no email was sent")
+	}
+	body := email.Body
+	for _, line := range strings.Split(body, "\n") {
+		if i := strings.Index(line, "token="); i >= 0 {
+			return line[i+len("token="):]
+		}
+	}
+	t.Fatalf("no token in email: %s", body)
+	return ""
+}
+
+func TestForgotPassword(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expectedEmails int
+	}{
+		{
+			name:           "Known email",
+			body:           `{"email": "jane@example.com"}`,
+			expectedStatus: http.StatusAccepted,
+			expectedEmails: 1,
+		},
+		{
+			name:           "Unknown email",
+			body:           `{"email": "nobody@example.com"}`,
+			expectedStatus: http.StatusAccepted,
+		},
+		{
+			name:           "Invalid email",
+			body:           `{"email": "jane"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Invalid JSON",
+			body:           `{"email":`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			th := newTestHandler(&config.Config{AppURL: "https://shop.example.com"})
+
+			rr := th.post(t, "/password/forgot", tc.body)
+			assert.Equal(t, tc.expectedStatus, rr.Code)
+			assert.Len(t, th.mailer.Sent(), tc.expectedEmails)
+
+			if tc.expectedStatus == http.StatusAccepted {
+				assert.JSONEq(t, `{"message":"`+utils.PasswordResetRequested+`"}`, rr.Body.String())
+			}
+			if tc.expectedEmails > 0 {
+				email := th.mailer.Sent()[0]
+				assert.Equal(t, "jane@example.com", email.To)
+				assert.Contains(t, email.Body, "https://shop.example.com/password/reset?token=")
+
+				// only the hash of the mailed token is stored
+				assert.Equal(t, auth.HashOpaqueToken(th.mailedToken(t)), th.store.tokens[0].TokenHash)
+			}
+		})
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	t.Run("Resets the password once", func(t *testing.T) {
+		th := newTestHandler(&config.Config{AppURL: "https://shop.example.com"})
+		th.post(t, "/password/forgot", `{"email": "jane@example.com"}`)
+		token := th.mailedToken(t)
+
+		rr := th.post(t, "/password/reset", `{"token": "`+token+`", "password": "new-password"}`)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.NoError(t, auth.ComparePasswords(th.store.passwords[7], "new-password"))
+		assert.Equal(t, []int{7}, th.sessions.revoked)
+
+		rr = th.post(t, "/password/reset", `{"token": "`+token+`", "password": "other-password"}`)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.JSONEq(t, `{"error":"`+utils.ErrInvalidResetToken+`"}`, rr.Body.String())
+	})
+
+	t.Run("A newer token replaces the older one", func(t *testing.T) {
+		th := newTestHandler(&config.Config{AppURL: "https://shop.example.com"})
+		th.post(t, "/password/forgot", `{"email": "jane@example.com"}`)
+		first := th.mailedToken(t)
+		th.post(t, "/password/forgot", `{"email": "jane@example.com"}`)
+
+		rr := th.post(t, "/password/reset", `{"token": "`+first+`", "password": "new-password"}`)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		rr = th.post(t, "/password/reset", `{"token": "`+th.mailedToken(t)+`", "password": "new-password"}`)
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("Expired token", func(t *testing.T) {
+		th := newTestHandler(&config.Config{AppURL: "https://shop.example.com"})
+		th.post(t, "/password/forgot", `{"email": "jane@example.com"}`)
+		th.handler.now = func() time.Time { return time.Now().Add(ResetTokenTTL) }
+
+		rr := th.post(t, "/password/reset", `{"token": "`+th.mailedToken(t)+`", "password": "new-password"}`)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Empty(t, th.sessions.revoked)
+	})
+
+	t.Run("Password too short", func(t *testing.T) {
+		th := newTestHandler(&config.Config{})
+
+		rr := th.post(t, "/password/reset", `{"token": "token", "password": "abc"}`)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
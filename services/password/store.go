@@ -0,0 +1,57 @@
+package password
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/loloDawit/ecom/config"
+	"github.com/loloDawit/ecom/db"
+	"github.com/loloDawit/ecom/types"
+)
+
+type PasswordResetStore struct {
+	db  *sql.DB
+	cfg *config.Config
+}
+
+func NewPasswordResetStore(db *sql.DB, cfg *config.Config) *PasswordResetStore {
+	return &PasswordResetStore{db: db, cfg: cfg}
+}
+
+func (s *PasswordResetStore) CreatePasswordResetToken(token types.PasswordResetToken) error {
+	return db.WithTransaction(s.db, func(tx *sql.Tx) error {
+		// only the latest token mailed to a user can be used
+		if _, err := tx.Exec("UPDATE password_reset_tokens SET usedAt = CURRENT_TIMESTAMP WHERE userId = $1 AND usedAt IS NULL", token.UserID); err != nil {
+			return err
+		}
+
+		_, err := tx.Exec(
+			"INSERT INTO password_reset_tokens (userId, tokenHash, expiresAt) VALUES ($1, $2, $3)",
+			token.UserID, token.TokenHash, token.ExpiresAt,
+		)
+		return err
+	})
+}
+
+// ResetPassword marks the token used with a conditional update, so a token
+// presented twice at the same time still only resets the password once.
+func (s *PasswordResetStore) ResetPassword(tokenHash string, passwordHash string, now time.Time) (int, error) {
+	var userID int
+	err := db.WithTransaction(s.db, func(tx *sql.Tx) error {
+		err := tx.QueryRow(
+			"UPDATE password_reset_tokens SET usedAt = CURRENT_TIMESTAMP WHERE tokenHash = $1 AND usedAt IS NULL AND expiresAt > $2 RETURNING userId",
+			tokenHash, now,
+		).Scan(&userID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec("UPDATE users SET password = $1 WHERE id = $2", passwordHash, userID)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
@@ -0,0 +1,91 @@
+package password
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/loloDawit/ecom/config"
+	"github.com/loloDawit/ecom/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreatePasswordResetToken(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	store := NewPasswordResetStore(db, &config.Config{})
+	expiresAt := time.Now().Add(ResetTokenTTL)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE password_reset_tokens SET usedAt = CURRENT_TIMESTAMP WHERE userId = \\$1 AND usedAt IS NULL").
+		WithArgs(7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO password_reset_tokens \\(userId, tokenHash, expiresAt\\) VALUES \\(\\$1, \\$2, \\$3\\)").
+		WithArgs(7, "hash", expiresAt).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	err = store.CreatePasswordResetToken(types.PasswordResetToken{UserID: 7, TokenHash: "hash", ExpiresAt: expiresAt})
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestResetPasswordStore(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	store := NewPasswordResetStore(db, &config.Config{})
+	now := time.Now()
+
+	tests := []struct {
+		name           string
+		mockQuery      func()
+		expectedUserID int
+		expectedErr    error
+	}{
+		{
+			name: "Valid token",
+			mockQuery: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery("UPDATE password_reset_tokens SET usedAt = CURRENT_TIMESTAMP WHERE tokenHash = \\$1 AND usedAt IS NULL AND expiresAt > \\$2 RETURNING userId").
+					WithArgs("hash", now).
+					WillReturnRows(sqlmock.NewRows([]string{"userId"}).AddRow(7))
+				mock.ExpectExec("UPDATE users SET password = \\$1 WHERE id = \\$2").
+					WithArgs("password-hash", 7).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			expectedUserID: 7,
+		},
+		{
+			name: "Used, expired or unknown token",
+			mockQuery: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery("UPDATE password_reset_tokens (.+) RETURNING userId").
+					WithArgs("hash", now).
+					WillReturnError(sql.ErrNoRows)
+				mock.ExpectRollback()
+			},
+			expectedErr: sql.ErrNoRows,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockQuery()
+
+			userID, err := store.ResetPassword("hash", "password-hash", now)
+			assert.Equal(t, tt.expectedErr, err)
+			assert.Equal(t, tt.expectedUserID, userID)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
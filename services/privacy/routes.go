@@ -0,0 +1,95 @@
+package privacy
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/loloDawit/ecom/config"
+	"github.com/loloDawit/ecom/services/auth"
+	"github.com/loloDawit/ecom/utils"
+)
+
+type Handler struct {
+	service *Service
+	auth    auth.Authenticator
+	cfg     *config.Config
+}
+
+func NewHandlers(service *Service, authenticator auth.Authenticator, cfg *config.Config) *Handler {
+	return &Handler{service: service, auth: authenticator, cfg: cfg}
+}
+
+func (h *Handler) RegisterRoutes(r *mux.Router) {
+	jwtMiddleware := auth.Middleware(h.auth)
+
+	r.HandleFunc("/users/me/export", jwtMiddleware(h.export)).Methods("GET")
+}
+
+// export hands the caller everything kept about them, as a single JSON
+// document or, with format=zip, as an archive of one file per section.
+func (h *Handler) export(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "zip" {
+		utils.WriteError(w, http.StatusBadRequest, utils.ErrInvalidExportFormat)
+		return
+	}
+
+	userID, err := auth.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	export, err := h.service.Export(userID)
+	if err != nil {
+		log.Printf("error exporting data of user %d: %v", userID, err)
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrInternalServerError)
+		return
+	}
+
+	filename := fmt.Sprintf("user-%d-export-%s", userID, export.ExportedAt.Format("20060102"))
+	if format == "json" {
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".json"))
+		utils.WriteJSON(w, http.StatusOK, export)
+		return
+	}
+
+	files := []struct {
+		name    string
+		content any
+	}{
+		{"profile.json", export.Profile},
+		{"addresses.json", export.Addresses},
+		{"orders.json", export.Orders},
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".zip"))
+	w.WriteHeader(http.StatusOK)
+
+	// the status is already sent, so a failure can only cut the archive short
+	archive := zip.NewWriter(w)
+	for _, file := range files {
+		f, err := archive.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate, Modified: export.ExportedAt})
+		if err != nil {
+			log.Printf("error writing export of user %d: %v", userID, err)
+			return
+		}
+		encoder := json.NewEncoder(f)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.content); err != nil {
+			log.Printf("error writing export of user %d: %v", userID, err)
+			return
+		}
+	}
+	if err := archive.Close(); err != nil {
+		log.Printf("error writing export of user %d: %v", userID, err)
+	}
+}
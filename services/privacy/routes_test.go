@@ -0,0 +1,218 @@
+package privacy
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/loloDawit/ecom/config"
+	"github.com/loloDawit/ecom/services/auth/authtest"
+	"github.com/loloDawit/ecom/types"
+	"github.com/loloDawit/ecom/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockUserStore struct{}
+
+func (m *mockUserStore) GetUserByEmail(email string) (*types.User, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (m *mockUserStore) CreateUser(user types.User) error {
+	return nil
+}
+
+func (m *mockUserStore) GetUserByID(id int) (*types.User, error) {
+	return &types.User{ID: id, FirstName: "Jane", LastName: "Doe", Email: "jane@example.com", Password: "hashed-password", Role: types.RoleCustomer}, nil
+}
+
+func (m *mockUserStore) UpdateUser(user types.User) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdatePassword(userID int, passwordHash string) error {
+	return nil
+}
+
+func (m *mockUserStore) DeleteUser(userID int, now time.Time) error {
+	return nil
+}
+
+func (m *mockUserStore) GetUsers(query types.UserQuery) ([]types.User, error) {
+	return nil, nil
+}
+
+func (m *mockUserStore) SetUserDisabled(userID int, disabledAt *time.Time) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdateUserRole(userID int, role types.Role) error {
+	return nil
+}
+
+type mockAddressStore struct {
+	addresses []types.Address
+}
+
+func (m *mockAddressStore) GetAddressesByUserID(userID int) ([]types.Address, error) {
+	return m.addresses, nil
+}
+
+func (m *mockAddressStore) GetAddressByID(userID int, id int) (*types.Address, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (m *mockAddressStore) GetDefaultAddress(userID int) (*types.Address, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (m *mockAddressStore) CreateAddress(address types.Address) (int, error) {
+	return 0, nil
+}
+
+func (m *mockAddressStore) UpdateAddress(address types.Address) error {
+	return nil
+}
+
+func (m *mockAddressStore) DeleteAddress(userID int, id int) error {
+	return nil
+}
+
+func (m *mockAddressStore) SetDefaultAddress(userID int, id int) error {
+	return nil
+}
+
+// mockOrderStore pages through orders and gives every order one item.
+type mockOrderStore struct {
+	orders []types.Order
+}
+
+func (m *mockOrderStore) CreateOrder(order types.Order) (int, error) {
+	return 0, nil
+}
+
+func (m *mockOrderStore) CreateOrderItem(item types.OrderItem) error {
+	return nil
+}
+
+func (m *mockOrderStore) GetOrdersByUserID(userID int, limit int, offset int) ([]types.Order, error) {
+	if offset >= len(m.orders) {
+		return []types.Order{}, nil
+	}
+	return m.orders[offset:min(offset+limit, len(m.orders))], nil
+}
+
+func (m *mockOrderStore) GetOrderByID(id int) (*types.Order, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (m *mockOrderStore) GetOrderItems(orderID int) ([]types.OrderItem, error) {
+	return []types.OrderItem{{ID: orderID, OrderID: orderID, ProductID: 3, Quantity: 1, Price: 9.99}}, nil
+}
+
+func (m *mockOrderStore) GetOrderForUpdate(id int) (*types.Order, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (m *mockOrderStore) UpdateOrderStatus(id int, status types.OrderStatus) error {
+	return nil
+}
+
+func (m *mockOrderStore) CreateStatusHistory(history types.StatusHistory) error {
+	return nil
+}
+
+func newTestRouter(orders []types.Order) *mux.Router {
+	addresses := &mockAddressStore{addresses: []types.Address{{ID: 1, UserID: 7, Line1: "1 Main St", City: "Springfield", PostalCode: "12345", Country: "US"}}}
+	service := NewService(&mockUserStore{}, addresses, &mockOrderStore{orders: orders})
+	service.now = func() time.Time { return time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC) }
+
+	router := mux.NewRouter()
+	NewHandlers(service, authtest.As(7, types.RoleCustomer), &config.Config{}).RegisterRoutes(router)
+	return router
+}
+
+func get(router *mux.Router, path string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestExportJSON(t *testing.T) {
+	// more orders than fit in one page
+	orders := make([]types.Order, ordersPageSize+1)
+	for i := range orders {
+		orders[i] = types.Order{ID: i + 1, UserID: 7, Total: 9.99, Status: types.OrderStatusPaid, Address: "1 Main St"}
+	}
+	router := newTestRouter(orders)
+
+	rr := get(router, "/users/me/export")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, `attachment; filename="user-7-export-20261017.json"`, rr.Header().Get("Content-Disposition"))
+	assert.NotContains(t, rr.Body.String(), "hashed-password")
+
+	var export types.UserExport
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &export))
+	assert.Equal(t, "jane@example.com", export.Profile.Email)
+	assert.Len(t, export.Addresses, 1)
+	assert.Len(t, export.Orders, ordersPageSize+1)
+	assert.Len(t, export.Orders[ordersPageSize].Items, 1)
+}
+
+func TestExportZIP(t *testing.T) {
+	router := newTestRouter([]types.Order{{ID: 1, UserID: 7, Total: 9.99, Status: types.OrderStatusPaid}})
+
+	rr := get(router, "/users/me/export?format=zip")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/zip", rr.Header().Get("Content-Type"))
+
+	archive, err := zip.NewReader(bytes.NewReader(rr.Body.Bytes()), int64(rr.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contents := map[string]string{}
+	for _, file := range archive.File {
+		f, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents[file.Name] = string(content)
+	}
+
+	assert.Len(t, contents, 3)
+	assert.Contains(t, contents["profile.json"], `"email": "jane@example.com"`)
+	assert.NotContains(t, contents["profile.json"], "hashed-password")
+	assert.Contains(t, contents["addresses.json"], `"line1": "1 Main St"`)
+	assert.Contains(t, contents["orders.json"], `"productId": 3`)
+}
+
+func TestExportInvalidFormat(t *testing.T) {
+	router := newTestRouter(nil)
+
+	rr := get(router, "/users/me/export?format=xml")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.JSONEq(t, fmt.Sprintf(`{"error":%q}`, utils.ErrInvalidExportFormat), rr.Body.String())
+}
+
+func TestExportRequiresAuthentication(t *testing.T) {
+	router := mux.NewRouter()
+	NewHandlers(NewService(&mockUserStore{}, &mockAddressStore{}, &mockOrderStore{}), authtest.Anonymous(), &config.Config{}).RegisterRoutes(router)
+
+	rr := get(router, "/users/me/export")
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
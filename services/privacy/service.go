@@ -0,0 +1,66 @@
+package privacy
+
+import (
+	"time"
+
+	"github.com/loloDawit/ecom/services/user"
+	"github.com/loloDawit/ecom/types"
+)
+
+// ordersPageSize is how many orders are read at a time while exporting.
+const ordersPageSize = 100
+
+// Service exports everything kept about a user. Erasure is run by an
+// admin through ErasureStore from the migrate CLI.
+type Service struct {
+	users     types.UserStore
+	addresses types.AddressStore
+	orders    types.OrderStore
+	now       func() time.Time
+}
+
+func NewService(users types.UserStore, addresses types.AddressStore, orders types.OrderStore) *Service {
+	return &Service{users: users, addresses: addresses, orders: orders, now: time.Now}
+}
+
+// Export collects the profile, addresses and orders, with their items, of
+// the user.
+func (s *Service) Export(userID int) (*types.UserExport, error) {
+	u, err := s.users.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	addresses, err := s.addresses.GetAddressesByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if addresses == nil {
+		addresses = []types.Address{}
+	}
+
+	orders := []types.Order{}
+	for offset := 0; ; offset += ordersPageSize {
+		page, err := s.orders.GetOrdersByUserID(userID, ordersPageSize, offset)
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range page {
+			o.Items, err = s.orders.GetOrderItems(o.ID)
+			if err != nil {
+				return nil, err
+			}
+			orders = append(orders, o)
+		}
+		if len(page) < ordersPageSize {
+			break
+		}
+	}
+
+	return &types.UserExport{
+		ExportedAt: s.now().UTC(),
+		Profile:    user.ToResponse(u),
+		Addresses:  addresses,
+		Orders:     orders,
+	}, nil
+}
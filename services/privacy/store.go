@@ -0,0 +1,89 @@
+package privacy
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/loloDawit/ecom/config"
+	"github.com/loloDawit/ecom/db"
+	"github.com/loloDawit/ecom/services/lockout"
+)
+
+type ErasureStore struct {
+	db  *sql.DB
+	cfg *config.Config
+}
+
+func NewErasureStore(db *sql.DB, cfg *config.Config) *ErasureStore {
+	return &ErasureStore{db: db, cfg: cfg}
+}
+
+// userTables hold rows that only exist for the user and go with their
+// personal data.
+var userTables = []string{
+	"addresses",
+	"carts",
+	"refresh_tokens",
+	"password_reset_tokens",
+	"email_verification_tokens",
+	"user_totp",
+	"mfa_recovery_codes",
+	"mfa_challenges",
+	"api_keys",
+	// stored checkout responses carry the shipping address
+	"idempotency_keys",
+}
+
+// EraseUser keeps the users row, which orders and status history refer to,
+// but blanks everything in it and in their orders' shipping addresses that
+// identifies a person. Erasing a user
+// twice does no harm, so a request can simply be run again.
+func (s *ErasureStore) EraseUser(userID int, now time.Time) error {
+	return db.WithTransaction(s.db, func(tx *sql.Tx) error {
+		var email string
+		if err := tx.QueryRow("SELECT email FROM users WHERE id = $1 FOR UPDATE", userID).Scan(&email); err != nil {
+			return err
+		}
+
+		// an empty hash matches no password, so the account cannot be used
+		_, err := tx.Exec(
+			`UPDATE users SET firstName = '', lastName = '', email = $1, password = '', emailVerifiedAt = NULL,
+			deletedAt = COALESCE(deletedAt, $2), erasedAt = $2 WHERE id = $3`,
+			erasedEmail(userID), now, userID,
+		)
+		if err != nil {
+			return err
+		}
+
+		// orders stay for the books, but not where they were shipped to
+		if _, err := tx.Exec("UPDATE orders SET address = '' WHERE userId = $1", userID); err != nil {
+			return err
+		}
+
+		for _, table := range userTables {
+			if _, err := tx.Exec("DELETE FROM "+table+" WHERE userId = $1", userID); err != nil {
+				return err
+			}
+		}
+
+		// failed logins are keyed by email
+		if _, err := tx.Exec("DELETE FROM login_throttles WHERE throttleKey = $1", lockout.AccountKey(email)); err != nil {
+			return err
+		}
+
+		// access tokens still out there stop working too
+		_, err = tx.Exec(
+			`INSERT INTO user_token_revocations (userId, revokedBefore) VALUES ($1, $2)
+			ON CONFLICT (userId) DO UPDATE SET revokedBefore = GREATEST(user_token_revocations.revokedBefore, EXCLUDED.revokedBefore)`,
+			userID, now,
+		)
+		return err
+	})
+}
+
+// erasedEmail is the placeholder email of an erased user. The .invalid
+// top-level domain is reserved, so it can never receive mail.
+func erasedEmail(userID int) string {
+	return fmt.Sprintf("erased-%d@erased.invalid", userID)
+}
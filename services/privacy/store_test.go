@@ -0,0 +1,98 @@
+package privacy
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/loloDawit/ecom/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEraseUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	store := NewErasureStore(db, &config.Config{})
+	now := time.Now()
+
+	t.Run("Anonymizes the user and their orders", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT email FROM users WHERE id = \\$1 FOR UPDATE").
+			WithArgs(7).
+			WillReturnRows(sqlmock.NewRows([]string{"email"}).AddRow("Jane@Example.com"))
+		mock.ExpectExec("UPDATE users SET firstName = '', lastName = '', email = \\$1, password = '', emailVerifiedAt = NULL, (.+) erasedAt = \\$2 WHERE id = \\$3").
+			WithArgs("erased-7@erased.invalid", now, 7).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		// shipping addresses are personal data too
+		mock.ExpectExec("UPDATE orders SET address = '' WHERE userId = \\$1").
+			WithArgs(7).
+			WillReturnResult(sqlmock.NewResult(0, 3))
+		for _, table := range userTables {
+			mock.ExpectExec("DELETE FROM " + table + " WHERE userId = \\$1").
+				WithArgs(7).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+		}
+		mock.ExpectExec("DELETE FROM login_throttles WHERE throttleKey = \\$1").
+			WithArgs("account:jane@example.com").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO user_token_revocations").
+			WithArgs(7, now).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		assert.NoError(t, store.EraseUser(7, now))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Deletes stored idempotent responses", func(t *testing.T) {
+		// checkout responses replayed from idempotency_keys hold the
+		// shipping address, so they go with the user
+		assert.Contains(t, userTables, "idempotency_keys")
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT email FROM users").
+			WithArgs(7).
+			WillReturnRows(sqlmock.NewRows([]string{"email"}).AddRow("jane@example.com"))
+		mock.ExpectExec("UPDATE users SET").
+			WithArgs("erased-7@erased.invalid", now, 7).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("UPDATE orders SET address = ''").
+			WithArgs(7).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		for _, table := range userTables {
+			result := sqlmock.NewResult(0, 0)
+			if table == "idempotency_keys" {
+				result = sqlmock.NewResult(0, 2)
+			}
+			mock.ExpectExec("DELETE FROM " + table + " WHERE userId = \\$1").
+				WithArgs(7).
+				WillReturnResult(result)
+		}
+		mock.ExpectExec("DELETE FROM login_throttles").
+			WithArgs("account:jane@example.com").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("INSERT INTO user_token_revocations").
+			WithArgs(7, now).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		assert.NoError(t, store.EraseUser(7, now))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Unknown user", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT email FROM users").
+			WithArgs(8).
+			WillReturnError(sql.ErrNoRows)
+		mock.ExpectRollback()
+
+		assert.Equal(t, sql.ErrNoRows, store.EraseUser(8, now))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -1,12 +1,21 @@
 package product
 
 import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 
 	"github.com/gorilla/mux"
+	"github.com/loloDawit/ecom/config"
+	"github.com/loloDawit/ecom/services/auth"
+	"github.com/loloDawit/ecom/services/idempotency"
 	"github.com/loloDawit/ecom/types"
 	"github.com/loloDawit/ecom/utils"
 	"gopkg.in/go-playground/validator.v9"
@@ -14,43 +23,224 @@ import (
 
 type Handler struct {
 	store types.ProductStore
+	auth  auth.Authenticator
+	cfg   *config.Config
+	// idempotency makes product creation safe to retry when set
+	idempotency types.IdempotencyStore
 }
 
-func NewHandlers(store types.ProductStore) *Handler {
-	return &Handler{store: store}
+func NewHandlers(store types.ProductStore, authenticator auth.Authenticator, cfg *config.Config) *Handler {
+	return &Handler{store: store, auth: authenticator, cfg: cfg}
+}
+
+// WithIdempotency returns a copy of the handler whose product creation
+// honours the Idempotency-Key header, so retries cannot create duplicates.
+func (h *Handler) WithIdempotency(store types.IdempotencyStore) *Handler {
+	copied := *h
+	copied.idempotency = store
+	return &copied
 }
 
 func (h *Handler) RegisterRoutes(r *mux.Router) {
 	r.HandleFunc("/products", h.getProducts).Methods("GET")
+	r.HandleFunc("/products/search", h.searchProducts).Methods("GET")
 	r.HandleFunc("/products/{id}", h.getProduct).Methods("GET")
-	r.HandleFunc("/products", h.createProduct).Methods("POST")
+
+	// only staff and admins may change the catalog, or their API keys with
+	// the products:write scope
+	writeMiddleware := auth.ScopedMiddleware(h.auth, types.ScopeProductsWrite)
+	catalogWriter := func(next http.HandlerFunc) http.HandlerFunc {
+		return writeMiddleware(auth.RequireRole(types.RoleStaff, types.RoleAdmin)(next))
+	}
+	idempotent := func(next http.HandlerFunc) http.HandlerFunc { return next }
+	if h.idempotency != nil {
+		idempotent = idempotency.Middleware(h.idempotency)
+	}
+	r.HandleFunc("/products", catalogWriter(idempotent(h.createProduct))).Methods("POST")
+	r.HandleFunc("/products/{id}", catalogWriter(h.updateProduct)).Methods("PUT")
+	r.HandleFunc("/products/{id}", catalogWriter(h.patchProduct)).Methods("PATCH")
+	r.HandleFunc("/products/{id}", catalogWriter(h.deleteProduct)).Methods("DELETE")
 }
 
+// getProducts lists the catalog one page at a time. Pages are addressed by
+// either offset or an opaque cursor; the response carries the next cursor
+// and a Link header pointing at the following page.
 func (h *Handler) getProducts(w http.ResponseWriter, r *http.Request) {
-	products, err := h.store.GetProducts()
+	limit, offset, err := utils.ParsePagination(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	query, err := parseProductQuery(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if query.Cursor != nil && r.URL.Query().Has("offset") {
+		utils.WriteError(w, http.StatusBadRequest, "cursor and offset cannot be combined")
+		return
+	}
+
+	// fetch one extra product to find out whether there is a next page
+	query.Limit = limit + 1
+	query.Offset = offset
+
+	products, err := h.store.GetProducts(query)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	if products == nil {
+		products = []types.Product{}
+	}
 
-	utils.WriteJSON(w, http.StatusOK, products)
+	response := types.ProductListResponse{Products: products, Limit: limit, Offset: offset}
+	if len(products) > limit {
+		response.Products = products[:limit]
+		last := response.Products[limit-1]
+		response.NextCursor = encodeCursor(types.ProductCursor{ID: last.ID, Price: last.Price, Name: last.Name, CreatedAt: last.CreatedAt})
+
+		next := *r.URL
+		values := next.Query()
+		if query.Cursor == nil && values.Has("offset") {
+			values.Set("offset", strconv.Itoa(offset+limit))
+		} else {
+			values.Set("cursor", response.NextCursor)
+		}
+		next.RawQuery = values.Encode()
+		response.Next = next.RequestURI()
+		w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", response.Next))
+	}
+
+	utils.WriteJSON(w, http.StatusOK, response)
 }
 
-func (h *Handler) getProduct(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id, err := strconv.Atoi(vars["id"])
+func (h *Handler) searchProducts(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		utils.WriteError(w, http.StatusBadRequest, utils.ErrSearchQueryRequired)
+		return
+	}
+
+	limit, offset, err := utils.ParsePagination(r)
 	if err != nil {
-		utils.WriteError(w, http.StatusBadRequest, "Invalid product ID")
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	results, err := h.store.SearchProducts(q, limit, offset)
+	if err != nil {
+		log.Printf("error searching products for %q: %v", q, err)
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrInternalServerError)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.ProductSearchResponse{Query: q, Results: results, Limit: limit, Offset: offset})
+}
+
+// parseProductQuery reads the sort, filter and cursor query parameters.
+// Sorting defaults to ascending; prefix the field with "-" to reverse it.
+func parseProductQuery(r *http.Request) (types.ProductQuery, error) {
+	var query types.ProductQuery
+	values := r.URL.Query()
+
+	if v := values.Get("sort"); v != "" {
+		field := strings.TrimPrefix(v, "-")
+		switch field {
+		case types.ProductSortPrice, types.ProductSortCreatedAt, types.ProductSortName:
+		default:
+			return query, fmt.Errorf("invalid sort: %s", v)
+		}
+		query.Sort = field
+		query.Descending = strings.HasPrefix(v, "-")
+	}
+
+	var err error
+	if query.MinPrice, err = parsePrice(values, "minPrice"); err != nil {
+		return query, err
+	}
+	if query.MaxPrice, err = parsePrice(values, "maxPrice"); err != nil {
+		return query, err
+	}
+	if query.MinPrice != nil && query.MaxPrice != nil && *query.MinPrice > *query.MaxPrice {
+		return query, fmt.Errorf("minPrice cannot be greater than maxPrice")
+	}
+
+	if v := values.Get("inStock"); v != "" {
+		inStock, err := strconv.ParseBool(v)
+		if err != nil {
+			return query, fmt.Errorf("invalid inStock: %s", v)
+		}
+		query.InStock = inStock
+	}
+
+	query.NamePrefix = strings.TrimSpace(values.Get("name"))
+
+	if v := values.Get("cursor"); v != "" {
+		cursor, err := decodeCursor(v)
+		if err != nil {
+			return query, fmt.Errorf("invalid cursor: %s", v)
+		}
+		query.Cursor = cursor
+	}
+
+	return query, nil
+}
+
+func parsePrice(values url.Values, name string) (*float64, error) {
+	v := values.Get(name)
+	if v == "" {
+		return nil, nil
+	}
+
+	price, err := strconv.ParseFloat(v, 64)
+	if err != nil || price < 0 {
+		return nil, fmt.Errorf("invalid %s: %s", name, v)
+	}
+
+	return &price, nil
+}
+
+func encodeCursor(c types.ProductCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (*types.ProductCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	cursor := new(types.ProductCursor)
+	if err := json.Unmarshal(data, cursor); err != nil {
+		return nil, err
+	}
+	if cursor.ID <= 0 {
+		return nil, fmt.Errorf("cursor has no product ID")
+	}
+
+	return cursor, nil
+}
+
+func (h *Handler) getProduct(w http.ResponseWriter, r *http.Request) {
+	id, ok := readProductID(w, r)
+	if !ok {
 		return
 	}
 
 	product, err := h.store.GetProductByID(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WriteError(w, http.StatusNotFound, utils.ErrProductNotFound)
+		return
+	}
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	utils.WriteJSON(w, http.StatusOK, product)
+	writeProduct(w, product)
 }
 
 func (h *Handler) createProduct(w http.ResponseWriter, r *http.Request) {
@@ -95,3 +285,191 @@ func (h *Handler) createProduct(w http.ResponseWriter, r *http.Request) {
 
 	utils.WriteJSON(w, http.StatusCreated, response)
 }
+
+// updateProduct replaces every editable field of a product. The request must
+// carry the ETag it last read in If-Match so concurrent edits are detected.
+func (h *Handler) updateProduct(w http.ResponseWriter, r *http.Request) {
+	id, ok := readProductID(w, r)
+	if !ok {
+		return
+	}
+
+	version, ok := readIfMatch(w, r)
+	if !ok {
+		return
+	}
+
+	if r.Body == nil {
+		utils.WriteError(w, http.StatusBadRequest, utils.ErrInvalidRequestBody)
+		return
+	}
+
+	var payload types.UpdateProductPayload
+	if err := utils.ReadJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, utils.ErrInvalidPayload)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Sprintf("%s: %v", utils.ErrInvalidPayload, validationErrors))
+		return
+	}
+
+	product, err := h.store.UpdateProduct(types.Product{
+		ID:          id,
+		Name:        payload.Name,
+		Description: payload.Description,
+		Image:       payload.Image,
+		Price:       payload.Price,
+		Quantity:    payload.Quantity,
+	}, version)
+	if err != nil {
+		writeWriteError(w, id, err)
+		return
+	}
+
+	writeProduct(w, product)
+}
+
+// patchProduct changes only the fields present in the body, under the same
+// If-Match rules as updateProduct.
+func (h *Handler) patchProduct(w http.ResponseWriter, r *http.Request) {
+	id, ok := readProductID(w, r)
+	if !ok {
+		return
+	}
+
+	version, ok := readIfMatch(w, r)
+	if !ok {
+		return
+	}
+
+	if r.Body == nil {
+		utils.WriteError(w, http.StatusBadRequest, utils.ErrInvalidRequestBody)
+		return
+	}
+
+	var payload types.PatchProductPayload
+	if err := utils.ReadJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, utils.ErrInvalidPayload)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Sprintf("%s: %v", utils.ErrInvalidPayload, validationErrors))
+		return
+	}
+
+	product, err := h.store.GetProductByID(id)
+	if err != nil {
+		writeWriteError(w, id, err)
+		return
+	}
+
+	// a wildcard If-Match still has to apply to the version just read,
+	// otherwise the unchanged fields could be stale
+	if version == 0 {
+		version = product.Version
+	}
+	if product.Version != version {
+		writeWriteError(w, id, ErrVersionConflict)
+		return
+	}
+
+	if payload.Name != nil {
+		product.Name = *payload.Name
+	}
+	if payload.Description != nil {
+		product.Description = *payload.Description
+	}
+	if payload.Price != nil {
+		product.Price = *payload.Price
+	}
+	if payload.Image != nil {
+		product.Image = *payload.Image
+	}
+	if payload.Quantity != nil {
+		product.Quantity = *payload.Quantity
+	}
+
+	product, err = h.store.UpdateProduct(*product, version)
+	if err != nil {
+		writeWriteError(w, id, err)
+		return
+	}
+
+	writeProduct(w, product)
+}
+
+func (h *Handler) deleteProduct(w http.ResponseWriter, r *http.Request) {
+	id, ok := readProductID(w, r)
+	if !ok {
+		return
+	}
+
+	version, ok := readIfMatch(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.store.DeleteProduct(id, version); err != nil {
+		writeWriteError(w, id, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func readProductID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, "Invalid product ID")
+		return 0, false
+	}
+	return id, true
+}
+
+// readIfMatch returns the product version named by the If-Match header, or
+// zero for "*". A missing header is answered with 428 and a value that
+// cannot be one of our ETags with 412.
+func readIfMatch(w http.ResponseWriter, r *http.Request) (int, bool) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" {
+		utils.WriteError(w, http.StatusPreconditionRequired, utils.ErrIfMatchRequired)
+		return 0, false
+	}
+	if header == "*" {
+		return 0, true
+	}
+
+	version, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(header, "W/"), `"`))
+	if err != nil || version < 1 {
+		utils.WriteError(w, http.StatusPreconditionFailed, utils.ErrProductModified)
+		return 0, false
+	}
+
+	return version, true
+}
+
+func etag(version int) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+func writeProduct(w http.ResponseWriter, product *types.Product) {
+	w.Header().Set("ETag", etag(product.Version))
+	utils.WriteJSON(w, http.StatusOK, product)
+}
+
+func writeWriteError(w http.ResponseWriter, id int, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		utils.WriteError(w, http.StatusNotFound, utils.ErrProductNotFound)
+	case errors.Is(err, ErrVersionConflict):
+		utils.WriteError(w, http.StatusPreconditionFailed, utils.ErrProductModified)
+	default:
+		log.Printf("error writing product %d: %v", id, err)
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrInternalServerError)
+	}
+}
@@ -2,30 +2,47 @@ package product
 
 import (
 	"bytes"
+	"database/sql"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/loloDawit/ecom/config"
+	"github.com/loloDawit/ecom/services/auth"
+	"github.com/loloDawit/ecom/services/auth/authtest"
 	"github.com/loloDawit/ecom/types"
+	"github.com/loloDawit/ecom/utils"
 	"github.com/stretchr/testify/assert"
 )
 
 type mockProductStore struct {
-	GetProductsFunc                          func() ([]types.Product, error)
+	GetProductsFunc                          func(query types.ProductQuery) ([]types.Product, error)
+	SearchProductsFunc                       func(query string, limit int, offset int) ([]types.ProductSearchResult, error)
 	GetProductByIDFunc                       func(id int) (*types.Product, error)
 	CreateProductFunc                        func(product types.Product) (int, error)
+	UpdateProductFunc                        func(product types.Product, expectedVersion int) (*types.Product, error)
+	DeleteProductFunc                        func(id int, expectedVersion int) error
 	UpdateProductQuantityWithTransactionFunc func(product types.Product) error
 }
 
-func (m *mockProductStore) GetProducts() ([]types.Product, error) {
+func (m *mockProductStore) GetProducts(query types.ProductQuery) ([]types.Product, error) {
 	if m.GetProductsFunc != nil {
-		return m.GetProductsFunc()
+		return m.GetProductsFunc(query)
 	}
 	return nil, nil
 }
 
+func (m *mockProductStore) SearchProducts(query string, limit int, offset int) ([]types.ProductSearchResult, error) {
+	if m.SearchProductsFunc != nil {
+		return m.SearchProductsFunc(query, limit, offset)
+	}
+	return []types.ProductSearchResult{}, nil
+}
+
 func (m *mockProductStore) GetProductByID(id int) (*types.Product, error) {
 	if m.GetProductByIDFunc != nil {
 		return m.GetProductByIDFunc(id)
@@ -40,6 +57,20 @@ func (m *mockProductStore) CreateProduct(product types.Product) (int, error) {
 	return 0, nil
 }
 
+func (m *mockProductStore) UpdateProduct(product types.Product, expectedVersion int) (*types.Product, error) {
+	if m.UpdateProductFunc != nil {
+		return m.UpdateProductFunc(product, expectedVersion)
+	}
+	return &product, nil
+}
+
+func (m *mockProductStore) DeleteProduct(id int, expectedVersion int) error {
+	if m.DeleteProductFunc != nil {
+		return m.DeleteProductFunc(id, expectedVersion)
+	}
+	return nil
+}
+
 func (m *mockProductStore) UpdateProductQuantityWithTransaction(product types.Product) error {
 	if m.UpdateProductQuantityWithTransactionFunc != nil {
 		return m.UpdateProductQuantityWithTransactionFunc(product)
@@ -47,9 +78,21 @@ func (m *mockProductStore) UpdateProductQuantityWithTransaction(product types.Pr
 	return nil
 }
 
+func (m *mockProductStore) RestoreProductQuantityWithTransaction(product types.Product) error {
+	return nil
+}
+
+var testConfig = &config.Config{JWT: config.JWTConfig{Secret: "testsecret"}}
+
+func roleToken(t *testing.T, role types.Role) string {
+	token, err := auth.GenerateToken([]byte(testConfig.JWT.Secret), 1, role, time.Hour)
+	assert.NoError(t, err)
+	return "Bearer " + token
+}
+
 func TestGetProductsRoute(t *testing.T) {
 	mockStore := &mockProductStore{
-		GetProductsFunc: func() ([]types.Product, error) {
+		GetProductsFunc: func(query types.ProductQuery) ([]types.Product, error) {
 			return []types.Product{
 				{Name: "Product1"},
 				{Name: "Product2"},
@@ -57,7 +100,7 @@ func TestGetProductsRoute(t *testing.T) {
 		},
 	}
 
-	handler := NewHandlers(mockStore)
+	handler := NewHandlers(mockStore, auth.NewJWTAuthenticator([]byte(testConfig.JWT.Secret)), testConfig)
 	router := mux.NewRouter()
 	handler.RegisterRoutes(router)
 
@@ -70,9 +113,13 @@ func TestGetProductsRoute(t *testing.T) {
 	assert.Equal(t, http.StatusOK, rr.Code)
 
 	// Unmarshal the response body to check specific fields
-	var actualProducts []map[string]interface{}
-	err = json.Unmarshal(rr.Body.Bytes(), &actualProducts)
+	var actual struct {
+		Products []map[string]interface{} `json:"products"`
+	}
+	err = json.Unmarshal(rr.Body.Bytes(), &actual)
 	assert.NoError(t, err)
+	actualProducts := actual.Products
+	assert.Len(t, actualProducts, 2)
 
 	expectedNames := []string{"Product1", "Product2"}
 	for i, product := range actualProducts {
@@ -80,6 +127,174 @@ func TestGetProductsRoute(t *testing.T) {
 	}
 }
 
+func TestGetProductsPagination(t *testing.T) {
+	createdAt := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	catalog := []types.Product{
+		{ID: 1, Name: "Apple", Price: 1, CreatedAt: createdAt},
+		{ID: 2, Name: "Banana", Price: 2, CreatedAt: createdAt},
+		{ID: 3, Name: "Cherry", Price: 3, CreatedAt: createdAt},
+	}
+	cursor := encodeCursor(types.ProductCursor{ID: 2, Price: 2, Name: "Banana", CreatedAt: createdAt})
+	minPrice, maxPrice := 1.5, 10.0
+
+	tests := []struct {
+		name               string
+		url                string
+		expectedStatus     int
+		expectedQuery      types.ProductQuery
+		expectedIDs        []int
+		expectedNextCursor string
+		expectedLink       string
+		expectedError      string
+	}{
+		{
+			name:               "First page links to the next cursor",
+			url:                "/products?limit=2",
+			expectedStatus:     http.StatusOK,
+			expectedQuery:      types.ProductQuery{Limit: 3},
+			expectedIDs:        []int{1, 2},
+			expectedNextCursor: cursor,
+			expectedLink:       "</products?cursor=" + cursor + "&limit=2>; rel=\"next\"",
+		},
+		{
+			name:               "Offset pages link to the next offset",
+			url:                "/products?limit=2&offset=2",
+			expectedStatus:     http.StatusOK,
+			expectedQuery:      types.ProductQuery{Limit: 3, Offset: 2},
+			expectedIDs:        []int{1, 2},
+			expectedNextCursor: cursor,
+			expectedLink:       "</products?limit=2&offset=4>; rel=\"next\"",
+		},
+		{
+			name:           "Last page has no next link",
+			url:            "/products?sort=-price&minPrice=1.5&maxPrice=10&inStock=true&name=b&cursor=" + cursor,
+			expectedStatus: http.StatusOK,
+			expectedQuery: types.ProductQuery{
+				Limit: 21, Sort: types.ProductSortPrice, Descending: true, MinPrice: &minPrice, MaxPrice: &maxPrice,
+				InStock: true, NamePrefix: "b", Cursor: &types.ProductCursor{ID: 2, Price: 2, Name: "Banana", CreatedAt: createdAt},
+			},
+			expectedIDs: []int{1, 2, 3},
+		},
+		{
+			name:           "Unknown sort field",
+			url:            "/products?sort=quantity",
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "invalid sort: quantity",
+		},
+		{
+			name:           "Inverted price range",
+			url:            "/products?minPrice=10&maxPrice=5",
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "minPrice cannot be greater than maxPrice",
+		},
+		{
+			name:           "Malformed cursor",
+			url:            "/products?cursor=nope",
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "invalid cursor: nope",
+		},
+		{
+			name:           "Cursor with offset",
+			url:            "/products?offset=2&cursor=" + cursor,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "cursor and offset cannot be combined",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var received types.ProductQuery
+			mockStore := &mockProductStore{
+				GetProductsFunc: func(query types.ProductQuery) ([]types.Product, error) {
+					received = query
+					if query.Limit < len(catalog) {
+						return catalog[:query.Limit], nil
+					}
+					return catalog, nil
+				},
+			}
+
+			router := mux.NewRouter()
+			NewHandlers(mockStore, auth.NewJWTAuthenticator([]byte(testConfig.JWT.Secret)), testConfig).RegisterRoutes(router)
+
+			req, err := http.NewRequest("GET", tt.url, nil)
+			assert.NoError(t, err)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedError != "" {
+				assert.JSONEq(t, `{"error":"`+tt.expectedError+`"}`, rr.Body.String())
+				return
+			}
+
+			var response types.ProductListResponse
+			assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+			assert.Equal(t, tt.expectedQuery, received)
+			ids := []int{}
+			for _, p := range response.Products {
+				ids = append(ids, p.ID)
+			}
+			assert.Equal(t, tt.expectedIDs, ids)
+			assert.Equal(t, tt.expectedNextCursor, response.NextCursor)
+			assert.Equal(t, tt.expectedLink, rr.Header().Get("Link"))
+		})
+	}
+}
+
+func TestSearchProductsRoute(t *testing.T) {
+	tests := []struct {
+		name                 string
+		url                  string
+		searchFunc           func(query string, limit int, offset int) ([]types.ProductSearchResult, error)
+		expectedStatus       int
+		expectedResponseBody string
+	}{
+		{
+			name: "Results",
+			url:  "/products/search?q=%20head%20&limit=5",
+			searchFunc: func(query string, limit int, offset int) ([]types.ProductSearchResult, error) {
+				if query != "head" || limit != 5 || offset != 0 {
+					return nil, fmt.Errorf("unexpected arguments %q %d %d", query, limit, offset)
+				}
+				return []types.ProductSearchResult{{Product: types.Product{ID: 4, Name: "Headphones"}, Rank: 0.5, Snippet: "<mark>Headphones</mark>"}}, nil
+			},
+			expectedStatus:       http.StatusOK,
+			expectedResponseBody: `{"query":"head","results":[{"id":4,"name":"Headphones","description":"","price":0,"createdAt":"0001-01-01T00:00:00Z","image":"","quantity":0,"version":0,"rank":0.5,"snippet":"<mark>Headphones</mark>"}],"limit":5,"offset":0}`,
+		},
+		{
+			name:                 "Missing query",
+			url:                  "/products/search?q=%20",
+			expectedStatus:       http.StatusBadRequest,
+			expectedResponseBody: `{"error":"search query is required"}`,
+		},
+		{
+			name: "Store error",
+			url:  "/products/search?q=lamp",
+			searchFunc: func(query string, limit int, offset int) ([]types.ProductSearchResult, error) {
+				return nil, fmt.Errorf("db down")
+			},
+			expectedStatus:       http.StatusInternalServerError,
+			expectedResponseBody: `{"error":"internal server error"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := mux.NewRouter()
+			NewHandlers(&mockProductStore{SearchProductsFunc: tt.searchFunc}, auth.NewJWTAuthenticator([]byte(testConfig.JWT.Secret)), testConfig).RegisterRoutes(router)
+
+			req, err := http.NewRequest("GET", tt.url, nil)
+			assert.NoError(t, err)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			assert.JSONEq(t, tt.expectedResponseBody, rr.Body.String())
+		})
+	}
+}
+
 func TestCreateProductRoute(t *testing.T) {
 	mockStore := &mockProductStore{
 		CreateProductFunc: func(product types.Product) (int, error) {
@@ -87,7 +302,7 @@ func TestCreateProductRoute(t *testing.T) {
 		},
 	}
 
-	handler := NewHandlers(mockStore)
+	handler := NewHandlers(mockStore, auth.NewJWTAuthenticator([]byte(testConfig.JWT.Secret)), testConfig)
 	router := mux.NewRouter()
 	handler.RegisterRoutes(router)
 
@@ -103,6 +318,7 @@ func TestCreateProductRoute(t *testing.T) {
 
 	req, err := http.NewRequest("POST", "/products", bytes.NewReader(body))
 	assert.NoError(t, err)
+	req.Header.Set("Authorization", roleToken(t, types.RoleStaff))
 
 	rr := httptest.NewRecorder()
 	router.ServeHTTP(rr, req)
@@ -112,6 +328,72 @@ func TestCreateProductRoute(t *testing.T) {
 	assert.JSONEq(t, expected, rr.Body.String())
 }
 
+// mockIdempotencyStore keeps idempotency records in memory, keyed by key.
+type mockIdempotencyStore struct {
+	records map[string]types.IdempotencyRecord
+}
+
+func (m *mockIdempotencyStore) ReserveIdempotencyKey(record types.IdempotencyRecord, expiredBefore time.Time) (bool, error) {
+	if _, ok := m.records[record.Key]; ok {
+		return false, nil
+	}
+	m.records[record.Key] = record
+	return true, nil
+}
+
+func (m *mockIdempotencyStore) GetIdempotencyRecord(key string, userID int) (*types.IdempotencyRecord, error) {
+	record, ok := m.records[key]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &record, nil
+}
+
+func (m *mockIdempotencyStore) SaveIdempotencyResponse(record types.IdempotencyRecord) error {
+	m.records[record.Key] = record
+	return nil
+}
+
+func (m *mockIdempotencyStore) DeleteIdempotencyRecord(key string, userID int) error {
+	delete(m.records, key)
+	return nil
+}
+
+func (m *mockIdempotencyStore) DeleteExpiredIdempotencyRecords(expiredBefore time.Time) (int64, error) {
+	return 0, nil
+}
+
+func TestCreateProductRouteIdempotency(t *testing.T) {
+	created := 0
+	mockStore := &mockProductStore{
+		CreateProductFunc: func(product types.Product) (int, error) {
+			created++
+			return 100 + created, nil
+		},
+	}
+	idempotencyStore := &mockIdempotencyStore{records: map[string]types.IdempotencyRecord{}}
+
+	handler := NewHandlers(mockStore, auth.NewJWTAuthenticator([]byte(testConfig.JWT.Secret)), testConfig).WithIdempotency(idempotencyStore)
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	body := `{"name":"Test Product","description":"Test Description","image":"test.jpg","price":100,"quantity":10}`
+	for i := 0; i < 2; i++ {
+		req, err := http.NewRequest("POST", "/products", bytes.NewReader([]byte(body)))
+		assert.NoError(t, err)
+		req.Header.Set("Authorization", roleToken(t, types.RoleStaff))
+		req.Header.Set("Idempotency-Key", "abc")
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		assert.JSONEq(t, `{"id":101,"message":"Product created successfully"}`, rr.Body.String())
+	}
+	assert.Equal(t, 1, created)
+	assert.Equal(t, 1, idempotencyStore.records["abc"].UserID)
+}
+
 func TestGetProductRoute(t *testing.T) {
 	mockStore := &mockProductStore{
 		GetProductByIDFunc: func(id int) (*types.Product, error) {
@@ -119,7 +401,7 @@ func TestGetProductRoute(t *testing.T) {
 		},
 	}
 
-	handler := NewHandlers(mockStore)
+	handler := NewHandlers(mockStore, auth.NewJWTAuthenticator([]byte(testConfig.JWT.Secret)), testConfig)
 	router := mux.NewRouter()
 	handler.RegisterRoutes(router)
 
@@ -138,3 +420,264 @@ func TestGetProductRoute(t *testing.T) {
 
 	assert.Equal(t, "Product1", actualProduct["name"])
 }
+
+func TestGetProductRouteNotFound(t *testing.T) {
+	mockStore := &mockProductStore{
+		GetProductByIDFunc: func(id int) (*types.Product, error) {
+			return nil, sql.ErrNoRows
+		},
+	}
+
+	router := mux.NewRouter()
+	NewHandlers(mockStore, auth.NewJWTAuthenticator([]byte(testConfig.JWT.Secret)), testConfig).RegisterRoutes(router)
+
+	req, err := http.NewRequest("GET", "/products/1", nil)
+	assert.NoError(t, err)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.JSONEq(t, `{"error":"product not found"}`, rr.Body.String())
+}
+
+func TestWriteProductRoutes(t *testing.T) {
+	current := func(id int) (*types.Product, error) {
+		return &types.Product{ID: id, Name: "Lamp", Description: "Desk lamp", Image: "lamp.jpg", Price: 25, Quantity: 4, Version: 2}, nil
+	}
+
+	tests := []struct {
+		name                 string
+		method               string
+		ifMatch              string
+		payload              string
+		mockStore            *mockProductStore
+		expectedStatus       int
+		expectedETag         string
+		expectedResponseBody string
+	}{
+		{
+			name:    "Replace product",
+			method:  "PUT",
+			ifMatch: `"2"`,
+			payload: `{"name":"Lamp","description":"Floor lamp","image":"lamp.jpg","price":30,"quantity":0}`,
+			mockStore: &mockProductStore{
+				UpdateProductFunc: func(product types.Product, expectedVersion int) (*types.Product, error) {
+					if expectedVersion != 2 {
+						return nil, ErrVersionConflict
+					}
+					product.Version = 3
+					return &product, nil
+				},
+			},
+			expectedStatus:       http.StatusOK,
+			expectedETag:         `"3"`,
+			expectedResponseBody: `{"id":1,"name":"Lamp","description":"Floor lamp","price":30,"createdAt":"0001-01-01T00:00:00Z","image":"lamp.jpg","quantity":0,"version":3}`,
+		},
+		{
+			name:                 "Replace without If-Match",
+			method:               "PUT",
+			payload:              `{"name":"Lamp","description":"Floor lamp","image":"lamp.jpg","price":30,"quantity":0}`,
+			mockStore:            &mockProductStore{},
+			expectedStatus:       http.StatusPreconditionRequired,
+			expectedResponseBody: `{"error":"If-Match header is required"}`,
+		},
+		{
+			name:    "Replace with stale ETag",
+			method:  "PUT",
+			ifMatch: `W/"1"`,
+			payload: `{"name":"Lamp","description":"Floor lamp","image":"lamp.jpg","price":30,"quantity":0}`,
+			mockStore: &mockProductStore{
+				UpdateProductFunc: func(product types.Product, expectedVersion int) (*types.Product, error) {
+					return nil, ErrVersionConflict
+				},
+			},
+			expectedStatus:       http.StatusPreconditionFailed,
+			expectedResponseBody: `{"error":"product was modified by another request"}`,
+		},
+		{
+			name:    "Patch price only",
+			method:  "PATCH",
+			ifMatch: `"2"`,
+			payload: `{"price":19.5}`,
+			mockStore: &mockProductStore{
+				GetProductByIDFunc: current,
+				UpdateProductFunc: func(product types.Product, expectedVersion int) (*types.Product, error) {
+					product.Version = expectedVersion + 1
+					return &product, nil
+				},
+			},
+			expectedStatus:       http.StatusOK,
+			expectedETag:         `"3"`,
+			expectedResponseBody: `{"id":1,"name":"Lamp","description":"Desk lamp","price":19.5,"createdAt":"0001-01-01T00:00:00Z","image":"lamp.jpg","quantity":4,"version":3}`,
+		},
+		{
+			name:                 "Patch with stale ETag",
+			method:               "PATCH",
+			ifMatch:              `"1"`,
+			payload:              `{"price":19.5}`,
+			mockStore:            &mockProductStore{GetProductByIDFunc: current},
+			expectedStatus:       http.StatusPreconditionFailed,
+			expectedResponseBody: `{"error":"product was modified by another request"}`,
+		},
+		{
+			name:                 "Patch with invalid field",
+			method:               "PATCH",
+			ifMatch:              "*",
+			payload:              `{"price":-1}`,
+			mockStore:            &mockProductStore{GetProductByIDFunc: current},
+			expectedStatus:       http.StatusBadRequest,
+			expectedResponseBody: `{"error":"invalid payload: Key: 'PatchProductPayload.Price' Error:Field validation for 'Price' failed on the 'gt' tag"}`,
+		},
+		{
+			name:                 "Delete product",
+			method:               "DELETE",
+			ifMatch:              `"2"`,
+			mockStore:            &mockProductStore{},
+			expectedStatus:       http.StatusNoContent,
+			expectedResponseBody: ``,
+		},
+		{
+			name:    "Delete missing product",
+			method:  "DELETE",
+			ifMatch: "*",
+			mockStore: &mockProductStore{
+				DeleteProductFunc: func(id int, expectedVersion int) error {
+					return sql.ErrNoRows
+				},
+			},
+			expectedStatus:       http.StatusNotFound,
+			expectedResponseBody: `{"error":"product not found"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := mux.NewRouter()
+			NewHandlers(tt.mockStore, auth.NewJWTAuthenticator([]byte(testConfig.JWT.Secret)), testConfig).RegisterRoutes(router)
+
+			req, err := http.NewRequest(tt.method, "/products/1", bytes.NewReader([]byte(tt.payload)))
+			assert.NoError(t, err)
+			req.Header.Set("Authorization", roleToken(t, types.RoleAdmin))
+			if tt.ifMatch != "" {
+				req.Header.Set("If-Match", tt.ifMatch)
+			}
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			assert.Equal(t, tt.expectedETag, rr.Header().Get("ETag"))
+			if tt.expectedResponseBody == "" {
+				assert.Empty(t, rr.Body.String())
+				return
+			}
+			assert.JSONEq(t, tt.expectedResponseBody, rr.Body.String())
+		})
+	}
+}
+
+func TestProductWriteRoutesRequireRole(t *testing.T) {
+	tests := []struct {
+		name                 string
+		method               string
+		path                 string
+		authorization        string
+		expectedStatus       int
+		expectedResponseBody string
+	}{
+		{
+			name:                 "Anonymous create",
+			method:               "POST",
+			path:                 "/products",
+			expectedStatus:       http.StatusUnauthorized,
+			expectedResponseBody: `{"error":"Authorization header is missing"}`,
+		},
+		{
+			name:                 "Customer create",
+			method:               "POST",
+			path:                 "/products",
+			authorization:        roleToken(t, types.RoleCustomer),
+			expectedStatus:       http.StatusForbidden,
+			expectedResponseBody: `{"error":"forbidden"}`,
+		},
+		{
+			name:                 "Customer update",
+			method:               "PUT",
+			path:                 "/products/1",
+			authorization:        roleToken(t, types.RoleCustomer),
+			expectedStatus:       http.StatusForbidden,
+			expectedResponseBody: `{"error":"forbidden"}`,
+		},
+		{
+			name:                 "Customer patch",
+			method:               "PATCH",
+			path:                 "/products/1",
+			authorization:        roleToken(t, types.RoleCustomer),
+			expectedStatus:       http.StatusForbidden,
+			expectedResponseBody: `{"error":"forbidden"}`,
+		},
+		{
+			name:                 "Customer delete",
+			method:               "DELETE",
+			path:                 "/products/1",
+			authorization:        roleToken(t, types.RoleCustomer),
+			expectedStatus:       http.StatusForbidden,
+			expectedResponseBody: `{"error":"forbidden"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStore := &mockProductStore{
+				CreateProductFunc: func(product types.Product) (int, error) {
+					t.Fatal("the store must not be reached")
+					return 0, nil
+				},
+			}
+
+			router := mux.NewRouter()
+			NewHandlers(mockStore, auth.NewJWTAuthenticator([]byte(testConfig.JWT.Secret)), testConfig).RegisterRoutes(router)
+
+			req, err := http.NewRequest(tt.method, tt.path, bytes.NewReader([]byte(`{}`)))
+			assert.NoError(t, err)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			req.Header.Set("If-Match", "*")
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			assert.JSONEq(t, tt.expectedResponseBody, rr.Body.String())
+		})
+	}
+}
+
+func TestProductWriteRoutesRequireScope(t *testing.T) {
+	// a staff member's API key without products:write
+	authenticator := &authtest.Authenticator{Identity: &auth.Identity{
+		UserID:   1,
+		Role:     types.RoleStaff,
+		APIKeyID: 3,
+		Scopes:   []types.Scope{types.ScopeOrdersRead},
+	}}
+	mockStore := &mockProductStore{
+		CreateProductFunc: func(product types.Product) (int, error) {
+			t.Fatal("the store must not be reached")
+			return 0, nil
+		},
+	}
+
+	router := mux.NewRouter()
+	NewHandlers(mockStore, authenticator, testConfig).RegisterRoutes(router)
+
+	req, err := http.NewRequest("POST", "/products", bytes.NewReader([]byte(`{}`)))
+	assert.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.JSONEq(t, `{"error":"`+utils.ErrInsufficientScope+`"}`, rr.Body.String())
+}
@@ -2,15 +2,26 @@ package product
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"html"
 	"log"
+	"strings"
+	"unicode"
 
 	"github.com/loloDawit/ecom/config"
+	"github.com/loloDawit/ecom/db"
 	"github.com/loloDawit/ecom/types"
+	"github.com/loloDawit/ecom/utils"
 )
 
+// ErrVersionConflict is returned when a product was changed by someone else
+// after the caller read it.
+var ErrVersionConflict = errors.New(utils.ErrProductModified)
+
 type ProductStore struct {
 	db  *sql.DB
+	tx  *sql.Tx
 	cfg *config.Config
 }
 
@@ -18,8 +29,83 @@ func NewProductStore(db *sql.DB, cfg *config.Config) *ProductStore {
 	return &ProductStore{db: db, cfg: cfg}
 }
 
-func (s *ProductStore) GetProducts() ([]types.Product, error) {
-	rows, err := s.db.Query("SELECT id, name, description, image, price, quantity, createdAt FROM products")
+// WithTx returns a copy of the store whose queries run inside tx.
+func (s *ProductStore) WithTx(tx *sql.Tx) *ProductStore {
+	return &ProductStore{db: s.db, tx: tx, cfg: s.cfg}
+}
+
+// conn returns the transaction the store is bound to, or the pool otherwise.
+func (s *ProductStore) conn() db.DBTX {
+	if s.tx != nil {
+		return s.tx
+	}
+	return s.db
+}
+
+const productColumns = "id, name, description, image, price, quantity, createdAt, version"
+
+var productSortColumns = map[string]string{
+	types.ProductSortID:        "id",
+	types.ProductSortPrice:     "price",
+	types.ProductSortCreatedAt: "createdAt",
+	types.ProductSortName:      "name",
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// GetProducts returns the page of products described by q. Ties on the sort
+// column are broken by id so that cursors always resume at a stable point.
+func (s *ProductStore) GetProducts(q types.ProductQuery) ([]types.Product, error) {
+	column, ok := productSortColumns[q.Sort]
+	if !ok {
+		column = "id"
+	}
+	direction, comparison := "ASC", ">"
+	if q.Descending {
+		direction, comparison = "DESC", "<"
+	}
+
+	conditions := []string{"deletedAt IS NULL"}
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if q.MinPrice != nil {
+		conditions = append(conditions, "price >= "+arg(*q.MinPrice))
+	}
+	if q.MaxPrice != nil {
+		conditions = append(conditions, "price <= "+arg(*q.MaxPrice))
+	}
+	if q.InStock {
+		conditions = append(conditions, "quantity > 0")
+	}
+	if q.NamePrefix != "" {
+		conditions = append(conditions, "name ILIKE "+arg(likeEscaper.Replace(q.NamePrefix)+"%"))
+	}
+	if q.Cursor != nil {
+		if column == "id" {
+			conditions = append(conditions, fmt.Sprintf("id %s %s", comparison, arg(q.Cursor.ID)))
+		} else {
+			value := cursorValue(column, q.Cursor)
+			conditions = append(conditions, fmt.Sprintf("(%s, id) %s (%s, %s)", column, comparison, arg(value), arg(q.Cursor.ID)))
+		}
+	}
+
+	query := "SELECT " + productColumns + " FROM products WHERE " + strings.Join(conditions, " AND ")
+	query += fmt.Sprintf(" ORDER BY %s %s", column, direction)
+	if column != "id" {
+		query += ", id " + direction
+	}
+	if q.Limit > 0 {
+		query += " LIMIT " + arg(q.Limit)
+	}
+	if q.Cursor == nil && q.Offset > 0 {
+		query += " OFFSET " + arg(q.Offset)
+	}
+
+	rows, err := s.conn().Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -27,22 +113,19 @@ func (s *ProductStore) GetProducts() ([]types.Product, error) {
 
 	products := []types.Product{}
 	for rows.Next() {
-		p := types.Product{}
-		err := rows.Scan(&p.ID, &p.Name, &p.Description, &p.Image, &p.Price, &p.Quantity, &p.CreatedAt)
+		p, err := scanProduct(rows)
 		if err != nil {
 			return nil, err
 		}
-		products = append(products, p)
+		products = append(products, *p)
 	}
 
 	return products, nil
 }
 
-func (s *ProductStore) GetProductByID(id int) (*types.Product, error) {
-	row := s.db.QueryRow("SELECT * FROM products WHERE id = $1", id)
-
+func scanProduct(row scanner) (*types.Product, error) {
 	p := new(types.Product)
-	err := row.Scan(&p.ID, &p.Name, &p.Description, &p.Image, &p.Price, &p.Quantity, &p.CreatedAt)
+	err := row.Scan(&p.ID, &p.Name, &p.Description, &p.Image, &p.Price, &p.Quantity, &p.CreatedAt, &p.Version)
 	if err != nil {
 		return nil, err
 	}
@@ -50,9 +133,107 @@ func (s *ProductStore) GetProductByID(id int) (*types.Product, error) {
 	return p, nil
 }
 
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func cursorValue(column string, c *types.ProductCursor) any {
+	switch column {
+	case "price":
+		return c.Price
+	case "name":
+		return c.Name
+	default:
+		return c.CreatedAt
+	}
+}
+
+// ts_headline wraps matches in these control characters rather than markup,
+// so the description can be escaped before the <mark> tags go in.
+const (
+	headlineStart   = "\x02"
+	headlineStop    = "\x03"
+	headlineOptions = "StartSel=" + headlineStart + ", StopSel=" + headlineStop + ", MaxWords=30, MinWords=10"
+)
+
+// SearchProducts runs a full-text search over product names and
+// descriptions. Every term in query is matched as a prefix, so "head" finds
+// "headphones"; results are ordered by relevance with name matches weighted
+// above description matches.
+func (s *ProductStore) SearchProducts(query string, limit int, offset int) ([]types.ProductSearchResult, error) {
+	tsQuery := prefixTSQuery(query)
+	if tsQuery == "" {
+		return []types.ProductSearchResult{}, nil
+	}
+
+	rows, err := s.conn().Query(
+		`SELECT p.id, p.name, p.description, p.image, p.price, p.quantity, p.createdAt, p.version,
+			ts_rank(p.searchVector, q.query) AS rank,
+			ts_headline('english', p.description, q.query, $4) AS snippet
+		FROM products p, to_tsquery('english', $1) AS q(query)
+		WHERE p.searchVector @@ q.query AND p.deletedAt IS NULL
+		ORDER BY rank DESC, p.id
+		LIMIT $2 OFFSET $3`,
+		tsQuery, limit, offset, headlineOptions,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []types.ProductSearchResult{}
+	for rows.Next() {
+		r := types.ProductSearchResult{}
+		err := rows.Scan(&r.ID, &r.Name, &r.Description, &r.Image, &r.Price, &r.Quantity, &r.CreatedAt, &r.Version, &r.Rank, &r.Snippet)
+		if err != nil {
+			return nil, err
+		}
+		r.Snippet = highlight(r.Snippet)
+		results = append(results, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// highlight HTML-escapes a ts_headline excerpt and only then marks the
+// matches, so the snippet is safe to render as HTML whatever the description
+// holds.
+func highlight(headline string) string {
+	escaped := html.EscapeString(headline)
+	escaped = strings.ReplaceAll(escaped, headlineStart, "<mark>")
+	return strings.ReplaceAll(escaped, headlineStop, "</mark>")
+}
+
+// prefixTSQuery turns free text into a to_tsquery expression that requires
+// every word as a prefix match. Anything other than letters and digits is
+// dropped so user input can never produce tsquery syntax errors.
+func prefixTSQuery(query string) string {
+	words := strings.FieldsFunc(query, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	terms := make([]string, 0, len(words))
+	for _, word := range words {
+		terms = append(terms, strings.ToLower(word)+":*")
+	}
+
+	return strings.Join(terms, " & ")
+}
+
+// GetProductByID returns the product unless it has been deleted, in which
+// case sql.ErrNoRows is returned.
+func (s *ProductStore) GetProductByID(id int) (*types.Product, error) {
+	row := s.conn().QueryRow("SELECT "+productColumns+" FROM products WHERE id = $1 AND deletedAt IS NULL", id)
+	return scanProduct(row)
+}
+
 func (s *ProductStore) CreateProduct(p types.Product) (int, error) {
 	var newID int
-	err := s.db.QueryRow(
+	err := s.conn().QueryRow(
 		"INSERT INTO products (name, description, image, price, quantity) VALUES ($1, $2, $3, $4, $5) RETURNING id",
 		p.Name, p.Description, p.Image, p.Price, p.Quantity,
 	).Scan(&newID)
@@ -64,60 +245,107 @@ func (s *ProductStore) CreateProduct(p types.Product) (int, error) {
 	return newID, nil
 }
 
-func (s *ProductStore) UpdateProductQuantityWithTransaction(p types.Product) error {
-	// Begin a new transaction
-	tx, err := s.db.Begin()
+// UpdateProduct saves the editable fields of p and bumps its version. It
+// returns ErrVersionConflict when the product changed since expectedVersion
+// was read and sql.ErrNoRows when it does not exist.
+func (s *ProductStore) UpdateProduct(p types.Product, expectedVersion int) (*types.Product, error) {
+	row := s.conn().QueryRow(
+		"UPDATE products SET name = $1, description = $2, image = $3, price = $4, quantity = $5, version = version + 1 WHERE id = $6 AND deletedAt IS NULL AND ($7 = 0 OR version = $7) RETURNING "+productColumns,
+		p.Name, p.Description, p.Image, p.Price, p.Quantity, p.ID, expectedVersion,
+	)
+
+	updated, err := scanProduct(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, s.missOrConflict(p.ID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// DeleteProduct hides the product from the catalog by setting deletedAt.
+// Order history keeps referring to the row.
+func (s *ProductStore) DeleteProduct(id int, expectedVersion int) error {
+	result, err := s.conn().Exec(
+		"UPDATE products SET deletedAt = CURRENT_TIMESTAMP, version = version + 1 WHERE id = $1 AND deletedAt IS NULL AND ($2 = 0 OR version = $2)",
+		id, expectedVersion,
+	)
 	if err != nil {
 		return err
 	}
 
-	// Ensure the transaction is either committed or rolled back
-	defer func() {
-		if p := recover(); p != nil {
-			tx.Rollback() // Rollback in case of panic
-			panic(p)
-		} else if err != nil {
-			tx.Rollback() // Rollback in case of error
-		} else {
-			err = tx.Commit() // Commit if no errors
-		}
-	}()
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return s.missOrConflict(id)
+	}
+
+	return nil
+}
+
+// missOrConflict explains why a versioned write matched no row.
+func (s *ProductStore) missOrConflict(id int) error {
+	if _, err := s.GetProductByID(id); err != nil {
+		return err
+	}
+	return ErrVersionConflict
+}
+
+// UpdateProductQuantityWithTransaction decrements the stock of p.ID by
+// p.Quantity. When the store is bound to a transaction the update joins it,
+// otherwise it runs in a transaction of its own.
+func (s *ProductStore) UpdateProductQuantityWithTransaction(p types.Product) error {
+	if s.tx != nil {
+		return updateProductQuantity(s.tx, p)
+	}
+
+	return db.WithTransaction(s.db, func(tx *sql.Tx) error {
+		return updateProductQuantity(tx, p)
+	})
+}
+
+// RestoreProductQuantityWithTransaction returns p.Quantity units to the stock
+// of p.ID, e.g. when an order is cancelled. Like the decrement it joins the
+// store's transaction when there is one.
+func (s *ProductStore) RestoreProductQuantityWithTransaction(p types.Product) error {
+	p.Quantity = -p.Quantity
+	return s.UpdateProductQuantityWithTransaction(p)
+}
 
+func updateProductQuantity(tx *sql.Tx, p types.Product) error {
 	// Retrieve the initial quantity within the transaction
 	var initialQuantity int
-	err = tx.QueryRow("SELECT quantity FROM products WHERE id = $1 FOR UPDATE", p.ID).Scan(&initialQuantity)
+	err := tx.QueryRow("SELECT quantity FROM products WHERE id = $1 FOR UPDATE", p.ID).Scan(&initialQuantity)
 	if err != nil {
-		fmt.Printf("Error retrieving initial quantity: %v\n", err)
 		return err
 	}
-	fmt.Printf("Initial quantity for product ID %d: %d\n", p.ID, initialQuantity)
 
-	// Execute the SQL update statement within the transaction
-	result, err := tx.Exec("UPDATE products SET quantity = quantity - $1 WHERE id = $2", p.Quantity, p.ID)
+	// Execute the SQL update statement within the transaction, refusing to
+	// take the stock below zero
+	result, err := tx.Exec("UPDATE products SET quantity = quantity - $1, version = version + 1 WHERE id = $2 AND quantity >= $1", p.Quantity, p.ID)
 	if err != nil {
-		fmt.Printf("Error executing update: %v\n", err)
 		return err
 	}
 
 	// Check the number of affected rows
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		fmt.Printf("Error getting affected rows: %v\n", err)
 		return err
 	}
-	fmt.Printf("Rows affected: %d\n", rowsAffected)
 	if rowsAffected == 0 {
 		return fmt.Errorf("no rows updated, check if the product ID exists and quantity is valid")
 	}
 
-	// Retrieve and log the updated quantity within the transaction
+	// Retrieve the updated quantity within the transaction
 	var updatedQuantity int
 	err = tx.QueryRow("SELECT quantity FROM products WHERE id = $1", p.ID).Scan(&updatedQuantity)
 	if err != nil {
-		fmt.Printf("Error retrieving updated quantity: %v\n", err)
 		return err
 	}
-	fmt.Printf("Updated product ID: %d, New quantity: %d\n", p.ID, updatedQuantity)
 
 	// Verify the update
 	expectedQuantity := initialQuantity - p.Quantity
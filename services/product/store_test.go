@@ -2,6 +2,7 @@ package product
 
 import (
 	"database/sql"
+	"database/sql/driver"
 	"testing"
 	"time"
 
@@ -30,10 +31,10 @@ func TestGetProducts(t *testing.T) {
 		{
 			name: "Products found",
 			mockQuery: func() {
-				rows := sqlmock.NewRows([]string{"id", "name", "description", "image", "price", "quantity", "createdAt"}).
-					AddRow(1, "Product 1", "Description 1", "image1.jpg", 10.5, 100, time.Now()).
-					AddRow(2, "Product 2", "Description 2", "image2.jpg", 20.0, 200, time.Now())
-				mock.ExpectQuery("SELECT id, name, description, image, price, quantity, createdAt FROM products").
+				rows := sqlmock.NewRows([]string{"id", "name", "description", "image", "price", "quantity", "createdAt", "version"}).
+					AddRow(1, "Product 1", "Description 1", "image1.jpg", 10.5, 100, time.Now(), 1).
+					AddRow(2, "Product 2", "Description 2", "image2.jpg", 20.0, 200, time.Now(), 1)
+				mock.ExpectQuery("SELECT id, name, description, image, price, quantity, createdAt, version FROM products WHERE deletedAt IS NULL").
 					WillReturnRows(rows)
 			},
 			expectedProducts: []types.Product{
@@ -45,7 +46,7 @@ func TestGetProducts(t *testing.T) {
 		{
 			name: "Database error",
 			mockQuery: func() {
-				mock.ExpectQuery("SELECT id, name, description, image, price, quantity, createdAt FROM products").
+				mock.ExpectQuery("SELECT id, name, description, image, price, quantity, createdAt, version FROM products WHERE deletedAt IS NULL").
 					WillReturnError(sql.ErrConnDone)
 			},
 			expectedProducts: nil,
@@ -56,7 +57,7 @@ func TestGetProducts(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			tt.mockQuery()
-			products, err := store.GetProducts()
+			products, err := store.GetProducts(types.ProductQuery{})
 			assert.Equal(t, tt.expectedErr, err)
 			for i, product := range products {
 				assert.Equal(t, tt.expectedProducts[i].ID, product.ID)
@@ -70,6 +71,152 @@ func TestGetProducts(t *testing.T) {
 	}
 }
 
+func TestGetProductsQuery(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	store := NewProductStore(db, &config.Config{})
+	minPrice, maxPrice := 5.0, 50.0
+	createdAt := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		query         types.ProductQuery
+		expectedQuery string
+		expectedArgs  []driver.Value
+	}{
+		{
+			name:          "Default order with offset",
+			query:         types.ProductQuery{Limit: 21, Offset: 40},
+			expectedQuery: "SELECT id, name, description, image, price, quantity, createdAt, version FROM products WHERE deletedAt IS NULL ORDER BY id ASC LIMIT \\$1 OFFSET \\$2",
+			expectedArgs:  []driver.Value{21, 40},
+		},
+		{
+			name:          "Filters",
+			query:         types.ProductQuery{Limit: 11, MinPrice: &minPrice, MaxPrice: &maxPrice, InStock: true, NamePrefix: "50%_off"},
+			expectedQuery: "SELECT (.+) FROM products WHERE deletedAt IS NULL AND price >= \\$1 AND price <= \\$2 AND quantity > 0 AND name ILIKE \\$3 ORDER BY id ASC LIMIT \\$4",
+			expectedArgs:  []driver.Value{5.0, 50.0, `50\%\_off%`, 11},
+		},
+		{
+			name:          "Cursor on price descending ignores offset",
+			query:         types.ProductQuery{Limit: 11, Offset: 40, Sort: types.ProductSortPrice, Descending: true, Cursor: &types.ProductCursor{ID: 7, Price: 19.99}},
+			expectedQuery: "SELECT (.+) FROM products WHERE deletedAt IS NULL AND \\(price, id\\) < \\(\\$1, \\$2\\) ORDER BY price DESC, id DESC LIMIT \\$3$",
+			expectedArgs:  []driver.Value{19.99, 7, 11},
+		},
+		{
+			name:          "Cursor on createdAt",
+			query:         types.ProductQuery{Limit: 11, Sort: types.ProductSortCreatedAt, Cursor: &types.ProductCursor{ID: 7, CreatedAt: createdAt}},
+			expectedQuery: "SELECT (.+) FROM products WHERE deletedAt IS NULL AND \\(createdAt, id\\) > \\(\\$1, \\$2\\) ORDER BY createdAt ASC, id ASC LIMIT \\$3",
+			expectedArgs:  []driver.Value{createdAt, 7, 11},
+		},
+		{
+			name:          "Cursor on default order",
+			query:         types.ProductQuery{Limit: 11, Cursor: &types.ProductCursor{ID: 7}},
+			expectedQuery: "SELECT (.+) FROM products WHERE deletedAt IS NULL AND id > \\$1 ORDER BY id ASC LIMIT \\$2",
+			expectedArgs:  []driver.Value{7, 11},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock.ExpectQuery(tt.expectedQuery).
+				WithArgs(tt.expectedArgs...).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "name", "description", "image", "price", "quantity", "createdAt", "version"}))
+
+			products, err := store.GetProducts(tt.query)
+			assert.NoError(t, err)
+			assert.Empty(t, products)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestSearchProducts(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	store := NewProductStore(db, &config.Config{})
+	createdAt := time.Now()
+
+	tests := []struct {
+		name            string
+		query           string
+		mockQuery       func()
+		expectedResults []types.ProductSearchResult
+		expectedErr     error
+	}{
+		{
+			name:  "Ranked prefix matches",
+			query: "Wireless head-",
+			mockQuery: func() {
+				rows := sqlmock.NewRows([]string{"id", "name", "description", "image", "price", "quantity", "createdAt", "version", "rank", "snippet"}).
+					AddRow(4, "Wireless Headphones", "Over-ear headphones", "h.jpg", 99.0, 5, createdAt, 3, 0.9, "Over-ear \x02headphones\x03")
+				mock.ExpectQuery("SELECT (.+) ts_rank\\(p.searchVector, q.query\\) AS rank, ts_headline\\('english', p.description, q.query, \\$4\\) AS snippet FROM products p, to_tsquery\\('english', \\$1\\) AS q\\(query\\) WHERE p.searchVector @@ q.query AND p.deletedAt IS NULL ORDER BY rank DESC, p.id LIMIT \\$2 OFFSET \\$3").
+					WithArgs("wireless:* & head:*", 20, 0, headlineOptions).
+					WillReturnRows(rows)
+			},
+			expectedResults: []types.ProductSearchResult{
+				{
+					Product: types.Product{ID: 4, Name: "Wireless Headphones", Description: "Over-ear headphones", Image: "h.jpg", Price: 99.0, Quantity: 5, CreatedAt: createdAt, Version: 3},
+					Rank:    0.9,
+					Snippet: "Over-ear <mark>headphones</mark>",
+				},
+			},
+		},
+		{
+			name:  "Description markup is escaped",
+			query: "lamp",
+			mockQuery: func() {
+				rows := sqlmock.NewRows([]string{"id", "name", "description", "image", "price", "quantity", "createdAt", "version", "rank", "snippet"}).
+					AddRow(5, "Lamp", "<script>x</script> lamp", "l.jpg", 20.0, 1, createdAt, 1, 0.5, "<script>x</script> \x02lamp\x03")
+				mock.ExpectQuery("SELECT (.+) FROM products p").
+					WithArgs("lamp:*", 20, 0, headlineOptions).
+					WillReturnRows(rows)
+			},
+			expectedResults: []types.ProductSearchResult{
+				{
+					Product: types.Product{ID: 5, Name: "Lamp", Description: "<script>x</script> lamp", Image: "l.jpg", Price: 20.0, Quantity: 1, CreatedAt: createdAt, Version: 1},
+					Rank:    0.5,
+					Snippet: "&lt;script&gt;x&lt;/script&gt; <mark>lamp</mark>",
+				},
+			},
+		},
+		{
+			name:            "Only punctuation",
+			query:           "&|!:*",
+			mockQuery:       func() {},
+			expectedResults: []types.ProductSearchResult{},
+		},
+		{
+			name:  "Database error",
+			query: "lamp",
+			mockQuery: func() {
+				mock.ExpectQuery("SELECT (.+) FROM products p").
+					WithArgs("lamp:*", 20, 0, headlineOptions).
+					WillReturnError(sql.ErrConnDone)
+			},
+			expectedErr: sql.ErrConnDone,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockQuery()
+
+			results, err := store.SearchProducts(tt.query, 20, 0)
+			assert.Equal(t, tt.expectedErr, err)
+			assert.Equal(t, tt.expectedResults, results)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
 func TestGetProductByID(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	if err != nil {
@@ -91,9 +238,9 @@ func TestGetProductByID(t *testing.T) {
 			name: "Product found",
 			id:   1,
 			mockQuery: func() {
-				rows := sqlmock.NewRows([]string{"id", "name", "description", "image", "price", "quantity", "createdAt"}).
-					AddRow(1, "Product 1", "Description 1", "image1.jpg", 10.5, 100, time.Now())
-				mock.ExpectQuery("SELECT \\* FROM products WHERE id = \\$1").
+				rows := sqlmock.NewRows([]string{"id", "name", "description", "image", "price", "quantity", "createdAt", "version"}).
+					AddRow(1, "Product 1", "Description 1", "image1.jpg", 10.5, 100, time.Now(), 1)
+				mock.ExpectQuery("SELECT id, name, description, image, price, quantity, createdAt, version FROM products WHERE id = \\$1 AND deletedAt IS NULL").
 					WithArgs(1).
 					WillReturnRows(rows)
 			},
@@ -104,7 +251,7 @@ func TestGetProductByID(t *testing.T) {
 			name: "Product not found",
 			id:   1,
 			mockQuery: func() {
-				mock.ExpectQuery("SELECT \\* FROM products WHERE id = \\$1").
+				mock.ExpectQuery("SELECT id, name, description, image, price, quantity, createdAt, version FROM products WHERE id = \\$1 AND deletedAt IS NULL").
 					WithArgs(1).
 					WillReturnError(sql.ErrNoRows)
 			},
@@ -115,7 +262,7 @@ func TestGetProductByID(t *testing.T) {
 			name: "Database error",
 			id:   1,
 			mockQuery: func() {
-				mock.ExpectQuery("SELECT \\* FROM products WHERE id = \\$1").
+				mock.ExpectQuery("SELECT id, name, description, image, price, quantity, createdAt, version FROM products WHERE id = \\$1 AND deletedAt IS NULL").
 					WithArgs(1).
 					WillReturnError(sql.ErrConnDone)
 			},
@@ -204,6 +351,122 @@ func TestCreateProduct(t *testing.T) {
 	}
 }
 
+func TestUpdateProduct(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	store := NewProductStore(db, &config.Config{})
+	product := types.Product{ID: 1, Name: "Lamp", Description: "Desk lamp", Image: "lamp.jpg", Price: 25, Quantity: 4}
+	columns := []string{"id", "name", "description", "image", "price", "quantity", "createdAt", "version"}
+	updateQuery := "UPDATE products SET name = \\$1, description = \\$2, image = \\$3, price = \\$4, quantity = \\$5, version = version \\+ 1 WHERE id = \\$6 AND deletedAt IS NULL AND \\(\\$7 = 0 OR version = \\$7\\) RETURNING (.+)"
+
+	tests := []struct {
+		name            string
+		mockQuery       func()
+		expectedVersion int
+		expectedErr     error
+	}{
+		{
+			name: "Matching version",
+			mockQuery: func() {
+				mock.ExpectQuery(updateQuery).
+					WithArgs("Lamp", "Desk lamp", "lamp.jpg", 25.0, 4, 1, 2).
+					WillReturnRows(sqlmock.NewRows(columns).AddRow(1, "Lamp", "Desk lamp", "lamp.jpg", 25.0, 4, time.Now(), 3))
+			},
+			expectedVersion: 3,
+		},
+		{
+			name: "Stale version",
+			mockQuery: func() {
+				mock.ExpectQuery(updateQuery).
+					WithArgs("Lamp", "Desk lamp", "lamp.jpg", 25.0, 4, 1, 2).
+					WillReturnError(sql.ErrNoRows)
+				mock.ExpectQuery("SELECT (.+) FROM products WHERE id = \\$1 AND deletedAt IS NULL").
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows(columns).AddRow(1, "Lamp", "Desk lamp", "lamp.jpg", 25.0, 4, time.Now(), 5))
+			},
+			expectedErr: ErrVersionConflict,
+		},
+		{
+			name: "Deleted product",
+			mockQuery: func() {
+				mock.ExpectQuery(updateQuery).
+					WithArgs("Lamp", "Desk lamp", "lamp.jpg", 25.0, 4, 1, 2).
+					WillReturnError(sql.ErrNoRows)
+				mock.ExpectQuery("SELECT (.+) FROM products WHERE id = \\$1 AND deletedAt IS NULL").
+					WithArgs(1).
+					WillReturnError(sql.ErrNoRows)
+			},
+			expectedErr: sql.ErrNoRows,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockQuery()
+
+			updated, err := store.UpdateProduct(product, 2)
+			assert.Equal(t, tt.expectedErr, err)
+			if tt.expectedErr == nil {
+				assert.Equal(t, tt.expectedVersion, updated.Version)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestDeleteProduct(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	store := NewProductStore(db, &config.Config{})
+	deleteQuery := "UPDATE products SET deletedAt = CURRENT_TIMESTAMP, version = version \\+ 1 WHERE id = \\$1 AND deletedAt IS NULL AND \\(\\$2 = 0 OR version = \\$2\\)"
+
+	tests := []struct {
+		name        string
+		mockQuery   func()
+		expectedErr error
+	}{
+		{
+			name: "Soft deleted",
+			mockQuery: func() {
+				mock.ExpectExec(deleteQuery).
+					WithArgs(1, 2).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			name: "Stale version",
+			mockQuery: func() {
+				mock.ExpectExec(deleteQuery).
+					WithArgs(1, 2).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery("SELECT (.+) FROM products WHERE id = \\$1 AND deletedAt IS NULL").
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "name", "description", "image", "price", "quantity", "createdAt", "version"}).
+						AddRow(1, "Lamp", "Desk lamp", "lamp.jpg", 25.0, 4, time.Now(), 3))
+			},
+			expectedErr: ErrVersionConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockQuery()
+
+			err := store.DeleteProduct(1, 2)
+			assert.Equal(t, tt.expectedErr, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
 func TestUpdateProductQuantityWithTransaction(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	if err != nil {
@@ -231,7 +494,7 @@ func TestUpdateProductQuantityWithTransaction(t *testing.T) {
 				mock.ExpectQuery("SELECT quantity FROM products WHERE id = \\$1 FOR UPDATE").
 					WithArgs(1).
 					WillReturnRows(sqlmock.NewRows([]string{"quantity"}).AddRow(20))
-				mock.ExpectExec("UPDATE products SET quantity = quantity - \\$1 WHERE id = \\$2").
+				mock.ExpectExec("UPDATE products SET quantity = quantity - \\$1, version = version \\+ 1 WHERE id = \\$2").
 					WithArgs(10, 1).
 					WillReturnResult(sqlmock.NewResult(1, 1))
 				mock.ExpectQuery("SELECT quantity FROM products WHERE id = \\$1").
@@ -267,7 +530,7 @@ func TestUpdateProductQuantityWithTransaction(t *testing.T) {
 				mock.ExpectQuery("SELECT quantity FROM products WHERE id = \\$1 FOR UPDATE").
 					WithArgs(1).
 					WillReturnRows(sqlmock.NewRows([]string{"quantity"}).AddRow(20))
-				mock.ExpectExec("UPDATE products SET quantity = quantity - \\$1 WHERE id = \\$2").
+				mock.ExpectExec("UPDATE products SET quantity = quantity - \\$1, version = version \\+ 1 WHERE id = \\$2").
 					WithArgs(10, 1).
 					WillReturnError(sql.ErrConnDone)
 				mock.ExpectRollback()
@@ -284,3 +547,30 @@ func TestUpdateProductQuantityWithTransaction(t *testing.T) {
 		})
 	}
 }
+
+func TestRestoreProductQuantityWithTransaction(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	cfg := &config.Config{}
+	store := NewProductStore(db, cfg)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT quantity FROM products WHERE id = \\$1 FOR UPDATE").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"quantity"}).AddRow(5))
+	mock.ExpectExec("UPDATE products SET quantity = quantity - \\$1, version = version \\+ 1 WHERE id = \\$2").
+		WithArgs(-3, 1).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery("SELECT quantity FROM products WHERE id = \\$1").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"quantity"}).AddRow(8))
+	mock.ExpectCommit()
+
+	err = store.RestoreProductQuantityWithTransaction(types.Product{ID: 1, Quantity: 3})
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,159 @@
+package revocation
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/loloDawit/ecom/types"
+)
+
+const (
+	// DefaultCacheSize bounds each of the token and user caches.
+	DefaultCacheSize = 10000
+
+	// CacheTTL is how long a lookup that found nothing revoked is trusted.
+	// Revocations made through another instance are seen within this window.
+	// Disabling a user works by revoking their tokens, so this is also how
+	// long a disabled user's access tokens may keep working elsewhere; there
+	// is no separate per-request status lookup.
+	CacheTTL = 30 * time.Second
+)
+
+// CachedStore puts an in-memory LRU cache in front of a revocation store so
+// that authenticating a request does not cost a query every time. Revoked
+// tokens stay cached until evicted, since a revocation is never undone.
+type CachedStore struct {
+	store  types.TokenRevocationStore
+	tokens *lru[string, bool]
+	users  *lru[int, time.Time]
+	now    func() time.Time
+}
+
+func NewCachedStore(store types.TokenRevocationStore, size int) *CachedStore {
+	return &CachedStore{
+		store:  store,
+		tokens: newLRU[string, bool](size),
+		users:  newLRU[int, time.Time](size),
+		now:    time.Now,
+	}
+}
+
+func (c *CachedStore) RevokeToken(tokenID string, userID int, expiresAt time.Time) error {
+	if err := c.store.RevokeToken(tokenID, userID, expiresAt); err != nil {
+		return err
+	}
+	c.tokens.add(tokenID, true, time.Time{})
+	return nil
+}
+
+func (c *CachedStore) IsTokenRevoked(tokenID string) (bool, error) {
+	now := c.now()
+	if revoked, ok := c.tokens.get(tokenID, now); ok {
+		return revoked, nil
+	}
+
+	revoked, err := c.store.IsTokenRevoked(tokenID)
+	if err != nil {
+		return false, err
+	}
+
+	expires := now.Add(CacheTTL)
+	if revoked {
+		expires = time.Time{}
+	}
+	c.tokens.add(tokenID, revoked, expires)
+	return revoked, nil
+}
+
+func (c *CachedStore) RevokeUserTokens(userID int, issuedBefore time.Time) error {
+	if err := c.store.RevokeUserTokens(userID, issuedBefore); err != nil {
+		return err
+	}
+	// the store may hold a later cutoff, so look it up again next time
+	c.users.remove(userID)
+	return nil
+}
+
+func (c *CachedStore) GetUserTokensRevokedBefore(userID int) (time.Time, error) {
+	now := c.now()
+	if revokedBefore, ok := c.users.get(userID, now); ok {
+		return revokedBefore, nil
+	}
+
+	revokedBefore, err := c.store.GetUserTokensRevokedBefore(userID)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	c.users.add(userID, revokedBefore, now.Add(CacheTTL))
+	return revokedBefore, nil
+}
+
+// lru is a fixed-size, least recently used cache whose entries may also
+// expire. A zero expiry never expires.
+type lru[K comparable, V any] struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[K]*list.Element
+}
+
+type lruEntry[K comparable, V any] struct {
+	key     K
+	value   V
+	expires time.Time
+}
+
+func newLRU[K comparable, V any](size int) *lru[K, V] {
+	return &lru[K, V]{size: size, order: list.New(), entries: make(map[K]*list.Element)}
+}
+
+func (c *lru[K, V]) get(key K, now time.Time) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var zero V
+	element, ok := c.entries[key]
+	if !ok {
+		return zero, false
+	}
+
+	entry := element.Value.(*lruEntry[K, V])
+	if !entry.expires.IsZero() && !now.Before(entry.expires) {
+		c.order.Remove(element)
+		delete(c.entries, key)
+		return zero, false
+	}
+
+	c.order.MoveToFront(element)
+	return entry.value, true
+}
+
+func (c *lru[K, V]) add(key K, value V, expires time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		element.Value = &lruEntry[K, V]{key: key, value: value, expires: expires}
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&lruEntry[K, V]{key: key, value: value, expires: expires})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry[K, V]).key)
+	}
+}
+
+func (c *lru[K, V]) remove(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.order.Remove(element)
+		delete(c.entries, key)
+	}
+}
@@ -0,0 +1,149 @@
+package revocation
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// countingStore records how often the cache falls through to it.
+type countingStore struct {
+	revoked       map[string]bool
+	revokedBefore map[int]time.Time
+	lookups       int
+	err           error
+}
+
+func newCountingStore() *countingStore {
+	return &countingStore{revoked: map[string]bool{}, revokedBefore: map[int]time.Time{}}
+}
+
+func (s *countingStore) RevokeToken(tokenID string, userID int, expiresAt time.Time) error {
+	s.revoked[tokenID] = true
+	return s.err
+}
+
+func (s *countingStore) IsTokenRevoked(tokenID string) (bool, error) {
+	s.lookups++
+	return s.revoked[tokenID], s.err
+}
+
+func (s *countingStore) RevokeUserTokens(userID int, issuedBefore time.Time) error {
+	s.revokedBefore[userID] = issuedBefore
+	return s.err
+}
+
+func (s *countingStore) GetUserTokensRevokedBefore(userID int) (time.Time, error) {
+	s.lookups++
+	return s.revokedBefore[userID], s.err
+}
+
+func TestCachedStoreTokens(t *testing.T) {
+	store := newCountingStore()
+	cache := NewCachedStore(store, 10)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	revoked, err := cache.IsTokenRevoked("a")
+	assert.NoError(t, err)
+	assert.False(t, revoked)
+	assert.Equal(t, 1, store.lookups)
+
+	// a miss is cached for CacheTTL
+	revoked, _ = cache.IsTokenRevoked("a")
+	assert.False(t, revoked)
+	assert.Equal(t, 1, store.lookups)
+
+	// revoking through the cache is seen straight away
+	assert.NoError(t, cache.RevokeToken("a", 1, now.Add(time.Minute)))
+	revoked, _ = cache.IsTokenRevoked("a")
+	assert.True(t, revoked)
+	assert.Equal(t, 1, store.lookups)
+
+	// revoking through another instance is seen once the miss expires
+	cache.IsTokenRevoked("b")
+	store.revoked["b"] = true
+	revoked, _ = cache.IsTokenRevoked("b")
+	assert.False(t, revoked)
+	now = now.Add(CacheTTL)
+	revoked, _ = cache.IsTokenRevoked("b")
+	assert.True(t, revoked)
+	assert.Equal(t, 3, store.lookups)
+}
+
+func TestCachedStoreUsers(t *testing.T) {
+	store := newCountingStore()
+	cache := NewCachedStore(store, 10)
+	cutoff := time.Now().Truncate(time.Second)
+
+	revokedBefore, err := cache.GetUserTokensRevokedBefore(7)
+	assert.NoError(t, err)
+	assert.True(t, revokedBefore.IsZero())
+
+	assert.NoError(t, cache.RevokeUserTokens(7, cutoff))
+	revokedBefore, _ = cache.GetUserTokensRevokedBefore(7)
+	assert.Equal(t, cutoff, revokedBefore)
+	revokedBefore, _ = cache.GetUserTokensRevokedBefore(7)
+	assert.Equal(t, cutoff, revokedBefore)
+	assert.Equal(t, 2, store.lookups)
+}
+
+func TestCachedStoreUserDisabledElsewhere(t *testing.T) {
+	store := newCountingStore()
+	cache := NewCachedStore(store, 10)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+	issuedAt := now.Add(-time.Minute)
+
+	revokedBefore, _ := cache.GetUserTokensRevokedBefore(7)
+	assert.False(t, issuedAt.Before(revokedBefore))
+
+	// another instance disables the user, which revokes their tokens; this
+	// one keeps accepting them until its cached cutoff expires
+	store.revokedBefore[7] = now
+	now = now.Add(CacheTTL - time.Second)
+	revokedBefore, _ = cache.GetUserTokensRevokedBefore(7)
+	assert.False(t, issuedAt.Before(revokedBefore))
+
+	now = now.Add(time.Second)
+	revokedBefore, _ = cache.GetUserTokensRevokedBefore(7)
+	assert.True(t, issuedAt.Before(revokedBefore))
+	assert.Equal(t, 2, store.lookups)
+}
+
+func TestCachedStoreErrors(t *testing.T) {
+	store := newCountingStore()
+	store.err = errors.New("connection refused")
+	cache := NewCachedStore(store, 10)
+
+	_, err := cache.IsTokenRevoked("a")
+	assert.Equal(t, store.err, err)
+	assert.Error(t, cache.RevokeToken("a", 1, time.Now()))
+
+	// errors are not cached
+	store.err = nil
+	revoked, err := cache.IsTokenRevoked("a")
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+}
+
+func TestLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := newLRU[string, int](2)
+	now := time.Now()
+
+	cache.add("a", 1, time.Time{})
+	cache.add("b", 2, time.Time{})
+	cache.get("a", now)
+	cache.add("c", 3, time.Time{})
+
+	_, ok := cache.get("b", now)
+	assert.False(t, ok)
+	value, ok := cache.get("a", now)
+	assert.True(t, ok)
+	assert.Equal(t, 1, value)
+	value, ok = cache.get("c", now)
+	assert.True(t, ok)
+	assert.Equal(t, 3, value)
+}
@@ -0,0 +1,51 @@
+package revocation
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/loloDawit/ecom/config"
+)
+
+type RevocationStore struct {
+	db  *sql.DB
+	cfg *config.Config
+}
+
+func NewRevocationStore(db *sql.DB, cfg *config.Config) *RevocationStore {
+	return &RevocationStore{db: db, cfg: cfg}
+}
+
+func (s *RevocationStore) RevokeToken(tokenID string, userID int, expiresAt time.Time) error {
+	_, err := s.db.Exec(
+		"INSERT INTO revoked_tokens (jti, userId, expiresAt) VALUES ($1, $2, $3) ON CONFLICT (jti) DO NOTHING",
+		tokenID, userID, expiresAt,
+	)
+	return err
+}
+
+func (s *RevocationStore) IsTokenRevoked(tokenID string) (bool, error) {
+	var revoked bool
+	err := s.db.QueryRow("SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1)", tokenID).Scan(&revoked)
+	return revoked, err
+}
+
+// RevokeUserTokens moves the user's cutoff forward; it never moves it back.
+func (s *RevocationStore) RevokeUserTokens(userID int, issuedBefore time.Time) error {
+	_, err := s.db.Exec(
+		`INSERT INTO user_token_revocations (userId, revokedBefore) VALUES ($1, $2)
+		ON CONFLICT (userId) DO UPDATE SET revokedBefore = GREATEST(user_token_revocations.revokedBefore, EXCLUDED.revokedBefore)`,
+		userID, issuedBefore,
+	)
+	return err
+}
+
+func (s *RevocationStore) GetUserTokensRevokedBefore(userID int) (time.Time, error) {
+	var revokedBefore time.Time
+	err := s.db.QueryRow("SELECT revokedBefore FROM user_token_revocations WHERE userId = $1", userID).Scan(&revokedBefore)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	return revokedBefore, err
+}
@@ -0,0 +1,116 @@
+package revocation
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/loloDawit/ecom/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRevokeToken(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	store := NewRevocationStore(db, &config.Config{})
+	expiresAt := time.Now().Add(time.Minute)
+
+	mock.ExpectExec("INSERT INTO revoked_tokens \\(jti, userId, expiresAt\\) VALUES \\(\\$1, \\$2, \\$3\\) ON CONFLICT \\(jti\\) DO NOTHING").
+		WithArgs("jti", 7, expiresAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	assert.NoError(t, store.RevokeToken("jti", 7, expiresAt))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestIsTokenRevoked(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	store := NewRevocationStore(db, &config.Config{})
+
+	tests := []struct {
+		name            string
+		mockQuery       func()
+		expectedRevoked bool
+		expectedErr     error
+	}{
+		{
+			name: "Revoked",
+			mockQuery: func() {
+				mock.ExpectQuery("SELECT EXISTS \\(SELECT 1 FROM revoked_tokens WHERE jti = \\$1\\)").
+					WithArgs("jti").
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+			},
+			expectedRevoked: true,
+		},
+		{
+			name: "Not revoked",
+			mockQuery: func() {
+				mock.ExpectQuery("SELECT EXISTS (.+)").
+					WithArgs("jti").
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+			},
+		},
+		{
+			name: "Database error",
+			mockQuery: func() {
+				mock.ExpectQuery("SELECT EXISTS (.+)").
+					WithArgs("jti").
+					WillReturnError(sql.ErrConnDone)
+			},
+			expectedErr: sql.ErrConnDone,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockQuery()
+
+			revoked, err := store.IsTokenRevoked("jti")
+			assert.Equal(t, tt.expectedErr, err)
+			assert.Equal(t, tt.expectedRevoked, revoked)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestUserTokensRevokedBefore(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	store := NewRevocationStore(db, &config.Config{})
+	cutoff := time.Now().Truncate(time.Second)
+
+	mock.ExpectExec("INSERT INTO user_token_revocations \\(userId, revokedBefore\\) VALUES \\(\\$1, \\$2\\) ON CONFLICT \\(userId\\) DO UPDATE SET revokedBefore = GREATEST(.+)").
+		WithArgs(7, cutoff).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(t, store.RevokeUserTokens(7, cutoff))
+
+	mock.ExpectQuery("SELECT revokedBefore FROM user_token_revocations WHERE userId = \\$1").
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"revokedBefore"}).AddRow(cutoff))
+	revokedBefore, err := store.GetUserTokensRevokedBefore(7)
+	assert.NoError(t, err)
+	assert.Equal(t, cutoff, revokedBefore)
+
+	mock.ExpectQuery("SELECT revokedBefore FROM user_token_revocations WHERE userId = \\$1").
+		WithArgs(8).
+		WillReturnError(sql.ErrNoRows)
+	revokedBefore, err = store.GetUserTokensRevokedBefore(8)
+	assert.NoError(t, err)
+	assert.True(t, revokedBefore.IsZero())
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
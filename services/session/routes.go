@@ -0,0 +1,107 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/loloDawit/ecom/config"
+	"github.com/loloDawit/ecom/services/auth"
+	"github.com/loloDawit/ecom/types"
+	"github.com/loloDawit/ecom/utils"
+	"gopkg.in/go-playground/validator.v9"
+)
+
+type Handler struct {
+	service *Service
+	auth    auth.Authenticator
+	cfg     *config.Config
+}
+
+func NewHandlers(service *Service, authenticator auth.Authenticator, cfg *config.Config) *Handler {
+	return &Handler{service: service, auth: authenticator, cfg: cfg}
+}
+
+func (h *Handler) RegisterRoutes(r *mux.Router) {
+	jwtMiddleware := auth.Middleware(h.auth)
+
+	r.HandleFunc("/token/refresh", h.refresh).Methods("POST")
+	r.HandleFunc("/logout", jwtMiddleware(h.logout)).Methods("POST")
+	r.HandleFunc("/logout/all", jwtMiddleware(h.logoutAll)).Methods("POST")
+}
+
+func (h *Handler) refresh(w http.ResponseWriter, r *http.Request) {
+	if r.Body == nil {
+		utils.WriteError(w, http.StatusBadRequest, utils.ErrInvalidRequestBody)
+		return
+	}
+
+	var payload types.RefreshTokenPayload
+	if err := utils.ReadJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, utils.ErrInvalidPayload)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Sprintf("%s: %v", utils.ErrInvalidPayload, validationErrors))
+		return
+	}
+
+	pair, err := h.service.Refresh(payload.RefreshToken)
+	if err != nil {
+		if errors.Is(err, ErrInvalidRefreshToken) {
+			utils.WriteError(w, http.StatusUnauthorized, utils.ErrInvalidRefreshToken)
+			return
+		}
+		log.Printf("error refreshing token: %v", err)
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrInternalServerError)
+		return
+	}
+
+	utils.WriteSecretJSON(w, http.StatusOK, pair)
+}
+
+func (h *Handler) logout(w http.ResponseWriter, r *http.Request) {
+	identity, err := auth.GetIdentityFromContext(r.Context())
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// the body is optional; send the refresh token to end that session too
+	var payload types.LogoutPayload
+	if r.Body != nil {
+		if err := utils.ReadJSON(r, &payload); err != nil && !errors.Is(err, io.EOF) {
+			utils.WriteError(w, http.StatusBadRequest, utils.ErrInvalidPayload)
+			return
+		}
+	}
+
+	if err := h.service.Logout(identity, payload.RefreshToken); err != nil {
+		log.Printf("error logging out user %d: %v", identity.UserID, err)
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) logoutAll(w http.ResponseWriter, r *http.Request) {
+	identity, err := auth.GetIdentityFromContext(r.Context())
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if err := h.service.LogoutAll(identity); err != nil {
+		log.Printf("error logging out all sessions of user %d: %v", identity.UserID, err)
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
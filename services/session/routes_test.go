@@ -0,0 +1,164 @@
+package session
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/loloDawit/ecom/services/auth"
+	"github.com/loloDawit/ecom/services/auth/authtest"
+	"github.com/loloDawit/ecom/types"
+	"github.com/loloDawit/ecom/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRefreshRoute(t *testing.T) {
+	store := &memoryStore{}
+	service := newTestService(store)
+	pair, _ := service.IssueTokens(&types.User{ID: 7})
+
+	handler := NewHandlers(service, authtest.Anonymous(), service.cfg)
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	refresh := func(body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodPost, "/token/refresh", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := refresh(`{"refreshToken": "` + pair.RefreshToken + `"}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "no-store", rr.Header().Get("Cache-Control"))
+
+	var next types.TokenPair
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &next))
+	assert.Equal(t, "access-7", next.Token)
+	assert.NotEqual(t, pair.RefreshToken, next.RefreshToken)
+
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expectedError  string
+	}{
+		{
+			name:           "Reused token",
+			body:           `{"refreshToken": "` + pair.RefreshToken + `"}`,
+			expectedStatus: http.StatusUnauthorized,
+			expectedError:  utils.ErrInvalidRefreshToken,
+		},
+		{
+			name:           "Successor of a reused token",
+			body:           `{"refreshToken": "` + next.RefreshToken + `"}`,
+			expectedStatus: http.StatusUnauthorized,
+			expectedError:  utils.ErrInvalidRefreshToken,
+		},
+		{
+			name:           "Missing token",
+			body:           `{}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Invalid JSON",
+			body:           `{"refreshToken":`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  utils.ErrInvalidPayload,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := refresh(tc.body)
+			assert.Equal(t, tc.expectedStatus, rr.Code)
+
+			if tc.expectedError != "" {
+				var body map[string]string
+				assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+				assert.Equal(t, tc.expectedError, body["error"])
+			}
+		})
+	}
+}
+
+func TestLogoutRoutes(t *testing.T) {
+	newRouter := func() (*mux.Router, *Service) {
+		service := newTestService(&memoryStore{})
+		service.generateToken = testKeys.GenerateToken
+		authenticator := auth.NewKeySetAuthenticator(testKeys).WithRevocationStore(service.revocations)
+
+		router := mux.NewRouter()
+		NewHandlers(service, authenticator, service.cfg).RegisterRoutes(router)
+		return router, service
+	}
+
+	post := func(router *mux.Router, path, token, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("Logout revokes the access and refresh token", func(t *testing.T) {
+		router, service := newRouter()
+		pair, _ := service.IssueTokens(&types.User{ID: 7})
+		other, _ := service.IssueTokens(&types.User{ID: 7})
+
+		rr := post(router, "/logout", pair.Token, `{"refreshToken": "`+pair.RefreshToken+`"}`)
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+
+		rr = post(router, "/logout", pair.Token, "")
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		assert.JSONEq(t, `{"error":"Token has been revoked"}`, rr.Body.String())
+
+		rr = post(router, "/token/refresh", "", `{"refreshToken": "`+pair.RefreshToken+`"}`)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+		// the other session is still alive
+		rr = post(router, "/logout", other.Token, "")
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+	})
+
+	t.Run("Logout without a body", func(t *testing.T) {
+		router, service := newRouter()
+		pair, _ := service.IssueTokens(&types.User{ID: 7})
+
+		rr := post(router, "/logout", pair.Token, "")
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+
+		rr = post(router, "/token/refresh", "", `{"refreshToken": "`+pair.RefreshToken+`"}`)
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("Logout all revokes every session", func(t *testing.T) {
+		router, service := newRouter()
+		first, _ := service.IssueTokens(&types.User{ID: 7})
+		second, _ := service.IssueTokens(&types.User{ID: 7})
+
+		rr := post(router, "/logout/all", first.Token, "")
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+
+		rr = post(router, "/logout", first.Token, "")
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		rr = post(router, "/token/refresh", "", `{"refreshToken": "`+second.RefreshToken+`"}`)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("Unauthenticated", func(t *testing.T) {
+		router, _ := newRouter()
+
+		rr := post(router, "/logout/all", "invalid", "")
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+}
@@ -0,0 +1,208 @@
+package session
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/loloDawit/ecom/config"
+	"github.com/loloDawit/ecom/services/auth"
+	"github.com/loloDawit/ecom/types"
+)
+
+// ErrInvalidRefreshToken is returned for refresh tokens that are unknown,
+// expired, revoked or reused. Callers get no hint as to which.
+var ErrInvalidRefreshToken = errors.New("invalid refresh token")
+
+// Service issues access/refresh token pairs, rotates refresh tokens and ends
+// sessions.
+type Service struct {
+	store         types.RefreshTokenStore
+	revocations   types.TokenRevocationStore
+	users         types.UserStore
+	cfg           *config.Config
+	generateToken func(int, types.Role, time.Duration) (string, error)
+	now           func() time.Time
+}
+
+func NewService(store types.RefreshTokenStore, revocations types.TokenRevocationStore, users types.UserStore, keys *auth.KeySet, cfg *config.Config) *Service {
+	return &Service{
+		store:         store,
+		revocations:   revocations,
+		users:         users,
+		cfg:           cfg,
+		generateToken: keys.GenerateToken,
+		now:           time.Now,
+	}
+}
+
+// IssueTokens starts a new refresh token family for the user.
+func (s *Service) IssueTokens(user *types.User) (*types.TokenPair, error) {
+	familyID, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, record, err := s.newRefreshToken(user.ID, familyID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.store.CreateRefreshToken(record); err != nil {
+		return nil, err
+	}
+
+	return s.pair(user, refreshToken)
+}
+
+// Refresh exchanges a refresh token for a new pair. The presented token is
+// rotated out; presenting it again revokes every token in its family, since
+// either the client or an attacker is holding a stolen copy.
+func (s *Service) Refresh(refreshToken string) (*types.TokenPair, error) {
+	current, err := s.store.GetRefreshTokenByHash(auth.HashOpaqueToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	if current.RevokedAt != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+	if current.RotatedAt != nil {
+		return nil, s.revokeFamily(current)
+	}
+	if !s.now().Before(current.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	// deleted and disabled users cannot keep their session going
+	user, err := s.users.GetUserByID(current.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user.DisabledAt != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	next, record, err := s.newRefreshToken(user.ID, current.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+
+	// the access token is minted before the rotation, so a refresh racing
+	// RevokeSessions either fails to rotate or gets a token issued before
+	// the cutoff
+	pair, err := s.pair(user, next)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.store.RotateRefreshToken(current.ID, record); err != nil {
+		if errors.Is(err, ErrTokenReused) {
+			return nil, s.revokeFamily(current)
+		}
+		return nil, err
+	}
+
+	return pair, nil
+}
+
+// Logout revokes the access token the caller authenticated with and, when
+// given, the refresh token family it was issued with. A refresh token that
+// belongs to someone else is ignored.
+func (s *Service) Logout(identity auth.Identity, refreshToken string) error {
+	if identity.TokenID != "" {
+		if err := s.revocations.RevokeToken(identity.TokenID, identity.UserID, identity.ExpiresAt); err != nil {
+			return err
+		}
+	}
+
+	if refreshToken == "" {
+		return nil
+	}
+
+	token, err := s.store.GetRefreshTokenByHash(auth.HashOpaqueToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+	if token.UserID != identity.UserID {
+		return nil
+	}
+
+	return s.store.RevokeRefreshTokenFamily(token.FamilyID)
+}
+
+// LogoutAll ends every session of the user, including the caller's own.
+func (s *Service) LogoutAll(identity auth.Identity) error {
+	if err := s.RevokeSessions(identity.UserID); err != nil {
+		return err
+	}
+
+	// the cutoff can miss a token issued within the same microsecond, so
+	// the caller's own token is also revoked by its jti
+	if identity.TokenID != "" {
+		return s.revocations.RevokeToken(identity.TokenID, identity.UserID, identity.ExpiresAt)
+	}
+
+	return nil
+}
+
+// RevokeSessions revokes all refresh tokens of the user and every access
+// token issued before now, to the microsecond, which is as precise as both
+// iat and the stored cutoff get. Tokens issued afterwards, such as the pair
+// a password change hands back, stay valid.
+func (s *Service) RevokeSessions(userID int) error {
+	if err := s.store.RevokeUserRefreshTokens(userID); err != nil {
+		return err
+	}
+	return s.revocations.RevokeUserTokens(userID, s.now().Truncate(time.Microsecond))
+}
+
+func (s *Service) revokeFamily(token *types.RefreshToken) error {
+	log.Printf("refresh token %d reused, revoking family %s of user %d", token.ID, token.FamilyID, token.UserID)
+	if err := s.store.RevokeRefreshTokenFamily(token.FamilyID); err != nil {
+		return err
+	}
+	return ErrInvalidRefreshToken
+}
+
+func (s *Service) newRefreshToken(userID int, familyID string) (string, types.RefreshToken, error) {
+	token, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return "", types.RefreshToken{}, err
+	}
+
+	return token, types.RefreshToken{
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: auth.HashOpaqueToken(token),
+		ExpiresAt: s.now().Add(time.Second * time.Duration(s.cfg.JWT.RefreshExpiration)),
+	}, nil
+}
+
+func (s *Service) pair(user *types.User, refreshToken string) (*types.TokenPair, error) {
+	expiration := time.Second * time.Duration(s.cfg.JWT.Expiration)
+	token, err := s.generateToken(user.ID, user.Role, expiration)
+	if err != nil {
+		return nil, err
+	}
+
+	return &types.TokenPair{Token: token, RefreshToken: refreshToken, ExpiresIn: s.cfg.JWT.Expiration}, nil
+}
+
+func randomHex(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,313 @@
+package session
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/loloDawit/ecom/config"
+	"github.com/loloDawit/ecom/services/auth"
+	"github.com/loloDawit/ecom/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryStore is an in-memory RefreshTokenStore with the same rotation rules
+// as the Postgres store.
+type memoryStore struct {
+	tokens []*types.RefreshToken
+}
+
+func (m *memoryStore) CreateRefreshToken(token types.RefreshToken) error {
+	token.ID = len(m.tokens) + 1
+	m.tokens = append(m.tokens, &token)
+	return nil
+}
+
+func (m *memoryStore) GetRefreshTokenByHash(hash string) (*types.RefreshToken, error) {
+	for _, token := range m.tokens {
+		if token.TokenHash == hash {
+			copied := *token
+			return &copied, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *memoryStore) RotateRefreshToken(id int, next types.RefreshToken) error {
+	token := m.tokens[id-1]
+	if token.RotatedAt != nil || token.RevokedAt != nil {
+		return ErrTokenReused
+	}
+	now := time.Now()
+	token.RotatedAt = &now
+	return m.CreateRefreshToken(next)
+}
+
+func (m *memoryStore) RevokeRefreshTokenFamily(familyID string) error {
+	now := time.Now()
+	for _, token := range m.tokens {
+		if token.FamilyID == familyID && token.RevokedAt == nil {
+			token.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func (m *memoryStore) RevokeUserRefreshTokens(userID int) error {
+	now := time.Now()
+	for _, token := range m.tokens {
+		if token.UserID == userID && token.RevokedAt == nil {
+			token.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+type memoryRevocations struct {
+	tokens map[string]bool
+	users  map[int]time.Time
+}
+
+func newMemoryRevocations() *memoryRevocations {
+	return &memoryRevocations{tokens: map[string]bool{}, users: map[int]time.Time{}}
+}
+
+func (m *memoryRevocations) RevokeToken(tokenID string, userID int, expiresAt time.Time) error {
+	m.tokens[tokenID] = true
+	return nil
+}
+
+func (m *memoryRevocations) IsTokenRevoked(tokenID string) (bool, error) {
+	return m.tokens[tokenID], nil
+}
+
+func (m *memoryRevocations) RevokeUserTokens(userID int, issuedBefore time.Time) error {
+	m.users[userID] = issuedBefore
+	return nil
+}
+
+func (m *memoryRevocations) GetUserTokensRevokedBefore(userID int) (time.Time, error) {
+	return m.users[userID], nil
+}
+
+// mockUserStore finds every user except the deleted ones.
+type mockUserStore struct {
+	disabled map[int]bool
+	deleted  map[int]bool
+}
+
+func (m *mockUserStore) GetUserByEmail(email string) (*types.User, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (m *mockUserStore) CreateUser(user types.User) error {
+	return nil
+}
+
+func (m *mockUserStore) GetUserByID(id int) (*types.User, error) {
+	if m.deleted[id] {
+		return nil, sql.ErrNoRows
+	}
+	user := &types.User{ID: id, Role: types.RoleCustomer}
+	if m.disabled[id] {
+		disabledAt := time.Now()
+		user.DisabledAt = &disabledAt
+	}
+	return user, nil
+}
+
+func (m *mockUserStore) UpdateUser(user types.User) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdatePassword(userID int, passwordHash string) error {
+	return nil
+}
+
+func (m *mockUserStore) DeleteUser(userID int, now time.Time) error {
+	return nil
+}
+
+func (m *mockUserStore) GetUsers(query types.UserQuery) ([]types.User, error) {
+	return nil, nil
+}
+
+func (m *mockUserStore) SetUserDisabled(userID int, disabledAt *time.Time) error {
+	return nil
+}
+
+func (m *mockUserStore) UpdateUserRole(userID int, role types.Role) error {
+	return nil
+}
+
+var testKeys = auth.NewHMACKeySet([]byte("secret"))
+
+func newTestService(store types.RefreshTokenStore) *Service {
+	service := NewService(store, newMemoryRevocations(), &mockUserStore{}, testKeys, &config.Config{
+		JWT: config.JWTConfig{Expiration: 60, RefreshExpiration: 3600},
+	})
+	service.generateToken = func(userID int, role types.Role, expiration time.Duration) (string, error) {
+		return fmt.Sprintf("access-%d", userID), nil
+	}
+	return service
+}
+
+func TestIssueTokens(t *testing.T) {
+	store := &memoryStore{}
+	service := newTestService(store)
+
+	pair, err := service.IssueTokens(&types.User{ID: 7})
+	assert.NoError(t, err)
+	assert.Equal(t, "access-7", pair.Token)
+	assert.Equal(t, int64(60), pair.ExpiresIn)
+	assert.NotEmpty(t, pair.RefreshToken)
+
+	// only the hash of the refresh token is stored
+	assert.Len(t, store.tokens, 1)
+	assert.Equal(t, auth.HashOpaqueToken(pair.RefreshToken), store.tokens[0].TokenHash)
+	assert.NotEqual(t, pair.RefreshToken, store.tokens[0].TokenHash)
+	assert.Equal(t, 7, store.tokens[0].UserID)
+}
+
+func TestRefresh(t *testing.T) {
+	t.Run("Rotates the refresh token", func(t *testing.T) {
+		store := &memoryStore{}
+		service := newTestService(store)
+		first, _ := service.IssueTokens(&types.User{ID: 7})
+
+		second, err := service.Refresh(first.RefreshToken)
+		assert.NoError(t, err)
+		assert.Equal(t, "access-7", second.Token)
+		assert.NotEqual(t, first.RefreshToken, second.RefreshToken)
+		assert.Equal(t, store.tokens[0].FamilyID, store.tokens[1].FamilyID)
+
+		third, err := service.Refresh(second.RefreshToken)
+		assert.NoError(t, err)
+		assert.NotEqual(t, second.RefreshToken, third.RefreshToken)
+	})
+
+	t.Run("Reuse revokes the family", func(t *testing.T) {
+		store := &memoryStore{}
+		service := newTestService(store)
+		first, _ := service.IssueTokens(&types.User{ID: 7})
+		other, _ := service.IssueTokens(&types.User{ID: 7})
+		second, _ := service.Refresh(first.RefreshToken)
+
+		_, err := service.Refresh(first.RefreshToken)
+		assert.Equal(t, ErrInvalidRefreshToken, err)
+
+		// the legitimate successor is gone too, other logins are untouched
+		_, err = service.Refresh(second.RefreshToken)
+		assert.Equal(t, ErrInvalidRefreshToken, err)
+		_, err = service.Refresh(other.RefreshToken)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Expired token", func(t *testing.T) {
+		store := &memoryStore{}
+		service := newTestService(store)
+		first, _ := service.IssueTokens(&types.User{ID: 7})
+
+		service.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+		_, err := service.Refresh(first.RefreshToken)
+		assert.Equal(t, ErrInvalidRefreshToken, err)
+	})
+
+	t.Run("Unknown token", func(t *testing.T) {
+		service := newTestService(&memoryStore{})
+
+		_, err := service.Refresh("unknown")
+		assert.Equal(t, ErrInvalidRefreshToken, err)
+	})
+
+	t.Run("Disabled or deleted user", func(t *testing.T) {
+		service := newTestService(&memoryStore{})
+		service.users = &mockUserStore{disabled: map[int]bool{7: true}, deleted: map[int]bool{8: true}}
+		disabled, _ := service.IssueTokens(&types.User{ID: 7})
+		deleted, _ := service.IssueTokens(&types.User{ID: 8})
+
+		_, err := service.Refresh(disabled.RefreshToken)
+		assert.Equal(t, ErrInvalidRefreshToken, err)
+		_, err = service.Refresh(deleted.RefreshToken)
+		assert.Equal(t, ErrInvalidRefreshToken, err)
+	})
+}
+
+func TestLogout(t *testing.T) {
+	t.Run("Revokes the access token and refresh token family", func(t *testing.T) {
+		store := &memoryStore{}
+		service := newTestService(store)
+		revocations := service.revocations.(*memoryRevocations)
+		pair, _ := service.IssueTokens(&types.User{ID: 7})
+		other, _ := service.IssueTokens(&types.User{ID: 7})
+
+		err := service.Logout(auth.Identity{UserID: 7, TokenID: "jti"}, pair.RefreshToken)
+		assert.NoError(t, err)
+		assert.True(t, revocations.tokens["jti"])
+
+		_, err = service.Refresh(pair.RefreshToken)
+		assert.Equal(t, ErrInvalidRefreshToken, err)
+		_, err = service.Refresh(other.RefreshToken)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Ignores another user's refresh token", func(t *testing.T) {
+		store := &memoryStore{}
+		service := newTestService(store)
+		pair, _ := service.IssueTokens(&types.User{ID: 8})
+
+		err := service.Logout(auth.Identity{UserID: 7, TokenID: "jti"}, pair.RefreshToken)
+		assert.NoError(t, err)
+
+		_, err = service.Refresh(pair.RefreshToken)
+		assert.NoError(t, err)
+	})
+}
+
+func TestLogoutAll(t *testing.T) {
+	store := &memoryStore{}
+	service := newTestService(store)
+	revocations := service.revocations.(*memoryRevocations)
+	now := time.Date(2026, 10, 17, 12, 0, 0, int(500*time.Millisecond), time.UTC)
+	service.now = func() time.Time { return now }
+
+	first, _ := service.IssueTokens(&types.User{ID: 7})
+	second, _ := service.IssueTokens(&types.User{ID: 7})
+
+	err := service.LogoutAll(auth.Identity{UserID: 7, TokenID: "jti"})
+	assert.NoError(t, err)
+	assert.True(t, revocations.tokens["jti"])
+	assert.Equal(t, now, revocations.users[7])
+
+	for _, pair := range []*types.TokenPair{first, second} {
+		_, err = service.Refresh(pair.RefreshToken)
+		assert.Equal(t, ErrInvalidRefreshToken, err)
+	}
+}
+
+func TestRevokeSessionsWithinTheSameSecond(t *testing.T) {
+	service := newTestService(&memoryStore{})
+	revocations := service.revocations.(*memoryRevocations)
+	authenticator := auth.NewKeySetAuthenticator(testKeys).WithRevocationStore(revocations)
+	authenticate := func(token string) error {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		_, err := authenticator.Authenticate(req)
+		return err
+	}
+
+	// a token issued a moment before the reset, as an attacker refreshing
+	// right then would hold, must not survive it
+	before, err := testKeys.GenerateToken(7, types.RoleCustomer, time.Minute)
+	assert.NoError(t, err)
+	time.Sleep(time.Millisecond)
+	assert.NoError(t, service.RevokeSessions(7))
+	time.Sleep(time.Millisecond)
+	after, err := testKeys.GenerateToken(7, types.RoleCustomer, time.Minute)
+	assert.NoError(t, err)
+
+	assert.Error(t, authenticate(before))
+	assert.NoError(t, authenticate(after))
+}
@@ -0,0 +1,87 @@
+package session
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/loloDawit/ecom/config"
+	"github.com/loloDawit/ecom/db"
+	"github.com/loloDawit/ecom/types"
+)
+
+// ErrTokenReused is returned when a refresh token that was already rotated or
+// revoked is presented for rotation again.
+var ErrTokenReused = errors.New("refresh token already used")
+
+const refreshTokenColumns = "id, userId, familyId, tokenHash, expiresAt, rotatedAt, revokedAt, createdAt"
+
+type RefreshTokenStore struct {
+	db  *sql.DB
+	cfg *config.Config
+}
+
+func NewRefreshTokenStore(db *sql.DB, cfg *config.Config) *RefreshTokenStore {
+	return &RefreshTokenStore{db: db, cfg: cfg}
+}
+
+func (s *RefreshTokenStore) CreateRefreshToken(token types.RefreshToken) error {
+	return createRefreshToken(s.db, token)
+}
+
+func (s *RefreshTokenStore) GetRefreshTokenByHash(hash string) (*types.RefreshToken, error) {
+	row := s.db.QueryRow("SELECT "+refreshTokenColumns+" FROM refresh_tokens WHERE tokenHash = $1", hash)
+
+	token := new(types.RefreshToken)
+	var rotatedAt, revokedAt sql.NullTime
+	err := row.Scan(&token.ID, &token.UserID, &token.FamilyID, &token.TokenHash, &token.ExpiresAt, &rotatedAt, &revokedAt, &token.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if rotatedAt.Valid {
+		token.RotatedAt = &rotatedAt.Time
+	}
+	if revokedAt.Valid {
+		token.RevokedAt = &revokedAt.Time
+	}
+
+	return token, nil
+}
+
+// RotateRefreshToken retires the token and inserts its successor in one
+// transaction. The update only matches a live token, so of two concurrent
+// rotations only one can win; the other gets ErrTokenReused.
+func (s *RefreshTokenStore) RotateRefreshToken(id int, next types.RefreshToken) error {
+	return db.WithTransaction(s.db, func(tx *sql.Tx) error {
+		result, err := tx.Exec("UPDATE refresh_tokens SET rotatedAt = CURRENT_TIMESTAMP WHERE id = $1 AND rotatedAt IS NULL AND revokedAt IS NULL", id)
+		if err != nil {
+			return err
+		}
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return ErrTokenReused
+		}
+
+		return createRefreshToken(tx, next)
+	})
+}
+
+func (s *RefreshTokenStore) RevokeRefreshTokenFamily(familyID string) error {
+	_, err := s.db.Exec("UPDATE refresh_tokens SET revokedAt = CURRENT_TIMESTAMP WHERE familyId = $1 AND revokedAt IS NULL", familyID)
+	return err
+}
+
+func (s *RefreshTokenStore) RevokeUserRefreshTokens(userID int) error {
+	_, err := s.db.Exec("UPDATE refresh_tokens SET revokedAt = CURRENT_TIMESTAMP WHERE userId = $1 AND revokedAt IS NULL", userID)
+	return err
+}
+
+func createRefreshToken(conn db.DBTX, token types.RefreshToken) error {
+	_, err := conn.Exec(
+		"INSERT INTO refresh_tokens (userId, familyId, tokenHash, expiresAt) VALUES ($1, $2, $3, $4)",
+		token.UserID, token.FamilyID, token.TokenHash, token.ExpiresAt,
+	)
+	return err
+}
@@ -0,0 +1,141 @@
+package session
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/loloDawit/ecom/config"
+	"github.com/loloDawit/ecom/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetRefreshTokenByHash(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	store := NewRefreshTokenStore(db, &config.Config{})
+	now := time.Now()
+
+	tests := []struct {
+		name          string
+		mockQuery     func()
+		expectedToken *types.RefreshToken
+		expectedErr   error
+	}{
+		{
+			name: "Live token",
+			mockQuery: func() {
+				mock.ExpectQuery("SELECT id, userId, familyId, tokenHash, expiresAt, rotatedAt, revokedAt, createdAt FROM refresh_tokens WHERE tokenHash = \\$1").
+					WithArgs("hash").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "userId", "familyId", "tokenHash", "expiresAt", "rotatedAt", "revokedAt", "createdAt"}).
+						AddRow(1, 2, "family", "hash", now, nil, nil, now))
+			},
+			expectedToken: &types.RefreshToken{ID: 1, UserID: 2, FamilyID: "family", TokenHash: "hash", ExpiresAt: now, CreatedAt: now},
+		},
+		{
+			name: "Rotated token",
+			mockQuery: func() {
+				mock.ExpectQuery("SELECT (.+) FROM refresh_tokens WHERE tokenHash = \\$1").
+					WithArgs("hash").
+					WillReturnRows(sqlmock.NewRows([]string{"id", "userId", "familyId", "tokenHash", "expiresAt", "rotatedAt", "revokedAt", "createdAt"}).
+						AddRow(1, 2, "family", "hash", now, now, nil, now))
+			},
+			expectedToken: &types.RefreshToken{ID: 1, UserID: 2, FamilyID: "family", TokenHash: "hash", ExpiresAt: now, RotatedAt: &now, CreatedAt: now},
+		},
+		{
+			name: "Unknown token",
+			mockQuery: func() {
+				mock.ExpectQuery("SELECT (.+) FROM refresh_tokens WHERE tokenHash = \\$1").
+					WithArgs("hash").
+					WillReturnError(sql.ErrNoRows)
+			},
+			expectedErr: sql.ErrNoRows,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockQuery()
+
+			token, err := store.GetRefreshTokenByHash("hash")
+			assert.Equal(t, tt.expectedErr, err)
+			assert.Equal(t, tt.expectedToken, token)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestRotateRefreshToken(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	store := NewRefreshTokenStore(db, &config.Config{})
+	expiresAt := time.Now().Add(time.Hour)
+	next := types.RefreshToken{UserID: 2, FamilyID: "family", TokenHash: "next", ExpiresAt: expiresAt}
+
+	tests := []struct {
+		name        string
+		mockQuery   func()
+		expectedErr error
+	}{
+		{
+			name: "Live token",
+			mockQuery: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec("UPDATE refresh_tokens SET rotatedAt = CURRENT_TIMESTAMP WHERE id = \\$1 AND rotatedAt IS NULL AND revokedAt IS NULL").
+					WithArgs(1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("INSERT INTO refresh_tokens \\(userId, familyId, tokenHash, expiresAt\\) VALUES \\(\\$1, \\$2, \\$3, \\$4\\)").
+					WithArgs(2, "family", "next", expiresAt).
+					WillReturnResult(sqlmock.NewResult(2, 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name: "Token already rotated",
+			mockQuery: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec("UPDATE refresh_tokens SET rotatedAt (.+)").
+					WithArgs(1).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+			},
+			expectedErr: ErrTokenReused,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockQuery()
+
+			err := store.RotateRefreshToken(1, next)
+			assert.Equal(t, tt.expectedErr, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestRevokeRefreshTokenFamily(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	store := NewRefreshTokenStore(db, &config.Config{})
+
+	mock.ExpectExec("UPDATE refresh_tokens SET revokedAt = CURRENT_TIMESTAMP WHERE familyId = \\$1 AND revokedAt IS NULL").
+		WithArgs("family").
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	assert.NoError(t, store.RevokeRefreshTokenFamily("family"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,53 @@
+package transaction
+
+import (
+	"database/sql"
+
+	"github.com/loloDawit/ecom/config"
+	"github.com/loloDawit/ecom/db"
+	"github.com/loloDawit/ecom/services/cart"
+	"github.com/loloDawit/ecom/services/order"
+	"github.com/loloDawit/ecom/services/product"
+	"github.com/loloDawit/ecom/types"
+)
+
+// Transactor hands out stores bound to a single database transaction so that
+// writes spanning several of them commit or roll back together.
+type Transactor struct {
+	db  *sql.DB
+	cfg *config.Config
+}
+
+func NewTransactor(db *sql.DB, cfg *config.Config) *Transactor {
+	return &Transactor{db: db, cfg: cfg}
+}
+
+// WithinTransaction runs fn in a new transaction, committing if it returns nil
+// and rolling back otherwise.
+func (t *Transactor) WithinTransaction(fn func(tx types.Transaction) error) error {
+	return db.WithTransaction(t.db, func(tx *sql.Tx) error {
+		return fn(&transaction{
+			products: product.NewProductStore(t.db, t.cfg).WithTx(tx),
+			orders:   order.NewOrderStore(t.db, t.cfg).WithTx(tx),
+			carts:    cart.NewCartStore(t.db, t.cfg).WithTx(tx),
+		})
+	})
+}
+
+type transaction struct {
+	products types.ProductStore
+	orders   types.OrderStore
+	carts    types.CartStore
+}
+
+func (t *transaction) Products() types.ProductStore {
+	return t.products
+}
+
+func (t *transaction) Orders() types.OrderStore {
+	return t.orders
+}
+
+func (t *transaction) Carts() types.CartStore {
+	return t.carts
+}
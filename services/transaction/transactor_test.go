@@ -0,0 +1,103 @@
+package transaction
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/loloDawit/ecom/config"
+	"github.com/loloDawit/ecom/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithinTransaction(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	transactor := NewTransactor(db, &config.Config{})
+
+	tests := []struct {
+		name        string
+		mockQuery   func()
+		fn          func(tx types.Transaction) error
+		expectedErr error
+	}{
+		{
+			name: "Commits when every step succeeds",
+			mockQuery: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT quantity FROM products WHERE id = \\$1 FOR UPDATE").
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"quantity"}).AddRow(5))
+				mock.ExpectExec("UPDATE products SET quantity = quantity - \\$1, version = version \\+ 1 WHERE id = \\$2 AND quantity >= \\$1").
+					WithArgs(2, 1).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery("SELECT quantity FROM products WHERE id = \\$1").
+					WithArgs(1).
+					WillReturnRows(sqlmock.NewRows([]string{"quantity"}).AddRow(3))
+				mock.ExpectQuery("INSERT INTO orders").
+					WithArgs(1, 20.0, "pending", "Seattle, WA").
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+				mock.ExpectExec("INSERT INTO order_items").
+					WithArgs(7, 1, 2, 10.0, 20.0, "Product 1", "image1.jpg").
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+			},
+			fn: func(tx types.Transaction) error {
+				if err := tx.Products().UpdateProductQuantityWithTransaction(types.Product{ID: 1, Quantity: 2}); err != nil {
+					return err
+				}
+				orderID, err := tx.Orders().CreateOrder(types.Order{UserID: 1, Total: 20, Status: "pending", Address: "Seattle, WA"})
+				if err != nil {
+					return err
+				}
+				return tx.Orders().CreateOrderItem(types.OrderItem{OrderID: orderID, ProductID: 1, Quantity: 2, Price: 10, Subtotal: 20, ProductName: "Product 1", ProductImage: "image1.jpg"})
+			},
+			expectedErr: nil,
+		},
+		{
+			name: "Rolls back when a later step fails",
+			mockQuery: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery("INSERT INTO orders").
+					WithArgs(1, 20.0, "pending", "Seattle, WA").
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+				mock.ExpectExec("INSERT INTO order_items").
+					WithArgs(7, 1, 2, 10.0, 20.0, "Product 1", "image1.jpg").
+					WillReturnError(sql.ErrConnDone)
+				mock.ExpectRollback()
+			},
+			fn: func(tx types.Transaction) error {
+				orderID, err := tx.Orders().CreateOrder(types.Order{UserID: 1, Total: 20, Status: "pending", Address: "Seattle, WA"})
+				if err != nil {
+					return err
+				}
+				return tx.Orders().CreateOrderItem(types.OrderItem{OrderID: orderID, ProductID: 1, Quantity: 2, Price: 10, Subtotal: 20, ProductName: "Product 1", ProductImage: "image1.jpg"})
+			},
+			expectedErr: sql.ErrConnDone,
+		},
+		{
+			name: "Begin error",
+			mockQuery: func() {
+				mock.ExpectBegin().WillReturnError(sql.ErrConnDone)
+			},
+			fn: func(tx types.Transaction) error {
+				t.Fatal("unit of work should not run when the transaction cannot begin")
+				return nil
+			},
+			expectedErr: sql.ErrConnDone,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockQuery()
+			err := transactor.WithinTransaction(tt.fn)
+			assert.Equal(t, tt.expectedErr, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
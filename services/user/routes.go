@@ -2,9 +2,12 @@ package user
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -18,23 +21,54 @@ import (
 type Handler struct {
 	store            types.UserStore
 	cfg              *config.Config
+	tokens           types.TokenIssuer
+	sessions         types.SessionRevoker
+	verifier         types.EmailVerifier
+	limiter          types.LoginLimiter
+	mfa              types.MFAChallenger
+	auth             auth.Authenticator
 	comparePasswords func(string, string) error
-	generateToken    func([]byte, int, time.Duration) (string, error)
+	now              func() time.Time
 }
 
-func NewHandlers(store types.UserStore, cfg *config.Config) *Handler {
+func NewHandlers(store types.UserStore, tokens types.TokenIssuer, sessions types.SessionRevoker, verifier types.EmailVerifier, limiter types.LoginLimiter, mfa types.MFAChallenger, authenticator auth.Authenticator, cfg *config.Config) *Handler {
 	return &Handler{
 		store:            store,
 		cfg:              cfg,
+		tokens:           tokens,
+		sessions:         sessions,
+		verifier:         verifier,
+		limiter:          limiter,
+		mfa:              mfa,
+		auth:             authenticator,
 		comparePasswords: auth.ComparePasswords,
-		generateToken:    auth.GenerateToken,
+		now:              time.Now,
 	}
 }
 
 func (h *Handler) RegisterRoutes(r *mux.Router) {
+	jwtMiddleware := auth.Middleware(h.auth)
+
 	r.HandleFunc("/signup", h.signUp).Methods("POST")
 	r.HandleFunc("/login", h.login).Methods("POST")
 
+	r.HandleFunc("/users/me", jwtMiddleware(h.getMe)).Methods("GET")
+	r.HandleFunc("/users/me", jwtMiddleware(h.patchMe)).Methods("PATCH")
+	r.HandleFunc("/users/me", jwtMiddleware(h.deleteMe)).Methods("DELETE")
+	r.HandleFunc("/users/me/password", jwtMiddleware(h.changePassword)).Methods("POST")
+}
+
+// ToResponse is the user as shown by the API, without the password hash.
+func ToResponse(user *types.User) types.UserResponse {
+	return types.UserResponse{
+		ID:              user.ID,
+		FirstName:       user.FirstName,
+		LastName:        user.LastName,
+		Email:           user.Email,
+		Role:            user.Role,
+		EmailVerifiedAt: user.EmailVerifiedAt,
+		DisabledAt:      user.DisabledAt,
+	}
 }
 
 func (h *Handler) signUp(w http.ResponseWriter, r *http.Request) {
@@ -85,9 +119,24 @@ func (h *Handler) signUp(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// the account exists either way; a lost email can be sent again
+	h.sendVerification(payload.Email)
+
 	utils.WriteJSON(w, http.StatusCreated, map[string]string{"message": utils.UserCreatedSuccessfully})
 }
 
+func (h *Handler) sendVerification(email string) {
+	user, err := h.store.GetUserByEmail(email)
+	if err != nil {
+		log.Printf("error getting new user for email verification: %v", err)
+		return
+	}
+
+	if err := h.verifier.SendVerification(user); err != nil {
+		log.Printf("error sending verification email to user %d: %v", user.ID, err)
+	}
+}
+
 func (h *Handler) login(w http.ResponseWriter, r *http.Request) {
 	if r.Body == nil {
 		utils.WriteError(w, http.StatusBadRequest, utils.ErrInvalidRequestBody)
@@ -109,32 +158,259 @@ func (h *Handler) login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// refuse attempts while the account or the client is locked out
+	ip := utils.ClientIP(r, h.cfg.TrustedProxies)
+	wait, err := h.limiter.LoginAllowed(payload.Email, ip)
+	if err != nil {
+		log.Printf("error checking login throttle: %v", err)
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrInternalServerError)
+		return
+	}
+	if wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		utils.WriteError(w, http.StatusTooManyRequests, utils.ErrTooManyLogins)
+		return
+	}
+
 	// get the user by email
 	user, err := h.store.GetUserByEmail(payload.Email)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("error getting user for login: %v", err)
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrInternalServerError)
+		return
+	}
+
+	// compare the password, against a dummy hash for unknown users so both
+	// failures take as long and look the same
+	hashedPassword := auth.DummyPasswordHash()
+	if user != nil {
+		hashedPassword = user.Password
+	}
+	if err := h.comparePasswords(hashedPassword, payload.Password); err != nil || user == nil {
+		if err := h.limiter.LoginFailed(payload.Email, ip); err != nil {
+			log.Printf("error recording failed login: %v", err)
+		}
+		utils.WriteError(w, http.StatusUnauthorized, utils.ErrInvalidCredentials)
+		return
+	}
+
+	// only someone who knows the password learns the account is disabled
+	if user.DisabledAt != nil {
+		utils.WriteError(w, http.StatusForbidden, utils.ErrAccountDisabled)
+		return
+	}
+
+	// users with two-factor authentication get a challenge to complete at
+	// /login/mfa instead of tokens; their failed logins are only forgotten
+	// once it is completed
+	challenge, err := h.mfa.Challenge(user)
+	if err != nil {
+		log.Printf("error creating mfa challenge for user %d: %v", user.ID, err)
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrInternalServerError)
+		return
+	}
+	if challenge != nil {
+		utils.WriteSecretJSON(w, http.StatusOK, challenge)
+		return
+	}
+
+	if err := h.limiter.LoginSucceeded(payload.Email); err != nil {
+		log.Printf("error clearing failed logins of user %d: %v", user.ID, err)
+	}
+
+	// issue an access token and start a refresh token family
+	pair, err := h.tokens.IssueTokens(user)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			utils.WriteError(w, http.StatusNotFound, utils.ErrUserNotFound)
+		log.Printf("error issuing tokens for user %d: %v", user.ID, err)
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrInternalServerError)
+		return
+	}
+
+	utils.WriteSecretJSON(w, http.StatusOK, pair)
+}
+
+func (h *Handler) getMe(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, ToResponse(user))
+}
+
+// patchMe changes only the fields present in the body. A new email has to
+// be verified again.
+func (h *Handler) patchMe(w http.ResponseWriter, r *http.Request) {
+	if r.Body == nil {
+		utils.WriteError(w, http.StatusBadRequest, utils.ErrInvalidRequestBody)
+		return
+	}
+
+	var payload types.PatchProfilePayload
+	if err := utils.ReadJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, utils.ErrInvalidPayload)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Sprintf("%s: %v", utils.ErrInvalidPayload, validationErrors))
+		return
+	}
+
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	if payload.FirstName != nil {
+		user.FirstName = *payload.FirstName
+	}
+	if payload.LastName != nil {
+		user.LastName = *payload.LastName
+	}
+	emailChanged := payload.Email != nil && *payload.Email != user.Email
+	if emailChanged {
+		if err := h.checkUserExists(*payload.Email); err != nil {
+			utils.WriteError(w, http.StatusBadRequest, err.Error())
 			return
 		}
+		user.Email = *payload.Email
+		user.EmailVerifiedAt = nil
+	}
+
+	if err := h.store.UpdateUser(*user); err != nil {
+		log.Printf("error updating user %d: %v", user.ID, err)
 		utils.WriteError(w, http.StatusInternalServerError, utils.ErrInternalServerError)
 		return
 	}
 
-	// compare the password
-	if err := h.comparePasswords(user.Password, payload.Password); err != nil {
-		utils.WriteError(w, http.StatusUnauthorized, utils.ErrUnauthorized)
+	if emailChanged {
+		if err := h.verifier.SendVerification(user); err != nil {
+			log.Printf("error sending verification email to user %d: %v", user.ID, err)
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, ToResponse(user))
+}
+
+// changePassword requires the current password and ends every session,
+// including the caller's, which gets a fresh token pair in the response.
+func (h *Handler) changePassword(w http.ResponseWriter, r *http.Request) {
+	if r.Body == nil {
+		utils.WriteError(w, http.StatusBadRequest, utils.ErrInvalidRequestBody)
 		return
 	}
 
-	// generate a token
-	expiration := time.Second * time.Duration(h.cfg.JWT.Expiration)
-	token, err := h.generateToken([]byte(h.cfg.JWT.Secret), user.ID, expiration)
+	var payload types.ChangePasswordPayload
+	if err := utils.ReadJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, utils.ErrInvalidPayload)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Sprintf("%s: %v", utils.ErrInvalidPayload, validationErrors))
+		return
+	}
+
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+	if err := h.comparePasswords(user.Password, payload.CurrentPassword); err != nil {
+		utils.WriteError(w, http.StatusForbidden, utils.ErrIncorrectPassword)
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(payload.NewPassword)
+	if err != nil {
+		log.Printf("%s: %v", utils.ErrHashingPassword, err)
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrInternalServerError)
+		return
+	}
+
+	if err := h.store.UpdatePassword(user.ID, hashedPassword); err != nil {
+		log.Printf("error updating password of user %d: %v", user.ID, err)
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrInternalServerError)
+		return
+	}
+
+	if err := h.sessions.RevokeSessions(user.ID); err != nil {
+		log.Printf("error revoking sessions of user %d: %v", user.ID, err)
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrInternalServerError)
+		return
+	}
+
+	pair, err := h.tokens.IssueTokens(user)
 	if err != nil {
+		log.Printf("error issuing tokens for user %d: %v", user.ID, err)
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrInternalServerError)
+		return
+	}
+
+	utils.WriteSecretJSON(w, http.StatusOK, pair)
+}
+
+// deleteMe closes the account of the caller, who has to confirm with their
+// password, and ends all of their sessions.
+func (h *Handler) deleteMe(w http.ResponseWriter, r *http.Request) {
+	if r.Body == nil {
+		utils.WriteError(w, http.StatusBadRequest, utils.ErrInvalidRequestBody)
+		return
+	}
+
+	var payload types.DeleteAccountPayload
+	if err := utils.ReadJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, utils.ErrInvalidPayload)
+		return
+	}
+
+	if err := utils.Validate.Struct(payload); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Sprintf("%s: %v", utils.ErrInvalidPayload, validationErrors))
+		return
+	}
+
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+	if err := h.comparePasswords(user.Password, payload.Password); err != nil {
+		utils.WriteError(w, http.StatusForbidden, utils.ErrIncorrectPassword)
+		return
+	}
+
+	if err := h.store.DeleteUser(user.ID, h.now()); err != nil {
+		log.Printf("error deleting user %d: %v", user.ID, err)
 		utils.WriteError(w, http.StatusInternalServerError, utils.ErrInternalServerError)
 		return
 	}
 
-	utils.WriteJSON(w, http.StatusOK, map[string]string{"token": token})
+	if err := h.sessions.RevokeSessions(user.ID); err != nil {
+		log.Printf("error revoking sessions of deleted user %d: %v", user.ID, err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// currentUser loads the signed in user, writing the error response if that
+// fails.
+func (h *Handler) currentUser(w http.ResponseWriter, r *http.Request) (*types.User, bool) {
+	userID, err := auth.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+
+	user, err := h.store.GetUserByID(userID)
+	if err != nil {
+		log.Printf("error getting user %d: %v", userID, err)
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrInternalServerError)
+		return nil, false
+	}
+
+	return user, true
 }
 
 // checkUserExists checks if a user with the given email already exists
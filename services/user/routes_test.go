@@ -7,13 +7,17 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"testing"
 	"time"
 
+	"github.com/gorilla/mux"
 	"github.com/loloDawit/ecom/config"
 	"github.com/loloDawit/ecom/services/auth"
+	"github.com/loloDawit/ecom/services/auth/authtest"
 	"github.com/loloDawit/ecom/types"
 	"github.com/loloDawit/ecom/utils"
+	"github.com/stretchr/testify/assert"
 	"gopkg.in/go-playground/validator.v9"
 )
 
@@ -21,6 +25,10 @@ type mockUserStore struct {
 	db                 *sql.DB
 	GetUserByEmailFunc func(email string) (*types.User, error)
 	CreateUserFunc     func(user types.User) error
+	GetUserByIDFunc    func(id int) (*types.User, error)
+	UpdateUserFunc     func(user types.User) error
+	UpdatePasswordFunc func(userID int, passwordHash string) error
+	DeleteUserFunc     func(userID int, now time.Time) error
 }
 
 func (m *mockUserStore) GetUserByEmail(email string) (*types.User, error) {
@@ -40,9 +48,51 @@ func (m *mockUserStore) CreateUser(user types.User) error {
 
 // GetUserByID implements types.UserStore.
 func (m *mockUserStore) GetUserByID(id int) (*types.User, error) {
+	if m.GetUserByIDFunc != nil {
+		return m.GetUserByIDFunc(id)
+	}
 	return nil, nil
 }
 
+// UpdateUser implements types.UserStore.
+func (m *mockUserStore) UpdateUser(user types.User) error {
+	if m.UpdateUserFunc != nil {
+		return m.UpdateUserFunc(user)
+	}
+	return nil
+}
+
+// UpdatePassword implements types.UserStore.
+func (m *mockUserStore) UpdatePassword(userID int, passwordHash string) error {
+	if m.UpdatePasswordFunc != nil {
+		return m.UpdatePasswordFunc(userID, passwordHash)
+	}
+	return nil
+}
+
+// GetUsers implements types.UserStore.
+func (m *mockUserStore) GetUsers(query types.UserQuery) ([]types.User, error) {
+	return nil, nil
+}
+
+// SetUserDisabled implements types.UserStore.
+func (m *mockUserStore) SetUserDisabled(userID int, disabledAt *time.Time) error {
+	return nil
+}
+
+// UpdateUserRole implements types.UserStore.
+func (m *mockUserStore) UpdateUserRole(userID int, role types.Role) error {
+	return nil
+}
+
+// DeleteUser implements types.UserStore.
+func (m *mockUserStore) DeleteUser(userID int, now time.Time) error {
+	if m.DeleteUserFunc != nil {
+		return m.DeleteUserFunc(userID, now)
+	}
+	return nil
+}
+
 func TestCheckUserExists(t *testing.T) {
 	tests := []struct {
 		name          string
@@ -105,6 +155,33 @@ func (v *mockValidator) Struct(s interface{}) error {
 	return nil
 }
 
+// newSignupStore returns a store that finds a user once it was created.
+func newSignupStore() *mockUserStore {
+	var created *types.User
+	return &mockUserStore{
+		GetUserByEmailFunc: func(email string) (*types.User, error) {
+			if created != nil && created.Email == email {
+				return created, nil
+			}
+			return nil, sql.ErrNoRows
+		},
+		CreateUserFunc: func(user types.User) error {
+			user.ID = 1
+			created = &user
+			return nil
+		},
+	}
+}
+
+type recordingVerifier struct {
+	sent []*types.User
+}
+
+func (v *recordingVerifier) SendVerification(user *types.User) error {
+	v.sent = append(v.sent, user)
+	return nil
+}
+
 func TestSignUp(t *testing.T) {
 	originalValidate := utils.Validate
 	utils.Validate = &mockValidator{}
@@ -116,6 +193,7 @@ func TestSignUp(t *testing.T) {
 		mockStore        *mockUserStore
 		expectedStatus   int
 		expectedResponse map[string]string
+		expectedVerified []string
 	}{
 		{
 			name: "Valid signup",
@@ -125,16 +203,10 @@ func TestSignUp(t *testing.T) {
 				Email:     "john.doe@example.com",
 				Password:  "password",
 			},
-			mockStore: &mockUserStore{
-				GetUserByEmailFunc: func(email string) (*types.User, error) {
-					return nil, sql.ErrNoRows
-				},
-				CreateUserFunc: func(user types.User) error {
-					return nil
-				},
-			},
+			mockStore:        newSignupStore(),
 			expectedStatus:   http.StatusCreated,
 			expectedResponse: map[string]string{"message": utils.UserCreatedSuccessfully},
+			expectedVerified: []string{"john.doe@example.com"},
 		},
 		{
 			name: "User already exists",
@@ -192,13 +264,22 @@ func TestSignUp(t *testing.T) {
 				t.Fatalf("could not create request: %v", err)
 			}
 			rr := httptest.NewRecorder()
-			handler := &Handler{store: tc.mockStore}
+			verifier := &recordingVerifier{}
+			handler := &Handler{store: tc.mockStore, verifier: verifier}
 			handler.signUp(rr, req)
 
 			if status := rr.Code; status != tc.expectedStatus {
 				t.Errorf("handler returned wrong status code: got %v want %v", status, tc.expectedStatus)
 			}
 
+			var verified []string
+			for _, user := range verifier.sent {
+				verified = append(verified, user.Email)
+			}
+			if !reflect.DeepEqual(verified, tc.expectedVerified) {
+				t.Errorf("verification emails sent to %v, want %v", verified, tc.expectedVerified)
+			}
+
 			var responseBody map[string]string
 			err = json.Unmarshal(rr.Body.Bytes(), &responseBody)
 			if err != nil {
@@ -225,14 +306,53 @@ func mockComparePasswords(storedPassword, providedPassword string) error {
 	return nil
 }
 
-func mockGenerateToken(secret []byte, userID int, expiration time.Duration) (string, error) {
-	return "mocked-token", nil
+type mockTokenIssuer struct {
+	err error
+}
+
+func (m *mockTokenIssuer) IssueTokens(user *types.User) (*types.TokenPair, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &types.TokenPair{Token: "mocked-token", RefreshToken: "mocked-refresh-token", ExpiresIn: 3600}, nil
 }
 
-func mockGenerateTokenError(secret []byte, userID int, expiration time.Duration) (string, error) {
-	return "", fmt.Errorf("token generation error")
+// mockLimiter records failed and successful logins and locks out the
+// emails in locked.
+type mockLimiter struct {
+	locked    map[string]time.Duration
+	failed    []string
+	succeeded []string
 }
 
+func (m *mockLimiter) LoginAllowed(email string, ip string) (time.Duration, error) {
+	return m.locked[email], nil
+}
+
+func (m *mockLimiter) LoginFailed(email string, ip string) error {
+	m.failed = append(m.failed, email+" "+ip)
+	return nil
+}
+
+func (m *mockLimiter) LoginSucceeded(email string) error {
+	m.succeeded = append(m.succeeded, email)
+	return nil
+}
+
+// mockMFA challenges the users in challenges.
+type mockMFA struct {
+	challenges map[int]*types.MFAChallenge
+}
+
+func (m *mockMFA) Challenge(user *types.User) (*types.MFAChallenge, error) {
+	return m.challenges[user.ID], nil
+}
+
+var (
+	mockTokens      = &mockTokenIssuer{}
+	mockTokensError = &mockTokenIssuer{err: fmt.Errorf("token generation error")}
+)
+
 func TestLogin(t *testing.T) {
 	originalValidate := utils.Validate
 	utils.Validate = &mockValidator{}
@@ -249,9 +369,9 @@ func TestLogin(t *testing.T) {
 		name             string
 		payload          *types.LoginUserPayload
 		mockStore        *mockUserStore
-		generateToken    func([]byte, int, time.Duration) (string, error)
+		tokens           types.TokenIssuer
 		expectedStatus   int
-		expectedResponse map[string]string
+		expectedResponse map[string]interface{}
 	}{
 		{
 			name: "Valid login",
@@ -267,9 +387,9 @@ func TestLogin(t *testing.T) {
 					},
 				}
 			}(),
-			generateToken:    mockGenerateToken,
+			tokens:           mockTokens,
 			expectedStatus:   http.StatusOK,
-			expectedResponse: map[string]string{"token": "mocked-token"},
+			expectedResponse: map[string]interface{}{"token": "mocked-token", "refreshToken": "mocked-refresh-token", "expiresIn": float64(3600)},
 		},
 		{
 			name: "User not found",
@@ -282,9 +402,9 @@ func TestLogin(t *testing.T) {
 					return nil, sql.ErrNoRows
 				},
 			},
-			generateToken:    mockGenerateToken,
-			expectedStatus:   http.StatusNotFound,
-			expectedResponse: map[string]string{"error": utils.ErrUserNotFound},
+			tokens:           mockTokens,
+			expectedStatus:   http.StatusUnauthorized,
+			expectedResponse: map[string]interface{}{"error": utils.ErrInvalidCredentials},
 		},
 		{
 			name: "Invalid payload",
@@ -292,10 +412,10 @@ func TestLogin(t *testing.T) {
 				Email:    "invalid-email",
 				Password: "password",
 			},
-			generateToken:  mockGenerateToken,
+			tokens:         mockTokens,
 			mockStore:      &mockUserStore{},
 			expectedStatus: http.StatusBadRequest,
-			expectedResponse: map[string]string{
+			expectedResponse: map[string]interface{}{
 				"error": fmt.Sprintf("%s: %v", utils.ErrInvalidPayload, validator.ValidationErrors{}),
 			},
 		},
@@ -303,9 +423,9 @@ func TestLogin(t *testing.T) {
 			name:           "Empty payload",
 			payload:        nil,
 			mockStore:      &mockUserStore{},
-			generateToken:  mockGenerateToken,
+			tokens:         mockTokens,
 			expectedStatus: http.StatusBadRequest,
-			expectedResponse: map[string]string{
+			expectedResponse: map[string]interface{}{
 				"error": "please send a valid request body",
 			},
 		},
@@ -323,9 +443,9 @@ func TestLogin(t *testing.T) {
 					},
 				}
 			}(),
-			generateToken:    mockGenerateToken,
+			tokens:           mockTokens,
 			expectedStatus:   http.StatusUnauthorized,
-			expectedResponse: map[string]string{"error": utils.ErrUnauthorized},
+			expectedResponse: map[string]interface{}{"error": utils.ErrInvalidCredentials},
 		},
 		{
 			name: "Internal server error - get user by email",
@@ -338,9 +458,9 @@ func TestLogin(t *testing.T) {
 					return nil, fmt.Errorf("some internal error")
 				},
 			},
-			generateToken:    mockGenerateToken,
+			tokens:           mockTokens,
 			expectedStatus:   http.StatusInternalServerError,
-			expectedResponse: map[string]string{"error": utils.ErrInternalServerError},
+			expectedResponse: map[string]interface{}{"error": utils.ErrInternalServerError},
 		},
 		{
 			name: "Internal server error - generate token",
@@ -356,9 +476,9 @@ func TestLogin(t *testing.T) {
 					},
 				}
 			}(),
-			generateToken:    mockGenerateTokenError,
+			tokens:           mockTokensError,
 			expectedStatus:   http.StatusInternalServerError,
-			expectedResponse: map[string]string{"error": utils.ErrInternalServerError},
+			expectedResponse: map[string]interface{}{"error": utils.ErrInternalServerError},
 		},
 	}
 
@@ -381,7 +501,9 @@ func TestLogin(t *testing.T) {
 				store:            tc.mockStore,
 				cfg:              mockCfg,
 				comparePasswords: auth.ComparePasswords,
-				generateToken:    tc.generateToken,
+				tokens:           tc.tokens,
+				limiter:          &mockLimiter{},
+				mfa:              &mockMFA{},
 			}
 			handler.login(rr, req)
 
@@ -389,7 +511,7 @@ func TestLogin(t *testing.T) {
 				t.Errorf("handler returned wrong status code: got %v want %v", status, tc.expectedStatus)
 			}
 
-			var responseBody map[string]string
+			var responseBody map[string]interface{}
 			err = json.Unmarshal(rr.Body.Bytes(), &responseBody)
 			if err != nil {
 				t.Fatalf("could not unmarshal response body: %v", err)
@@ -421,7 +543,9 @@ func TestLogin(t *testing.T) {
 			store:            &mockUserStore{},
 			cfg:              mockCfg,
 			comparePasswords: auth.ComparePasswords,
-			generateToken:    mockGenerateToken,
+			tokens:           mockTokens,
+			limiter:          &mockLimiter{},
+			mfa:              &mockMFA{},
 		}
 		handler.login(rr, req)
 
@@ -449,3 +573,488 @@ func TestLogin(t *testing.T) {
 		}
 	})
 }
+
+func TestLoginThrottling(t *testing.T) {
+	hashedPassword, _ := auth.HashPassword("password")
+	store := &mockUserStore{
+		GetUserByEmailFunc: func(email string) (*types.User, error) {
+			if email == "john.doe@example.com" {
+				return &types.User{ID: 1, Email: email, Password: hashedPassword}, nil
+			}
+			return nil, sql.ErrNoRows
+		},
+	}
+
+	login := func(limiter *mockLimiter, compared *[]string, body string) *httptest.ResponseRecorder {
+		handler := &Handler{
+			store:   store,
+			cfg:     &config.Config{},
+			tokens:  mockTokens,
+			limiter: limiter,
+			mfa:     &mockMFA{},
+			comparePasswords: func(hashed, password string) error {
+				*compared = append(*compared, hashed)
+				return auth.ComparePasswords(hashed, password)
+			},
+		}
+		req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewBufferString(body))
+		req.RemoteAddr = "203.0.113.7:51234"
+		rr := httptest.NewRecorder()
+		handler.login(rr, req)
+		return rr
+	}
+
+	t.Run("Unknown email and wrong password look the same", func(t *testing.T) {
+		limiter := &mockLimiter{}
+		var compared []string
+
+		unknown := login(limiter, &compared, `{"email": "nobody@example.com", "password": "password"}`)
+		wrong := login(limiter, &compared, `{"email": "john.doe@example.com", "password": "wrong"}`)
+
+		assert.Equal(t, http.StatusUnauthorized, unknown.Code)
+		assert.Equal(t, unknown.Code, wrong.Code)
+		assert.Equal(t, unknown.Body.String(), wrong.Body.String())
+
+		// both spent a bcrypt comparison
+		assert.Equal(t, []string{auth.DummyPasswordHash(), hashedPassword}, compared)
+		assert.Equal(t, []string{"nobody@example.com 203.0.113.7", "john.doe@example.com 203.0.113.7"}, limiter.failed)
+		assert.Empty(t, limiter.succeeded)
+	})
+
+	t.Run("Successful login", func(t *testing.T) {
+		limiter := &mockLimiter{}
+		var compared []string
+
+		rr := login(limiter, &compared, `{"email": "john.doe@example.com", "password": "password"}`)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Empty(t, limiter.failed)
+		assert.Equal(t, []string{"john.doe@example.com"}, limiter.succeeded)
+	})
+
+	t.Run("Locked out", func(t *testing.T) {
+		limiter := &mockLimiter{locked: map[string]time.Duration{"john.doe@example.com": 90*time.Second + time.Millisecond}}
+		var compared []string
+
+		rr := login(limiter, &compared, `{"email": "john.doe@example.com", "password": "password"}`)
+		assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+		assert.Equal(t, "91", rr.Header().Get("Retry-After"))
+		assert.JSONEq(t, `{"error":"`+utils.ErrTooManyLogins+`"}`, rr.Body.String())
+
+		// the password is not even checked
+		assert.Empty(t, compared)
+		assert.Empty(t, limiter.succeeded)
+	})
+}
+
+func TestLoginClientIP(t *testing.T) {
+	tests := []struct {
+		name           string
+		trustedProxies []string
+		remoteAddr     string
+		forwardedFor   []string
+		expectedIP     string
+	}{
+		{
+			name:         "Direct connection ignores X-Forwarded-For",
+			remoteAddr:   "203.0.113.7:51234",
+			forwardedFor: []string{"198.51.100.1"},
+			expectedIP:   "203.0.113.7",
+		},
+		{
+			name:           "Untrusted peer ignores X-Forwarded-For",
+			trustedProxies: []string{"10.0.0.0/8"},
+			remoteAddr:     "203.0.113.7:51234",
+			forwardedFor:   []string{"198.51.100.1"},
+			expectedIP:     "203.0.113.7",
+		},
+		{
+			name:           "Behind a trusted proxy",
+			trustedProxies: []string{"10.0.0.0/8"},
+			remoteAddr:     "10.0.0.2:51234",
+			forwardedFor:   []string{"203.0.113.7"},
+			expectedIP:     "203.0.113.7",
+		},
+		{
+			name:           "Spoofed entries left of the client are skipped",
+			trustedProxies: []string{"10.0.0.0/8", "192.0.2.10"},
+			remoteAddr:     "10.0.0.2:51234",
+			forwardedFor:   []string{"198.51.100.1, 203.0.113.7", "192.0.2.10"},
+			expectedIP:     "203.0.113.7",
+		},
+		{
+			name:           "Malformed entry stops at the last trusted proxy",
+			trustedProxies: []string{"10.0.0.0/8"},
+			remoteAddr:     "10.0.0.2:51234",
+			forwardedFor:   []string{"203.0.113.7, not-an-ip, 10.0.0.3"},
+			expectedIP:     "10.0.0.3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := &mockLimiter{}
+			handler := &Handler{
+				store:            &mockUserStore{},
+				cfg:              &config.Config{TrustedProxies: tt.trustedProxies},
+				tokens:           mockTokens,
+				limiter:          limiter,
+				mfa:              &mockMFA{},
+				comparePasswords: auth.ComparePasswords,
+			}
+			req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewBufferString(`{"email": "nobody@example.com", "password": "password"}`))
+			req.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwardedFor {
+				req.Header.Add("X-Forwarded-For", value)
+			}
+			rr := httptest.NewRecorder()
+			handler.login(rr, req)
+
+			assert.Equal(t, http.StatusUnauthorized, rr.Code)
+			assert.Equal(t, []string{"nobody@example.com " + tt.expectedIP}, limiter.failed)
+		})
+	}
+}
+
+func TestLoginMFAChallenge(t *testing.T) {
+	hashedPassword, _ := auth.HashPassword("password")
+	limiter := &mockLimiter{}
+	handler := &Handler{
+		store: &mockUserStore{
+			GetUserByEmailFunc: func(email string) (*types.User, error) {
+				return &types.User{ID: 1, Email: email, Password: hashedPassword}, nil
+			},
+		},
+		cfg:              &config.Config{},
+		tokens:           mockTokensError,
+		limiter:          limiter,
+		mfa:              &mockMFA{challenges: map[int]*types.MFAChallenge{1: {MFARequired: true, MFAToken: "challenge", ExpiresIn: 300}}},
+		comparePasswords: auth.ComparePasswords,
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewBufferString(`{"email": "john.doe@example.com", "password": "password"}`))
+	rr := httptest.NewRecorder()
+	handler.login(rr, req)
+
+	// no tokens are issued until the challenge is completed
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"mfaRequired":true,"mfaToken":"challenge","expiresIn":300}`, rr.Body.String())
+
+	// nor are failed logins forgotten
+	assert.Empty(t, limiter.succeeded)
+}
+
+type recordingSessions struct {
+	revoked []int
+}
+
+func (m *recordingSessions) RevokeSessions(userID int) error {
+	m.revoked = append(m.revoked, userID)
+	return nil
+}
+
+// profileTest serves the /users/me routes to user 1, whose stored record is
+// user.
+type profileTest struct {
+	router   *mux.Router
+	user     *types.User
+	existing map[string]bool
+	deleted  bool
+	verifier *recordingVerifier
+	sessions *recordingSessions
+}
+
+func newProfileTest(t *testing.T) *profileTest {
+	hashedPassword, err := auth.HashPassword("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifiedAt := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	pt := &profileTest{
+		user: &types.User{
+			ID:              1,
+			FirstName:       "John",
+			LastName:        "Doe",
+			Email:           "john.doe@example.com",
+			Password:        hashedPassword,
+			Role:            types.RoleCustomer,
+			EmailVerifiedAt: &verifiedAt,
+		},
+		existing: map[string]bool{"taken@example.com": true},
+		verifier: &recordingVerifier{},
+		sessions: &recordingSessions{},
+	}
+	store := &mockUserStore{
+		GetUserByEmailFunc: func(email string) (*types.User, error) {
+			if pt.existing[email] {
+				return &types.User{Email: email}, nil
+			}
+			return nil, sql.ErrNoRows
+		},
+		GetUserByIDFunc: func(id int) (*types.User, error) {
+			copied := *pt.user
+			return &copied, nil
+		},
+		UpdateUserFunc: func(user types.User) error {
+			if user.Email != pt.user.Email {
+				user.EmailVerifiedAt = nil
+			}
+			pt.user = &user
+			return nil
+		},
+		UpdatePasswordFunc: func(userID int, passwordHash string) error {
+			pt.user.Password = passwordHash
+			return nil
+		},
+		DeleteUserFunc: func(userID int, now time.Time) error {
+			pt.deleted = true
+			return nil
+		},
+	}
+
+	handler := NewHandlers(store, mockTokens, pt.sessions, pt.verifier, &mockLimiter{}, &mockMFA{}, authtest.As(1, types.RoleCustomer), &config.Config{})
+	pt.router = mux.NewRouter()
+	handler.RegisterRoutes(pt.router)
+	return pt
+}
+
+func (pt *profileTest) do(t *testing.T, method string, body string) *httptest.ResponseRecorder {
+	return pt.doPath(t, method, "/users/me", body)
+}
+
+func (pt *profileTest) doPath(t *testing.T, method string, path string, body string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest(method, path, bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	pt.router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestGetMe(t *testing.T) {
+	pt := newProfileTest(t)
+
+	rr := pt.do(t, http.MethodGet, "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{
+		"id": 1,
+		"firstName": "John",
+		"lastName": "Doe",
+		"email": "john.doe@example.com",
+		"role": "customer",
+		"emailVerifiedAt": "2026-10-01T00:00:00Z"
+	}`, rr.Body.String())
+	assert.NotContains(t, rr.Body.String(), pt.user.Password)
+}
+
+func TestUserNeverSerializesPassword(t *testing.T) {
+	body, err := json.Marshal(types.User{ID: 1, Password: "hash"})
+	assert.NoError(t, err)
+	assert.NotContains(t, string(body), "hash")
+}
+
+func TestPatchMe(t *testing.T) {
+	tests := []struct {
+		name               string
+		body               string
+		expectedStatus     int
+		expectedFirstName  string
+		expectedEmail      string
+		expectVerified     bool
+		expectedSentEmails int
+	}{
+		{
+			name:              "Name only",
+			body:              `{"firstName": "Johnny"}`,
+			expectedStatus:    http.StatusOK,
+			expectedFirstName: "Johnny",
+			expectedEmail:     "john.doe@example.com",
+			expectVerified:    true,
+		},
+		{
+			name:               "New email",
+			body:               `{"email": "johnny@example.com"}`,
+			expectedStatus:     http.StatusOK,
+			expectedFirstName:  "John",
+			expectedEmail:      "johnny@example.com",
+			expectedSentEmails: 1,
+		},
+		{
+			name:              "Same email",
+			body:              `{"email": "john.doe@example.com"}`,
+			expectedStatus:    http.StatusOK,
+			expectedFirstName: "John",
+			expectedEmail:     "john.doe@example.com",
+			expectVerified:    true,
+		},
+		{
+			name:              "Email taken",
+			body:              `{"email": "taken@example.com"}`,
+			expectedStatus:    http.StatusBadRequest,
+			expectedFirstName: "John",
+			expectedEmail:     "john.doe@example.com",
+			expectVerified:    true,
+		},
+		{
+			name:              "Invalid email",
+			body:              `{"email": "johnny"}`,
+			expectedStatus:    http.StatusBadRequest,
+			expectedFirstName: "John",
+			expectedEmail:     "john.doe@example.com",
+			expectVerified:    true,
+		},
+		{
+			name:              "Empty name",
+			body:              `{"firstName": ""}`,
+			expectedStatus:    http.StatusBadRequest,
+			expectedFirstName: "John",
+			expectedEmail:     "john.doe@example.com",
+			expectVerified:    true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			pt := newProfileTest(t)
+
+			rr := pt.do(t, http.MethodPatch, tc.body)
+			assert.Equal(t, tc.expectedStatus, rr.Code)
+			assert.Equal(t, tc.expectedFirstName, pt.user.FirstName)
+			assert.Equal(t, tc.expectedEmail, pt.user.Email)
+			assert.Equal(t, tc.expectVerified, pt.user.EmailVerifiedAt != nil)
+			assert.Len(t, pt.verifier.sent, tc.expectedSentEmails)
+
+			if tc.expectedStatus == http.StatusOK {
+				var response types.UserResponse
+				assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+				assert.Equal(t, tc.expectedEmail, response.Email)
+				assert.Equal(t, tc.expectVerified, response.EmailVerifiedAt != nil)
+			}
+		})
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	tests := []struct {
+		name            string
+		body            string
+		expectedStatus  int
+		expectedChanged bool
+	}{
+		{
+			name:            "Correct current password",
+			body:            `{"currentPassword": "password", "newPassword": "new-password"}`,
+			expectedStatus:  http.StatusOK,
+			expectedChanged: true,
+		},
+		{
+			name:           "Wrong current password",
+			body:           `{"currentPassword": "wrong", "newPassword": "new-password"}`,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "New password too short",
+			body:           `{"currentPassword": "password", "newPassword": "abc"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			pt := newProfileTest(t)
+
+			rr := pt.doPath(t, http.MethodPost, "/users/me/password", tc.body)
+			assert.Equal(t, tc.expectedStatus, rr.Code)
+			assert.Equal(t, tc.expectedChanged, auth.ComparePasswords(pt.user.Password, "new-password") == nil)
+
+			if tc.expectedChanged {
+				// every session ends and the caller gets a new one
+				assert.Equal(t, []int{1}, pt.sessions.revoked)
+				assert.JSONEq(t, `{"token":"mocked-token","refreshToken":"mocked-refresh-token","expiresIn":3600}`, rr.Body.String())
+			} else {
+				assert.Empty(t, pt.sessions.revoked)
+			}
+		})
+	}
+}
+
+func TestDeleteMe(t *testing.T) {
+	t.Run("Correct password", func(t *testing.T) {
+		pt := newProfileTest(t)
+
+		rr := pt.do(t, http.MethodDelete, `{"password": "password"}`)
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+		assert.True(t, pt.deleted)
+		assert.Equal(t, []int{1}, pt.sessions.revoked)
+	})
+
+	t.Run("Wrong password", func(t *testing.T) {
+		pt := newProfileTest(t)
+
+		rr := pt.do(t, http.MethodDelete, `{"password": "wrong"}`)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		assert.JSONEq(t, `{"error":"`+utils.ErrIncorrectPassword+`"}`, rr.Body.String())
+		assert.False(t, pt.deleted)
+		assert.Empty(t, pt.sessions.revoked)
+	})
+}
+
+func TestMeRequiresAuthentication(t *testing.T) {
+	handler := NewHandlers(&mockUserStore{}, mockTokens, &recordingSessions{}, &recordingVerifier{}, &mockLimiter{}, &mockMFA{}, authtest.Anonymous(), &config.Config{})
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	req := httptest.NewRequest(http.MethodGet, "/users/me", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
+func TestLoginDisabledUser(t *testing.T) {
+	disabledAt := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name             string
+		password         string
+		expectedStatus   int
+		expectedResponse string
+	}{
+		{
+			name:             "Correct password",
+			password:         "password",
+			expectedStatus:   http.StatusForbidden,
+			expectedResponse: `{"error":"` + utils.ErrAccountDisabled + `"}`,
+		},
+		{
+			name:             "Wrong password",
+			password:         "wrong",
+			expectedStatus:   http.StatusUnauthorized,
+			expectedResponse: `{"error":"` + utils.ErrInvalidCredentials + `"}`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := &Handler{
+				store: &mockUserStore{
+					GetUserByEmailFunc: func(email string) (*types.User, error) {
+						return &types.User{ID: 1, Email: email, Password: "password", DisabledAt: &disabledAt}, nil
+					},
+				},
+				cfg:              &config.Config{},
+				tokens:           mockTokens,
+				limiter:          &mockLimiter{},
+				mfa:              &mockMFA{},
+				comparePasswords: mockComparePasswords,
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewBufferString(`{"email": "john.doe@example.com", "password": "`+tc.password+`"}`))
+			rr := httptest.NewRecorder()
+			handler.login(rr, req)
+
+			assert.Equal(t, tc.expectedStatus, rr.Code)
+			assert.JSONEq(t, tc.expectedResponse, rr.Body.String())
+		})
+	}
+}
@@ -3,8 +3,11 @@ package user
 import (
 	"database/sql"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/loloDawit/ecom/config"
+	"github.com/loloDawit/ecom/db"
 	"github.com/loloDawit/ecom/types"
 )
 
@@ -17,11 +20,28 @@ func NewUserStore(db *sql.DB, cfg *config.Config) *UserStore {
 	return &UserStore{db: db, cfg: cfg}
 }
 
-func (s *UserStore) GetUserByEmail(email string) (*types.User, error) {
-	row := s.db.QueryRow("SELECT id, firstName, lastName, email, password FROM users WHERE email = $1", email)
+const userColumns = "id, firstName, lastName, email, password, role, emailVerifiedAt, disabledAt"
 
+// scanUser reads userColumns from a *sql.Row or *sql.Rows.
+func scanUser(row interface{ Scan(...any) error }) (*types.User, error) {
 	u := new(types.User)
-	err := row.Scan(&u.ID, &u.FirstName, &u.LastName, &u.Email, &u.Password)
+	var emailVerifiedAt, disabledAt sql.NullTime
+	err := row.Scan(&u.ID, &u.FirstName, &u.LastName, &u.Email, &u.Password, &u.Role, &emailVerifiedAt, &disabledAt)
+	if err != nil {
+		return nil, err
+	}
+	if emailVerifiedAt.Valid {
+		u.EmailVerifiedAt = &emailVerifiedAt.Time
+	}
+	if disabledAt.Valid {
+		u.DisabledAt = &disabledAt.Time
+	}
+
+	return u, nil
+}
+
+func (s *UserStore) GetUserByEmail(email string) (*types.User, error) {
+	u, err := scanUser(s.db.QueryRow("SELECT "+userColumns+" FROM users WHERE email = $1 AND deletedAt IS NULL", email))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, sql.ErrNoRows
@@ -42,16 +62,131 @@ func (s *UserStore) CreateUser(user types.User) error {
 }
 
 func (s *UserStore) GetUserByID(id int) (*types.User, error) {
-	row := s.db.QueryRow("SELECT id, firstName, lastName, email, password FROM users WHERE id = $1", id)
+	u, err := scanUser(s.db.QueryRow("SELECT "+userColumns+" FROM users WHERE id = $1 AND deletedAt IS NULL", id))
+	if err != nil {
+		return nil, err
+	}
 
-	u := new(types.User)
-	err := row.Scan(&u.ID, &u.FirstName, &u.LastName, &u.Email, &u.Password)
+	return u, nil
+}
+
+func (s *UserStore) UpdateUser(user types.User) error {
+	return db.WithTransaction(s.db, func(tx *sql.Tx) error {
+		var previousEmail string
+		err := tx.QueryRow("SELECT email FROM users WHERE id = $1 AND deletedAt IS NULL FOR UPDATE", user.ID).Scan(&previousEmail)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(
+			"UPDATE users SET firstName = $1, lastName = $2, email = $3 WHERE id = $4",
+			user.FirstName, user.LastName, user.Email, user.ID,
+		); err != nil {
+			return err
+		}
+		if user.Email == previousEmail {
+			return nil
+		}
+
+		// the new address has to be verified again, and links mailed to the
+		// old one must not verify it
+		if _, err := tx.Exec("UPDATE users SET emailVerifiedAt = NULL WHERE id = $1", user.ID); err != nil {
+			return err
+		}
+		_, err = tx.Exec("UPDATE email_verification_tokens SET usedAt = CURRENT_TIMESTAMP WHERE userId = $1 AND usedAt IS NULL", user.ID)
+		return err
+	})
+}
+
+func (s *UserStore) UpdatePassword(userID int, passwordHash string) error {
+	result, err := s.db.Exec("UPDATE users SET password = $1 WHERE id = $2 AND deletedAt IS NULL", passwordHash, userID)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("user not found")
+		return err
+	}
+	return requireRowsAffected(result)
+}
+
+// DeleteUser only marks the user deleted, since their orders still
+// reference them.
+func (s *UserStore) DeleteUser(userID int, now time.Time) error {
+	result, err := s.db.Exec("UPDATE users SET deletedAt = $1 WHERE id = $2 AND deletedAt IS NULL", now, userID)
+	if err != nil {
+		return err
+	}
+	return requireRowsAffected(result)
+}
+
+// likeEscaper escapes the LIKE wildcards in user input.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func (s *UserStore) GetUsers(q types.UserQuery) ([]types.User, error) {
+	conditions := []string{"deletedAt IS NULL"}
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if q.Search != "" {
+		pattern := arg("%" + likeEscaper.Replace(q.Search) + "%")
+		conditions = append(conditions, fmt.Sprintf("(email ILIKE %s OR firstName ILIKE %s OR lastName ILIKE %s)", pattern, pattern, pattern))
+	}
+	if q.Role != "" {
+		conditions = append(conditions, "role = "+arg(q.Role))
+	}
+
+	query := "SELECT " + userColumns + " FROM users WHERE " + strings.Join(conditions, " AND ") + " ORDER BY id"
+	if q.Limit > 0 {
+		query += " LIMIT " + arg(q.Limit)
+	}
+	if q.Offset > 0 {
+		query += " OFFSET " + arg(q.Offset)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []types.User{}
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, err
 		}
+		users = append(users, *u)
+	}
+	if err := rows.Err(); err != nil {
 		return nil, err
 	}
 
-	return u, nil
+	return users, nil
+}
+
+func (s *UserStore) SetUserDisabled(userID int, disabledAt *time.Time) error {
+	result, err := s.db.Exec("UPDATE users SET disabledAt = $1 WHERE id = $2 AND deletedAt IS NULL", disabledAt, userID)
+	if err != nil {
+		return err
+	}
+	return requireRowsAffected(result)
+}
+
+func (s *UserStore) UpdateUserRole(userID int, role types.Role) error {
+	result, err := s.db.Exec("UPDATE users SET role = $1 WHERE id = $2 AND deletedAt IS NULL", role, userID)
+	if err != nil {
+		return err
+	}
+	return requireRowsAffected(result)
+}
+
+func requireRowsAffected(result sql.Result) error {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
 }
@@ -2,8 +2,8 @@ package user
 
 import (
 	"database/sql"
-	"fmt"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/loloDawit/ecom/config"
@@ -32,9 +32,9 @@ func TestGetUserByEmail(t *testing.T) {
 			name:  "User found",
 			email: "john.doe@example.com",
 			mockQuery: func() {
-				rows := sqlmock.NewRows([]string{"id", "firstName", "lastName", "email", "password"}).
-					AddRow(1, "John", "Doe", "john.doe@example.com", "hashedpassword")
-				mock.ExpectQuery("SELECT id, firstName, lastName, email, password FROM users WHERE email = \\$1").
+				rows := sqlmock.NewRows([]string{"id", "firstName", "lastName", "email", "password", "role", "emailVerifiedAt", "disabledAt"}).
+					AddRow(1, "John", "Doe", "john.doe@example.com", "hashedpassword", "staff", nil, nil)
+				mock.ExpectQuery("SELECT id, firstName, lastName, email, password, role, emailVerifiedAt, disabledAt FROM users WHERE email = \\$1").
 					WithArgs("john.doe@example.com").
 					WillReturnRows(rows)
 			},
@@ -44,6 +44,7 @@ func TestGetUserByEmail(t *testing.T) {
 				LastName:  "Doe",
 				Email:     "john.doe@example.com",
 				Password:  "hashedpassword",
+				Role:      types.RoleStaff,
 			},
 			expectedErr: nil,
 		},
@@ -51,7 +52,7 @@ func TestGetUserByEmail(t *testing.T) {
 			name:  "User not found",
 			email: "john.doe@example.com",
 			mockQuery: func() {
-				mock.ExpectQuery("SELECT id, firstName, lastName, email, password FROM users WHERE email = \\$1").
+				mock.ExpectQuery("SELECT id, firstName, lastName, email, password, role, emailVerifiedAt, disabledAt FROM users WHERE email = \\$1").
 					WithArgs("john.doe@example.com").
 					WillReturnError(sql.ErrNoRows)
 			},
@@ -62,7 +63,7 @@ func TestGetUserByEmail(t *testing.T) {
 			name:  "Database error",
 			email: "john.doe@example.com",
 			mockQuery: func() {
-				mock.ExpectQuery("SELECT id, firstName, lastName, email, password FROM users WHERE email = \\$1").
+				mock.ExpectQuery("SELECT id, firstName, lastName, email, password, role, emailVerifiedAt, disabledAt FROM users WHERE email = \\$1").
 					WithArgs("john.doe@example.com").
 					WillReturnError(sql.ErrConnDone)
 			},
@@ -159,9 +160,9 @@ func TestGetUserByID(t *testing.T) {
 			name: "User found",
 			id:   1,
 			mockQuery: func() {
-				rows := sqlmock.NewRows([]string{"id", "firstName", "lastName", "email", "password"}).
-					AddRow(1, "John", "Doe", "john.doe@example.com", "hashedpassword")
-				mock.ExpectQuery("SELECT id, firstName, lastName, email, password FROM users WHERE id = \\$1").
+				rows := sqlmock.NewRows([]string{"id", "firstName", "lastName", "email", "password", "role", "emailVerifiedAt", "disabledAt"}).
+					AddRow(1, "John", "Doe", "john.doe@example.com", "hashedpassword", "staff", nil, nil)
+				mock.ExpectQuery("SELECT id, firstName, lastName, email, password, role, emailVerifiedAt, disabledAt FROM users WHERE id = \\$1").
 					WithArgs(1).
 					WillReturnRows(rows)
 			},
@@ -171,6 +172,7 @@ func TestGetUserByID(t *testing.T) {
 				LastName:  "Doe",
 				Email:     "john.doe@example.com",
 				Password:  "hashedpassword",
+				Role:      types.RoleStaff,
 			},
 			expectedErr: nil,
 		},
@@ -178,18 +180,18 @@ func TestGetUserByID(t *testing.T) {
 			name: "User not found",
 			id:   1,
 			mockQuery: func() {
-				mock.ExpectQuery("SELECT id, firstName, lastName, email, password FROM users WHERE id = \\$1").
+				mock.ExpectQuery("SELECT id, firstName, lastName, email, password, role, emailVerifiedAt, disabledAt FROM users WHERE id = \\$1").
 					WithArgs(1).
 					WillReturnError(sql.ErrNoRows)
 			},
 			expectedUser: nil,
-			expectedErr:  fmt.Errorf("user not found"),
+			expectedErr:  sql.ErrNoRows,
 		},
 		{
 			name: "Database error",
 			id:   1,
 			mockQuery: func() {
-				mock.ExpectQuery("SELECT id, firstName, lastName, email, password FROM users WHERE id = \\$1").
+				mock.ExpectQuery("SELECT id, firstName, lastName, email, password, role, emailVerifiedAt, disabledAt FROM users WHERE id = \\$1").
 					WithArgs(1).
 					WillReturnError(sql.ErrConnDone)
 			},
@@ -207,3 +209,190 @@ func TestGetUserByID(t *testing.T) {
 		})
 	}
 }
+
+func TestUpdateUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	store := NewUserStore(db, &config.Config{})
+	user := types.User{ID: 1, FirstName: "John", LastName: "Doe", Email: "john.doe@example.com"}
+
+	t.Run("Same email", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT email FROM users WHERE id = \\$1 AND deletedAt IS NULL FOR UPDATE").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"email"}).AddRow("john.doe@example.com"))
+		mock.ExpectExec("UPDATE users SET firstName = \\$1, lastName = \\$2, email = \\$3 WHERE id = \\$4").
+			WithArgs("John", "Doe", "john.doe@example.com", 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		assert.NoError(t, store.UpdateUser(user))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("New email", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT email FROM users").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"email"}).AddRow("old@example.com"))
+		mock.ExpectExec("UPDATE users SET firstName").
+			WithArgs("John", "Doe", "john.doe@example.com", 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("UPDATE users SET emailVerifiedAt = NULL WHERE id = \\$1").
+			WithArgs(1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("UPDATE email_verification_tokens SET usedAt = CURRENT_TIMESTAMP WHERE userId = \\$1 AND usedAt IS NULL").
+			WithArgs(1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		assert.NoError(t, store.UpdateUser(user))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("User not found", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT email FROM users").
+			WithArgs(1).
+			WillReturnError(sql.ErrNoRows)
+		mock.ExpectRollback()
+
+		assert.Equal(t, sql.ErrNoRows, store.UpdateUser(user))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestUpdatePassword(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	store := NewUserStore(db, &config.Config{})
+
+	mock.ExpectExec("UPDATE users SET password = \\$1 WHERE id = \\$2 AND deletedAt IS NULL").
+		WithArgs("hashedpassword", 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	assert.NoError(t, store.UpdatePassword(1, "hashedpassword"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeleteUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	store := NewUserStore(db, &config.Config{})
+	now := time.Now()
+
+	mock.ExpectExec("UPDATE users SET deletedAt = \\$1 WHERE id = \\$2 AND deletedAt IS NULL").
+		WithArgs(now, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE users SET deletedAt").
+		WithArgs(now, 1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.NoError(t, store.DeleteUser(1, now))
+	assert.Equal(t, sql.ErrNoRows, store.DeleteUser(1, now))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetUsers(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	store := NewUserStore(db, &config.Config{})
+	columns := []string{"id", "firstName", "lastName", "email", "password", "role", "emailVerifiedAt", "disabledAt"}
+	disabledAt := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		query         types.UserQuery
+		mockQuery     func()
+		expectedUsers []types.User
+	}{
+		{
+			name:  "First page",
+			query: types.UserQuery{Limit: 20},
+			mockQuery: func() {
+				mock.ExpectQuery("SELECT (.+) FROM users WHERE deletedAt IS NULL ORDER BY id LIMIT \\$1$").
+					WithArgs(20).
+					WillReturnRows(sqlmock.NewRows(columns).
+						AddRow(1, "John", "Doe", "john.doe@example.com", "hashedpassword", "customer", nil, disabledAt))
+			},
+			expectedUsers: []types.User{
+				{ID: 1, FirstName: "John", LastName: "Doe", Email: "john.doe@example.com", Password: "hashedpassword", Role: types.RoleCustomer, DisabledAt: &disabledAt},
+			},
+		},
+		{
+			name:  "Search and role",
+			query: types.UserQuery{Limit: 20, Offset: 40, Search: "50%_off", Role: types.RoleStaff},
+			mockQuery: func() {
+				mock.ExpectQuery("SELECT (.+) FROM users WHERE deletedAt IS NULL AND \\(email ILIKE \\$1 OR firstName ILIKE \\$1 OR lastName ILIKE \\$1\\) AND role = \\$2 ORDER BY id LIMIT \\$3 OFFSET \\$4").
+					WithArgs(`%50\%\_off%`, types.RoleStaff, 20, 40).
+					WillReturnRows(sqlmock.NewRows(columns))
+			},
+			expectedUsers: []types.User{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockQuery()
+			users, err := store.GetUsers(tt.query)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedUsers, users)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestSetUserDisabled(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	store := NewUserStore(db, &config.Config{})
+	now := time.Now()
+
+	mock.ExpectExec("UPDATE users SET disabledAt = \\$1 WHERE id = \\$2 AND deletedAt IS NULL").
+		WithArgs(&now, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE users SET disabledAt = \\$1").
+		WithArgs(nil, 2).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.NoError(t, store.SetUserDisabled(1, &now))
+	assert.Equal(t, sql.ErrNoRows, store.SetUserDisabled(2, nil))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateUserRole(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	store := NewUserStore(db, &config.Config{})
+
+	mock.ExpectExec("UPDATE users SET role = \\$1 WHERE id = \\$2 AND deletedAt IS NULL").
+		WithArgs(types.RoleStaff, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	assert.NoError(t, store.UpdateUserRole(1, types.RoleStaff))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
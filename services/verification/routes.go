@@ -0,0 +1,83 @@
+package verification
+
+import (
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/loloDawit/ecom/config"
+	"github.com/loloDawit/ecom/services/auth"
+	"github.com/loloDawit/ecom/types"
+	"github.com/loloDawit/ecom/utils"
+)
+
+type Handler struct {
+	service *Service
+	users   types.UserStore
+	auth    auth.Authenticator
+	cfg     *config.Config
+}
+
+func NewHandlers(service *Service, users types.UserStore, authenticator auth.Authenticator, cfg *config.Config) *Handler {
+	return &Handler{service: service, users: users, auth: authenticator, cfg: cfg}
+}
+
+func (h *Handler) RegisterRoutes(r *mux.Router) {
+	jwtMiddleware := auth.Middleware(h.auth)
+
+	r.HandleFunc("/verify-email", h.verifyEmail).Methods("GET")
+	r.HandleFunc("/verify-email/resend", jwtMiddleware(h.resend)).Methods("POST")
+}
+
+func (h *Handler) verifyEmail(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		utils.WriteError(w, http.StatusBadRequest, utils.ErrInvalidVerifyToken)
+		return
+	}
+
+	if _, err := h.service.Verify(token); err != nil {
+		if errors.Is(err, ErrInvalidToken) {
+			utils.WriteError(w, http.StatusBadRequest, utils.ErrInvalidVerifyToken)
+			return
+		}
+		log.Printf("error verifying email: %v", err)
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrInternalServerError)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"message": utils.EmailVerifiedSuccessfully})
+}
+
+func (h *Handler) resend(w http.ResponseWriter, r *http.Request) {
+	userID, err := auth.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	user, err := h.users.GetUserByID(userID)
+	if err != nil {
+		log.Printf("error getting user %d: %v", userID, err)
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrInternalServerError)
+		return
+	}
+
+	var throttled *ThrottledError
+	err = h.service.Resend(user)
+	switch {
+	case err == nil:
+		utils.WriteJSON(w, http.StatusAccepted, map[string]string{"message": utils.VerificationEmailSent})
+	case errors.Is(err, ErrAlreadyVerified):
+		utils.WriteError(w, http.StatusConflict, utils.ErrEmailVerified)
+	case errors.As(err, &throttled):
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+		utils.WriteError(w, http.StatusTooManyRequests, utils.ErrVerifyThrottled)
+	default:
+		log.Printf("error resending verification email to user %d: %v", userID, err)
+		utils.WriteError(w, http.StatusInternalServerError, utils.ErrInternalServerError)
+	}
+}
@@ -0,0 +1,243 @@
+package verification
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/loloDawit/ecom/config"
+	"github.com/loloDawit/ecom/services/auth"
+	"github.com/loloDawit/ecom/services/auth/authtest"
+	"github.com/loloDawit/ecom/services/notify"
+	"github.com/loloDawit/ecom/types"
+	"github.com/loloDawit/ecom/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryStore is an in-memory EmailVerificationStore that marks the users
+// of memoryUsers verified.
+type memoryStore struct {
+	tokens []*types.EmailVerificationToken
+	users  *memoryUsers
+}
+
+func (m *memoryStore) CreateEmailVerificationToken(token types.EmailVerificationToken) error {
+	for _, existing := range m.tokens {
+		if existing.UserID == token.UserID && existing.UsedAt == nil {
+			usedAt := token.CreatedAt
+			existing.UsedAt = &usedAt
+		}
+	}
+	m.tokens = append(m.tokens, &token)
+	return nil
+}
+
+func (m *memoryStore) GetLastEmailVerificationSentAt(userID int) (time.Time, error) {
+	for i := len(m.tokens) - 1; i >= 0; i-- {
+		if m.tokens[i].UserID == userID {
+			return m.tokens[i].CreatedAt, nil
+		}
+	}
+	return time.Time{}, sql.ErrNoRows
+}
+
+func (m *memoryStore) VerifyEmail(tokenHash string, now time.Time) (int, error) {
+	for _, token := range m.tokens {
+		if token.TokenHash == tokenHash && token.UsedAt == nil && token.ExpiresAt.After(now) {
+			token.UsedAt = &now
+			if user := m.users.byID[token.UserID]; user.EmailVerifiedAt == nil {
+				user.EmailVerifiedAt = &now
+			}
+			return token.UserID, nil
+		}
+	}
+	return 0, sql.ErrNoRows
+}
+
+type memoryUsers struct {
+	byID map[int]*types.User
+}
+
+func (m *memoryUsers) GetUserByEmail(email string) (*types.User, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (m *memoryUsers) CreateUser(user types.User) error {
+	return nil
+}
+
+func (m *memoryUsers) GetUserByID(id int) (*types.User, error) {
+	if user, ok := m.byID[id]; ok {
+		copied := *user
+		return &copied, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *memoryUsers) UpdateUser(user types.User) error {
+	return nil
+}
+
+func (m *memoryUsers) UpdatePassword(userID int, passwordHash string) error {
+	return nil
+}
+
+func (m *memoryUsers) DeleteUser(userID int, now time.Time) error {
+	return nil
+}
+
+func (m *memoryUsers) GetUsers(query types.UserQuery) ([]types.User, error) {
+	return nil, nil
+}
+
+func (m *memoryUsers) SetUserDisabled(userID int, disabledAt *time.Time) error {
+	return nil
+}
+
+func (m *memoryUsers) UpdateUserRole(userID int, role types.Role) error {
+	return nil
+}
+
+type testHandler struct {
+	router  *mux.Router
+	service *Service
+	store   *memoryStore
+	users   *memoryUsers
+	mailer  *notify.MemoryMailer
+	now     time.Time
+}
+
+func newTestHandler(cfg *config.Config) *testHandler {
+	th := &testHandler{
+		users:  &memoryUsers{byID: map[int]*types.User{7: {ID: 7, FirstName: "Jane", Email: "jane@example.com"}}},
+		mailer: notify.NewMemoryMailer(),
+		now:    time.Date(2026, 10, 17, 9, 30, 0, 0, time.UTC),
+	}
+	th.store = &memoryStore{users: th.users}
+	th.service = NewService(th.store, notify.NewNotifier(th.mailer, cfg), cfg)
+	th.service.now = func() time.Time { return th.now }
+	th.router = mux.NewRouter()
+	NewHandlers(th.service, th.users, authtest.As(7, types.RoleCustomer), cfg).RegisterRoutes(th.router)
+	return th
+}
+
+func (th *testHandler) do(t *testing.T, method string, path string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest(method, path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	th.router.ServeHTTP(rr, req)
+	return rr
+}
+
+// mailedToken pulls the token out of the last email sent.
+func (th *testHandler) mailedToken(t *testing.T) string {
+	email, ok := th.mailer.Last()
+	if !ok {
+		t.Fatal("no email was sent")
+	}
+	body := email.Body
+	for _, line := range strings.Split(body, "\n") {
+		if i := strings.Index(line, "token="); i >= 0 {
+			return line[i+len("token="):]
+		}
+	}
+	t.Fatalf("no token in email: %s", body)
+	return ""
+}
+
+func TestVerifyEmail(t *testing.T) {
+	t.Run("Verifies once", func(t *testing.T) {
+		th := newTestHandler(&config.Config{AppURL: "https://shop.example.com"})
+		assert.NoError(t, th.service.SendVerification(th.users.byID[7]))
+
+		email := th.mailer.Sent()[0]
+		assert.Equal(t, "jane@example.com", email.To)
+		assert.Contains(t, email.Body, "https://shop.example.com/verify-email?token=")
+		token := th.mailedToken(t)
+
+		// only the hash of the mailed token is stored
+		assert.Equal(t, auth.HashOpaqueToken(token), th.store.tokens[0].TokenHash)
+
+		rr := th.do(t, http.MethodGet, "/verify-email?token="+token)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.JSONEq(t, `{"message":"`+utils.EmailVerifiedSuccessfully+`"}`, rr.Body.String())
+		assert.Equal(t, th.now, *th.users.byID[7].EmailVerifiedAt)
+
+		rr = th.do(t, http.MethodGet, "/verify-email?token="+token)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.JSONEq(t, `{"error":"`+utils.ErrInvalidVerifyToken+`"}`, rr.Body.String())
+	})
+
+	t.Run("Expired token", func(t *testing.T) {
+		th := newTestHandler(&config.Config{AppURL: "https://shop.example.com"})
+		assert.NoError(t, th.service.SendVerification(th.users.byID[7]))
+		th.now = th.now.Add(TokenTTL)
+
+		rr := th.do(t, http.MethodGet, "/verify-email?token="+th.mailedToken(t))
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Nil(t, th.users.byID[7].EmailVerifiedAt)
+	})
+
+	t.Run("A newer token replaces the older one", func(t *testing.T) {
+		th := newTestHandler(&config.Config{AppURL: "https://shop.example.com"})
+		assert.NoError(t, th.service.SendVerification(th.users.byID[7]))
+		first := th.mailedToken(t)
+		assert.NoError(t, th.service.SendVerification(th.users.byID[7]))
+
+		rr := th.do(t, http.MethodGet, "/verify-email?token="+first)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("Missing token", func(t *testing.T) {
+		th := newTestHandler(&config.Config{AppURL: "https://shop.example.com"})
+
+		rr := th.do(t, http.MethodGet, "/verify-email")
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
+
+func TestResendVerification(t *testing.T) {
+	th := newTestHandler(&config.Config{AppURL: "https://shop.example.com"})
+
+	rr := th.do(t, http.MethodPost, "/verify-email/resend")
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+	assert.JSONEq(t, `{"message":"`+utils.VerificationEmailSent+`"}`, rr.Body.String())
+	assert.Len(t, th.mailer.Sent(), 1)
+
+	// a second request within the interval is throttled
+	th.now = th.now.Add(20 * time.Second)
+	rr = th.do(t, http.MethodPost, "/verify-email/resend")
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, "40", rr.Header().Get("Retry-After"))
+	assert.JSONEq(t, `{"error":"`+utils.ErrVerifyThrottled+`"}`, rr.Body.String())
+	assert.Len(t, th.mailer.Sent(), 1)
+
+	th.now = th.now.Add(40 * time.Second)
+	rr = th.do(t, http.MethodPost, "/verify-email/resend")
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+	assert.Len(t, th.mailer.Sent(), 2)
+
+	// once verified there is nothing left to send
+	_, err := th.service.Verify(th.mailedToken(t))
+	assert.NoError(t, err)
+	rr = th.do(t, http.MethodPost, "/verify-email/resend")
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	assert.JSONEq(t, `{"error":"`+utils.ErrEmailVerified+`"}`, rr.Body.String())
+}
+
+func TestResendRequiresAuthentication(t *testing.T) {
+	th := newTestHandler(&config.Config{AppURL: "https://shop.example.com"})
+	router := mux.NewRouter()
+	NewHandlers(th.service, th.users, authtest.Anonymous(), &config.Config{}).RegisterRoutes(router)
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/verify-email/resend", nil))
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Empty(t, th.mailer.Sent())
+}
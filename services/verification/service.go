@@ -0,0 +1,100 @@
+package verification
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/loloDawit/ecom/config"
+	"github.com/loloDawit/ecom/services/auth"
+	"github.com/loloDawit/ecom/types"
+)
+
+const (
+	// TokenTTL is how long a mailed verification link can be used.
+	TokenTTL = 24 * time.Hour
+	// ResendInterval is the least time between two verification emails to
+	// the same user.
+	ResendInterval = time.Minute
+)
+
+var (
+	// ErrAlreadyVerified is returned when resending to a verified user.
+	ErrAlreadyVerified = errors.New("email is already verified")
+	// ErrInvalidToken is returned for tokens that are unknown, used or
+	// expired.
+	ErrInvalidToken = errors.New("invalid email verification token")
+)
+
+// ThrottledError is returned by Resend when the last email went out less
+// than ResendInterval ago.
+type ThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("verification email sent too recently, retry after %s", e.RetryAfter)
+}
+
+// Service mails verification links and consumes them.
+type Service struct {
+	store    types.EmailVerificationStore
+	notifier types.Notifier
+	cfg      *config.Config
+	now      func() time.Time
+}
+
+func NewService(store types.EmailVerificationStore, notifier types.Notifier, cfg *config.Config) *Service {
+	return &Service{store: store, notifier: notifier, cfg: cfg, now: time.Now}
+}
+
+// SendVerification mails the user a new link, invalidating earlier ones.
+func (s *Service) SendVerification(user *types.User) error {
+	token, err := auth.GenerateOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	now := s.now()
+	err = s.store.CreateEmailVerificationToken(types.EmailVerificationToken{
+		UserID:    user.ID,
+		TokenHash: auth.HashOpaqueToken(token),
+		ExpiresAt: now.Add(TokenTTL),
+		CreatedAt: now,
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.notifier.SendEmailVerification(user, token, TokenTTL)
+}
+
+// Resend mails a new link unless the user is already verified or was sent
+// one less than ResendInterval ago.
+func (s *Service) Resend(user *types.User) error {
+	if user.EmailVerifiedAt != nil {
+		return ErrAlreadyVerified
+	}
+
+	sentAt, err := s.store.GetLastEmailVerificationSentAt(user.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if err == nil {
+		if wait := sentAt.Add(ResendInterval).Sub(s.now()); wait > 0 {
+			return &ThrottledError{RetryAfter: wait}
+		}
+	}
+
+	return s.SendVerification(user)
+}
+
+// Verify consumes the token and returns the id of the verified user.
+func (s *Service) Verify(token string) (int, error) {
+	userID, err := s.store.VerifyEmail(auth.HashOpaqueToken(token), s.now())
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrInvalidToken
+	}
+	return userID, err
+}
@@ -0,0 +1,66 @@
+package verification
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/loloDawit/ecom/config"
+	"github.com/loloDawit/ecom/db"
+	"github.com/loloDawit/ecom/types"
+)
+
+type EmailVerificationStore struct {
+	db  *sql.DB
+	cfg *config.Config
+}
+
+func NewEmailVerificationStore(db *sql.DB, cfg *config.Config) *EmailVerificationStore {
+	return &EmailVerificationStore{db: db, cfg: cfg}
+}
+
+func (s *EmailVerificationStore) CreateEmailVerificationToken(token types.EmailVerificationToken) error {
+	return db.WithTransaction(s.db, func(tx *sql.Tx) error {
+		// only the latest link mailed to a user can be used
+		if _, err := tx.Exec("UPDATE email_verification_tokens SET usedAt = CURRENT_TIMESTAMP WHERE userId = $1 AND usedAt IS NULL", token.UserID); err != nil {
+			return err
+		}
+
+		_, err := tx.Exec(
+			"INSERT INTO email_verification_tokens (userId, tokenHash, expiresAt, createdAt) VALUES ($1, $2, $3, $4)",
+			token.UserID, token.TokenHash, token.ExpiresAt, token.CreatedAt,
+		)
+		return err
+	})
+}
+
+func (s *EmailVerificationStore) GetLastEmailVerificationSentAt(userID int) (time.Time, error) {
+	var sentAt time.Time
+	err := s.db.QueryRow(
+		"SELECT createdAt FROM email_verification_tokens WHERE userId = $1 ORDER BY createdAt DESC LIMIT 1",
+		userID,
+	).Scan(&sentAt)
+	return sentAt, err
+}
+
+// VerifyEmail marks the token used with a conditional update, the same way
+// password resets do, so a link opened twice verifies only once.
+func (s *EmailVerificationStore) VerifyEmail(tokenHash string, now time.Time) (int, error) {
+	var userID int
+	err := db.WithTransaction(s.db, func(tx *sql.Tx) error {
+		err := tx.QueryRow(
+			"UPDATE email_verification_tokens SET usedAt = CURRENT_TIMESTAMP WHERE tokenHash = $1 AND usedAt IS NULL AND expiresAt > $2 RETURNING userId",
+			tokenHash, now,
+		).Scan(&userID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec("UPDATE users SET emailVerifiedAt = $1 WHERE id = $2 AND emailVerifiedAt IS NULL", now, userID)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return userID, nil
+}
@@ -0,0 +1,117 @@
+package verification
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/loloDawit/ecom/config"
+	"github.com/loloDawit/ecom/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateEmailVerificationToken(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	store := NewEmailVerificationStore(db, &config.Config{})
+	now := time.Now()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE email_verification_tokens SET usedAt = CURRENT_TIMESTAMP WHERE userId = \\$1 AND usedAt IS NULL").
+		WithArgs(7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO email_verification_tokens \\(userId, tokenHash, expiresAt, createdAt\\) VALUES \\(\\$1, \\$2, \\$3, \\$4\\)").
+		WithArgs(7, "hash", now.Add(TokenTTL), now).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	err = store.CreateEmailVerificationToken(types.EmailVerificationToken{UserID: 7, TokenHash: "hash", ExpiresAt: now.Add(TokenTTL), CreatedAt: now})
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetLastEmailVerificationSentAt(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	store := NewEmailVerificationStore(db, &config.Config{})
+	sentAt := time.Now()
+
+	mock.ExpectQuery("SELECT createdAt FROM email_verification_tokens WHERE userId = \\$1 ORDER BY createdAt DESC LIMIT 1").
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"createdAt"}).AddRow(sentAt))
+	mock.ExpectQuery("SELECT createdAt FROM email_verification_tokens (.+)").
+		WithArgs(8).
+		WillReturnRows(sqlmock.NewRows([]string{"createdAt"}))
+
+	got, err := store.GetLastEmailVerificationSentAt(7)
+	assert.NoError(t, err)
+	assert.Equal(t, sentAt, got)
+
+	_, err = store.GetLastEmailVerificationSentAt(8)
+	assert.Equal(t, sql.ErrNoRows, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestVerifyEmailStore(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	store := NewEmailVerificationStore(db, &config.Config{})
+	now := time.Now()
+
+	tests := []struct {
+		name           string
+		mockQuery      func()
+		expectedUserID int
+		expectedErr    error
+	}{
+		{
+			name: "Valid token",
+			mockQuery: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery("UPDATE email_verification_tokens SET usedAt = CURRENT_TIMESTAMP WHERE tokenHash = \\$1 AND usedAt IS NULL AND expiresAt > \\$2 RETURNING userId").
+					WithArgs("hash", now).
+					WillReturnRows(sqlmock.NewRows([]string{"userId"}).AddRow(7))
+				mock.ExpectExec("UPDATE users SET emailVerifiedAt = \\$1 WHERE id = \\$2 AND emailVerifiedAt IS NULL").
+					WithArgs(now, 7).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+			},
+			expectedUserID: 7,
+		},
+		{
+			name: "Used, expired or unknown token",
+			mockQuery: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery("UPDATE email_verification_tokens (.+) RETURNING userId").
+					WithArgs("hash", now).
+					WillReturnError(sql.ErrNoRows)
+				mock.ExpectRollback()
+			},
+			expectedErr: sql.ErrNoRows,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockQuery()
+
+			userID, err := store.VerifyEmail("hash", now)
+			assert.Equal(t, tt.expectedErr, err)
+			assert.Equal(t, tt.expectedUserID, userID)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
@@ -4,21 +4,95 @@ import "time"
 
 type contextKey string
 
-const UserIDKey contextKey = "userID"
+const (
+	UserIDKey   contextKey = "userID"
+	UserRoleKey contextKey = "userRole"
+	IdentityKey contextKey = "identity"
+)
+
+// Role decides which parts of the API a user may call.
+type Role string
+
+const (
+	RoleCustomer Role = "customer"
+	RoleStaff    Role = "staff"
+	RoleAdmin    Role = "admin"
+)
 
 type User struct {
-	ID        int    `json:"id"`
-	FirstName string `json:"firstName"`
-	LastName  string `json:"lastName"`
-	Email     string `json:"email"`
-	Password  string `json:"password"`
-	CreatedAt string `json:"createdAt"`
+	ID              int        `json:"id"`
+	FirstName       string     `json:"firstName"`
+	LastName        string     `json:"lastName"`
+	Email           string     `json:"email"`
+	Password        string     `json:"-"`
+	Role            Role       `json:"role"`
+	EmailVerifiedAt *time.Time `json:"emailVerifiedAt"`
+	DisabledAt      *time.Time `json:"disabledAt"`
+	CreatedAt       string     `json:"createdAt"`
 }
 
 type UserStore interface {
 	GetUserByEmail(email string) (*User, error)
 	CreateUser(User) error
 	GetUserByID(id int) (*User, error)
+	// UpdateUser saves the user's name and email. Changing the email clears
+	// emailVerifiedAt and invalidates verification links already mailed.
+	UpdateUser(user User) error
+	UpdatePassword(userID int, passwordHash string) error
+	// DeleteUser closes the account; deleted users are no longer found by
+	// email or id.
+	DeleteUser(userID int, now time.Time) error
+	GetUsers(query UserQuery) ([]User, error)
+	// SetUserDisabled disables the user as of disabledAt, or enables them
+	// again when it is nil.
+	SetUserDisabled(userID int, disabledAt *time.Time) error
+	UpdateUserRole(userID int, role Role) error
+}
+
+// UserQuery selects a page of users for the admin API. Search matches
+// email, first and last name.
+type UserQuery struct {
+	Limit  int
+	Offset int
+	Search string
+	Role   Role
+}
+
+// UserResponse is what the API shows of a user. It is built field by field
+// so the password hash can never end up in a response.
+type UserResponse struct {
+	ID              int        `json:"id"`
+	FirstName       string     `json:"firstName"`
+	LastName        string     `json:"lastName"`
+	Email           string     `json:"email"`
+	Role            Role       `json:"role"`
+	EmailVerifiedAt *time.Time `json:"emailVerifiedAt"`
+	DisabledAt      *time.Time `json:"disabledAt,omitempty"`
+}
+
+type UserListResponse struct {
+	Users  []UserResponse `json:"users"`
+	Limit  int            `json:"limit"`
+	Offset int            `json:"offset"`
+}
+
+type UpdateRolePayload struct {
+	Role Role `json:"role" validate:"required,oneof=customer staff admin"`
+}
+
+// UserExport is everything kept about a user, handed to them on request.
+type UserExport struct {
+	ExportedAt time.Time    `json:"exportedAt"`
+	Profile    UserResponse `json:"profile"`
+	Addresses  []Address    `json:"addresses"`
+	Orders     []Order      `json:"orders"`
+}
+
+// ErasureStore forgets users who asked for it.
+type ErasureStore interface {
+	// EraseUser replaces the personal data of the user with placeholders and
+	// deletes what was only kept for them. Their orders stay for accounting.
+	EraseUser(userID int, now time.Time) error
 }
 
 type SignupUserPayload struct {
@@ -33,6 +107,327 @@ type LoginUserPayload struct {
 	Password string `json:"password" validate:"required"`
 }
 
+// PatchProfilePayload changes only the fields that are present.
+type PatchProfilePayload struct {
+	FirstName *string `json:"firstName" validate:"omitempty,min=1"`
+	LastName  *string `json:"lastName" validate:"omitempty,min=1"`
+	Email     *string `json:"email" validate:"omitempty,email"`
+}
+
+type ChangePasswordPayload struct {
+	CurrentPassword string `json:"currentPassword" validate:"required"`
+	NewPassword     string `json:"newPassword" validate:"required,min=6,max=20"`
+}
+
+type DeleteAccountPayload struct {
+	Password string `json:"password" validate:"required"`
+}
+
+// TokenPair is handed out at login and on every refresh. Token is the
+// short-lived access token sent as a bearer token; RefreshToken is exchanged
+// at /token/refresh for the next pair.
+type TokenPair struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+	ExpiresIn    int64  `json:"expiresIn"`
+}
+
+// TokenIssuer starts a new session for a user who has just proven who they are.
+type TokenIssuer interface {
+	IssueTokens(user *User) (*TokenPair, error)
+}
+
+// SessionRevoker ends every session of a user, e.g. once their password
+// has changed.
+type SessionRevoker interface {
+	RevokeSessions(userID int) error
+}
+
+// RefreshToken is a stored refresh token. Only the SHA-256 hash of the token
+// is kept. Every token rotated from the same login shares a FamilyID, so a
+// reused token can revoke the whole chain.
+type RefreshToken struct {
+	ID        int
+	UserID    int
+	FamilyID  string
+	TokenHash string
+	ExpiresAt time.Time
+	RotatedAt *time.Time
+	RevokedAt *time.Time
+	CreatedAt time.Time
+}
+
+type RefreshTokenStore interface {
+	CreateRefreshToken(token RefreshToken) error
+	GetRefreshTokenByHash(hash string) (*RefreshToken, error)
+	// RotateRefreshToken marks the token as used and stores next in its place.
+	// It fails if the token was already rotated or revoked.
+	RotateRefreshToken(id int, next RefreshToken) error
+	RevokeRefreshTokenFamily(familyID string) error
+	RevokeUserRefreshTokens(userID int) error
+}
+
+// TokenRevocationStore records access tokens that must be rejected before
+// they expire.
+type TokenRevocationStore interface {
+	// RevokeToken revokes the token with the given jti until it expires.
+	RevokeToken(tokenID string, userID int, expiresAt time.Time) error
+	IsTokenRevoked(tokenID string) (bool, error)
+	// RevokeUserTokens revokes every token of the user issued before the
+	// given time.
+	RevokeUserTokens(userID int, issuedBefore time.Time) error
+	// GetUserTokensRevokedBefore returns the zero time if the user never
+	// revoked all their tokens.
+	GetUserTokensRevokedBefore(userID int) (time.Time, error)
+}
+
+type LogoutPayload struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+type RefreshTokenPayload struct {
+	RefreshToken string `json:"refreshToken" validate:"required"`
+}
+
+// Email is a single message handed to a Mailer. Body is the plain text
+// version; HTML, when set, is sent alongside it as an alternative.
+type Email struct {
+	To      string
+	Subject string
+	Body    string
+	HTML    string
+}
+
+// Mailer delivers email to users.
+type Mailer interface {
+	Send(email Email) error
+}
+
+// PasswordResetToken is a single-use token mailed to a user who forgot their
+// password. Only its hash is stored.
+type PasswordResetToken struct {
+	ID        int
+	UserID    int
+	TokenHash string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+type PasswordResetStore interface {
+	// CreatePasswordResetToken stores the token and invalidates any earlier
+	// unused tokens of the same user.
+	CreatePasswordResetToken(token PasswordResetToken) error
+	// ResetPassword uses up the token if it is unused and has not expired at
+	// now, and sets the password of its user in the same transaction. It
+	// returns sql.ErrNoRows for any other token.
+	ResetPassword(tokenHash string, passwordHash string, now time.Time) (int, error)
+}
+
+type ForgotPasswordPayload struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ResetPasswordPayload struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=6,max=20"`
+}
+
+// EmailVerificationToken is a single-use token mailed to a user to confirm
+// they own their email address. Only its hash is stored.
+type EmailVerificationToken struct {
+	ID        int
+	UserID    int
+	TokenHash string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+type EmailVerificationStore interface {
+	// CreateEmailVerificationToken stores the token and invalidates any
+	// earlier unused tokens of the same user.
+	CreateEmailVerificationToken(token EmailVerificationToken) error
+	// GetLastEmailVerificationSentAt returns when the latest token of the
+	// user was created, or sql.ErrNoRows if none was.
+	GetLastEmailVerificationSentAt(userID int) (time.Time, error)
+	// VerifyEmail uses up the token if it is unused and has not expired at
+	// now, and marks the email of its user verified in the same
+	// transaction. It returns sql.ErrNoRows for any other token.
+	VerifyEmail(tokenHash string, now time.Time) (int, error)
+}
+
+// Notifier renders the emails the shop sends users and hands them to a
+// Mailer. Tokens are turned into links to the web app when one is
+// configured.
+type Notifier interface {
+	SendEmailVerification(user *User, token string, expiresIn time.Duration) error
+	SendPasswordReset(user *User, token string, expiresIn time.Duration) error
+	// SendOrderConfirmation expects the order with its items.
+	SendOrderConfirmation(user *User, order *Order) error
+}
+
+// EmailVerifier mails a user a link to verify their email address.
+type EmailVerifier interface {
+	SendVerification(user *User) error
+}
+
+// LoginThrottleStore counts failed logins per throttle key, an account or
+// a client IP, and holds the lockouts they earn.
+type LoginThrottleStore interface {
+	// RecordLoginFailure counts a failure at now and returns the failures
+	// of the key so far. Failures before resetBefore are forgotten.
+	RecordLoginFailure(key string, now time.Time, resetBefore time.Time) (int, error)
+	// LockLogin locks the key until the given time, or later if it is
+	// already locked for longer.
+	LockLogin(key string, until time.Time) error
+	// GetLoginLockedUntil returns the zero time if the key was never locked.
+	GetLoginLockedUntil(key string) (time.Time, error)
+	ClearLoginFailures(key string) error
+}
+
+// LoginLimiter decides whether a login attempt may go ahead.
+type LoginLimiter interface {
+	// LoginAllowed returns how long the caller has to wait before trying to
+	// log in to the account from the IP, or 0 if they may try now.
+	LoginAllowed(email string, ip string) (time.Duration, error)
+	LoginFailed(email string, ip string) error
+	LoginSucceeded(email string) error
+}
+
+// TOTPEnrollment is a user's authenticator app secret. It only guards
+// logins once ConfirmedAt is set. LastUsedStep is the time step of the last
+// code accepted, so a code cannot be used twice.
+type TOTPEnrollment struct {
+	UserID       int
+	Secret       string
+	ConfirmedAt  *time.Time
+	LastUsedStep int64
+}
+
+// MFAChallengeToken is handed out by a login that passed the password check
+// and must be exchanged, with a code, for tokens. Only its hash is stored.
+// Attempts counts the codes tried against it, right or wrong.
+type MFAChallengeToken struct {
+	ID        int
+	UserID    int
+	TokenHash string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	Attempts  int
+}
+
+type MFAStore interface {
+	// GetTOTPEnrollment returns sql.ErrNoRows if the user never enrolled.
+	GetTOTPEnrollment(userID int) (*TOTPEnrollment, error)
+	// SaveTOTPSecret starts or restarts an enrollment. It returns
+	// sql.ErrNoRows if the user already confirmed one.
+	SaveTOTPSecret(userID int, secret string) error
+	// ConfirmTOTP confirms the enrollment with the step of the code used and
+	// replaces the user's recovery codes. It returns sql.ErrNoRows if there
+	// is no unconfirmed enrollment.
+	ConfirmTOTP(userID int, step int64, recoveryCodeHashes []string, now time.Time) error
+	// UseTOTPStep records a code as used unless a code of the same or a
+	// later step was, and reports whether it did.
+	UseTOTPStep(userID int, step int64) (bool, error)
+	// UseRecoveryCode uses up the code and reports whether it was unused.
+	UseRecoveryCode(userID int, codeHash string, now time.Time) (bool, error)
+
+	CreateMFAChallenge(challenge MFAChallengeToken) error
+	// GetMFAChallenge returns sql.ErrNoRows for unknown tokens.
+	GetMFAChallenge(tokenHash string) (*MFAChallengeToken, error)
+	// ClaimMFAChallengeAttempt counts an attempt against an open challenge
+	// before its code is checked, so concurrent requests cannot try more
+	// than maxAttempts codes. It returns sql.ErrNoRows when the token is
+	// unknown, used, expired or out of attempts.
+	ClaimMFAChallengeAttempt(tokenHash string, maxAttempts int, now time.Time) (*MFAChallengeToken, error)
+	// UseMFAChallenge uses up the challenge and reports whether it was
+	// unused.
+	UseMFAChallenge(id int, now time.Time) (bool, error)
+}
+
+// MFAChallenge is what /login answers instead of tokens when the user has
+// to complete a second step: enter a code, or enroll first.
+type MFAChallenge struct {
+	MFARequired           bool   `json:"mfaRequired,omitempty"`
+	MFAEnrollmentRequired bool   `json:"mfaEnrollmentRequired,omitempty"`
+	MFAToken              string `json:"mfaToken"`
+	ExpiresIn             int64  `json:"expiresIn"`
+}
+
+// MFAChallenger decides whether a login needs a second step.
+type MFAChallenger interface {
+	// Challenge returns nil when the password is enough for the user.
+	Challenge(user *User) (*MFAChallenge, error)
+}
+
+type TOTPEnrollmentResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauthUri"`
+}
+
+type MFACodePayload struct {
+	Code string `json:"code" validate:"required"`
+}
+
+type MFATokenPayload struct {
+	MFAToken string `json:"mfaToken" validate:"required"`
+}
+
+type MFALoginPayload struct {
+	MFAToken string `json:"mfaToken" validate:"required"`
+	Code     string `json:"code" validate:"required"`
+}
+
+// Scope is a permission granted to an API key. A key can only call the
+// routes that accept one of its scopes, and only as far as the role of its
+// owner allows.
+type Scope string
+
+const (
+	ScopeProductsWrite Scope = "products:write"
+	ScopeOrdersRead    Scope = "orders:read"
+	ScopeOrdersWrite   Scope = "orders:write"
+)
+
+// APIKey lets scripts call the API on behalf of a user. Keys are looked up
+// by Prefix, which is part of the key, and only the hash of the whole key
+// is stored.
+type APIKey struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"-"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	KeyHash    string     `json:"-"`
+	Scopes     []Scope    `json:"scopes"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	RevokedAt  *time.Time `json:"-"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+type APIKeyStore interface {
+	CreateAPIKey(key APIKey) (int, error)
+	// GetAPIKeysByUserID returns the keys of the user that were not revoked.
+	GetAPIKeysByUserID(userID int) ([]APIKey, error)
+	GetAPIKeyByPrefix(prefix string) (*APIKey, error)
+	// RevokeAPIKey returns sql.ErrNoRows unless the user holds the key and
+	// it was not revoked yet.
+	RevokeAPIKey(userID int, id int, now time.Time) error
+	TouchAPIKey(id int, now time.Time) error
+}
+
+type CreateAPIKeyPayload struct {
+	Name   string  `json:"name" validate:"required,max=100"`
+	Scopes []Scope `json:"scopes" validate:"required,min=1,dive,oneof=products:write orders:read orders:write"`
+}
+
+// CreatedAPIKey is the response to creating a key, the only time the key
+// itself is shown.
+type CreatedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
+
 type Product struct {
 	ID          int       `json:"id"`
 	Name        string    `json:"name"`
@@ -41,13 +436,38 @@ type Product struct {
 	CreatedAt   time.Time `json:"createdAt"`
 	Image       string    `json:"image"`
 	Quantity    int       `json:"quantity"`
+	Version     int       `json:"version"`
 }
 
 type ProductStore interface {
 	GetProductByID(id int) (*Product, error)
-	GetProducts() ([]Product, error)
+	GetProducts(query ProductQuery) ([]Product, error)
+	SearchProducts(query string, limit int, offset int) ([]ProductSearchResult, error)
 	CreateProduct(Product) (int, error)
+	// UpdateProduct overwrites the editable fields of p when its stored
+	// version still equals expectedVersion; zero skips the check.
+	UpdateProduct(p Product, expectedVersion int) (*Product, error)
+	// DeleteProduct soft deletes the product under the same version check.
+	DeleteProduct(id int, expectedVersion int) error
 	UpdateProductQuantityWithTransaction(Product) error
+	RestoreProductQuantityWithTransaction(Product) error
+}
+
+type UpdateProductPayload struct {
+	Name        string  `json:"name" validate:"required"`
+	Description string  `json:"description" validate:"required"`
+	Price       float64 `json:"price" validate:"required,gt=0"`
+	Image       string  `json:"image" validate:"required"`
+	Quantity    int     `json:"quantity" validate:"gte=0"`
+}
+
+// PatchProductPayload changes only the fields that are present.
+type PatchProductPayload struct {
+	Name        *string  `json:"name" validate:"omitempty,min=1"`
+	Description *string  `json:"description" validate:"omitempty,min=1"`
+	Price       *float64 `json:"price" validate:"omitempty,gt=0"`
+	Image       *string  `json:"image" validate:"omitempty,min=1"`
+	Quantity    *int     `json:"quantity" validate:"omitempty,gte=0"`
 }
 
 type CreateProductPayload struct {
@@ -64,27 +484,164 @@ type CreateProductResponse struct {
 }
 
 // cart
+type OrderStatus string
+
+const (
+	OrderStatusPending   OrderStatus = "pending"
+	OrderStatusPaid      OrderStatus = "paid"
+	OrderStatusFulfilled OrderStatus = "fulfilled"
+	OrderStatusShipped   OrderStatus = "shipped"
+	OrderStatusDelivered OrderStatus = "delivered"
+	OrderStatusCancelled OrderStatus = "cancelled"
+	OrderStatusRefunded  OrderStatus = "refunded"
+)
+
 type Order struct {
-	ID        int       `json:"id"`
-	UserID    int       `json:"userId"`
-	Total     float64   `json:"total"`
-	Status    string    `json:"status"`
-	Address   string    `json:"address"`
-	CreatedAt time.Time `json:"createdAt"`
+	ID        int         `json:"id"`
+	UserID    int         `json:"userId"`
+	Total     float64     `json:"total"`
+	Status    OrderStatus `json:"status"`
+	Address   string      `json:"address"`
+	CreatedAt time.Time   `json:"createdAt"`
+	Items     []OrderItem `json:"items,omitempty"`
 }
 
+// OrderItem is a purchased line. Price is the unit price and, together with
+// the product name and image, is captured at checkout so later catalog
+// changes don't rewrite order history.
 type OrderItem struct {
-	ID        int       `json:"id"`
-	OrderID   int       `json:"orderId"`
-	ProductID int       `json:"productId"`
-	Quantity  int       `json:"quantity"`
-	Price     float64   `json:"price"`
-	CreatedAt time.Time `json:"createdAt"`
+	ID           int       `json:"id"`
+	OrderID      int       `json:"orderId"`
+	ProductID    int       `json:"productId"`
+	Quantity     int       `json:"quantity"`
+	Price        float64   `json:"price"`
+	Subtotal     float64   `json:"subtotal"`
+	CreatedAt    time.Time `json:"createdAt"`
+	ProductName  string    `json:"productName,omitempty"`
+	ProductImage string    `json:"productImage,omitempty"`
 }
 
 type OrderStore interface {
 	CreateOrder(Order) (int, error)
 	CreateOrderItem(OrderItem) error
+	GetOrdersByUserID(userID int, limit int, offset int) ([]Order, error)
+	GetOrderByID(id int) (*Order, error)
+	GetOrderItems(orderID int) ([]OrderItem, error)
+	GetOrderForUpdate(id int) (*Order, error)
+	UpdateOrderStatus(id int, status OrderStatus) error
+	CreateStatusHistory(StatusHistory) error
+}
+
+// StatusHistory records a single move of an order through its lifecycle.
+type StatusHistory struct {
+	ID         int         `json:"id"`
+	OrderID    int         `json:"orderId"`
+	FromStatus OrderStatus `json:"fromStatus"`
+	ToStatus   OrderStatus `json:"toStatus"`
+	ActorID    int         `json:"actorId"`
+	CreatedAt  time.Time   `json:"createdAt"`
+}
+
+type OrderTransitionPayload struct {
+	Status OrderStatus `json:"status" validate:"required,oneof=pending paid fulfilled shipped delivered cancelled refunded"`
+}
+
+// Product sort fields accepted by ProductQuery.
+const (
+	ProductSortID        = "id"
+	ProductSortPrice     = "price"
+	ProductSortCreatedAt = "createdAt"
+	ProductSortName      = "name"
+)
+
+// ProductQuery selects a page of the catalog. When Cursor is set the page
+// starts after the product it points at and Offset is ignored.
+type ProductQuery struct {
+	Limit      int
+	Offset     int
+	Cursor     *ProductCursor
+	Sort       string
+	Descending bool
+	MinPrice   *float64
+	MaxPrice   *float64
+	InStock    bool
+	NamePrefix string
+}
+
+// ProductCursor records the sort key of the last product on a page.
+type ProductCursor struct {
+	ID        int       `json:"id"`
+	Price     float64   `json:"price"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type ProductListResponse struct {
+	Products   []Product `json:"products"`
+	Limit      int       `json:"limit"`
+	Offset     int       `json:"offset,omitempty"`
+	NextCursor string    `json:"nextCursor,omitempty"`
+	Next       string    `json:"next,omitempty"`
+}
+
+// ProductSearchResult is a product matched by full-text search. Snippet is an
+// HTML-escaped excerpt of the description with matched terms wrapped in
+// <mark> tags; it is safe to render as HTML.
+type ProductSearchResult struct {
+	Product
+	Rank    float64 `json:"rank"`
+	Snippet string  `json:"snippet"`
+}
+
+type ProductSearchResponse struct {
+	Query   string                `json:"query"`
+	Results []ProductSearchResult `json:"results"`
+	Limit   int                   `json:"limit"`
+	Offset  int                   `json:"offset"`
+}
+
+type OrderListResponse struct {
+	Orders []Order `json:"orders"`
+	Limit  int     `json:"limit"`
+	Offset int     `json:"offset"`
+}
+
+// Transaction exposes stores whose writes share one database transaction.
+type Transaction interface {
+	Products() ProductStore
+	Orders() OrderStore
+	Carts() CartStore
+}
+
+// Transactor runs a unit of work that must commit or roll back as a whole.
+type Transactor interface {
+	WithinTransaction(fn func(tx Transaction) error) error
+}
+
+// IdempotencyRecord is the stored outcome of a request sent with an
+// Idempotency-Key header. StatusCode stays zero while the original request
+// is still being handled. Keys belong to the user who sent them.
+type IdempotencyRecord struct {
+	Key          string
+	UserID       int
+	Fingerprint  string
+	StatusCode   int
+	ContentType  string
+	ResponseBody []byte
+	CreatedAt    time.Time
+}
+
+type IdempotencyStore interface {
+	// ReserveIdempotencyKey claims the key for a new request, taking over a
+	// record created before expiredBefore. It reports false when the key is
+	// already held.
+	ReserveIdempotencyKey(record IdempotencyRecord, expiredBefore time.Time) (bool, error)
+	GetIdempotencyRecord(key string, userID int) (*IdempotencyRecord, error)
+	SaveIdempotencyResponse(record IdempotencyRecord) error
+	DeleteIdempotencyRecord(key string, userID int) error
+	// DeleteExpiredIdempotencyRecords removes the records created before
+	// expiredBefore and returns how many there were.
+	DeleteExpiredIdempotencyRecords(expiredBefore time.Time) (int64, error)
 }
 
 type CartItem struct {
@@ -92,8 +649,72 @@ type CartItem struct {
 	Quantity  int `json:"quantity"`
 }
 
+// Cart is the server-side shopping cart of a single user.
+type Cart struct {
+	UserID int        `json:"userId"`
+	Items  []CartItem `json:"items"`
+}
+
+type CartStore interface {
+	GetCartByUserID(userID int) (*Cart, error)
+	AddCartItem(userID int, item CartItem) error
+	UpdateCartItem(userID int, item CartItem) error
+	RemoveCartItem(userID int, productID int) error
+	ClearCart(userID int) error
+}
+
+type AddCartItemPayload struct {
+	ProductID int `json:"productId" validate:"required"`
+	Quantity  int `json:"quantity" validate:"required,min=1"`
+}
+
+type UpdateCartItemPayload struct {
+	Quantity int `json:"quantity" validate:"required,min=1"`
+}
+
+// CartCheckoutPayload lists the items to buy. Checkout falls back to the
+// user's stored cart when the request has no body or no items. The order
+// ships to the saved address AddressID, the inline Address, or else the
+// user's default address.
 type CartCheckoutPayload struct {
-	Items []CartItem `json:"items" validate:"required"`
+	Items     []CartItem      `json:"items,omitempty"`
+	AddressID int             `json:"addressId,omitempty"`
+	Address   *AddressPayload `json:"address,omitempty"`
+}
+
+type Address struct {
+	ID         int       `json:"id"`
+	UserID     int       `json:"userId"`
+	Line1      string    `json:"line1"`
+	Line2      string    `json:"line2"`
+	City       string    `json:"city"`
+	Region     string    `json:"region"`
+	PostalCode string    `json:"postalCode"`
+	Country    string    `json:"country"`
+	IsDefault  bool      `json:"isDefault"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// AddressStore manages a user's address book. Every lookup is scoped to the
+// owning user and reports other users' addresses as sql.ErrNoRows.
+type AddressStore interface {
+	GetAddressesByUserID(userID int) ([]Address, error)
+	GetAddressByID(userID int, id int) (*Address, error)
+	GetDefaultAddress(userID int) (*Address, error)
+	CreateAddress(Address) (int, error)
+	UpdateAddress(Address) error
+	DeleteAddress(userID int, id int) error
+	SetDefaultAddress(userID int, id int) error
+}
+
+type AddressPayload struct {
+	Line1      string `json:"line1" validate:"required,max=255"`
+	Line2      string `json:"line2" validate:"max=255"`
+	City       string `json:"city" validate:"required,max=100"`
+	Region     string `json:"region" validate:"max=100"`
+	PostalCode string `json:"postalCode" validate:"required,max=20"`
+	Country    string `json:"country" validate:"required,len=2,alpha"`
+	IsDefault  bool   `json:"isDefault"`
 }
 
 type CreateOrderResponse struct {
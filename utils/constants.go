@@ -9,8 +9,42 @@ const (
 	ErrCreatingUser        = "error creating user"
 	ErrInternalServerError = "internal server error"
 	ErrUnauthorized        = "unauthorized"
+	ErrForbidden           = "forbidden"
 	ErrCreatingProduct     = "error creating product"
+	ErrProductNotFound     = "product not found"
+	ErrCartItemNotFound    = "cart item not found"
+	ErrOrderNotFound       = "order not found"
+	ErrAddressNotFound     = "address not found"
+	ErrAddressRequired     = "shipping address is required"
+	ErrInvalidIdempotency  = "idempotency key must be between 1 and 255 characters"
+	ErrIdempotencyMismatch = "idempotency key was already used with a different request"
+	ErrIdempotencyInFlight = "a request with this idempotency key is still being processed"
+	ErrSearchQueryRequired = "search query is required"
+	ErrIfMatchRequired     = "If-Match header is required"
+	ErrProductModified     = "product was modified by another request"
+	ErrInvalidRefreshToken = "invalid refresh token"
+	ErrInvalidResetToken   = "invalid or expired password reset token"
+	ErrInvalidVerifyToken  = "invalid or expired email verification token"
+	ErrEmailVerified       = "email is already verified"
+	ErrVerifyThrottled     = "a verification email was sent recently, please try again later"
+	ErrEmailNotVerified    = "email must be verified before checking out"
+	ErrInvalidCredentials  = "invalid email or password"
+	ErrTooManyLogins       = "too many failed login attempts, please try again later"
+	ErrInvalidMFAToken     = "invalid or expired mfa token"
+	ErrInvalidMFACode      = "invalid two-factor code"
+	ErrMFAEnabled          = "two-factor authentication is already enabled"
+	ErrMFANotStarted       = "start two-factor enrollment first"
+	ErrIncorrectPassword   = "current password is incorrect"
+	ErrInvalidExportFormat = "format must be json or zip"
+	ErrAccountDisabled     = "account has been disabled"
+	ErrCannotChangeSelf    = "admins cannot disable or change the role of their own account"
+	ErrInsufficientScope   = "this API key is not allowed to call this endpoint"
+	ErrAPIKeyNotFound      = "api key not found"
 
 	// success messages
-	UserCreatedSuccessfully = "user created successfully"
+	UserCreatedSuccessfully   = "user created successfully"
+	PasswordResetRequested    = "if an account exists for this email, a password reset link has been sent"
+	PasswordResetSuccessfully = "password has been reset"
+	VerificationEmailSent     = "a verification email has been sent"
+	EmailVerifiedSuccessfully = "email has been verified"
 )
@@ -2,7 +2,11 @@ package utils
 
 import (
 	"encoding/json"
+	"fmt"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"gopkg.in/go-playground/validator.v9"
 )
@@ -19,6 +23,14 @@ func WriteJSON(w http.ResponseWriter, statusCode int, data any) {
 	json.NewEncoder(w).Encode(data)
 }
 
+// WriteSecretJSON writes a response that carries credentials, such as
+// tokens or recovery codes. It is marked no-store so neither caches nor the
+// idempotency middleware keep a copy.
+func WriteSecretJSON(w http.ResponseWriter, statusCode int, data any) {
+	w.Header().Set("Cache-Control", "no-store")
+	WriteJSON(w, statusCode, data)
+}
+
 func ReadJSON(r *http.Request, v any) error {
 	return json.NewDecoder(r.Body).Decode(v)
 }
@@ -26,3 +38,84 @@ func ReadJSON(r *http.Request, v any) error {
 func WriteError(w http.ResponseWriter, statusCode int, message string) {
 	WriteJSON(w, statusCode, map[string]string{"error": message})
 }
+
+// ClientIP is the address the request came from. X-Forwarded-For is only
+// read when the request arrives from one of trustedProxies (IPs or CIDRs);
+// its entries are walked from the right and the first one not added by a
+// trusted proxy is the client. Entries left of it could have been set by
+// the client itself, so they are never used.
+func ClientIP(r *http.Request, trustedProxies []string) string {
+	client, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		client = r.RemoteAddr
+	}
+	if !isTrustedProxy(client, trustedProxies) {
+		return client
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			// a malformed entry was not written by a trusted proxy; keep the
+			// last address we can vouch for
+			return client
+		}
+		client = hop
+		if !isTrustedProxy(hop, trustedProxies) {
+			return client
+		}
+	}
+	return client
+}
+
+func isTrustedProxy(address string, trustedProxies []string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	for _, proxy := range trustedProxies {
+		if _, network, err := net.ParseCIDR(proxy); err == nil {
+			if network.Contains(ip) {
+				return true
+			}
+		} else if proxyIP := net.ParseIP(proxy); proxyIP != nil && proxyIP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+)
+
+// ParsePagination reads the limit and offset query parameters, falling back
+// to DefaultPageLimit and 0 and capping the limit at MaxPageLimit.
+func ParsePagination(r *http.Request) (limit int, offset int, err error) {
+	limit, offset = DefaultPageLimit, 0
+	query := r.URL.Query()
+
+	if v := query.Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			return 0, 0, fmt.Errorf("invalid limit: %s", v)
+		}
+		if limit > MaxPageLimit {
+			limit = MaxPageLimit
+		}
+	}
+
+	if v := query.Get("offset"); v != "" {
+		offset, err = strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("invalid offset: %s", v)
+		}
+	}
+
+	return limit, offset, nil
+}